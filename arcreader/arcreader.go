@@ -2,6 +2,7 @@ package arcreader
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"iter"
 
@@ -65,7 +66,9 @@ func (wf *ArcFileReader) Records() iter.Seq2[gowarc.Record, error] {
 			if !yield(rec, err) {
 				return
 			}
-			if err != nil {
+			// the reader has moved past a corrupt record, so it can continue with the next one
+			var corrupt *CorruptRecordError
+			if err != nil && !errors.As(err, &corrupt) {
 				return
 			}
 		}
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +15,30 @@ import (
 	"github.com/nlnwa/gowarc/v3"
 )
 
+// WARC header fields holding the fields of ARC version 2 records that have no counterpart in
+// WARC.
+const (
+	ArcResultCode = "ARC-Result-Code"
+	ArcChecksum   = "ARC-Checksum"
+	ArcLocation   = "ARC-Location"
+	ArcOffset     = "ARC-Offset"
+	ArcFilename   = "ARC-Filename"
+)
+
+// CorruptRecordError is returned for a record that can't be read to its end, like a record in a
+// corrupt or truncated gzip member. Reading continues with the next record found after it.
+type CorruptRecordError struct {
+	Err error
+}
+
+func (e *CorruptRecordError) Error() string {
+	return fmt.Sprintf("corrupt ARC record: %v", e.Err)
+}
+
+func (e *CorruptRecordError) Unwrap() error {
+	return e.Err
+}
+
 type unmarshaler struct {
 	opts       []gowarc.WarcRecordOption
 	LastOffset int64
@@ -30,6 +53,28 @@ func NewUnmarshaler(opts ...gowarc.WarcRecordOption) gowarc.Unmarshaler {
 	return u
 }
 
+// urlRecord holds the fields of the header line of an ARC record.
+type urlRecord struct {
+	version     int
+	recordType  gowarc.RecordType
+	url         string
+	ip          string
+	date        time.Time
+	contentType string
+	length      int64
+
+	// only in version 2
+	resultCode string
+	checksum   string
+	location   string
+	offset     string
+	filename   string
+}
+
+// Unmarshal parses the next ARC record. Data that doesn't belong to a record, like the
+// remains of a corrupt record, is skipped and reported as a validation error of the next
+// record. A record that can't be read to its end is returned as a CorruptRecordError, after
+// which the next record can be read.
 func (u *unmarshaler) Unmarshal(b *bufio.Reader) (gowarc.WarcRecord, int64, []error, error) {
 	isGzip, r, offset, err := u.searchNextRecord(b)
 	if err == io.EOF {
@@ -39,246 +84,367 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (gowarc.WarcRecord, int64, []er
 		return nil, offset, nil, fmt.Errorf("could not parse ARC record: %w", err)
 	}
 
-	defer func() {
-		// Discarding 1 byte which makes up the end of record marker (\n)
-		var lf byte = '\n'
-		bb, e := r.Peek(4)
-		if len(bb) == 0 {
-			err = fmt.Errorf("wrong peek: %d, %w", len(bb), e)
-		} else {
-			if len(bb) != 1 || bb[0] != lf || (e != nil && e != io.EOF) {
-				err = fmt.Errorf("wrong peek: %d, %q, %w", len(bb), bb[0], e)
-			}
-			_, _ = r.Discard(1)
-		}
-
-		if isGzip {
-			// Empty gzip reader to ensure gzip checksum is validated
-			b := make([]byte, 10)
-			var err error
-			for err == nil {
-				_, err = u.gz.Read(b)
-				if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-					return
-				}
-			}
-			_ = u.gz.Close()
-		}
-	}()
-
 	l, err := r.ReadString('\n')
 	if err != nil {
-		return nil, 0, nil, fmt.Errorf("could not parse ARC record: %w", err)
+		return nil, offset, nil, fmt.Errorf("could not parse ARC record: %w", err)
 	}
 
 	var validation []error
+	if offset > 0 {
+		validation = append(validation, fmt.Errorf("skipped %d bytes of data not belonging to a record", offset))
+	}
+
 	var wr gowarc.WarcRecord
+	var recordValidation []error
 	if strings.HasPrefix(l, "filedesc://") {
-		wr, validation, err = u.parseFileHeader(r, l)
+		wr, recordValidation, err = u.parseFileHeader(r, l)
 	} else {
-		wr, validation, err = u.parseRecord(r, l)
+		wr, recordValidation, err = u.parseRecord(r, l)
+	}
+	validation = append(validation, recordValidation...)
+	if err != nil {
+		return wr, offset, validation, err
 	}
 
-	return wr, offset, validation, err
+	if err := u.endRecord(r, isGzip); err != nil {
+		validation = append(validation, err)
+	}
+	return wr, offset, validation, nil
 }
 
-func (u *unmarshaler) searchNextRecord(b *bufio.Reader) (bool, *bufio.Reader, int64, error) {
-	var offset int64
-	isGzip := false
-	var r *bufio.Reader
+// endRecord consumes the newline ending a record. For compressed records the rest of the
+// gzip member is read to validate the checksum.
+func (u *unmarshaler) endRecord(r *bufio.Reader, isGzip bool) error {
 	var err error
+	bb, peekErr := r.Peek(1)
+	if len(bb) == 1 && bb[0] == '\n' {
+		_, _ = r.Discard(1)
+	} else if peekErr != io.EOF {
+		err = errors.New("missing end of record marker")
+	}
+
+	if isGzip {
+		if _, drainErr := io.Copy(io.Discard, r); drainErr != nil && err == nil {
+			err = fmt.Errorf("failed to read end of gzip member: %w", drainErr)
+		}
+		_ = u.gz.Close()
+	}
+	return err
+}
 
-	// Search for start of new record
-	expectedRecordStartOffset := offset
-	found := false
+// searchNextRecord finds the start of the next record, which is either a gzip member starting
+// with a header line, or a header line. It returns the reader to read the record from and the
+// number of bytes skipped before the record.
+func (u *unmarshaler) searchNextRecord(b *bufio.Reader) (bool, *bufio.Reader, int64, error) {
+	var offset int64
+	// whether anything but whitespace has been skipped
+	var skippedData bool
 
-	for !found {
-		var magic []byte
-		magic, err = b.Peek(4)
+	for {
+		magic, err := b.Peek(4)
 		if err != nil {
+			if err == io.EOF {
+				// trailing data too short to be a record
+				skippedData = skippedData || len(bytes.TrimSpace(magic)) > 0
+				offset += int64(len(magic))
+				_, _ = b.Discard(len(magic))
+				if skippedData {
+					return false, nil, offset, fmt.Errorf("no record found in the last %d bytes", offset)
+				}
+			}
 			return false, nil, offset, err
 		}
 
 		switch {
 		case magic[0] == 0x1f && magic[1] == 0x8b:
+			counter := &byteCounter{r: b}
 			if u.gz == nil {
-				u.gz, err = gzip.NewReader(b)
+				u.gz, err = gzip.NewReader(counter)
 			} else {
-				err = u.gz.Reset(b)
+				err = u.gz.Reset(counter)
 			}
 			if err != nil {
-				if _, err = b.Discard(1); err != nil {
-					return false, nil, offset, err
+				if counter.n == 0 {
+					if _, err = b.Discard(1); err != nil {
+						return false, nil, offset, err
+					}
+					counter.n = 1
 				}
-				offset++
+				offset += counter.n
+				skippedData = true
 				continue
 			}
 			u.gz.Multistream(false)
-			r = bufio.NewReader(u.gz)
-			isGzip = true
-			found = true
-
-		case bytes.HasPrefix(magic, []byte("http")):
-			fallthrough
-		case bytes.HasPrefix(magic, []byte("file")):
-			fallthrough
-		case bytes.HasPrefix(magic, []byte("dns")):
-			fallthrough
-		case bytes.HasPrefix(magic, []byte("ftp")):
-			r = b
-			found = true
+			r := bufio.NewReader(u.gz)
+			if u.isHeaderLine(r) {
+				return true, r, offset, nil
+			}
+			// not an ARC record, skip the whole member
+			_, _ = io.Copy(io.Discard, r)
+			offset += counter.n
+			skippedData = true
+
+		case bytes.HasPrefix(magic, []byte("http")),
+			bytes.HasPrefix(magic, []byte("file")),
+			bytes.HasPrefix(magic, []byte("dns")),
+			bytes.HasPrefix(magic, []byte("ftp")):
+			if u.isHeaderLine(b) {
+				return false, b, offset, nil
+			}
+			if _, err = b.Discard(1); err != nil {
+				return false, nil, offset, err
+			}
+			offset++
+			skippedData = true
 
 		default:
 			if _, err = b.Discard(1); err != nil {
 				return false, nil, offset, err
 			}
 			offset++
+			skippedData = skippedData || !isSpace(magic[0])
 		}
 	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
 
-	if expectedRecordStartOffset != offset {
-		err = fmt.Errorf("expected start of record at offset: %d, but record was found at offset: %d",
-			expectedRecordStartOffset, offset)
+// isHeaderLine reports whether the next line of r is a valid header line. A line longer than
+// the buffer of r can't be checked and is assumed to be one.
+func (u *unmarshaler) isHeaderLine(r *bufio.Reader) bool {
+	buf, _ := r.Peek(r.Size())
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return len(buf) == r.Size()
 	}
+	_, err := u.parseUrlRecord(string(buf[:i+1]))
+	return err == nil
+}
 
-	return isGzip, r, offset, err
+// byteCounter counts the bytes read from a bufio.Reader. It implements io.ByteReader so the
+// gzip reader doesn't read past the end of a member.
+type byteCounter struct {
+	r *bufio.Reader
+	n int64
 }
 
-func (u *unmarshaler) parseFileHeader(r *bufio.Reader, l1 string) (gowarc.WarcRecord, []error, error) {
-	var read int
-	l2, err := r.ReadString('\n')
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not parse ARC file header")
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *byteCounter) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
 	}
-	read += len(l2)
+	return b, err
+}
 
-	verStr, _, ok := strings.Cut(l2, " ")
-	if !ok {
-		return nil, nil, fmt.Errorf("could not parse version from ARC file header: missing space")
+// errorReader remembers the error of the reader it wraps, which tells a failure to read a record
+// from a failure to build it.
+type errorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errorReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		e.err = err
 	}
-	v, err := strconv.Atoi(verStr)
+	return n, err
+}
+
+func (u *unmarshaler) parseFileHeader(r *bufio.Reader, l1 string) (gowarc.WarcRecord, []error, error) {
+	h, err := u.parseUrlRecord(l1)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not parse version from ARC file header: %w", err)
+		return nil, nil, fmt.Errorf("could not parse ARC file header: %w", err)
+	}
+	if h.recordType != gowarc.Warcinfo {
+		return nil, nil, fmt.Errorf("could not parse ARC file header: not a filedesc record: %s", h.url)
 	}
-	u.version = v
 
-	var recordType gowarc.RecordType
-	var url, contentType string
-	var date time.Time
-	var length int64
+	block, err := io.ReadAll(NewLimitedCountingReader(r, h.length))
+	if err != nil {
+		return nil, nil, &CorruptRecordError{Err: fmt.Errorf("could not read ARC file header: %w", err)}
+	}
 
-	switch u.version {
-	case 1:
-		recordType, url, _, date, contentType, length, err = u.parseUrlRecordV1(l1)
-		if err != nil || recordType != gowarc.Warcinfo {
-			return nil, nil, err
-		}
-	default:
-		return nil, nil, fmt.Errorf("unknown ARC record version: %d", v)
+	var validation []error
+	if int64(len(block)) < h.length {
+		validation = append(validation, fmt.Errorf("ARC file header is %d bytes shorter than its length %d", h.length-int64(len(block)), h.length))
 	}
 
-	l3, err := r.ReadString('\n')
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not parse ARC record: %w", err)
+	// The version block tells the version of the file, but since it is sometimes malformed,
+	// the layout of the header line is trusted instead.
+	versionLine, _, _ := bytes.Cut(block, []byte("\n"))
+	if v, err := parseVersion(string(versionLine)); err != nil {
+		validation = append(validation, fmt.Errorf("malformed ARC version block %q: %w", versionLine, err))
+	} else if v != h.version {
+		validation = append(validation, fmt.Errorf("ARC version block has version %d, but the file header is version %d", v, h.version))
 	}
-	read += len(l3)
-	remaining := length - int64(read)
+	u.version = h.version
 
 	rb := gowarc.NewRecordBuilder(gowarc.Metadata, u.opts...)
-	rb.AddWarcHeader(gowarc.WarcTargetURI, url)
-	rb.AddWarcHeader(gowarc.ContentType, contentType)
-	rb.AddWarcHeaderTime(gowarc.WarcDate, date)
+	rb.AddWarcHeader(gowarc.WarcTargetURI, h.url)
+	rb.AddWarcHeader(gowarc.ContentType, h.contentType)
+	rb.AddWarcHeaderTime(gowarc.WarcDate, h.date)
 
-	if _, err = rb.WriteString(l1 + l2 + l3); err != nil {
+	if _, err = rb.WriteString(l1); err != nil {
 		_ = rb.Close()
 		return nil, nil, err
 	}
-
-	c2 := NewLimitedCountingReader(r, remaining)
-	_, err = rb.ReadFrom(c2)
-	if err != nil {
-		if err == io.ErrUnexpectedEOF {
-			err = io.EOF
-		}
+	if _, err = rb.Write(block); err != nil {
 		_ = rb.Close()
 		return nil, nil, err
 	}
 
-	wr, validation, err := rb.Build()
+	wr, recordValidation, err := rb.Build()
+	return wr, append(validation, recordValidation...), err
+}
 
-	return wr, validation, err
+// parseVersion parses the version number from the first line of the filedesc block.
+func parseVersion(l string) (int, error) {
+	verStr, _, ok := strings.Cut(strings.TrimSpace(l), " ")
+	if !ok {
+		return 0, errors.New("missing space")
+	}
+	v, err := strconv.Atoi(verStr)
+	if err != nil {
+		return 0, err
+	}
+	if v != 1 && v != 2 {
+		return 0, fmt.Errorf("unknown ARC version: %d", v)
+	}
+	return v, nil
 }
 
 func (u *unmarshaler) parseRecord(r *bufio.Reader, l1 string) (gowarc.WarcRecord, []error, error) {
-	var recordType gowarc.RecordType
-	var url, ip, contentType string
-	var date time.Time
-	var length int64
-	var err error
+	h, err := u.parseUrlRecord(l1)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	switch u.version {
-	case 1:
-		recordType, url, ip, date, contentType, length, err = u.parseUrlRecordV1(l1)
-		if err != nil {
-			return nil, nil, err
-		}
-	default:
-		return nil, nil, fmt.Errorf("unknown ARC record version: %d", u.version)
+	var validation []error
+	if u.version != 0 && h.version != u.version {
+		validation = append(validation, fmt.Errorf("version %d record in version %d file", h.version, u.version))
 	}
 
 	rb := gowarc.NewRecordBuilder(0, u.opts...)
-	rb.SetRecordType(recordType)
-	rb.AddWarcHeader(gowarc.WarcTargetURI, url)
-	rb.AddWarcHeader(gowarc.ContentType, contentType)
-	rb.AddWarcHeaderTime(gowarc.WarcDate, date)
-	rb.AddWarcHeaderInt64(gowarc.ContentLength, length)
-	rb.AddWarcHeader(gowarc.WarcIPAddress, ip)
-
-	c2 := NewLimitedCountingReader(r, length)
-	_, err = rb.ReadFrom(c2)
-	if err != nil {
-		if err == io.ErrUnexpectedEOF {
-			err = io.EOF
+	rb.SetRecordType(h.recordType)
+	rb.AddWarcHeader(gowarc.WarcTargetURI, h.url)
+	rb.AddWarcHeader(gowarc.ContentType, h.contentType)
+	rb.AddWarcHeaderTime(gowarc.WarcDate, h.date)
+	rb.AddWarcHeaderInt64(gowarc.ContentLength, h.length)
+	rb.AddWarcHeader(gowarc.WarcIPAddress, h.ip)
+	for _, field := range []struct{ name, value string }{
+		{ArcResultCode, h.resultCode},
+		{ArcChecksum, h.checksum},
+		{ArcLocation, h.location},
+		{ArcOffset, h.offset},
+		{ArcFilename, h.filename},
+	} {
+		// '-' is used for fields without a value
+		if field.value != "" && field.value != "-" {
+			rb.AddWarcHeader(field.name, field.value)
 		}
+	}
+
+	body := &errorReader{r: NewLimitedCountingReader(r, h.length)}
+	_, err = rb.ReadFrom(body)
+	if err != nil {
 		_ = rb.Close()
+		if body.err != nil {
+			return nil, nil, &CorruptRecordError{Err: body.err}
+		}
 		return nil, nil, err
 	}
 
-	return rb.Build()
+	wr, recordValidation, err := rb.Build()
+	return wr, append(validation, recordValidation...), err
 }
 
-func (u *unmarshaler) parseUrlRecordV1(l string) (gowarc.RecordType, string, string, time.Time, string, int64, error) {
-	reg := regexp.MustCompile(`([^ ]*) ([^ ]*) (\d*) ([^ ]*) (\d*)`)
-	subs := reg.FindStringSubmatch(l)
-	if len(subs) < 4 {
-		return 0, "", "", time.Time{}, "", 0, fmt.Errorf("could not parse ARC record from: %s", l)
+// parseUrlRecord parses the header line of a record. Version 1 header lines have the fields
+//
+//	URL IP-address Archive-date Content-type Archive-length
+//
+// and version 2 header lines have the fields
+//
+//	URL IP-address Archive-date Content-type Result-code Checksum Location Offset Filename Archive-length
+//
+// The version is found from the position of the date, preferring the version of the file. URLs
+// containing spaces are accepted with the spaces escaped.
+func (u *unmarshaler) parseUrlRecord(l string) (*urlRecord, error) {
+	fields := strings.Split(strings.TrimRight(l, "\r\n"), " ")
+
+	versions := []int{1, 2}
+	if u.version == 2 {
+		versions = []int{2, 1}
 	}
-	url := subs[1]
-	ip := subs[2]
-	d := subs[3]
-	date, err := mytime.From14ToTime(d)
-	if err != nil {
-		return 0, "", "", time.Time{}, "", 0, err
+	for _, version := range versions {
+		h, ok := parseFields(fields, version)
+		if ok {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("could not parse ARC record from: %s", l)
+}
+
+// parseFields parses the fields of a header line as the given version.
+func parseFields(fields []string, version int) (*urlRecord, bool) {
+	// number of fields following the URL
+	n := 4
+	if version == 2 {
+		n = 9
+	}
+	if len(fields) < n+1 {
+		return nil, false
 	}
-	contentType := subs[4]
-	length, err := strconv.ParseInt(subs[5], 10, 64)
+	urlEnd := len(fields) - n
+	rest := fields[urlEnd:]
+
+	date, err := mytime.From14ToTime(rest[1])
 	if err != nil {
-		return 0, "", "", time.Time{}, "", 0, fmt.Errorf("could not parse ARC record: %w", err)
+		return nil, false
+	}
+	length, err := strconv.ParseInt(rest[n-1], 10, 64)
+	if err != nil || length < 0 {
+		return nil, false
 	}
 
-	recordType := gowarc.Response
+	h := &urlRecord{
+		version:     version,
+		url:         strings.Join(fields[:urlEnd], "%20"),
+		ip:          rest[0],
+		date:        date,
+		contentType: rest[2],
+		length:      length,
+	}
+	if version == 2 {
+		h.resultCode = rest[3]
+		h.checksum = rest[4]
+		h.location = rest[5]
+		h.offset = rest[6]
+		h.filename = rest[7]
+	}
+	if h.url == "" {
+		return nil, false
+	}
 
+	h.recordType = gowarc.Response
 	switch {
-	case strings.HasPrefix(url, "http"):
-		contentType = "application/http;msgtype=response"
-	case strings.HasPrefix(url, "dns:"):
-		contentType = "text/dns"
-		recordType = gowarc.Resource
-	case strings.HasPrefix(url, "filedesc://"):
-		recordType = gowarc.Warcinfo
+	case strings.HasPrefix(h.url, "http"):
+		h.contentType = "application/http;msgtype=response"
+	case strings.HasPrefix(h.url, "dns:"):
+		h.contentType = "text/dns"
+		h.recordType = gowarc.Resource
+	case strings.HasPrefix(h.url, "filedesc://"):
+		h.recordType = gowarc.Warcinfo
 	default:
-		recordType = gowarc.Resource
+		h.recordType = gowarc.Resource
 	}
-
-	return recordType, url, ip, date, contentType, length, nil
+	return h, true
 }
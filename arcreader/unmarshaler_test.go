@@ -0,0 +1,184 @@
+package arcreader
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUrlRecord(t *testing.T) {
+	date := time.Date(2006, 9, 28, 22, 39, 31, 0, time.UTC)
+	tests := []struct {
+		name    string
+		version int
+		line    string
+		want    *urlRecord
+		wantErr bool
+	}{
+		{
+			name: "version 1",
+			line: "http://example.com/ 127.0.0.1 20060928223931 text/html 123\n",
+			want: &urlRecord{version: 1, recordType: gowarc.Response, url: "http://example.com/", ip: "127.0.0.1", date: date,
+				contentType: "application/http;msgtype=response", length: 123},
+		},
+		{
+			name: "version 2",
+			line: "http://example.com/ 127.0.0.1 20060928223931 text/html 200 3c5a2b6f - 1234 IA-001.arc 123\n",
+			want: &urlRecord{version: 2, recordType: gowarc.Response, url: "http://example.com/", ip: "127.0.0.1", date: date,
+				contentType: "application/http;msgtype=response", length: 123,
+				resultCode: "200", checksum: "3c5a2b6f", location: "-", offset: "1234", filename: "IA-001.arc"},
+		},
+		{
+			name: "version 2 filedesc",
+			line: "filedesc://IA-001.arc 0.0.0.0 20060928223931 text/plain 200 - - 0 IA-001.arc 77\n",
+			want: &urlRecord{version: 2, recordType: gowarc.Warcinfo, url: "filedesc://IA-001.arc", ip: "0.0.0.0", date: date,
+				contentType: "text/plain", length: 77,
+				resultCode: "200", checksum: "-", location: "-", offset: "0", filename: "IA-001.arc"},
+		},
+		{
+			name: "space in url",
+			line: "http://example.com/a b 127.0.0.1 20060928223931 text/html 123\n",
+			want: &urlRecord{version: 1, recordType: gowarc.Response, url: "http://example.com/a%20b", ip: "127.0.0.1", date: date,
+				contentType: "application/http;msgtype=response", length: 123},
+		},
+		{
+			name:    "dns",
+			version: 1,
+			line:    "dns:example.com 127.0.0.1 20060928223931 text/dns 56\n",
+			want: &urlRecord{version: 1, recordType: gowarc.Resource, url: "dns:example.com", ip: "127.0.0.1", date: date,
+				contentType: "text/dns", length: 56},
+		},
+		{
+			name:    "invalid date",
+			line:    "http://example.com/ 127.0.0.1 2006 text/html 123\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing length",
+			line:    "http://example.com/ 127.0.0.1 20060928223931 text/html\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unmarshaler{version: tt.version}
+			got, err := u.parseUrlRecord(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := parseVersion("2 0 Internet Archive\n")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	_, err = parseVersion("<arcmetadata>")
+	assert.Error(t, err)
+
+	_, err = parseVersion("3 0 Unknown")
+	assert.Error(t, err)
+}
+
+func TestArcReaderVersion2WithCorruptRecord(t *testing.T) {
+	versionBlock := "2 0 Internet Archive\nURL IP-address Archive-date Content-type Result-code Checksum Location Offset Filename Archive-length\n"
+	response := "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nhello"
+	arc := fmt.Sprintf("filedesc://IA-001.arc 0.0.0.0 20060928223931 text/plain 200 - - 0 IA-001.arc %d\n%s\n", len(versionBlock), versionBlock) +
+		"garbage left by a corrupt record\n" +
+		fmt.Sprintf("http://example.com/ 127.0.0.1 20060928223931 text/plain 200 3c5a2b6f - 1234 IA-000.arc %d\n%s\n", len(response), response)
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "IA-001.arc", []byte(arc), 0o644))
+
+	arcFileReader, err := NewArcFileReader(fs, "IA-001.arc", 0, gowarc.WithBufferTmpDir(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = arcFileReader.Close() }()
+
+	var records []gowarc.Record
+	for record, err := range arcFileReader.Records() {
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+
+	assert.Equal(t, gowarc.Metadata, records[0].WarcRecord.Type())
+	assert.Empty(t, records[0].Validation)
+
+	record := records[1]
+	assert.Equal(t, gowarc.Response, record.WarcRecord.Type())
+	assert.NotEmpty(t, record.Validation, "skipped data should be reported")
+	header := record.WarcRecord.WarcHeader()
+	assert.Equal(t, "200", header.Get(ArcResultCode))
+	assert.Equal(t, "3c5a2b6f", header.Get(ArcChecksum))
+	assert.False(t, header.Has(ArcLocation))
+	assert.Equal(t, "1234", header.Get(ArcOffset))
+	assert.Equal(t, "IA-000.arc", header.Get(ArcFilename))
+}
+
+func TestArcReaderWithCorruptGzipMember(t *testing.T) {
+	versionBlock := "1 0 Internet Archive\nURL IP-address Archive-date Content-type Archive-length\n"
+	members := [][]byte{
+		gzipMember(t, fmt.Sprintf("filedesc://IA-001.arc 0.0.0.0 20060928223931 text/plain %d\n", len(versionBlock)), versionBlock+"\n"),
+		gzipMember(t, "http://example.com/a 127.0.0.1 20060928223931 text/plain 5\n", "first\n"),
+		gzipMember(t, "http://example.com/b 127.0.0.1 20060928223931 text/plain 6\n", "second\n"),
+		gzipMember(t, "http://example.com/c 127.0.0.1 20060928223931 text/plain 5\n", "third\n"),
+	}
+	// make the deflate block holding the content of the second record invalid
+	corrupt := members[2]
+	sync := bytes.Index(corrupt, []byte{0x00, 0x00, 0xff, 0xff})
+	require.Positive(t, sync)
+	corrupt[sync+4] = 0xff
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "IA-001.arc.gz", bytes.Join(members, nil), 0o644))
+
+	arcFileReader, err := NewArcFileReader(fs, "IA-001.arc.gz", 0, gowarc.WithBufferTmpDir(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = arcFileReader.Close() }()
+
+	var urls []string
+	var errs []error
+	var errOffset int64
+	for record, err := range arcFileReader.Records() {
+		if err != nil {
+			errs = append(errs, err)
+			errOffset = record.Offset
+			continue
+		}
+		urls = append(urls, record.WarcRecord.WarcHeader().Get(gowarc.WarcTargetURI))
+		_ = record.Close()
+	}
+
+	assert.Equal(t, []string{"filedesc://IA-001.arc", "http://example.com/a", "http://example.com/c"}, urls)
+	require.Len(t, errs, 1)
+	var corruptErr *CorruptRecordError
+	assert.ErrorAs(t, errs[0], &corruptErr)
+	assert.Equal(t, int64(len(members[0])+len(members[1])), errOffset)
+}
+
+// gzipMember compresses a record as a gzip member, with the header line and the content in
+// separate deflate blocks.
+func gzipMember(t *testing.T, headerLine string, content string) []byte {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.NoCompression)
+	require.NoError(t, err)
+	_, err = gz.Write([]byte(headerLine))
+	require.NoError(t, err)
+	require.NoError(t, gz.Flush())
+	_, err = gz.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
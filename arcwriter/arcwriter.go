@@ -0,0 +1,150 @@
+package arcwriter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	mytime "github.com/nationallibraryofnorway/warchaeology/v5/internal/time"
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// ErrNotRepresentable is returned for records that have no counterpart in ARC files.
+var ErrNotRepresentable = errors.New("record can not be represented in ARC")
+
+const (
+	noType    = "no-type"
+	noAddress = "0.0.0.0"
+)
+
+// ArcWriter writes WARC records as ARC version 1 records.
+//
+// Only response and resource records can be represented in ARC. The block of the record is
+// written as the content of the ARC record, which for HTTP responses includes the HTTP headers.
+// The filedesc header record must be written with WriteFileHeader before any other record.
+type ArcWriter struct {
+	w            io.Writer
+	compress     bool
+	organization string
+}
+
+type Option func(*ArcWriter)
+
+// WithCompression makes the writer compress each record as a separate gzip member.
+func WithCompression(compress bool) Option {
+	return func(a *ArcWriter) {
+		a.compress = compress
+	}
+}
+
+// WithOrganization sets the organization named in the filedesc header.
+func WithOrganization(organization string) Option {
+	return func(a *ArcWriter) {
+		a.organization = organization
+	}
+}
+
+func NewArcWriter(w io.Writer, options ...Option) *ArcWriter {
+	arcWriter := &ArcWriter{w: w}
+	for _, option := range options {
+		option(arcWriter)
+	}
+	return arcWriter
+}
+
+// WriteFileHeader writes the filedesc record that starts every ARC file.
+func (a *ArcWriter) WriteFileHeader(filename string, date time.Time) error {
+	versionBlock := "1 0"
+	if a.organization != "" {
+		versionBlock += " " + strings.ReplaceAll(a.organization, "\n", " ")
+	}
+	versionBlock += "\nURL IP-address Archive-date Content-type Archive-length\n"
+	return a.writeRecord("filedesc://"+filename, noAddress, date, "text/plain", int64(len(versionBlock)), strings.NewReader(versionBlock))
+}
+
+// Write writes a WARC record as an ARC record. ErrNotRepresentable is returned for record types
+// other than response and resource.
+func (a *ArcWriter) Write(warcRecord gowarc.WarcRecord) error {
+	switch warcRecord.Type() {
+	case gowarc.Response, gowarc.Resource:
+	default:
+		return fmt.Errorf("%w: %s record", ErrNotRepresentable, warcRecord.Type())
+	}
+
+	header := warcRecord.WarcHeader()
+	url := header.Get(gowarc.WarcTargetURI)
+	if url == "" {
+		return fmt.Errorf("%w: missing %s", ErrNotRepresentable, gowarc.WarcTargetURI)
+	}
+	date, err := header.GetTime(gowarc.WarcDate)
+	if err != nil {
+		return err
+	}
+	ip := header.Get(gowarc.WarcIPAddress)
+	if ip == "" {
+		ip = noAddress
+	}
+	length, err := warcRecord.ContentLength()
+	if err != nil {
+		return err
+	}
+
+	contentType := header.Get(gowarc.ContentType)
+	if block, ok := warcRecord.Block().(gowarc.HttpResponseBlock); ok {
+		contentType = ""
+		if httpHeader := block.HttpHeader(); httpHeader != nil {
+			contentType = httpHeader.Get("Content-Type")
+		}
+	}
+
+	content, err := warcRecord.Block().RawBytes()
+	if err != nil {
+		return err
+	}
+	return a.writeRecord(url, ip, date, contentType, length, content)
+}
+
+func (a *ArcWriter) writeRecord(url string, ip string, date time.Time, contentType string, length int64, content io.Reader) (err error) {
+	w := a.w
+	if a.compress {
+		gz := gzip.NewWriter(a.w)
+		defer func() {
+			if closeErr := gz.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = gz
+	}
+
+	// the fields of the URL record are separated by spaces so they can't contain any
+	if _, err = fmt.Fprintf(w, "%s %s %s %s %d\n", strings.ReplaceAll(url, " ", "%20"), ip, mytime.To14(date), arcContentType(contentType), length); err != nil {
+		return err
+	}
+	n, err := io.CopyN(w, content, length)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("content is %d bytes shorter than its length %d", length-n, length)
+		}
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// arcContentType returns the media type of a content type without parameters, or no-type.
+func arcContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// keep what looks like a media type of a malformed header
+		before, _, _ := strings.Cut(contentType, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(before))
+	}
+	if mediaType == "" || strings.ContainsAny(mediaType, " \t") {
+		return noType
+	}
+	return mediaType
+}
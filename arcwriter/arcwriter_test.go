@@ -0,0 +1,122 @@
+package arcwriter
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/nationallibraryofnorway/warchaeology/v5/arcreader"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDate = time.Date(2006, 9, 28, 22, 39, 31, 0, time.UTC)
+
+func TestWriteFileHeader(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewArcWriter(&buf, WithOrganization("National Library")).WriteFileHeader("test.arc", testDate)
+	require.NoError(t, err)
+
+	want := "filedesc://test.arc 0.0.0.0 20060928223931 text/plain 77\n" +
+		"1 0 National Library\n" +
+		"URL IP-address Archive-date Content-type Archive-length\n" +
+		"\n"
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWriteCompressed(t *testing.T) {
+	var buf bytes.Buffer
+	arcWriter := NewArcWriter(&buf, WithCompression(true))
+	require.NoError(t, arcWriter.WriteFileHeader("test.arc.gz", testDate))
+	require.NoError(t, arcWriter.writeRecord("http://example.com/a b", "127.0.0.1", testDate, "text/html; charset=utf-8", 5, bytes.NewReader([]byte("hello"))))
+
+	// each record is a gzip member of its own
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	var members []string
+	for {
+		gz.Multistream(false)
+		member, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		members = append(members, string(member))
+		if err := gz.Reset(&buf); err == io.EOF {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+	}
+	require.Len(t, members, 2)
+	assert.Equal(t, "http://example.com/a%20b 127.0.0.1 20060928223931 text/html 5\nhello\n", members[1])
+}
+
+func TestWriteShortContent(t *testing.T) {
+	err := NewArcWriter(io.Discard).writeRecord("http://example.com/", noAddress, testDate, "", 10, bytes.NewReader([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestArcContentType(t *testing.T) {
+	tests := map[string]string{
+		"text/html; charset=UTF-8": "text/html",
+		"Text/HTML;;":              "text/html",
+		"":                         noType,
+		"not a type":               noType,
+	}
+	for contentType, want := range tests {
+		assert.Equal(t, want, arcContentType(contentType), contentType)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	file, err := fs.Create("test.arc.gz")
+	require.NoError(t, err)
+
+	arcWriter := NewArcWriter(file, WithCompression(true))
+	require.NoError(t, arcWriter.WriteFileHeader("test.arc.gz", testDate))
+
+	httpResponse := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello"
+	rb := gowarc.NewRecordBuilder(gowarc.Response, gowarc.WithBufferTmpDir(t.TempDir()))
+	rb.AddWarcHeader(gowarc.WarcTargetURI, "http://example.com/")
+	rb.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	rb.AddWarcHeaderTime(gowarc.WarcDate, testDate)
+	rb.AddWarcHeader(gowarc.WarcIPAddress, "127.0.0.1")
+	_, err = rb.WriteString(httpResponse)
+	require.NoError(t, err)
+	response, _, err := rb.Build()
+	require.NoError(t, err)
+	require.NoError(t, arcWriter.Write(response))
+
+	rb = gowarc.NewRecordBuilder(gowarc.Request, gowarc.WithBufferTmpDir(t.TempDir()))
+	rb.AddWarcHeader(gowarc.WarcTargetURI, "http://example.com/")
+	rb.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=request")
+	rb.AddWarcHeaderTime(gowarc.WarcDate, testDate)
+	_, err = rb.WriteString("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	require.NoError(t, err)
+	request, _, err := rb.Build()
+	require.NoError(t, err)
+	assert.ErrorIs(t, arcWriter.Write(request), ErrNotRepresentable)
+	require.NoError(t, file.Close())
+
+	arcFileReader, err := arcreader.NewArcFileReader(fs, "test.arc.gz", 0, gowarc.WithBufferTmpDir(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = arcFileReader.Close() }()
+
+	var records []gowarc.WarcRecord
+	for record, err := range arcFileReader.Records() {
+		require.NoError(t, err)
+		records = append(records, record.WarcRecord)
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, gowarc.Response, records[1].Type())
+	assert.Equal(t, "http://example.com/", records[1].WarcHeader().Get(gowarc.WarcTargetURI))
+	assert.Equal(t, "127.0.0.1", records[1].WarcHeader().Get(gowarc.WarcIPAddress))
+	content, err := records[1].Block().RawBytes()
+	require.NoError(t, err)
+	b, err := io.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, httpResponse, string(b))
+}
@@ -119,7 +119,7 @@ func (o *AartOptions) Validate() error {
 }
 
 func (o *AartOptions) Run() error {
-	wf, err := gowarc.NewWarcFileReader(o.fileName, o.offset, o.warcRecordOptions...)
+	wf, err := warc.NewReader(o.fileName, o.offset, o.warcRecordOptions...)
 	defer func() {
 		if wf != nil {
 			_ = wf.Close()
@@ -40,7 +40,7 @@ const (
 )
 
 type CatOptions struct {
-	paths             []string
+	files             []flag.SrcFile
 	offset            int64
 	recordNum         int
 	recordCount       int
@@ -97,7 +97,8 @@ func (f CatFlags) ToOptions() (*CatOptions, error) {
 		return nil, err
 	}
 
-	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	srcFileListFlags := f.FileWalkerFlags.SrcFileListFlags
+	files, err := flag.ReadSrcFiles(srcFileListFlags.SrcFileList(), srcFileListFlags.Null())
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from source file: %w", err)
 	}
@@ -114,7 +115,7 @@ func (f CatFlags) ToOptions() (*CatOptions, error) {
 	}
 
 	return &CatOptions{
-		paths:             fileList,
+		files:             files,
 		offset:            f.WarcIteratorFlags.Offset(),
 		recordCount:       f.WarcIteratorFlags.Limit(),
 		recordNum:         f.WarcIteratorFlags.RecordNum(),
@@ -140,7 +141,10 @@ func NewCmdCat() *cobra.Command {
 warc cat file1.warc.gz
 
 # Pipe the payload of the 4th record into the image viewer feh
-warc cat -n4 -P file1.warc.gz | feh -`,
+warc cat -n4 -P file1.warc.gz | feh -
+
+# Print the record at a byte offset, e.g. from a CDX file, with lines like path<TAB>offset<TAB>count on stdin
+printf 'file1.warc.gz\t1234\t1\n' | warc cat --source-file-list -`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o, err := flags.ToOptions()
 			if err != nil {
@@ -169,7 +173,9 @@ warc cat -n4 -P file1.warc.gz | feh -`,
 }
 
 func (o *CatOptions) Complete(cmd *cobra.Command, args []string) error {
-	o.paths = append(o.paths, args...)
+	for _, arg := range args {
+		o.files = append(o.files, flag.SrcFile{Path: arg})
+	}
 
 	// If no output is specified, show everything.
 	// This way we can specify a single flag to show just that part of the record.
@@ -184,9 +190,13 @@ func (o *CatOptions) Complete(cmd *cobra.Command, args []string) error {
 
 // Validate validates the options
 func (o *CatOptions) Validate() error {
-	if len(o.paths) == 0 {
+	if len(o.files) == 0 {
 		return errors.New("missing file or directory")
 	}
+	// files are printed one input at a time, so shards are only balanced within a single input
+	if len(o.files) > 1 && o.fileWalker.Shards > 1 && o.fileWalker.ShardBy == filewalker.ShardBySize {
+		return fmt.Errorf("--%s %s needs a single file or directory", flag.ShardBy, filewalker.ShardBySize)
+	}
 	return nil
 }
 
@@ -195,23 +205,44 @@ func (o *CatOptions) Run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
-	for _, path := range o.paths {
-		err := o.fileWalker.Walk(ctx, path, func(fs afero.Fs, path string, err error) error {
+	defer o.fileWalker.Close()
+
+	handleError := func(path string, err error) {
+		if !o.continueOnError {
+			cancel()
+		}
+		var recordErr warc.RecordError
+		if errors.As(err, &recordErr) {
+			slog.Error(recordErr.Error(), "path", path, "offset", recordErr.Offset())
+		} else {
+			slog.Error(err.Error(), "path", path)
+		}
+	}
+
+	for _, file := range o.files {
+		// files listed with an offset are read from the offset on the input filesystem
+		if file.HasOffset {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// a line without a count prints the record at the offset
+			recordCount := 1
+			if file.Count > 0 {
+				recordCount = file.Count
+			}
+			if err := o.handleFile(ctx, o.fileWalker.Fs, file.Path, file.Offset, recordCount); err != nil {
+				handleError(file.Path, err)
+			}
+			continue
+		}
+		err := o.fileWalker.Walk(ctx, file.Path, func(fs afero.Fs, path string, err error) error {
 			if err != nil {
 				return err
 			}
 
-			err = o.handleFile(ctx, fs, path)
+			err = o.handleFile(ctx, fs, path, o.offset, o.recordCount)
 			if err != nil {
-				if !o.continueOnError {
-					cancel()
-				}
-				var recordErr warc.RecordError
-				if errors.As(err, &recordErr) {
-					slog.Error(recordErr.Error(), "path", path, "offset", recordErr.Offset())
-				} else {
-					slog.Error(err.Error(), "path", path)
-				}
+				handleError(path, err)
 			}
 
 			return nil
@@ -223,13 +254,14 @@ func (o *CatOptions) Run() error {
 	return nil
 }
 
-// handleFile reads a WARC file and writes the content to stdout
-func (o *CatOptions) handleFile(ctx context.Context, fs afero.Fs, path string) error {
+// handleFile reads at most recordCount records, or all if zero, of a WARC file from the offset
+// and writes the content to stdout
+func (o *CatOptions) handleFile(ctx context.Context, fs afero.Fs, path string, offset int64, recordCount int) error {
 	f, err := fs.Open(path)
 	if err != nil {
 		return err
 	}
-	warcFileReader, err := gowarc.NewWarcFileReaderFromStream(f, o.offset, o.warcRecordOptions...)
+	warcFileReader, err := warc.NewReaderFromStream(f, offset, o.warcRecordOptions...)
 	if err != nil {
 		return err
 	}
@@ -239,7 +271,7 @@ func (o *CatOptions) handleFile(ctx context.Context, fs afero.Fs, path string) e
 
 	var lastOffset int64 = -1
 
-	records := warc.Compose(warcFileReader.Records(), o.filter, o.recordNum, o.recordCount)
+	records := warc.Compose(warcFileReader.Records(), o.filter, o.recordNum, recordCount)
 	for record, err := range records {
 		if ctx.Err() != nil {
 			return ctx.Err()
@@ -13,10 +13,17 @@ import (
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/console"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/dedup"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/derive"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/export"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/fetch"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/ls"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/recompress"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/redact"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/sample"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/validate"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/version"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/wacz"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -49,14 +56,21 @@ func NewWarcCommand() *cobra.Command {
 	flag.AddPersistentFlags(cmd)
 
 	// Add subcommands
-	cmd.AddCommand(ls.NewCmdList())           // ls
-	cmd.AddCommand(cat.NewCmdCat())           // cat
-	cmd.AddCommand(validate.NewCmdValidate()) // validate
-	cmd.AddCommand(console.NewCmdConsole())   // console
-	cmd.AddCommand(convert.NewCmdConvert())   // convert
-	cmd.AddCommand(dedup.NewCmdDedup())       // dedup
-	cmd.AddCommand(aart.NewCmdAart())         // aart
-	cmd.AddCommand(version.NewCmdVersion())   // version
+	cmd.AddCommand(ls.NewCmdList())               // ls
+	cmd.AddCommand(cat.NewCmdCat())               // cat
+	cmd.AddCommand(fetch.NewCmdFetch())           // fetch
+	cmd.AddCommand(validate.NewCmdValidate())     // validate
+	cmd.AddCommand(console.NewCmdConsole())       // console
+	cmd.AddCommand(convert.NewCmdConvert())       // convert
+	cmd.AddCommand(recompress.NewCmdRecompress()) // recompress
+	cmd.AddCommand(redact.NewCmdRedact())         // redact
+	cmd.AddCommand(sample.NewCmdSample())         // sample
+	cmd.AddCommand(dedup.NewCmdDedup())           // dedup
+	cmd.AddCommand(export.NewCmdExport())         // export
+	cmd.AddCommand(derive.NewCmdDerive())         // derive
+	cmd.AddCommand(wacz.NewCmdWacz())             // wacz
+	cmd.AddCommand(aart.NewCmdAart())             // aart
+	cmd.AddCommand(version.NewCmdVersion())       // version
 
 	return cmd
 }
@@ -2,11 +2,16 @@ package console
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/fs"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/ui"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -15,7 +20,10 @@ type ConsoleFlags struct{}
 
 func (f ConsoleFlags) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().String(flag.TempDir, os.TempDir(), flag.TempDirHelp)
-	cmd.Flags().StringSlice(flag.Suffixes, []string{".warc", ".warc.gz"}, flag.SuffixesHelp)
+	cmd.Flags().StringSlice(flag.Suffixes, []string{".warc", ".warc.gz", ".warc.zst"}, flag.SuffixesHelp)
+	cmd.Flags().StringP(flag.SrcFileSystem, "i", "", flag.SrcFileSystemHelp)
+	cmd.Flags().String(flag.HttpManifest, "", flag.HttpManifestHelp)
+	flag.AddSftpFlags(cmd)
 }
 
 func (f ConsoleFlags) TempDir() string {
@@ -26,12 +34,25 @@ func (f ConsoleFlags) Suffixes() []string {
 	return viper.GetStringSlice(flag.Suffixes)
 }
 
+func (f ConsoleFlags) SrcFilesystem() string {
+	return viper.GetString(flag.SrcFileSystem)
+}
+
+func (f ConsoleFlags) HttpManifest() string {
+	return viper.GetString(flag.HttpManifest)
+}
+
 func (f ConsoleFlags) ToOptions(_ *cobra.Command, args []string) (*ui.Options, error) {
 	if len(args) == 0 {
 		return nil, errors.New("missing input directory")
 	}
 
 	dir := args[0]
+
+	if f.SrcFilesystem() != "" {
+		return f.toRemoteOptions(dir)
+	}
+
 	abs, err := filepath.Abs(dir)
 	if err != nil {
 		return nil, err
@@ -60,6 +81,33 @@ func (f ConsoleFlags) ToOptions(_ *cobra.Command, args []string) (*ui.Options, e
 	}, nil
 }
 
+// toRemoteOptions returns the options for a directory or file of the input filesystem.
+func (f ConsoleFlags) toRemoteOptions(dir string) (*ui.Options, error) {
+	srcFs, err := fs.ResolveFilesystem(afero.NewOsFs(), f.SrcFilesystem(), fs.WithHttpManifest(f.HttpManifest()), fs.WithSftpConfig(flag.SftpConfig()), fs.WithTmpDir(f.TempDir()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file system: %w", err)
+	}
+	dir = path.Clean("/" + filepath.ToSlash(dir))
+	fi, err := srcFs.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	if !fi.IsDir() {
+		files = append(files, path.Base(dir))
+		dir = path.Dir(dir)
+	}
+
+	return &ui.Options{
+		Fs:       srcFs,
+		Dir:      dir,
+		Files:    files,
+		Suffixes: f.Suffixes(),
+		TempDir:  f.TempDir(),
+	}, nil
+}
+
 func NewCmdConsole() *cobra.Command {
 	flags := ConsoleFlags{}
 
@@ -72,6 +120,10 @@ func NewCmdConsole() *cobra.Command {
 				return err
 			}
 			cmd.SilenceUsage = true
+			// archives given as input filesystem are extracted to temporary files
+			if closer, ok := opts.Fs.(io.Closer); ok {
+				defer func() { _ = closer.Close() }()
+			}
 			return ui.NewApp(opts).Run()
 		},
 		ValidArgsFunction: flag.SuffixCompletionFn,
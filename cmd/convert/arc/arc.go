@@ -14,6 +14,7 @@ import (
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/provenance"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
@@ -34,6 +35,7 @@ type ConvertArcOptions struct {
 	WarcRecordOptions  []gowarc.WarcRecordOption
 	FileWalker         *filewalker.FileWalker
 	ContinueOnError    bool
+	Provenance         bool
 	FileIndex          *index.FileIndex
 	OpenInputFileHook  hooks.OpenInputFileHook
 	CloseInputFileHook hooks.CloseInputFileHook
@@ -49,6 +51,7 @@ type ConvertArcFlags struct {
 	UtilFlags             flag.UtilFlags
 	ConcurrencyFlags      flag.ConcurrencyFlags
 	ErrorFlags            flag.ErrorFlags
+	ProvenanceFlags       flag.ProvenanceFlags
 }
 
 func NewConvertArcFlags() ConvertArcFlags {
@@ -69,6 +72,7 @@ func (f ConvertArcFlags) AddFlags(cmd *cobra.Command) {
 	f.UtilFlags.AddFlags(cmd)
 	f.ConcurrencyFlags.AddFlags(cmd)
 	f.ErrorFlags.AddFlags(cmd)
+	f.ProvenanceFlags.AddFlags(cmd)
 }
 
 func (f ConvertArcFlags) ToConvertArcOptions() (*ConvertArcOptions, error) {
@@ -91,7 +95,7 @@ func (f ConvertArcFlags) ToConvertArcOptions() (*ConvertArcOptions, error) {
 			_, err := recordBuilder.WriteString(payload.String())
 			return err
 		}
-		warcWriterConfig.WarcFileWriterOptions = append(warcWriterConfig.WarcFileWriterOptions, gowarc.WithWarcInfoFunc(warcInfoFunc))
+		warcWriterConfig.WarcInfoFunc = warcInfoFunc
 	}
 
 	warcRecordOptions := f.WarcRecordOptionFlags.ToWarcRecordOptions()
@@ -123,7 +127,7 @@ func (f ConvertArcFlags) ToConvertArcOptions() (*ConvertArcOptions, error) {
 
 	var fileIndex *index.FileIndex
 	if f.IndexFlags.KeepIndex() {
-		fileIndex, err = f.IndexFlags.ToFileIndex()
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file index: %w", err)
 		}
@@ -139,6 +143,7 @@ func (f ConvertArcFlags) ToConvertArcOptions() (*ConvertArcOptions, error) {
 		FileIndex:          fileIndex,
 		Paths:              fileList,
 		ContinueOnError:    f.ErrorFlags.ContinueOnError(),
+		Provenance:         f.ProvenanceFlags.Provenance(),
 		MinWARCDiskFree:    f.UtilFlags.MinFreeDisk(),
 	}, nil
 }
@@ -149,7 +154,15 @@ func NewCmdConvertArc() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:   "arc FILE/DIR ...",
 		Short: "Convert ARC to WARC",
-		Long:  ``,
+		Long: `Convert ARC version 1 and version 2 files into WARC files.
+
+The filedesc header of each ARC file is converted into a metadata record. The
+result code, checksum, location, offset and filename fields of version 2 records
+are kept in the ARC-Result-Code, ARC-Checksum, ARC-Location, ARC-Offset and
+ARC-Filename WARC header fields.
+
+Data that doesn't belong to a record, like the remains of a corrupt record, is
+skipped until the next valid record header and reported as a validation error.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o, err := flags.ToConvertArcOptions()
 			if err != nil {
@@ -236,57 +249,53 @@ func (o *ConvertArcOptions) Run() error {
 
 	defer o.WarcWriterConfig.Close()
 
+	defer o.FileWalker.Close()
+
 	workerPool := workerpool.New(ctx, o.Concurrency)
 	defer workerPool.CloseWait()
 
-	for _, path := range o.Paths {
-		err := o.FileWalker.Walk(ctx, path, func(fs afero.Fs, path string, err error) error {
-			if err != nil {
-				return err
-			}
+	return o.FileWalker.WalkAll(ctx, o.Paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
 
-			workerPool.Submit(func() {
-				// Assert WARC disk has enough free space
-				if o.MinWARCDiskFree > 0 {
-					diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
-					if err != nil {
-						cancel()
-						slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
-						return
-					}
-					if diskFree < o.MinWARCDiskFree {
-						cancel()
-						slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
-						return
-					}
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.MinWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
+					return
 				}
-				result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
-				if errors.Is(err, filewalker.ErrSkipFile) {
+				if diskFree < o.MinWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
 					return
-				} else if err != nil {
-					if !o.ContinueOnError {
-						cancel()
-					}
-					if result == nil {
-						result = stat.NewResult(path)
-					}
-					result.AddError(err)
 				}
+			}
+			result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.ContinueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
 
-				results <- result
-			})
-
-			return nil
+			results <- result
 		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+
+		return nil
+	})
 }
 
-func (o *ConvertArcOptions) handleFile(fs afero.Fs, fileName string) (stat.Result, error) {
-	result := stat.NewResult(fileName)
+func (o *ConvertArcOptions) handleFile(fs afero.Fs, fileName string) (result stat.Result, err error) {
+	result = stat.NewResult(fileName)
 
 	arcFileReader, err := arcreader.NewArcFileReader(fs, fileName, 0, o.WarcRecordOptions...)
 	if err != nil {
@@ -294,7 +303,7 @@ func (o *ConvertArcOptions) handleFile(fs afero.Fs, fileName string) (stat.Resul
 	}
 	defer func() { _ = arcFileReader.Close() }()
 
-	var writer *gowarc.WarcFileWriter
+	var writer warcwriterconfig.WarcWriter
 	if o.WarcWriterConfig.OneToOneWriter {
 		defer func() {
 			if writer != nil {
@@ -303,8 +312,33 @@ func (o *ConvertArcOptions) handleFile(fs afero.Fs, fileName string) (stat.Resul
 		}()
 	}
 
+	var prov *provenance.Provenance
+	if o.Provenance {
+		if prov, err = provenance.New(fs, fileName, "Converted from ARC", []string{"added missing digests"}); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if writer == nil || !o.WarcWriterConfig.OneToOneWriter {
+				var getErr error
+				if writer, getErr = o.WarcWriterConfig.GetWarcWriter(fileName, prov.Date()); getErr != nil {
+					err = errors.Join(err, getErr)
+					return
+				}
+			}
+			if provErr := prov.Write(writer, result, err, o.WarcRecordOptions...); provErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to write provenance record: %w", provErr))
+			}
+		}()
+	}
+
 	records := warc.Compose(arcFileReader.Records(), nil, 0, 0)
 	for record, err := range records {
+		var corrupt *arcreader.CorruptRecordError
+		if errors.As(err, &corrupt) {
+			// the reader continues after the corrupt record
+			result.AddError(warc.ErrorFrom(record, err))
+			continue
+		}
 		if err != nil {
 			return result, warc.ErrorFrom(record, err)
 		}
@@ -318,7 +352,7 @@ func (o *ConvertArcOptions) handleFile(fs afero.Fs, fileName string) (stat.Resul
 				return result, warc.ErrorFrom(record, err)
 			}
 		}
-		err = o.handleRecord(writer, record, result)
+		err = o.handleRecord(writer, record, result, prov)
 		if err != nil {
 			return result, warc.ErrorFrom(record, err)
 		}
@@ -327,9 +361,13 @@ func (o *ConvertArcOptions) handleFile(fs afero.Fs, fileName string) (stat.Resul
 	return result, nil
 }
 
-func (o *ConvertArcOptions) handleRecord(warcFileWriter *gowarc.WarcFileWriter, record gowarc.Record, result stat.Result) error {
+func (o *ConvertArcOptions) handleRecord(warcFileWriter warcwriterconfig.WarcWriter, record gowarc.Record, result stat.Result, prov *provenance.Provenance) error {
 	defer record.Close()
 
+	if prov != nil {
+		prov.Link(record.WarcRecord)
+	}
+
 	result.IncrRecords()
 
 	if len(record.Validation) > 0 {
@@ -2,8 +2,12 @@ package convert
 
 import (
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert/arc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert/har"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert/httrack"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert/mhtml"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert/nedlib"
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/convert/wget"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +22,10 @@ func NewCmdConvert() *cobra.Command {
 	cmd.AddCommand(nedlib.NewCmdConvertNedlib())
 	cmd.AddCommand(arc.NewCmdConvertArc())
 	cmd.AddCommand(warc.NewCmdConvertWarc())
+	cmd.AddCommand(har.NewCmdConvertHar())
+	cmd.AddCommand(wget.NewCmdConvertWget())
+	cmd.AddCommand(httrack.NewCmdConvertHttrack())
+	cmd.AddCommand(mhtml.NewCmdConvertMhtml())
 
 	return cmd
 }
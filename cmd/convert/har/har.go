@@ -0,0 +1,348 @@
+package har
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/harreader"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type ConvertHarOptions struct {
+	Paths              []string
+	Concurrency        int
+	MinWARCDiskFree    int64
+	WarcWriterConfig   *warcwriterconfig.WarcWriterConfig
+	WarcRecordOptions  []gowarc.WarcRecordOption
+	FileWalker         *filewalker.FileWalker
+	ContinueOnError    bool
+	FileIndex          *index.FileIndex
+	OpenInputFileHook  hooks.OpenInputFileHook
+	CloseInputFileHook hooks.CloseInputFileHook
+}
+
+type ConvertHarFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	IndexFlags            flag.IndexFlags
+	WarcWriterConfigFlags *flag.WarcWriterConfigFlags
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	OutputHookFlags       *flag.OutputHookFlags
+	InputHookFlags        *flag.InputHookFlags
+	UtilFlags             flag.UtilFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewConvertHarFlags() ConvertHarFlags {
+	return ConvertHarFlags{
+		OutputHookFlags:       &flag.OutputHookFlags{},
+		InputHookFlags:        &flag.InputHookFlags{},
+		WarcWriterConfigFlags: &flag.WarcWriterConfigFlags{},
+	}
+}
+
+func (f ConvertHarFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".har"}))
+	f.OutputHookFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.WarcWriterConfigFlags.AddFlags(cmd, flag.WithDefaultOneToOne(true))
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.IndexFlags.AddFlags(cmd)
+	f.UtilFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+}
+
+func (f ConvertHarFlags) ToConvertHarOptions() (*ConvertHarOptions, error) {
+	warcWriterConfig, err := f.WarcWriterConfigFlags.ToWarcWriterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warc writer config: %w", err)
+	}
+	if warcWriterConfig.OneToOneWriter {
+		warcInfoFunc := func(recordBuilder gowarc.WarcRecordBuilder) error {
+			payload := &gowarc.WarcFields{}
+			payload.Set("software", version.SoftwareVersion())
+			payload.Set("format", fmt.Sprintf("WARC File Format %d.%d", warcWriterConfig.WarcVersion.Major(), warcWriterConfig.WarcVersion.Minor()))
+			payload.Set("description", "Converted from HAR")
+			hostname, errInner := os.Hostname()
+			if errInner != nil {
+				return errInner
+			}
+			payload.Set("host", hostname)
+
+			_, err := recordBuilder.WriteString(payload.String())
+			return err
+		}
+		warcWriterConfig.WarcInfoFunc = warcInfoFunc
+	}
+
+	warcRecordOptions := f.WarcRecordOptionFlags.ToWarcRecordOptions()
+	warcRecordOptions = append(warcRecordOptions,
+		gowarc.WithVersion(warcWriterConfig.WarcVersion),
+		gowarc.WithAddMissingDigest(true),
+	)
+
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	// and we also read paths from a file if the --src-file-fileList flag is set
+	fileList, err := flag.ReadSrcFileList(viper.GetString(flag.SrcFileList))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+
+	return &ConvertHarOptions{
+		Concurrency:        f.ConcurrencyFlags.Concurrency(),
+		OpenInputFileHook:  openInputFileHook,
+		CloseInputFileHook: closeInputFileHook,
+		WarcWriterConfig:   warcWriterConfig,
+		WarcRecordOptions:  warcRecordOptions,
+		FileWalker:         fileWalker,
+		FileIndex:          fileIndex,
+		Paths:              fileList,
+		ContinueOnError:    f.ErrorFlags.ContinueOnError(),
+		MinWARCDiskFree:    f.UtilFlags.MinFreeDisk(),
+	}, nil
+}
+
+func NewCmdConvertHar() *cobra.Command {
+	flags := NewConvertHarFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "har FILE/DIR ...",
+		Short: "Convert HAR files to WARC",
+		Long: `Convert HTTP Archive (HAR 1.2) files, e.g. exported from browser devtools, to WARC.
+
+Each entry is written as a response record and a request record linked with
+WARC-Concurrent-To. HAR files contain decoded content, so Content-Encoding and
+Transfer-Encoding headers are renamed with an X-Archive-Orig- prefix and
+Content-Length is recomputed. Entries without a response are skipped. Entries are
+read one at a time, so large HAR files are not held in memory.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToConvertHarOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *ConvertHarOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.Paths = append(o.Paths, args...)
+	return nil
+}
+
+func (o *ConvertHarOptions) Validate() error {
+	if len(o.Paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	return nil
+}
+
+func (o *ConvertHarOptions) Run() error {
+	done := make(chan struct{})
+	exitCode := 0
+
+	defer func() {
+		<-done
+		os.Exit(exitCode)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	results := make(chan stat.Result)
+	go func() {
+		defer close(done)
+
+		stats := stat.NewStats()
+		defer func() {
+			slog.Info("Total", "files", stats.Files, "errors", stats.Errors, "records", stats.Records)
+		}()
+
+		for result := range results {
+			slog := slog.With("path", result.Name())
+			for _, err := range result.Errors() {
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error("Validation error", "error", recordErr.Error(), "offset", recordErr.Offset())
+				} else {
+					slog.Error("Validation error", "error", err.Error())
+				}
+			}
+			slog.Info("Converted file", "errors", result.ErrorCount(), "records", result.Records())
+			stats.Merge(result)
+		}
+		if stats.Errors > 0 {
+			exitCode = 1
+		}
+	}()
+	defer close(results)
+
+	if o.FileIndex != nil {
+		defer o.FileIndex.Close()
+	}
+
+	defer o.WarcWriterConfig.Close()
+
+	defer o.FileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.Concurrency)
+	defer workerPool.CloseWait()
+
+	return o.FileWalker.WalkAll(ctx, o.Paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.MinWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
+					return
+				}
+				if diskFree < o.MinWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
+					return
+				}
+			}
+			result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.ContinueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
+
+			results <- result
+		})
+
+		return nil
+	})
+}
+
+func (o *ConvertHarOptions) handleFile(fs afero.Fs, fileName string) (stat.Result, error) {
+	result := stat.NewResult(fileName)
+
+	harReader, err := harreader.NewHarReader(fs, fileName, o.WarcWriterConfig.DefaultTime, o.WarcRecordOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create har reader: %w", err)
+	}
+	defer func() { _ = harReader.Close() }()
+
+	var writer warcwriterconfig.WarcWriter
+	if o.WarcWriterConfig.OneToOneWriter {
+		defer func() {
+			if writer != nil {
+				_ = writer.Close()
+			}
+		}()
+	}
+
+	records := warc.Compose(harReader.Records(), nil, 0, 0)
+	for record, err := range records {
+		if err != nil {
+			return result, warc.ErrorFrom(record, err)
+		}
+		if writer == nil || !o.WarcWriterConfig.OneToOneWriter {
+			warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+			if err != nil {
+				return result, warc.ErrorFrom(record, err)
+			}
+			writer, err = o.WarcWriterConfig.GetWarcWriter(fileName, warcDate)
+			if err != nil {
+				return result, warc.ErrorFrom(record, err)
+			}
+		}
+		err = o.handleRecord(writer, record, result)
+		if err != nil {
+			return result, warc.ErrorFrom(record, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (o *ConvertHarOptions) handleRecord(warcFileWriter warcwriterconfig.WarcWriter, record gowarc.Record, result stat.Result) error {
+	defer record.Close()
+
+	result.IncrRecords()
+
+	if len(record.Validation) > 0 {
+		for _, err := range record.Validation {
+			result.AddError(warc.ErrorFrom(record, err))
+		}
+	}
+
+	writeResponse := warcFileWriter.Write(record.WarcRecord)
+	if len(writeResponse) > 0 {
+		return writeResponse[0].Err
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package httrack
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestIsCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"/a/hts-cache/new.zip", "/a/hts-cache/new.txt", "/b/hts-cache/new.txt", "/c/new.zip"} {
+		if err := afero.WriteFile(fs, name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := map[string]bool{
+		"/a/hts-cache/new.zip": true,
+		// the transfer log is skipped when there is a zip cache
+		"/a/hts-cache/new.txt": false,
+		"/b/hts-cache/new.txt": true,
+		"/c/new.zip":           false,
+	}
+	for name, expected := range tests {
+		if got := isCache(fs, name); got != expected {
+			t.Errorf("isCache(%q) = %v, want %v", name, got, expected)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/provenance"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/time"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
@@ -35,6 +36,7 @@ type ConvertNedlibOptions struct {
 	MinWARCDiskFree    int64
 	Concurrency        int
 	ContinueOnError    bool
+	Provenance         bool
 	WarcRecordOptions  []gowarc.WarcRecordOption
 	OpenInputFileHook  hooks.OpenInputFileHook
 	CloseInputFileHook hooks.CloseInputFileHook
@@ -48,6 +50,7 @@ type ConvertNedlibFlags struct {
 	InputHookFlags        *flag.InputHookFlags
 	ConcurrencyFlags      flag.ConcurrencyFlags
 	ErrorFlags            flag.ErrorFlags
+	ProvenanceFlags       flag.ProvenanceFlags
 }
 
 func NewConvertNedlibFlags() ConvertNedlibFlags {
@@ -66,6 +69,7 @@ func (f ConvertNedlibFlags) AddFlags(cmd *cobra.Command) {
 	f.InputHookFlags.AddFlags(cmd)
 	f.ConcurrencyFlags.AddFlags(cmd)
 	f.ErrorFlags.AddFlags(cmd)
+	f.ProvenanceFlags.AddFlags(cmd)
 }
 
 func (f ConvertNedlibFlags) ToOptions() (*ConvertNedlibOptions, error) {
@@ -91,7 +95,7 @@ func (f ConvertNedlibFlags) ToOptions() (*ConvertNedlibOptions, error) {
 		_, err := wr.WriteString(warcHeader.String())
 		return err
 	}
-	warcWriterConfig.WarcFileWriterOptions = append(warcWriterConfig.WarcFileWriterOptions, gowarc.WithWarcInfoFunc(warcInfoFunc))
+	warcWriterConfig.WarcInfoFunc = warcInfoFunc
 
 	warcRecordOptions := []gowarc.WarcRecordOption{
 		gowarc.WithVersion(warcWriterConfig.WarcVersion),
@@ -113,7 +117,7 @@ func (f ConvertNedlibFlags) ToOptions() (*ConvertNedlibOptions, error) {
 
 	var fileIndex *index.FileIndex
 	if f.IndexFlags.KeepIndex() {
-		fileIndex, err = f.IndexFlags.ToFileIndex()
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file index: %w", err)
 		}
@@ -126,6 +130,7 @@ func (f ConvertNedlibFlags) ToOptions() (*ConvertNedlibOptions, error) {
 		FileWalker:        fileWalker,
 		FileIndex:         fileIndex,
 		ContinueOnError:   f.ErrorFlags.ContinueOnError(),
+		Provenance:        f.ProvenanceFlags.Provenance(),
 	}, nil
 }
 
@@ -221,58 +226,54 @@ func (o *ConvertNedlibOptions) Run() error {
 
 	defer o.WarcWriterConfig.Close()
 
+	defer o.FileWalker.Close()
+
 	workerPool := workerpool.New(ctx, o.Concurrency)
 	defer workerPool.CloseWait()
 
-	for _, path := range o.Paths {
-		err := o.FileWalker.Walk(ctx, path, func(fs afero.Fs, path string, err error) error {
-			if err != nil {
-				return err
-			}
+	return o.FileWalker.WalkAll(ctx, o.Paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
 
-			workerPool.Submit(func() {
-				// Assert WARC disk has enough free space
-				if o.MinWARCDiskFree > 0 {
-					diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
-					if err != nil {
-						cancel()
-						slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
-						return
-					}
-					if diskFree < o.MinWARCDiskFree {
-						cancel()
-						slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
-						return
-					}
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.MinWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
+					return
 				}
-
-				result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
-				if errors.Is(err, filewalker.ErrSkipFile) {
+				if diskFree < o.MinWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
 					return
-				} else if err != nil {
-					if !o.ContinueOnError {
-						cancel()
-					}
-					if result == nil {
-						result = stat.NewResult(path)
-					}
-					result.AddError(err)
 				}
+			}
 
-				results <- result
-			})
+			result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.ContinueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
 
-			return nil
+			results <- result
 		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+
+		return nil
+	})
 }
 
-func (o *ConvertNedlibOptions) handleFile(fs afero.Fs, fileName string) (stat.Result, error) {
-	result := stat.NewResult(fileName)
+func (o *ConvertNedlibOptions) handleFile(fs afero.Fs, fileName string) (result stat.Result, err error) {
+	result = stat.NewResult(fileName)
 
 	nedlibReader, err := nedlibreader.NewNedlibReader(fs, fileName, o.WarcWriterConfig.DefaultTime, o.WarcRecordOptions...)
 	if err != nil {
@@ -280,7 +281,7 @@ func (o *ConvertNedlibOptions) handleFile(fs afero.Fs, fileName string) (stat.Re
 	}
 	defer func() { _ = nedlibReader.Close() }()
 
-	var writer *gowarc.WarcFileWriter
+	var writer warcwriterconfig.WarcWriter
 	if o.WarcWriterConfig.OneToOneWriter {
 		defer func() {
 			if writer != nil {
@@ -289,25 +290,50 @@ func (o *ConvertNedlibOptions) handleFile(fs afero.Fs, fileName string) (stat.Re
 		}()
 	}
 
+	var prov *provenance.Provenance
+	if o.Provenance {
+		repairs := []string{"added missing and fixed wrong digests", "added missing and fixed wrong Content-Length"}
+		if prov, err = provenance.New(fs, fileName, "Converted from Nedlib", repairs); err != nil {
+			return nil, err
+		}
+		// the provenance record is written to the output file of the converted records
+		defer func() {
+			if writer == nil || !o.WarcWriterConfig.OneToOneWriter {
+				date := prov.Date()
+				var getErr error
+				if writer, getErr = o.WarcWriterConfig.GetWarcWriter(time.To14(date), date); getErr != nil {
+					err = errors.Join(err, getErr)
+					return
+				}
+			}
+			if provErr := prov.Write(writer, result, err, o.WarcRecordOptions...); provErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to write provenance record: %w", provErr))
+			}
+		}()
+	}
+
 	records := warc.Compose(nedlibReader.Records(), nil, 0, 0)
 	for record, err := range records {
 		if err != nil {
 			return result, warc.ErrorFrom(record, err)
 		}
 
-		warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
-		if err != nil {
-			return result, warc.ErrorFrom(record, err)
-		}
+		// one to one writers write all records of the input file to the same output file
+		if writer == nil || !o.WarcWriterConfig.OneToOneWriter {
+			warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+			if err != nil {
+				return result, warc.ErrorFrom(record, err)
+			}
 
-		syntheticFileName := time.To14(warcDate)
+			syntheticFileName := time.To14(warcDate)
 
-		writer, err := o.WarcWriterConfig.GetWarcWriter(syntheticFileName, warcDate)
-		if err != nil {
-			return result, warc.ErrorFrom(record, err)
+			writer, err = o.WarcWriterConfig.GetWarcWriter(syntheticFileName, warcDate)
+			if err != nil {
+				return result, warc.ErrorFrom(record, err)
+			}
 		}
 
-		err = o.handleRecord(writer, record, result)
+		err = o.handleRecord(writer, record, result, prov)
 		if err != nil {
 			return result, warc.ErrorFrom(record, err)
 		}
@@ -316,9 +342,13 @@ func (o *ConvertNedlibOptions) handleFile(fs afero.Fs, fileName string) (stat.Re
 	return result, nil
 }
 
-func (o *ConvertNedlibOptions) handleRecord(w *gowarc.WarcFileWriter, record gowarc.Record, result stat.Result) error {
+func (o *ConvertNedlibOptions) handleRecord(w warcwriterconfig.WarcWriter, record gowarc.Record, result stat.Result, prov *provenance.Provenance) error {
 	defer record.Close()
 
+	if prov != nil {
+		prov.Link(record.WarcRecord)
+	}
+
 	result.IncrRecords()
 
 	if len(record.Validation) > 0 {
@@ -1,10 +1,16 @@
 package nedlib
 
 import (
+	"fmt"
+	"io"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/provenance"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nlnwa/gowarc/v3"
 	"github.com/spf13/afero"
 )
 
@@ -58,3 +64,93 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestProvenanceOneToOne(t *testing.T) {
+	filename, err := filepath.Abs(filepath.Join(testDataDir, "nedlib", "nb-image", "b863a630196bce1a15ca86b40f34a2d5.meta"))
+	if err != nil {
+		t.Fatalf("failed to get absolute path: %v", err)
+	}
+	outDir := t.TempDir()
+	warcWriterConfig, err := warcwriterconfig.New("test",
+		warcwriterconfig.WithBufferTmpDir(t.TempDir()),
+		warcwriterconfig.WithOutDir(outDir),
+		warcwriterconfig.WithOneToOneWriter(true),
+		warcwriterconfig.WithCompress(false),
+	)
+	if err != nil {
+		t.Fatalf("failed to create warc writer config: %v", err)
+	}
+	defer warcWriterConfig.Close()
+
+	o := &ConvertNedlibOptions{
+		WarcWriterConfig: warcWriterConfig,
+		Provenance:       true,
+	}
+	result, err := o.handleFile(afero.NewOsFs(), filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the provenance record is written to the output file of the converted records
+	files, err := filepath.Glob(filepath.Join(outDir, "*.warc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected one output file, got %v", files)
+	}
+	reader, err := warc.NewReader(files[0], 0, gowarc.WithBufferTmpDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	var provenanceIds []string
+	var block string
+	var provenanceId string
+	for record, err := range reader.Records() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := record.WarcRecord.WarcHeader()
+		switch {
+		case header.Get(gowarc.ContentType) == "application/warc-fields" && record.WarcRecord.Type() == gowarc.Metadata:
+			provenanceId = record.WarcRecord.RecordId()
+			r, err := record.WarcRecord.Block().RawBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block = string(b)
+		case header.Has(provenance.WarcProvenanceID):
+			provenanceIds = append(provenanceIds, header.Get(provenance.WarcProvenanceID))
+		}
+		_ = record.Close()
+	}
+
+	if provenanceId == "" {
+		t.Fatal("no provenance record found")
+	}
+	if int64(len(provenanceIds)) != result.Records() {
+		t.Errorf("expected %d records referring to the provenance record, got %d", result.Records(), len(provenanceIds))
+	}
+	for _, id := range provenanceIds {
+		if id != provenanceId {
+			t.Errorf("expected records to refer to provenance record %s, got %s", provenanceId, id)
+		}
+	}
+	for _, field := range []string{
+		"source: " + filename,
+		"description: Converted from Nedlib",
+		fmt.Sprintf("records: %d", result.Records()),
+		"repair: added missing and fixed wrong digests",
+		"source-digest: sha256:",
+	} {
+		if !strings.Contains(block, field) {
+			t.Errorf("expected provenance record to contain %q, got:\n%s", field, block)
+		}
+	}
+}
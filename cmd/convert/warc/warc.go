@@ -7,12 +7,16 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 
 	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/provenance"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/rewrite"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
@@ -24,21 +28,27 @@ import (
 )
 
 type ConvertWarcOptions struct {
-	Paths              []string
-	Concurrency        int
-	MinWARCDiskFree    int64
-	Repair             bool
-	ContinueOnError    bool
-	Offset             int64
-	RecordNum          int
-	RecordCount        int
-	Force              bool
-	WarcRecordOptions  []gowarc.WarcRecordOption
-	WarcWriterConfig   *warcwriterconfig.WarcWriterConfig
-	FileWalker         *filewalker.FileWalker
-	FileIndex          *index.FileIndex
-	OpenInputFileHook  hooks.OpenInputFileHook
-	CloseInputFileHook hooks.CloseInputFileHook
+	Paths             []string
+	Concurrency       int
+	MinWARCDiskFree   int64
+	Repair            bool
+	Repairs           []string
+	Provenance        bool
+	Rules             *rewrite.Rules
+	DryRun            bool
+	ContinueOnError   bool
+	Offset            int64
+	RecordNum         int
+	RecordCount       int
+	Force             bool
+	WarcRecordOptions []gowarc.WarcRecordOption
+	// RecordBuilderOptions are used when building the converted records
+	RecordBuilderOptions []gowarc.WarcRecordOption
+	WarcWriterConfig     *warcwriterconfig.WarcWriterConfig
+	FileWalker           *filewalker.FileWalker
+	FileIndex            *index.FileIndex
+	OpenInputFileHook    hooks.OpenInputFileHook
+	CloseInputFileHook   hooks.CloseInputFileHook
 }
 
 type ConvertWarcFlags struct {
@@ -53,6 +63,8 @@ type ConvertWarcFlags struct {
 	RepairFlags           flag.RepairFlags
 	ConcurrencyFlags      flag.ConcurrencyFlags
 	ErrorFlags            flag.ErrorFlags
+	ProvenanceFlags       flag.ProvenanceFlags
+	RewriteFlags          flag.RewriteFlags
 }
 
 func NewConvertWarcFlags() ConvertWarcFlags {
@@ -64,7 +76,7 @@ func NewConvertWarcFlags() ConvertWarcFlags {
 }
 
 func (f ConvertWarcFlags) AddFlags(cmd *cobra.Command) {
-	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".warc", ".warc.gz"}))
+	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".warc", ".warc.gz", ".warc.zst"}))
 	f.IndexFlags.AddFlags(cmd)
 	f.WarcRecordOptionFlags.AddFlags(cmd)
 	f.WarcWriterConfigFlags.AddFlags(cmd)
@@ -75,6 +87,8 @@ func (f ConvertWarcFlags) AddFlags(cmd *cobra.Command) {
 	f.ConcurrencyFlags.AddFlags(cmd)
 	f.ErrorFlags.AddFlags(cmd)
 	f.WarcIteratorFlags.AddFlags(cmd)
+	f.ProvenanceFlags.AddFlags(cmd)
+	f.RewriteFlags.AddFlags(cmd)
 }
 
 func (f ConvertWarcFlags) ToConvertWarcOptions() (*ConvertWarcOptions, error) {
@@ -89,6 +103,19 @@ func (f ConvertWarcFlags) ToConvertWarcOptions() (*ConvertWarcOptions, error) {
 	warcRecordOptions = append(warcRecordOptions, f.RepairFlags.ToWarcRecordOptions()...)
 	warcRecordOptions = append(warcRecordOptions, f.WarcRecordOptionFlags.ToWarcRecordOptions()...)
 
+	rules, err := f.RewriteFlags.ToRules()
+	if err != nil {
+		return nil, err
+	}
+	recordBuilderOptions := warcRecordOptions
+	if rules != nil {
+		// rewriting HTTP header fields removes the digest and length of the block
+		recordBuilderOptions = append(slices.Clip(warcRecordOptions),
+			gowarc.WithAddMissingDigest(true),
+			gowarc.WithAddMissingContentLength(true),
+		)
+	}
+
 	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file walker: %w", err)
@@ -110,28 +137,35 @@ func (f ConvertWarcFlags) ToConvertWarcOptions() (*ConvertWarcOptions, error) {
 	}
 
 	var fileIndex *index.FileIndex
-	if f.IndexFlags.KeepIndex() {
-		fileIndex, err = f.IndexFlags.ToFileIndex()
+	// a dry run does not convert any files
+	if f.IndexFlags.KeepIndex() && !f.RewriteFlags.DryRun() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file index: %w", err)
 		}
 	}
 
 	return &ConvertWarcOptions{
-		Concurrency:        f.ConcurrencyFlags.Concurrency(),
-		MinWARCDiskFree:    f.UtilFlags.MinFreeDisk(),
-		WarcWriterConfig:   wwc,
-		FileWalker:         fileWalker,
-		WarcRecordOptions:  warcRecordOptions,
-		Paths:              fileList,
-		FileIndex:          fileIndex,
-		RecordNum:          f.WarcIteratorFlags.RecordNum(),
-		RecordCount:        f.WarcIteratorFlags.Limit(),
-		Force:              f.WarcIteratorFlags.Force(),
-		Offset:             f.WarcIteratorFlags.Offset(),
-		OpenInputFileHook:  openInputFileHook,
-		CloseInputFileHook: closeInputFileHook,
-		ContinueOnError:    f.ErrorFlags.ContinueOnError(),
+		Concurrency:          f.ConcurrencyFlags.Concurrency(),
+		MinWARCDiskFree:      f.UtilFlags.MinFreeDisk(),
+		WarcWriterConfig:     wwc,
+		FileWalker:           fileWalker,
+		WarcRecordOptions:    warcRecordOptions,
+		RecordBuilderOptions: recordBuilderOptions,
+		Rules:                rules,
+		DryRun:               f.RewriteFlags.DryRun(),
+		Paths:                fileList,
+		FileIndex:            fileIndex,
+		RecordNum:            f.WarcIteratorFlags.RecordNum(),
+		RecordCount:          f.WarcIteratorFlags.Limit(),
+		Force:                f.WarcIteratorFlags.Force(),
+		Offset:               f.WarcIteratorFlags.Offset(),
+		OpenInputFileHook:    openInputFileHook,
+		CloseInputFileHook:   closeInputFileHook,
+		ContinueOnError:      f.ErrorFlags.ContinueOnError(),
+		Repair:               f.RepairFlags.Repair(),
+		Repairs:              f.RepairFlags.Repairs(),
+		Provenance:           f.ProvenanceFlags.Provenance(),
 	}, nil
 }
 
@@ -142,7 +176,11 @@ func NewCmdConvertWarc() *cobra.Command {
 		Use:   "warc FILE/DIR ...",
 		Short: "Convert WARC file into WARC file",
 		Long: `The WARC to WARC converter can be used to reorganize, convert or repair WARC-records.
-This is an experimental feature.`,
+This is an experimental feature.
+
+Systematic header errors can be fixed with a rules file (--rules) rewriting WARC and
+HTTP header fields of matching records. Use --dry-run to list the records affected by
+the rules without writing any files.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o, err := flags.ToConvertWarcOptions()
 			if err != nil {
@@ -180,6 +218,12 @@ func (o *ConvertWarcOptions) Validate() error {
 	if len(o.Paths) == 0 {
 		return errors.New("missing file or directory name")
 	}
+	if o.DryRun && o.Rules == nil {
+		return fmt.Errorf("--%s requires --%s", flag.DryRun, flag.Rules)
+	}
+	if o.DryRun && o.Provenance {
+		return fmt.Errorf("--%s can not be combined with --%s", flag.DryRun, flag.Provenance)
+	}
 	return nil
 }
 
@@ -228,71 +272,67 @@ func (o *ConvertWarcOptions) Run() error {
 	}
 	defer o.WarcWriterConfig.Close()
 
+	defer o.FileWalker.Close()
+
 	workerPool := workerpool.New(ctx, o.Concurrency)
 	defer workerPool.CloseWait()
 
-	for _, path := range o.Paths {
-		err := o.FileWalker.Walk(ctx, path, func(fs afero.Fs, path string, err error) error {
-			if err != nil {
-				return err
-			}
-
-			workerPool.Submit(func() {
-				// Assert WARC disk has enough free space
-				if o.MinWARCDiskFree > 0 {
-					diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
-					if err != nil {
-						cancel()
-						slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
-						return
-					}
-					if diskFree < o.MinWARCDiskFree {
-						cancel()
-						slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
-						return
-					}
-				}
+	return o.FileWalker.WalkAll(ctx, o.Paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
 
-				result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
-				if errors.Is(err, filewalker.ErrSkipFile) {
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.MinWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
 					return
 				}
-				if err != nil {
-					if !o.ContinueOnError {
-						cancel()
-					}
-					if result == nil {
-						result = stat.NewResult(path)
-					}
-					result.AddError(err)
+				if diskFree < o.MinWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
+					return
 				}
+			}
 
-				results <- result
-			})
+			result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			}
+			if err != nil {
+				if !o.ContinueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
 
-			return nil
+			results <- result
 		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+
+		return nil
+	})
 }
 
-func (o *ConvertWarcOptions) handleFile(fs afero.Fs, path string) (stat.Result, error) {
+func (o *ConvertWarcOptions) handleFile(fs afero.Fs, path string) (result stat.Result, err error) {
 	file, err := fs.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = file.Close() }()
 
-	warcFileReader, err := gowarc.NewWarcFileReaderFromStream(file, o.Offset, o.WarcRecordOptions...)
+	warcFileReader, err := warc.NewReaderFromStream(file, o.Offset, o.WarcRecordOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create warc file reader: %w", err)
 	}
 	defer func() { _ = warcFileReader.Close() }()
 
-	var writer *gowarc.WarcFileWriter
+	var writer warcwriterconfig.WarcWriter
 	if o.WarcWriterConfig.OneToOneWriter {
 		defer func() {
 			if writer != nil {
@@ -301,7 +341,26 @@ func (o *ConvertWarcOptions) handleFile(fs afero.Fs, path string) (stat.Result,
 		}()
 	}
 
-	result := stat.NewResult(path)
+	result = stat.NewResult(path)
+
+	var prov *provenance.Provenance
+	if o.Provenance {
+		if prov, err = provenance.New(fs, path, "Converted from WARC", o.Repairs); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if writer == nil || !o.WarcWriterConfig.OneToOneWriter {
+				var getErr error
+				if writer, getErr = o.WarcWriterConfig.GetWarcWriter(path, prov.Date()); getErr != nil {
+					err = errors.Join(err, getErr)
+					return
+				}
+			}
+			if provErr := prov.Write(writer, result, err, o.WarcRecordOptions...); provErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to write provenance record: %w", provErr))
+			}
+		}()
+	}
 
 	var lastOffset int64 = -1
 
@@ -317,7 +376,7 @@ func (o *ConvertWarcOptions) handleFile(fs afero.Fs, path string) (stat.Result,
 			return result, warc.ErrorFrom(record, err)
 		}
 
-		if writer == nil || !o.WarcWriterConfig.OneToOneWriter {
+		if !o.DryRun && (writer == nil || !o.WarcWriterConfig.OneToOneWriter) {
 			warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
 			if err != nil {
 				return result, warc.ErrorFrom(record, err)
@@ -327,7 +386,7 @@ func (o *ConvertWarcOptions) handleFile(fs afero.Fs, path string) (stat.Result,
 				return result, warc.ErrorFrom(record, err)
 			}
 		}
-		err = o.handleRecord(writer, record, result)
+		err = o.handleRecord(writer, path, record, result, prov)
 		if err != nil {
 			return result, warc.ErrorFrom(record, err)
 		}
@@ -335,7 +394,7 @@ func (o *ConvertWarcOptions) handleFile(fs afero.Fs, path string) (stat.Result,
 	return result, nil
 }
 
-func (o *ConvertWarcOptions) handleRecord(warcFileWriter *gowarc.WarcFileWriter, record gowarc.Record, result stat.Result) error {
+func (o *ConvertWarcOptions) handleRecord(warcFileWriter warcwriterconfig.WarcWriter, path string, record gowarc.Record, result stat.Result, prov *provenance.Provenance) error {
 	defer record.Close()
 
 	result.IncrRecords()
@@ -347,17 +406,34 @@ func (o *ConvertWarcOptions) handleRecord(warcFileWriter *gowarc.WarcFileWriter,
 	}
 
 	warcRecord := record.WarcRecord
-	warcRecordBuilder := gowarc.NewRecordBuilder(warcRecord.Type(), o.WarcRecordOptions...)
-
+	warcHeader := make(rewrite.Fields, 0, len(*warcRecord.WarcHeader()))
 	for _, warcField := range *warcRecord.WarcHeader() {
-		if warcField.Name != gowarc.WarcType {
-			warcRecordBuilder.AddWarcHeader(warcField.Name, warcField.Value)
-		}
+		warcHeader = append(warcHeader, *warcField)
 	}
 	ioReader, err := warcRecord.Block().RawBytes()
 	if err != nil {
 		return err
 	}
+	if o.Rules != nil {
+		var applied []string
+		warcHeader, ioReader, applied, err = o.Rules.Rewrite(warcRecord.Type(), warcHeader, ioReader)
+		if err != nil {
+			return err
+		}
+		if o.DryRun {
+			if len(applied) > 0 {
+				fmt.Printf("%s\t%d\t%s\t%s\n", path, record.Offset, warcRecord.RecordId(), strings.Join(applied, ","))
+			}
+			return nil
+		}
+	}
+
+	warcRecordBuilder := gowarc.NewRecordBuilder(warcRecord.Type(), o.RecordBuilderOptions...)
+	for _, warcField := range warcHeader {
+		if warcField.Name != gowarc.WarcType {
+			warcRecordBuilder.AddWarcHeader(warcField.Name, warcField.Value)
+		}
+	}
 	_, err = warcRecordBuilder.ReadFrom(ioReader)
 	if err != nil {
 		return err
@@ -369,6 +445,9 @@ func (o *ConvertWarcOptions) handleRecord(warcFileWriter *gowarc.WarcFileWriter,
 	defer func() {
 		_ = warcRecord.Close()
 	}()
+	if prov != nil {
+		prov.Link(warcRecord)
+	}
 	if writeResponse := warcFileWriter.Write(warcRecord); len(writeResponse) > 0 {
 		return writeResponse[0].Err
 	}
@@ -40,7 +40,7 @@ const (
 	RecordTypesHelp = `comma separated list of record types to deduplicate. Other record types are written as is.`
 
 	Deterministic     = "deterministic"
-	DeterministicHelp = `force deterministic execution order (single worker and sorted input paths)`
+	DeterministicHelp = `force deterministic execution order (single worker, sorted input paths and --sort name unless set)`
 )
 
 type DedupOptions struct {
@@ -160,6 +160,9 @@ func (f DedupFlags) ToDedupOptions() (*DedupOptions, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file walker: %w", err)
 	}
+	if deterministic && fileWalker.Sort == filewalker.SortNone {
+		fileWalker.Sort = filewalker.SortName
+	}
 
 	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
 	if err != nil {
@@ -173,7 +176,7 @@ func (f DedupFlags) ToDedupOptions() (*DedupOptions, error) {
 
 	var fileIndex *index.FileIndex
 	if f.IndexFlags.KeepIndex() {
-		fileIndex, err = f.IndexFlags.ToFileIndex()
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file index: %w", err)
 		}
@@ -315,6 +318,8 @@ func (o *DedupOptions) Run() error {
 
 	defer o.WarcWriterConfig.Close()
 
+	defer o.FileWalker.Close()
+
 	workerPool := workerpool.New(ctx, o.Concurrency)
 	defer workerPool.CloseWait()
 
@@ -324,65 +329,59 @@ func (o *DedupOptions) Run() error {
 		slog.Warn(err.Error())
 	}
 
-	for _, path := range o.Paths {
-		err := o.FileWalker.Walk(ctx, path, func(fs afero.Fs, path string, err error) error {
-			if err != nil {
-				return err
-			}
+	return o.FileWalker.WalkAll(ctx, o.Paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
 
-			workerPool.Submit(func() {
-				// Assert WARC disk has enough free space
-				if o.MinWARCDiskFree > 0 {
-					diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
-					if err != nil {
-						cancel()
-						slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
-						return
-					}
-					if diskFree < o.MinWARCDiskFree {
-						cancel()
-						slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
-						return
-					}
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.MinWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
+					return
 				}
-				// Assert index disk has enough free space
-				if o.MinIndexDiskFree > 0 {
-					diskFree, err := util.DiskFree(o.DigestIndex.GetDir())
-					if err != nil {
-						cancel()
-						slog.Error("Failed to get free space on device", "path", o.DigestIndex.GetDir(), "error", err)
-						return
-					}
-					if diskFree < o.MinIndexDiskFree {
-						cancel()
-						slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.DigestIndex.GetDir())
-						return
-					}
+				if diskFree < o.MinWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
+					return
 				}
-
-				result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
-				if errors.Is(err, filewalker.ErrSkipFile) {
+			}
+			// Assert index disk has enough free space
+			if o.MinIndexDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.DigestIndex.GetDir())
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.DigestIndex.GetDir(), "error", err)
 					return
-				} else if err != nil {
-					if !o.ContinueOnError {
-						cancel()
-					}
-					if result == nil {
-						result = stat.NewResult(path)
-					}
-					result.AddError(err)
 				}
+				if diskFree < o.MinIndexDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.DigestIndex.GetDir())
+					return
+				}
+			}
 
-				results <- result
-			})
+			result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.ContinueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
 
-			return nil
+			results <- result
 		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+
+		return nil
+	})
 }
 
 func (o *DedupOptions) handleFile(fs afero.Fs, path string) (stat.Result, error) {
@@ -394,13 +393,13 @@ func (o *DedupOptions) handleFile(fs afero.Fs, path string) (stat.Result, error)
 	}
 	defer func() { _ = file.Close() }()
 
-	warcReader, err := gowarc.NewWarcFileReaderFromStream(file, 0, o.WarcRecordOptions...)
+	warcReader, err := warc.NewReaderFromStream(file, 0, o.WarcRecordOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create warc file reader: %w", err)
 	}
 	defer func() { _ = warcReader.Close() }()
 
-	var writer *gowarc.WarcFileWriter
+	var writer warcwriterconfig.WarcWriter
 	if o.WarcWriterConfig.OneToOneWriter {
 		defer func() {
 			if writer != nil {
@@ -434,7 +433,7 @@ func (o *DedupOptions) handleFile(fs afero.Fs, path string) (stat.Result, error)
 	return result, nil
 }
 
-func (o *DedupOptions) handleRecord(writer *gowarc.WarcFileWriter, record gowarc.Record, result stat.Result) error {
+func (o *DedupOptions) handleRecord(writer warcwriterconfig.WarcWriter, record gowarc.Record, result stat.Result) error {
 	defer record.Close()
 
 	result.IncrRecords()
@@ -503,7 +502,7 @@ func (o *DedupOptions) handleRecord(writer *gowarc.WarcFileWriter, record gowarc
 	return err
 }
 
-func writeRecord(writer *gowarc.WarcFileWriter, warcRecord gowarc.WarcRecord) error {
+func writeRecord(writer warcwriterconfig.WarcWriter, warcRecord gowarc.WarcRecord) error {
 	writeResponse := writer.Write(warcRecord)
 	if len(writeResponse) > 0 {
 		return writeResponse[0].Err
@@ -0,0 +1,21 @@
+package derive
+
+import (
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/derive/wat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/derive/wet"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdDerive() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "derive",
+		Short: "Derive metadata and text records from WARC files. Use subcommands for the supported formats",
+		Long:  ``,
+	}
+
+	// Subcommands
+	cmd.AddCommand(wat.NewCmdDeriveWat())
+	cmd.AddCommand(wet.NewCmdDeriveWet())
+
+	return cmd
+}
@@ -0,0 +1,197 @@
+package wat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/derive"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/cobra"
+)
+
+type DeriveWatOptions struct {
+	*derive.Options
+}
+
+type DeriveWatFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	IndexFlags            flag.IndexFlags
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	WarcWriterConfigFlags *flag.WarcWriterConfigFlags
+	OutputHookFlags       *flag.OutputHookFlags
+	InputHookFlags        *flag.InputHookFlags
+	WarcIteratorFlags     flag.WarcIteratorFlags
+	UtilFlags             flag.UtilFlags
+	RepairFlags           flag.RepairFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewDeriveWatFlags() DeriveWatFlags {
+	return DeriveWatFlags{
+		OutputHookFlags:       &flag.OutputHookFlags{},
+		InputHookFlags:        &flag.InputHookFlags{},
+		WarcWriterConfigFlags: &flag.WarcWriterConfigFlags{},
+	}
+}
+
+func (f DeriveWatFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".warc", ".warc.gz", ".warc.zst"}))
+	f.IndexFlags.AddFlags(cmd)
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.WarcWriterConfigFlags.AddFlags(cmd, flag.WithDefaultOneToOne(true), flag.WithDefaultFilePrefix("wat_"))
+	f.OutputHookFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.UtilFlags.AddFlags(cmd)
+	f.RepairFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+	f.WarcIteratorFlags.AddFlags(cmd)
+}
+
+func (f DeriveWatFlags) ToDeriveWatOptions() (*DeriveWatOptions, error) {
+	wwc, err := f.WarcWriterConfigFlags.ToWarcWriterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warc writer config: %w", err)
+	}
+	if wwc.OneToOneWriter {
+		warcInfoFunc := func(recordBuilder gowarc.WarcRecordBuilder) error {
+			payload := &gowarc.WarcFields{}
+			payload.Set("software", version.SoftwareVersion())
+			payload.Set("format", fmt.Sprintf("WARC File Format %d.%d", wwc.WarcVersion.Major(), wwc.WarcVersion.Minor()))
+			payload.Set("description", "WAT metadata derived from WARC")
+			hostname, errInner := os.Hostname()
+			if errInner != nil {
+				return errInner
+			}
+			payload.Set("host", hostname)
+
+			_, err := recordBuilder.WriteString(payload.String())
+			return err
+		}
+		wwc.WarcInfoFunc = warcInfoFunc
+	}
+
+	warcRecordOptions := []gowarc.WarcRecordOption{
+		gowarc.WithVersion(wwc.WarcVersion),
+	}
+	warcRecordOptions = append(warcRecordOptions, f.RepairFlags.ToWarcRecordOptions()...)
+	warcRecordOptions = append(warcRecordOptions, f.WarcRecordOptionFlags.ToWarcRecordOptions()...)
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+
+	return &DeriveWatOptions{&derive.Options{
+		Concurrency:        f.ConcurrencyFlags.Concurrency(),
+		MinWARCDiskFree:    f.UtilFlags.MinFreeDisk(),
+		WarcWriterConfig:   wwc,
+		FileWalker:         fileWalker,
+		WarcRecordOptions:  warcRecordOptions,
+		Paths:              fileList,
+		FileIndex:          fileIndex,
+		RecordNum:          f.WarcIteratorFlags.RecordNum(),
+		RecordCount:        f.WarcIteratorFlags.Limit(),
+		Force:              f.WarcIteratorFlags.Force(),
+		Offset:             f.WarcIteratorFlags.Offset(),
+		OpenInputFileHook:  openInputFileHook,
+		CloseInputFileHook: closeInputFileHook,
+		ContinueOnError:    f.ErrorFlags.ContinueOnError(),
+		Derive:             deriveWat,
+	}}, nil
+}
+
+func NewCmdDeriveWat() *cobra.Command {
+	flags := NewDeriveWatFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "wat FILE/DIR ...",
+		Short: "Derive WAT metadata records from WARC files",
+		Long: `Derive WAT metadata records from WARC files.
+
+For each record a metadata record is written with a JSON description of the record in the
+layout used by Common Crawl WAT files: the WARC header fields, the HTTP headers and, for HTML
+responses, the title, meta tags and links of the document. The metadata record refers to the
+original record with WARC-Refers-To.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToDeriveWatOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *DeriveWatOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.Paths = append(o.Paths, args...)
+	return nil
+}
+
+func (o *DeriveWatOptions) Validate() error {
+	if len(o.Paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	return nil
+}
+
+// deriveWat derives a metadata record with the WAT description of a record.
+func deriveWat(record gowarc.Record, source derive.Source) (*derive.Derived, error) {
+	wat, err := derive.NewWAT(record, source.Path, source.Compressed)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(wat)
+	if err != nil {
+		return nil, err
+	}
+	return &derive.Derived{Type: gowarc.Metadata, ContentType: "application/json", Content: payload}, nil
+}
@@ -0,0 +1,193 @@
+package wet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/derive"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/cobra"
+)
+
+type DeriveWetOptions struct {
+	*derive.Options
+}
+
+type DeriveWetFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	IndexFlags            flag.IndexFlags
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	WarcWriterConfigFlags *flag.WarcWriterConfigFlags
+	OutputHookFlags       *flag.OutputHookFlags
+	InputHookFlags        *flag.InputHookFlags
+	WarcIteratorFlags     flag.WarcIteratorFlags
+	UtilFlags             flag.UtilFlags
+	RepairFlags           flag.RepairFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewDeriveWetFlags() DeriveWetFlags {
+	return DeriveWetFlags{
+		OutputHookFlags:       &flag.OutputHookFlags{},
+		InputHookFlags:        &flag.InputHookFlags{},
+		WarcWriterConfigFlags: &flag.WarcWriterConfigFlags{},
+	}
+}
+
+func (f DeriveWetFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".warc", ".warc.gz", ".warc.zst"}))
+	f.IndexFlags.AddFlags(cmd)
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.WarcWriterConfigFlags.AddFlags(cmd, flag.WithDefaultOneToOne(true), flag.WithDefaultFilePrefix("wet_"))
+	f.OutputHookFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.UtilFlags.AddFlags(cmd)
+	f.RepairFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+	f.WarcIteratorFlags.AddFlags(cmd)
+}
+
+func (f DeriveWetFlags) ToDeriveWetOptions() (*DeriveWetOptions, error) {
+	wwc, err := f.WarcWriterConfigFlags.ToWarcWriterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warc writer config: %w", err)
+	}
+	if wwc.OneToOneWriter {
+		warcInfoFunc := func(recordBuilder gowarc.WarcRecordBuilder) error {
+			payload := &gowarc.WarcFields{}
+			payload.Set("software", version.SoftwareVersion())
+			payload.Set("format", fmt.Sprintf("WARC File Format %d.%d", wwc.WarcVersion.Major(), wwc.WarcVersion.Minor()))
+			payload.Set("description", "WET text derived from WARC")
+			hostname, errInner := os.Hostname()
+			if errInner != nil {
+				return errInner
+			}
+			payload.Set("host", hostname)
+
+			_, err := recordBuilder.WriteString(payload.String())
+			return err
+		}
+		wwc.WarcInfoFunc = warcInfoFunc
+	}
+
+	warcRecordOptions := []gowarc.WarcRecordOption{
+		gowarc.WithVersion(wwc.WarcVersion),
+	}
+	warcRecordOptions = append(warcRecordOptions, f.RepairFlags.ToWarcRecordOptions()...)
+	warcRecordOptions = append(warcRecordOptions, f.WarcRecordOptionFlags.ToWarcRecordOptions()...)
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+
+	return &DeriveWetOptions{&derive.Options{
+		Concurrency:        f.ConcurrencyFlags.Concurrency(),
+		MinWARCDiskFree:    f.UtilFlags.MinFreeDisk(),
+		WarcWriterConfig:   wwc,
+		FileWalker:         fileWalker,
+		WarcRecordOptions:  warcRecordOptions,
+		Paths:              fileList,
+		FileIndex:          fileIndex,
+		RecordNum:          f.WarcIteratorFlags.RecordNum(),
+		RecordCount:        f.WarcIteratorFlags.Limit(),
+		Force:              f.WarcIteratorFlags.Force(),
+		Offset:             f.WarcIteratorFlags.Offset(),
+		OpenInputFileHook:  openInputFileHook,
+		CloseInputFileHook: closeInputFileHook,
+		ContinueOnError:    f.ErrorFlags.ContinueOnError(),
+		Derive:             deriveWet,
+	}}, nil
+}
+
+func NewCmdDeriveWet() *cobra.Command {
+	flags := NewDeriveWetFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "wet FILE/DIR ...",
+		Short: "Derive WET plain text records from WARC files",
+		Long: `Derive WET plain text records from WARC files.
+
+For each successful HTML or plain text response or resource a conversion record is written
+with the text of the document, like the records of Common Crawl WET files. Scripts, navigation,
+headers, footers and blocks consisting mostly of links are left out of HTML documents. The
+conversion record refers to the original record with WARC-Refers-To.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToDeriveWetOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *DeriveWetOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.Paths = append(o.Paths, args...)
+	return nil
+}
+
+func (o *DeriveWetOptions) Validate() error {
+	if len(o.Paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	return nil
+}
+
+// deriveWet derives a conversion record with the text of a record holding a HTML or plain text
+// document.
+func deriveWet(record gowarc.Record, _ derive.Source) (*derive.Derived, error) {
+	text, ok, err := derive.Text(record.WarcRecord)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &derive.Derived{Type: gowarc.Conversion, ContentType: "text/plain", Content: []byte(text)}, nil
+}
@@ -0,0 +1,395 @@
+package arc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/arcwriter"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filter"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	OutputDirHelp = `output directory for generated ARC files (must already exist)`
+
+	CompressHelp = `compress each ARC record as a separate gzip member`
+
+	Organization     = "organization"
+	OrganizationHelp = `organization named in the filedesc header of generated ARC files`
+)
+
+type ExportArcOptions struct {
+	paths              []string
+	outputDir          string
+	compress           bool
+	organization       string
+	concurrency        int
+	continueOnError    bool
+	filter             *filter.RecordFilter
+	FileWalker         *filewalker.FileWalker
+	FileIndex          *index.FileIndex
+	warcRecordOptions  []gowarc.WarcRecordOption
+	openInputFileHook  hooks.OpenInputFileHook
+	closeInputFileHook hooks.CloseInputFileHook
+}
+
+type ExportArcFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	FilterFlags           flag.FilterFlags
+	IndexFlags            flag.IndexFlags
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	InputHookFlags        *flag.InputHookFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewExportArcFlags() ExportArcFlags {
+	return ExportArcFlags{
+		InputHookFlags: &flag.InputHookFlags{},
+	}
+}
+
+func (f ExportArcFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd)
+	f.FilterFlags.AddFlags(cmd)
+	f.IndexFlags.AddFlags(cmd)
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+
+	cmd.Flags().StringP(flag.OutputDir, "w", ".", OutputDirHelp)
+	if err := cmd.MarkFlagDirname(flag.OutputDir); err != nil {
+		panic(err)
+	}
+	cmd.Flags().BoolP(flag.Compress, "z", true, CompressHelp)
+	cmd.Flags().String(Organization, "", OrganizationHelp)
+}
+
+func (f ExportArcFlags) OutputDir() string {
+	return viper.GetString(flag.OutputDir)
+}
+
+func (f ExportArcFlags) Compress() bool {
+	return viper.GetBool(flag.Compress)
+}
+
+func (f ExportArcFlags) Organization() string {
+	return viper.GetString(Organization)
+}
+
+func (f ExportArcFlags) ToOptions() (*ExportArcOptions, error) {
+	filter, err := f.FilterFlags.ToFilter()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create filter: %w", err)
+	}
+
+	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	return &ExportArcOptions{
+		paths:              fileList,
+		outputDir:          f.OutputDir(),
+		compress:           f.Compress(),
+		organization:       f.Organization(),
+		concurrency:        f.ConcurrencyFlags.Concurrency(),
+		continueOnError:    f.ErrorFlags.ContinueOnError(),
+		filter:             filter,
+		FileWalker:         fileWalker,
+		FileIndex:          fileIndex,
+		warcRecordOptions:  f.WarcRecordOptionFlags.ToWarcRecordOptions(),
+		openInputFileHook:  openInputFileHook,
+		closeInputFileHook: closeInputFileHook,
+	}, nil
+}
+
+func NewCmdExportArc() *cobra.Command {
+	flags := NewExportArcFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "arc FILE/DIR ...",
+		Short: "Export response and resource records from WARC files to ARC",
+		Long: `Export response and resource records from WARC files to ARC version 1 files for
+systems that can't read WARC. One ARC file is written per WARC file.
+
+Other record types, like requests, metadata and revisits, can't be represented in ARC
+and are skipped. Skipped records are logged and counted per file. The filter flags
+select which records to export.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *ExportArcOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.paths = append(o.paths, args...)
+	return nil
+}
+
+func (o *ExportArcOptions) Validate() error {
+	if len(o.paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	if f, err := os.Stat(o.outputDir); err != nil {
+		return fmt.Errorf("failed to stat output directory: %w", err)
+	} else if !f.IsDir() {
+		return fmt.Errorf("specified output directory is not a directory: %s", o.outputDir)
+	}
+	return nil
+}
+
+func (o *ExportArcOptions) Run() error {
+	exitCode := 0
+	done := make(chan struct{})
+
+	defer func() {
+		<-done
+		os.Exit(exitCode)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	results := make(chan stat.Result)
+	go func() {
+		defer close(done)
+
+		stats := stat.NewStats()
+		defer func() {
+			slog.Info("Total", "files", stats.Files, "errors", stats.Errors, "records", stats.Records)
+		}()
+
+		for result := range results {
+			slog := slog.With("path", result.Name())
+			for _, err := range result.Errors() {
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error("Export error", "error", recordErr.Error(), "offset", recordErr.Offset())
+				} else {
+					slog.Error("Export error", "error", err.Error())
+				}
+			}
+			slog.Info("Exported file", "errors", result.ErrorCount(), "records", result.Records())
+			stats.Merge(result)
+		}
+		if stats.Errors > 0 {
+			exitCode = 1
+		}
+	}()
+	defer close(results)
+
+	if o.FileIndex != nil {
+		defer o.FileIndex.Close()
+	}
+
+	defer o.FileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.concurrency)
+	defer workerPool.CloseWait()
+
+	return o.FileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			result, err := filewalker.Preposterous(fs, path, o.openInputFileHook, o.closeInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.continueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
+
+			results <- result
+		})
+
+		return nil
+	})
+}
+
+func (o *ExportArcOptions) handleFile(fs afero.Fs, fileName string) (_ stat.Result, err error) {
+	result := stat.NewResult(fileName)
+
+	f, err := fs.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	warcFileReader, err := warc.NewReaderFromStream(f, 0, o.warcRecordOptions...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	name := arcFileName(fileName, o.compress)
+	arcFile := filepath.Join(o.outputDir, name)
+
+	// the ARC file is created at the first record, since the filedesc header is dated by it
+	var out *os.File
+	var w *bufio.Writer
+	var arcWriter *arcwriter.ArcWriter
+	defer func() {
+		if out == nil {
+			return
+		}
+		_ = out.Close()
+		if err != nil {
+			_ = os.Remove(arcFile)
+		}
+	}()
+
+	skipped := make(map[string]int)
+
+	for record, err := range warcFileReader.Records() {
+		if err != nil {
+			return result, warc.ErrorFrom(record, err)
+		}
+		if arcWriter == nil {
+			date, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+			if err != nil {
+				_ = record.Close()
+				return result, warc.ErrorFrom(record, err)
+			}
+			out, err = os.Create(arcFile)
+			if err != nil {
+				_ = record.Close()
+				return result, fmt.Errorf("failed to create ARC file: %w", err)
+			}
+			w = bufio.NewWriter(out)
+			arcWriter = arcwriter.NewArcWriter(w, arcwriter.WithCompression(o.compress), arcwriter.WithOrganization(o.organization))
+			if err := arcWriter.WriteFileHeader(name, date); err != nil {
+				_ = record.Close()
+				return result, err
+			}
+		}
+		if err := o.handleRecord(arcWriter, record, result, skipped); err != nil {
+			return result, warc.ErrorFrom(record, err)
+		}
+	}
+
+	if out == nil {
+		slog.Info("Skipped WARC file without records", "path", fileName)
+		return result, nil
+	}
+	if err := w.Flush(); err != nil {
+		return result, fmt.Errorf("failed to write ARC file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return result, fmt.Errorf("failed to close ARC file: %w", err)
+	}
+	if len(skipped) > 0 {
+		args := []any{"path", fileName}
+		for recordType, count := range skipped {
+			args = append(args, recordType, count)
+		}
+		slog.Info("Skipped records not representable in ARC", args...)
+	}
+	slog.Debug("Wrote ARC file", "path", arcFile, "records", result.Records())
+
+	return result, nil
+}
+
+func (o *ExportArcOptions) handleRecord(arcWriter *arcwriter.ArcWriter, record gowarc.Record, result stat.Result, skipped map[string]int) error {
+	defer record.Close()
+
+	warcRecord := record.WarcRecord
+	if !o.filter.Accept(warcRecord) {
+		return nil
+	}
+	err := arcWriter.Write(warcRecord)
+	if errors.Is(err, arcwriter.ErrNotRepresentable) {
+		skipped[warcRecord.Type().String()]++
+		slog.Debug("Skipped record", "error", err, "recordId", warcRecord.RecordId(), "offset", record.Offset)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	result.IncrRecords()
+	return nil
+}
+
+// arcFileName returns the name of the ARC file exported from a WARC file.
+func arcFileName(fileName string, compress bool) string {
+	name := path.Base(filepath.ToSlash(fileName))
+	for _, suffix := range []string{".gz", ".warc"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if compress {
+		return name + ".arc.gz"
+	}
+	return name + ".arc"
+}
@@ -0,0 +1,21 @@
+package arc
+
+import "testing"
+
+func TestArcFileName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		compress bool
+		want     string
+	}{
+		{"/data/example.warc.gz", true, "example.arc.gz"},
+		{"example.warc", false, "example.arc"},
+		{"/data/archive.tar!/inner.gz", true, "inner.arc.gz"},
+		{"/data/example-00001.warc.gz", false, "example-00001.arc"},
+	}
+	for _, tt := range tests {
+		if got := arcFileName(tt.fileName, tt.compress); got != tt.want {
+			t.Errorf("arcFileName(%q, %v) = %q, want %q", tt.fileName, tt.compress, got, tt.want)
+		}
+	}
+}
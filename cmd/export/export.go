@@ -0,0 +1,21 @@
+package export
+
+import (
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/export/arc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/export/har"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdExport() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export WARC records to other formats. Use subcommands for the supported formats",
+		Long:  ``,
+	}
+
+	// Subcommands
+	cmd.AddCommand(har.NewCmdExportHar())
+	cmd.AddCommand(arc.NewCmdExportArc())
+
+	return cmd
+}
@@ -0,0 +1,504 @@
+package har
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filter"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/har"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	OutputDirHelp = `output directory for generated HAR files (must already exist)`
+)
+
+type ExportHarOptions struct {
+	paths              []string
+	outputDir          string
+	concurrency        int
+	continueOnError    bool
+	filter             *filter.RecordFilter
+	FileWalker         *filewalker.FileWalker
+	FileIndex          *index.FileIndex
+	warcRecordOptions  []gowarc.WarcRecordOption
+	openInputFileHook  hooks.OpenInputFileHook
+	closeInputFileHook hooks.CloseInputFileHook
+	// harFiles maps the HAR files written to the WARC files they are exported from
+	harFiles sync.Map
+}
+
+type ExportHarFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	FilterFlags           flag.FilterFlags
+	IndexFlags            flag.IndexFlags
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	InputHookFlags        *flag.InputHookFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewExportHarFlags() ExportHarFlags {
+	return ExportHarFlags{
+		InputHookFlags: &flag.InputHookFlags{},
+	}
+}
+
+func (f ExportHarFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd)
+	f.FilterFlags.AddFlags(cmd)
+	f.IndexFlags.AddFlags(cmd)
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+
+	cmd.Flags().StringP(flag.OutputDir, "w", ".", OutputDirHelp)
+	if err := cmd.MarkFlagDirname(flag.OutputDir); err != nil {
+		panic(err)
+	}
+}
+
+func (f ExportHarFlags) OutputDir() string {
+	return viper.GetString(flag.OutputDir)
+}
+
+func (f ExportHarFlags) ToOptions() (*ExportHarOptions, error) {
+	filter, err := f.FilterFlags.ToFilter()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create filter: %w", err)
+	}
+
+	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	return &ExportHarOptions{
+		paths:              fileList,
+		outputDir:          f.OutputDir(),
+		concurrency:        f.ConcurrencyFlags.Concurrency(),
+		continueOnError:    f.ErrorFlags.ContinueOnError(),
+		filter:             filter,
+		FileWalker:         fileWalker,
+		FileIndex:          fileIndex,
+		warcRecordOptions:  f.WarcRecordOptionFlags.ToWarcRecordOptions(),
+		openInputFileHook:  openInputFileHook,
+		closeInputFileHook: closeInputFileHook,
+	}, nil
+}
+
+func NewCmdExportHar() *cobra.Command {
+	flags := NewExportHarFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "har FILE/DIR ...",
+		Short: "Export request/response pairs from WARC files to HAR",
+		Long: `Export request/response pairs from WARC files to HTTP Archive (HAR 1.2) files that
+can be opened in browser devtools. One HAR file is written per WARC file, named after it.
+WARC files with the same name in different directories are exported once, and the others
+fail instead of overwriting the HAR file.
+
+The filter flags select response records. Each selected response is paired with
+its request record using WARC-Concurrent-To. Responses without a matching
+request get a minimal GET request in the HAR file. Entries are written as soon as they
+are paired, so only requests and responses whose pair has not been read yet are held in
+memory. Requests of responses that are not exported are dropped.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *ExportHarOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.paths = append(o.paths, args...)
+	return nil
+}
+
+func (o *ExportHarOptions) Validate() error {
+	if len(o.paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	if f, err := os.Stat(o.outputDir); err != nil {
+		return fmt.Errorf("failed to stat output directory: %w", err)
+	} else if !f.IsDir() {
+		return fmt.Errorf("specified output directory is not a directory: %s", o.outputDir)
+	}
+	return nil
+}
+
+func (o *ExportHarOptions) Run() error {
+	exitCode := 0
+	done := make(chan struct{})
+
+	defer func() {
+		<-done
+		os.Exit(exitCode)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	results := make(chan stat.Result)
+	go func() {
+		defer close(done)
+
+		stats := stat.NewStats()
+		defer func() {
+			slog.Info("Total", "files", stats.Files, "errors", stats.Errors, "records", stats.Records)
+		}()
+
+		for result := range results {
+			slog := slog.With("path", result.Name())
+			for _, err := range result.Errors() {
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error("Export error", "error", recordErr.Error(), "offset", recordErr.Offset())
+				} else {
+					slog.Error("Export error", "error", err.Error())
+				}
+			}
+			slog.Info("Exported file", "errors", result.ErrorCount(), "records", result.Records())
+			stats.Merge(result)
+		}
+		if stats.Errors > 0 {
+			exitCode = 1
+		}
+	}()
+	defer close(results)
+
+	if o.FileIndex != nil {
+		defer o.FileIndex.Close()
+	}
+
+	defer o.FileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.concurrency)
+	defer workerPool.CloseWait()
+
+	return o.FileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			result, err := filewalker.Preposterous(fs, path, o.openInputFileHook, o.closeInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.continueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
+
+			results <- result
+		})
+
+		return nil
+	})
+}
+
+// exchange is a response read for export together with what is needed to find its request.
+// Responses not selected by the filter are skipped: they are only kept to drop their request.
+type exchange struct {
+	entry        har.Entry
+	recordId     string
+	concurrentTo []string
+	skip         bool
+	seq          int
+}
+
+// heldRequest is a request waiting for its response.
+type heldRequest struct {
+	request      har.Request
+	recordId     string
+	concurrentTo []string
+}
+
+// pairing pairs responses with their requests by WARC-Concurrent-To, which may refer either
+// way, and writes each response as soon as its request is found. Only records whose pair has
+// not been read yet are held in memory, and responses never paired are written without their
+// request by flush.
+type pairing struct {
+	encoder *har.Encoder
+	// requests holds the requests waiting for their response by their record id
+	requests map[string]heldRequest
+	// requestFor maps the id of a response to the id of the waiting request that claims it
+	requestFor map[string]string
+	// pending holds the responses waiting for their request by their record id
+	pending map[string]exchange
+	// waiting maps the id of a request to the id of the pending response that claims it
+	waiting map[string]string
+	seq     int
+}
+
+func newPairing(encoder *har.Encoder) *pairing {
+	return &pairing{
+		encoder:    encoder,
+		requests:   make(map[string]heldRequest),
+		requestFor: make(map[string]string),
+		pending:    make(map[string]exchange),
+		waiting:    make(map[string]string),
+	}
+}
+
+func (p *pairing) addRequest(id string, concurrentTo []string, request har.Request) error {
+	held := heldRequest{request: request, recordId: id, concurrentTo: concurrentTo}
+	for _, responseId := range concurrentTo {
+		if ex, ok := p.pending[responseId]; ok {
+			return p.write(ex, &held)
+		}
+	}
+	if responseId, ok := p.waiting[id]; ok {
+		if ex, ok := p.pending[responseId]; ok {
+			return p.write(ex, &held)
+		}
+	}
+	p.requests[id] = held
+	for _, responseId := range concurrentTo {
+		p.requestFor[responseId] = id
+	}
+	return nil
+}
+
+func (p *pairing) addResponse(ex exchange) error {
+	for _, requestId := range ex.concurrentTo {
+		if held, ok := p.requests[requestId]; ok {
+			return p.write(ex, &held)
+		}
+	}
+	if requestId, ok := p.requestFor[ex.recordId]; ok {
+		if held, ok := p.requests[requestId]; ok {
+			return p.write(ex, &held)
+		}
+	}
+	if ex.skip {
+		// only the ids are needed to drop the request when it is read
+		ex.entry = har.Entry{}
+	}
+	p.seq++
+	ex.seq = p.seq
+	p.pending[ex.recordId] = ex
+	for _, requestId := range ex.concurrentTo {
+		p.waiting[requestId] = ex.recordId
+	}
+	return nil
+}
+
+// write forgets the response and its request, if any, and writes the response unless it is
+// skipped.
+func (p *pairing) write(ex exchange, held *heldRequest) error {
+	delete(p.pending, ex.recordId)
+	for _, requestId := range ex.concurrentTo {
+		if p.waiting[requestId] == ex.recordId {
+			delete(p.waiting, requestId)
+		}
+	}
+	if held != nil {
+		delete(p.requests, held.recordId)
+		for _, responseId := range held.concurrentTo {
+			if p.requestFor[responseId] == held.recordId {
+				delete(p.requestFor, responseId)
+			}
+		}
+		if p.waiting[held.recordId] == ex.recordId {
+			delete(p.waiting, held.recordId)
+		}
+		ex.entry.Request = held.request
+	}
+	if ex.skip {
+		return nil
+	}
+	return p.encoder.Encode(ex.entry)
+}
+
+// flush writes the responses never paired with a request in the order they were read.
+func (p *pairing) flush() error {
+	unpaired := make([]exchange, 0, len(p.pending))
+	for _, ex := range p.pending {
+		if !ex.skip {
+			unpaired = append(unpaired, ex)
+		}
+	}
+	sort.Slice(unpaired, func(i, j int) bool { return unpaired[i].seq < unpaired[j].seq })
+	for _, ex := range unpaired {
+		if err := p.write(ex, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *ExportHarOptions) handleFile(fs afero.Fs, fileName string) (stat.Result, error) {
+	result := stat.NewResult(fileName)
+
+	// input files with the same name in different directories would write the same HAR file
+	harFile := filepath.Join(o.outputDir, harFileName(fileName))
+	if other, loaded := o.harFiles.LoadOrStore(harFile, fileName); loaded {
+		return nil, fmt.Errorf("HAR file %s is already exported from %s", harFile, other)
+	}
+
+	f, err := fs.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	warcFileReader, err := warc.NewReaderFromStream(f, 0, o.warcRecordOptions...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	out, err := os.Create(harFile)
+	if err != nil {
+		return result, fmt.Errorf("failed to create HAR file: %w", err)
+	}
+	bw := bufio.NewWriter(out)
+	encoder := har.NewEncoder(bw, har.Creator{Name: "warc", Version: version.Version.GitVersion})
+
+	if err := o.exportRecords(warcFileReader, result, newPairing(encoder)); err != nil {
+		_ = out.Close()
+		_ = os.Remove(harFile)
+		return result, err
+	}
+	err = encoder.Close()
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(harFile)
+		return result, fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	slog.Debug("Wrote HAR file", "path", harFile, "entries", result.Records())
+
+	return result, nil
+}
+
+func (o *ExportHarOptions) exportRecords(warcFileReader warc.Reader, result stat.Result, pairing *pairing) error {
+	for record, err := range warcFileReader.Records() {
+		if err != nil {
+			return warc.ErrorFrom(record, err)
+		}
+		if err := o.handleRecord(record, result, pairing); err != nil {
+			return warc.ErrorFrom(record, err)
+		}
+	}
+	return pairing.flush()
+}
+
+func (o *ExportHarOptions) handleRecord(record gowarc.Record, result stat.Result, pairing *pairing) error {
+	defer record.Close()
+
+	warcRecord := record.WarcRecord
+	var concurrentTo []string
+	for _, id := range warcRecord.WarcHeader().GetAll(gowarc.WarcConcurrentTo) {
+		concurrentTo = append(concurrentTo, strings.Trim(id, "<>"))
+	}
+	switch warcRecord.Type() {
+	case gowarc.Request:
+		if _, ok := warcRecord.Block().(gowarc.HttpRequestBlock); !ok {
+			return nil
+		}
+		request, err := har.RequestFromRecord(warcRecord)
+		if err != nil {
+			return err
+		}
+		return pairing.addRequest(warcRecord.RecordId(), concurrentTo, request)
+	case gowarc.Response:
+		if _, ok := warcRecord.Block().(gowarc.HttpResponseBlock); !ok || !o.filter.Accept(warcRecord) {
+			// the request of a response that is not exported is dropped when it is read
+			return pairing.addResponse(exchange{recordId: warcRecord.RecordId(), concurrentTo: concurrentTo, skip: true})
+		}
+		result.IncrRecords()
+		entry, err := har.EntryFromRecord(warcRecord)
+		if err != nil {
+			return err
+		}
+		return pairing.addResponse(exchange{entry: entry, recordId: warcRecord.RecordId(), concurrentTo: concurrentTo})
+	}
+	return nil
+}
+
+// harFileName returns the name of the HAR file exported from a WARC file.
+func harFileName(fileName string) string {
+	name := path.Base(filepath.ToSlash(fileName))
+	for _, suffix := range []string{".gz", ".zst", ".warc"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name + ".har"
+}
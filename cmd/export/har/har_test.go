@@ -0,0 +1,112 @@
+package har
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/har"
+	"github.com/spf13/afero"
+)
+
+func TestHarFileName(t *testing.T) {
+	tests := map[string]string{
+		"/data/example.warc.gz":       "example.har",
+		"/data/example.warc.zst":      "example.har",
+		"example.warc":                "example.har",
+		"/data/archive.tar!/inner.gz": "inner.har",
+		"/data/example-00001.warc.gz": "example-00001.har",
+	}
+	for fileName, want := range tests {
+		if got := harFileName(fileName); got != want {
+			t.Errorf("harFileName(%q) = %q, want %q", fileName, got, want)
+		}
+	}
+}
+
+func TestPairing(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := har.NewEncoder(&buf, har.Creator{Name: "warc"})
+	pairing := newPairing(encoder)
+
+	request := func(url string) har.Request {
+		return har.NewRequest(http.MethodPost, url, "HTTP/1.1", http.Header{}, nil)
+	}
+	response := func(id string, url string, concurrentTo ...string) exchange {
+		entry := har.Entry{Request: har.NewRequest(http.MethodGet, url, "HTTP/1.1", http.Header{}, nil)}
+		return exchange{entry: entry, recordId: id, concurrentTo: concurrentTo}
+	}
+
+	// the request refers to the response read before it
+	if err := pairing.addResponse(response("res1", "https://example.com/1")); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("expected response to wait for its request")
+	}
+	if err := pairing.addRequest("req1", []string{"res1"}, request("https://example.com/1")); err != nil {
+		t.Fatal(err)
+	}
+	// the response refers to the request read before it
+	if err := pairing.addRequest("req2", nil, request("https://example.com/2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pairing.addResponse(response("res2", "https://example.com/2", "req2")); err != nil {
+		t.Fatal(err)
+	}
+	// a response without a request
+	if err := pairing.addResponse(response("res3", "https://example.com/3")); err != nil {
+		t.Fatal(err)
+	}
+	// requests of responses that are not exported are dropped, whichever is read first
+	skipped := func(id string, concurrentTo ...string) exchange {
+		return exchange{recordId: id, concurrentTo: concurrentTo, skip: true}
+	}
+	if err := pairing.addResponse(skipped("res4", "req4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pairing.addRequest("req4", nil, request("https://example.com/4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pairing.addRequest("req5", []string{"res5"}, request("https://example.com/5")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pairing.addResponse(skipped("res5")); err != nil {
+		t.Fatal(err)
+	}
+	if len(pairing.pending) != 1 || len(pairing.requests) != 0 || len(pairing.waiting) != 0 || len(pairing.requestFor) != 0 {
+		t.Errorf("expected only the unpaired response to be held, got %d responses, %d requests, %d waiting and %d claimed",
+			len(pairing.pending), len(pairing.requests), len(pairing.waiting), len(pairing.requestFor))
+	}
+	if err := pairing.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := har.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var methods []string
+	for _, entry := range h.Log.Entries {
+		methods = append(methods, entry.Request.Method+" "+entry.Request.URL)
+	}
+	expected := "POST https://example.com/1, POST https://example.com/2, GET https://example.com/3"
+	if got := strings.Join(methods, ", "); got != expected {
+		t.Errorf("expected entries %s, got %s", expected, got)
+	}
+}
+
+func TestHandleFileRefusesToOverwrite(t *testing.T) {
+	o := &ExportHarOptions{outputDir: t.TempDir()}
+	o.harFiles.Store(filepath.Join(o.outputDir, "example.har"), "/a/example.warc.gz")
+
+	_, err := o.handleFile(afero.NewMemMapFs(), "/b/example.warc.gz")
+	if err == nil || !strings.Contains(err.Error(), "/a/example.warc.gz") {
+		t.Errorf("expected error naming the other input file, got %v", err)
+	}
+}
@@ -0,0 +1,432 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/fs"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	WarcDir     = "warc-dir"
+	WarcDirHelp = `directory the relative file names of the list are resolved against`
+
+	Warc     = "warc"
+	WarcHelp = `write the records to WARC files configured by the WARC writer flags instead of stdout`
+
+	PayloadDir     = "payload-dir"
+	PayloadDirHelp = `write the payload of each record to a file in this directory instead of writing WARC records.
+Files are named by the path of the WARC file in the list and the offset of the record, like dir/file.warc.gz-1234.
+Existing files are not overwritten`
+)
+
+type FetchOptions struct {
+	list              string
+	warcDir           string
+	payloadDir        string
+	continueOnError   bool
+	fs                afero.Fs
+	warcRecordOptions []gowarc.WarcRecordOption
+	warcWriterConfig  *warcwriterconfig.WarcWriterConfig
+}
+
+type FetchFlags struct {
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	WarcWriterConfigFlags *flag.WarcWriterConfigFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewFetchFlags() FetchFlags {
+	return FetchFlags{
+		WarcWriterConfigFlags: &flag.WarcWriterConfigFlags{},
+	}
+}
+
+func (f FetchFlags) AddFlags(cmd *cobra.Command) {
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.WarcWriterConfigFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+
+	flags := cmd.Flags()
+	flags.StringP(flag.SrcFileSystem, "i", "", flag.SrcFileSystemHelp)
+	flags.String(flag.HttpManifest, "", flag.HttpManifestHelp)
+	flag.AddSftpFlags(cmd)
+	flags.String(WarcDir, "", WarcDirHelp)
+	flags.Bool(Warc, false, WarcHelp)
+	flags.String(PayloadDir, "", PayloadDirHelp)
+	if err := cmd.MarkFlagDirname(PayloadDir); err != nil {
+		panic(err)
+	}
+}
+
+func (f FetchFlags) SrcFilesystem() string {
+	return viper.GetString(flag.SrcFileSystem)
+}
+
+func (f FetchFlags) HttpManifest() string {
+	return viper.GetString(flag.HttpManifest)
+}
+
+func (f FetchFlags) WarcDir() string {
+	return viper.GetString(WarcDir)
+}
+
+func (f FetchFlags) PayloadDir() string {
+	return viper.GetString(PayloadDir)
+}
+
+func (f FetchFlags) ToOptions() (*FetchOptions, error) {
+	srcFs, err := fs.ResolveFilesystem(afero.NewOsFs(), f.SrcFilesystem(), fs.WithHttpManifest(f.HttpManifest()), fs.WithSftpConfig(flag.SftpConfig()), fs.WithTmpDir(f.WarcRecordOptionFlags.TempDir()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file system: %w", err)
+	}
+
+	o := &FetchOptions{
+		warcDir:           f.WarcDir(),
+		payloadDir:        f.PayloadDir(),
+		continueOnError:   f.ErrorFlags.ContinueOnError(),
+		fs:                srcFs,
+		warcRecordOptions: f.WarcRecordOptionFlags.ToWarcRecordOptions(),
+	}
+	if viper.GetBool(Warc) {
+		o.warcWriterConfig, err = f.WarcWriterConfigFlags.ToWarcWriterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create warc writer config: %w", err)
+		}
+		o.warcWriterConfig.WarcInfoFunc = func(recordBuilder gowarc.WarcRecordBuilder) error {
+			payload := &gowarc.WarcFields{}
+			payload.Set("software", version.SoftwareVersion())
+			payload.Set("description", "Records fetched by file name and offset")
+			hostname, err := os.Hostname()
+			if err != nil {
+				return err
+			}
+			payload.Set("host", hostname)
+			_, err = recordBuilder.WriteString(payload.String())
+			return err
+		}
+	}
+	return o, nil
+}
+
+func NewCmdFetch() *cobra.Command {
+	flags := NewFetchFlags()
+
+	cmd := &cobra.Command{
+		Use:   "fetch [LIST]",
+		Short: "Fetch records by file name and offset",
+		Long: `Fetch the records at the positions given by a list of file names and offsets, like the
+hits of a CDX index, and write them to stdout, to WARC files or their payloads to a directory.
+
+The list is read from LIST, or stdin if it is missing or -. Each line holds a file name,
+the byte offset of a record and optionally its length, separated by whitespace. Empty lines
+and lines starting with # are skipped. The length is accepted for CDX-style lists but not
+needed, since records are read by their headers.
+
+The records are grouped by file, in the order files first appear in the list, and each file
+is opened once and read in order of offset.`,
+		Example: `
+# Fetch the records listed in hits.txt into compressed WARC files in out/
+warc fetch --warc-dir /data/warcs --warc -w out/ hits.txt
+
+# Fetch the payloads of the records of CDX lines with file name, offset and length at columns 11, 10 and 9
+awk '{print $11, $10, $9}' index.cdx | warc fetch --warc-dir /data/warcs --payload-dir payloads`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *FetchOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		o.list = args[0]
+	}
+	return nil
+}
+
+// Validate validates the options
+func (o *FetchOptions) Validate() error {
+	if o.warcWriterConfig != nil && o.warcWriterConfig.OneToOneWriter {
+		return fmt.Errorf("--%s can not be used with --%s", flag.OneToOne, Warc)
+	}
+	if o.payloadDir != "" {
+		if o.warcWriterConfig != nil {
+			return fmt.Errorf("--%s and --%s are mutually exclusive", Warc, PayloadDir)
+		}
+		if f, err := os.Stat(o.payloadDir); err != nil {
+			return fmt.Errorf("failed to stat payload directory: %w", err)
+		} else if !f.IsDir() {
+			return fmt.Errorf("specified payload directory is not a directory: %s", o.payloadDir)
+		}
+	}
+	return nil
+}
+
+// Run runs the fetch command
+func (o *FetchOptions) Run() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	// archives given as input filesystem are extracted to temporary files
+	if closer, ok := o.fs.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+
+	var r io.Reader = os.Stdin
+	if o.list != "" && o.list != "-" {
+		f, err := os.Open(o.list)
+		if err != nil {
+			return fmt.Errorf("failed to open list: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	locations, err := parseLocations(r)
+	if err != nil {
+		return fmt.Errorf("failed to read list: %w", err)
+	}
+
+	if o.warcWriterConfig != nil {
+		defer o.warcWriterConfig.Close()
+	}
+	return o.fetch(ctx, os.Stdout, locations)
+}
+
+// fetch writes the records at the locations grouped by file.
+func (o *FetchOptions) fetch(ctx context.Context, w io.Writer, locations []location) error {
+	for _, file := range groupByFile(locations) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := o.fetchFile(ctx, w, file); err != nil {
+			if !o.continueOnError {
+				return err
+			}
+			slog.Error(err.Error(), "path", file.name)
+		}
+	}
+	return nil
+}
+
+// fetchFile writes the records at the offsets of the file.
+func (o *FetchOptions) fetchFile(ctx context.Context, w io.Writer, file fileLocations) error {
+	name := file.name
+	if o.warcDir != "" && !path.IsAbs(name) && !filepath.IsAbs(name) {
+		name = path.Join(o.warcDir, name)
+	}
+	f, err := o.fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	for _, offset := range file.offsets {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := o.fetchRecord(w, f, name, file.name, offset); err != nil {
+			err = fmt.Errorf("failed to fetch record at offset %d: %w", offset, err)
+			if !o.continueOnError {
+				return err
+			}
+			slog.Error(err.Error(), "path", name, "offset", offset)
+		}
+	}
+	return nil
+}
+
+// fetchRecord writes the record at offset of the open WARC file f, which is at path and named
+// name in the list.
+func (o *FetchOptions) fetchRecord(w io.Writer, f afero.File, path string, name string, offset int64) error {
+	// the file is reused for the next record, so it must not be closed with the reader
+	reader, err := warc.NewReaderFromStream(struct{ io.ReadSeeker }{f}, offset, o.warcRecordOptions...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	record, err := reader.Next()
+	if err != nil {
+		return err
+	}
+	defer record.Close()
+
+	if o.payloadDir != "" {
+		return o.writePayload(record.WarcRecord, o.payloadPath(name, offset))
+	}
+	if o.warcWriterConfig != nil {
+		return o.writeRecord(record.WarcRecord, path)
+	}
+	_, _, err = gowarc.NewMarshaler().Marshal(w, record.WarcRecord, 0)
+	return err
+}
+
+// writeRecord writes the record with the WARC writer of the file at path.
+func (o *FetchOptions) writeRecord(warcRecord gowarc.WarcRecord, path string) error {
+	warcDate, err := warcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+	if err != nil {
+		warcDate = o.warcWriterConfig.DefaultTime
+	}
+	writer, err := o.warcWriterConfig.GetWarcWriter(path, warcDate)
+	if err != nil {
+		return err
+	}
+	if writeResponse := writer.Write(warcRecord); len(writeResponse) > 0 && writeResponse[0].Err != nil {
+		return writeResponse[0].Err
+	}
+	return nil
+}
+
+// payloadPath returns the path of the payload file of the record at offset of the WARC file named
+// name in the list. The directories of the name are kept, so that WARC files with the same name in
+// different directories get different payload files.
+func (o *FetchOptions) payloadPath(name string, offset int64) string {
+	rel := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	return filepath.Join(o.payloadDir, filepath.FromSlash(fmt.Sprintf("%s-%d", rel, offset)))
+}
+
+// writePayload writes the payload of the record, or its block if it has no payload, to the file
+// at name, which must not exist.
+func (o *FetchOptions) writePayload(warcRecord gowarc.WarcRecord, name string) error {
+	var payload io.Reader
+	var err error
+	if payloadBlock, ok := warcRecord.Block().(gowarc.PayloadBlock); ok {
+		payload, err = payloadBlock.PayloadBytes()
+	} else {
+		payload, err = warcRecord.Block().RawBytes()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, payload); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+	return f.Close()
+}
+
+// location is the position of a record in a WARC file.
+type location struct {
+	name   string
+	offset int64
+	// length is the length of the record, or 0 if not given
+	length int64
+}
+
+// parseLocations parses lines of a file name, an offset and an optional length separated by
+// whitespace, skipping empty lines and lines starting with #.
+func parseLocations(r io.Reader) ([]location, error) {
+	var locations []location
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected file name, offset and optional length, got '%s'", lineNum, line)
+		}
+		loc := location{name: fields[0]}
+		var err error
+		if loc.offset, err = strconv.ParseInt(fields[1], 10, 64); err != nil || loc.offset < 0 {
+			return nil, fmt.Errorf("line %d: invalid offset '%s'", lineNum, fields[1])
+		}
+		if len(fields) == 3 {
+			if loc.length, err = strconv.ParseInt(fields[2], 10, 64); err != nil || loc.length < 0 {
+				return nil, fmt.Errorf("line %d: invalid length '%s'", lineNum, fields[2])
+			}
+		}
+		locations = append(locations, loc)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// fileLocations holds the distinct offsets of records in a file in ascending order.
+type fileLocations struct {
+	name    string
+	offsets []int64
+}
+
+// groupByFile groups the locations by file name, in the order the files first appear.
+func groupByFile(locations []location) []fileLocations {
+	var files []fileLocations
+	index := make(map[string]int)
+	for _, loc := range locations {
+		i, ok := index[loc.name]
+		if !ok {
+			i = len(files)
+			index[loc.name] = i
+			files = append(files, fileLocations{name: loc.name})
+		}
+		files[i].offsets = append(files[i].offsets, loc.offset)
+	}
+	for i := range files {
+		offsets := files[i].offsets
+		sort.Slice(offsets, func(a, b int) bool { return offsets[a] < offsets[b] })
+		// fetch each record once
+		distinct := offsets[:0]
+		for _, offset := range offsets {
+			if len(distinct) == 0 || offset != distinct[len(distinct)-1] {
+				distinct = append(distinct, offset)
+			}
+		}
+		files[i].offsets = distinct
+	}
+	return files
+}
@@ -0,0 +1,291 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+var testDataDir = filepath.Join("..", "..", "testdata")
+
+func TestParseLocations(t *testing.T) {
+	input := "# file offset length\nb.warc.gz 300 120\n\na.warc.gz\t0\nb.warc.gz 100\n"
+	got, err := parseLocations(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []location{
+		{name: "b.warc.gz", offset: 300, length: 120},
+		{name: "a.warc.gz", offset: 0},
+		{name: "b.warc.gz", offset: 100},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	for _, invalid := range []string{"a.warc.gz\n", "a.warc.gz x\n", "a.warc.gz 1 -2\n", "a.warc.gz 1 2 3\n"} {
+		if _, err := parseLocations(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestGroupByFile(t *testing.T) {
+	got := groupByFile([]location{
+		{name: "b.warc.gz", offset: 300},
+		{name: "a.warc.gz", offset: 0},
+		{name: "b.warc.gz", offset: 100},
+		{name: "b.warc.gz", offset: 300},
+	})
+	expected := []fileLocations{
+		{name: "b.warc.gz", offsets: []int64{100, 300}},
+		{name: "a.warc.gz", offsets: []int64{0}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+type fetchedRecord struct {
+	recordType gowarc.RecordType
+	id         string
+	payload    string
+}
+
+// readRecords reads the records of a WARC file with their payloads, or blocks if they have none.
+func readRecords(t *testing.T, r io.Reader) []fetchedRecord {
+	t.Helper()
+	reader, err := warc.NewReaderFromStream(r, 0, gowarc.WithBufferTmpDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	var records []fetchedRecord
+	for record, err := range reader.Records() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload io.Reader
+		if payloadBlock, ok := record.WarcRecord.Block().(gowarc.PayloadBlock); ok {
+			payload, err = payloadBlock.PayloadBytes()
+		} else {
+			payload, err = record.WarcRecord.Block().RawBytes()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, fetchedRecord{record.WarcRecord.Type(), record.WarcRecord.RecordId(), string(b)})
+		record.Close()
+	}
+	return records
+}
+
+func TestFetch(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join(testDataDir, "warc", "single-record.warc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readRecords(t, bytes.NewReader(fixture))
+	if len(want) != 1 {
+		t.Fatalf("expected one record in the fixture, got %d", len(want))
+	}
+
+	// WARC files with the same name in different directories
+	warcDir := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(warcDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(warcDir, dir, "single-record.warc"), fixture, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	locations, err := parseLocations(strings.NewReader("a/single-record.warc 0\nb/single-record.warc 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newOptions := func() *FetchOptions {
+		return &FetchOptions{
+			warcDir:           warcDir,
+			fs:                afero.NewOsFs(),
+			warcRecordOptions: []gowarc.WarcRecordOption{gowarc.WithBufferTmpDir(t.TempDir())},
+		}
+	}
+
+	t.Run("stdout", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := newOptions().fetch(context.Background(), &out, locations); err != nil {
+			t.Fatal(err)
+		}
+		if got := readRecords(t, &out); !reflect.DeepEqual(got, []fetchedRecord{want[0], want[0]}) {
+			t.Errorf("expected the fixture record twice, got %v", got)
+		}
+	})
+
+	t.Run("warc", func(t *testing.T) {
+		outDir := t.TempDir()
+		o := newOptions()
+		o.warcWriterConfig, err = warcwriterconfig.New("fetch",
+			warcwriterconfig.WithOutDir(outDir),
+			warcwriterconfig.WithConcurrentWriters(1),
+			warcwriterconfig.WithBufferTmpDir(t.TempDir()),
+			warcwriterconfig.WithWarcInfoFunc(func(recordBuilder gowarc.WarcRecordBuilder) error {
+				_, err := recordBuilder.WriteString("description: test\r\n")
+				return err
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.fetch(context.Background(), io.Discard, locations); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.warcWriterConfig.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := filepath.Glob(filepath.Join(outDir, "*.warc.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Fatalf("expected one output file, got %v", files)
+		}
+		f, err := os.Open(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		got := readRecords(t, f)
+		if len(got) != 3 || got[0].recordType != gowarc.Warcinfo {
+			t.Fatalf("expected a warcinfo record and two fetched records, got %v", got)
+		}
+		if !reflect.DeepEqual(got[1:], []fetchedRecord{want[0], want[0]}) {
+			t.Errorf("expected the fixture record twice, got %v", got[1:])
+		}
+	})
+
+	t.Run("payloads", func(t *testing.T) {
+		o := newOptions()
+		o.payloadDir = t.TempDir()
+		if err := o.fetch(context.Background(), io.Discard, locations); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"a/single-record.warc-0", "b/single-record.warc-0"} {
+			b, err := os.ReadFile(filepath.Join(o.payloadDir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != want[0].payload {
+				t.Errorf("%s: expected %q, got %q", name, want[0].payload, b)
+			}
+		}
+
+		// existing payload files are not overwritten
+		if err := o.fetch(context.Background(), io.Discard, locations); err == nil {
+			t.Error("expected error when the payload file exists")
+		}
+	})
+}
+
+func testRecord(i int) string {
+	content := fmt.Sprintf("content of record %d", i)
+	return fmt.Sprintf("WARC/1.1\r\n"+
+		"WARC-Type: resource\r\n"+
+		"WARC-Record-ID: <urn:uuid:00000000-0000-0000-0000-%012d>\r\n"+
+		"WARC-Date: 2024-01-01T00:00:00Z\r\n"+
+		"WARC-Target-URI: http://example.com/%d\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: %d\r\n"+
+		"\r\n%s\r\n\r\n", i, i, len(content), content)
+}
+
+// compressRecords compresses each record as a gzip member or a zstd frame and returns the file
+// content and the offsets of the records.
+func compressRecords(t *testing.T, compression string, records ...string) ([]byte, []int64) {
+	t.Helper()
+	var buf bytes.Buffer
+	var offsets []int64
+	for _, record := range records {
+		offsets = append(offsets, int64(buf.Len()))
+		switch compression {
+		case "gzip":
+			gz := gzip.NewWriter(&buf)
+			if _, err := gz.Write([]byte(record)); err != nil {
+				t.Fatal(err)
+			}
+			if err := gz.Close(); err != nil {
+				t.Fatal(err)
+			}
+		case "zstd":
+			encoder, err := zstd.NewWriter(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf.Write(encoder.EncodeAll([]byte(record), nil))
+			_ = encoder.Close()
+		}
+	}
+	return buf.Bytes(), offsets
+}
+
+func TestFetchOffsetsOfCompressedFiles(t *testing.T) {
+	warcDir := t.TempDir()
+	var list strings.Builder
+	var want []string
+	for _, file := range []struct {
+		name        string
+		compression string
+	}{
+		{"records.warc.gz", "gzip"},
+		{"records.warc.zst", "zstd"},
+	} {
+		content, offsets := compressRecords(t, file.compression, testRecord(0), testRecord(1), testRecord(2))
+		if err := os.WriteFile(filepath.Join(warcDir, file.name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// the offsets are read from the same open file in sorted order
+		fmt.Fprintf(&list, "%s %d\n%s %d\n", file.name, offsets[2], file.name, offsets[1])
+		want = append(want,
+			"<urn:uuid:00000000-0000-0000-0000-000000000001>",
+			"<urn:uuid:00000000-0000-0000-0000-000000000002>")
+	}
+	locations, err := parseLocations(strings.NewReader(list.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &FetchOptions{
+		warcDir:           warcDir,
+		fs:                afero.NewOsFs(),
+		warcRecordOptions: []gowarc.WarcRecordOption{gowarc.WithBufferTmpDir(t.TempDir())},
+	}
+	var out bytes.Buffer
+	if err := o.fetch(context.Background(), &out, locations); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, record := range readRecords(t, &out) {
+		got = append(got, record.id)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected records %v, got %v", want, got)
+	}
+}
@@ -2,8 +2,12 @@ package flag
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -16,7 +20,48 @@ const (
 	FollowSymlinksHelp = `follow symbolic links while walking`
 
 	Suffixes     = "suffixes"
-	SuffixesHelp = `only process files with these suffixes`
+	SuffixesHelp = `only process files with these suffixes.
+Archive files (tar, tar.gz, tgz, zip, wacz, 7z) not matching a suffix are walked as directories. Their files are
+named by virtual paths like outer.tar!/inner.zip!/file.warc.gz`
+
+	NestedArchives     = "nested-archives"
+	NestedArchivesHelp = `walk archive files found in archives as directories, to any depth.
+Use --nested-archives=false to only walk the archives found outside archives.
+Tar and 7z archives are extracted to --tmp-dir while their files are processed`
+
+	Include     = "include"
+	IncludeHelp = `only process files matching one of these glob patterns.
+'*' and '?' do not match '/', '**' matches any number of directories. Patterns without '/' match the file name`
+
+	Exclude     = "exclude"
+	ExcludeHelp = `skip files and directories matching one of these glob patterns, e.g. '**/tmp/**'`
+
+	MinSize     = "min-size"
+	MinSizeHelp = `only process files of at least this size, e.g. 1MB`
+
+	MaxSize     = "max-size"
+	MaxSizeHelp = `only process files of at most this size, e.g. 1GB`
+
+	ModifiedAfter     = "modified-after"
+	ModifiedAfterHelp = `only process files modified after this date (2006-01-02 or RFC 3339) or age (e.g. 7d or 36h)`
+
+	ModifiedBefore     = "modified-before"
+	ModifiedBeforeHelp = `only process files modified before this date (2006-01-02 or RFC 3339) or age (e.g. 7d or 36h)`
+
+	MaxDepth     = "max-depth"
+	MaxDepthHelp = `maximum depth of files below the input paths when walking recursively, like find -maxdepth.
+0 means no limit`
+
+	Sort     = "sort"
+	SortHelp = `order of the files of each input path: name or size (largest first).
+Files are listed before they are processed. By default files are processed as found, by name within each directory`
+
+	Shard     = "shard"
+	ShardHelp = `only process the files of shard i of n, given as i/n, to split a job over n hosts without overlap`
+
+	ShardBy     = "shard-by"
+	ShardByHelp = `how files are assigned to shards: hash of the path relative to the input path, or size to balance
+the total size of the shards. Size lists the files of all input paths before processing`
 )
 
 type FileWalkerFlags struct {
@@ -35,13 +80,24 @@ func (f FileWalkerFlags) AddFlags(cmd *cobra.Command, options ...func(*FileWalke
 		option(&f)
 	}
 	if len(f.suffixes) == 0 {
-		f.suffixes = []string{".warc", ".warc.gz"}
+		f.suffixes = []string{".warc", ".warc.gz", ".warc.zst"}
 	}
 
 	flags := cmd.Flags()
 	flags.BoolP(Recursive, "r", false, RecursiveHelp)
 	flags.BoolP(FollowSymlinks, "s", false, FollowSymlinksHelp)
 	flags.StringSlice(Suffixes, f.suffixes, SuffixesHelp)
+	flags.Bool(NestedArchives, true, NestedArchivesHelp)
+	flags.StringArray(Include, nil, IncludeHelp)
+	flags.StringArray(Exclude, nil, ExcludeHelp)
+	flags.String(MinSize, "", MinSizeHelp)
+	flags.String(MaxSize, "", MaxSizeHelp)
+	flags.String(ModifiedAfter, "", ModifiedAfterHelp)
+	flags.String(ModifiedBefore, "", ModifiedBeforeHelp)
+	flags.Int(MaxDepth, 0, MaxDepthHelp)
+	flags.String(Sort, filewalker.SortNone, SortHelp)
+	flags.String(Shard, "", ShardHelp)
+	flags.String(ShardBy, filewalker.ShardByHash, ShardByHelp)
 
 	f.SrcFileListFlags.AddFlags(cmd)
 }
@@ -52,10 +108,77 @@ func (f FileWalkerFlags) ToFileWalker() (*filewalker.FileWalker, error) {
 		return nil, fmt.Errorf("failed to create file system: %w", err)
 	}
 
+	include, err := filewalker.CompileGlobs(viper.GetStringSlice(Include))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", Include, err)
+	}
+	exclude, err := filewalker.CompileGlobs(viper.GetStringSlice(Exclude))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", Exclude, err)
+	}
+	now := time.Now()
+	modifiedAfter, err := parseTimeOrAge(viper.GetString(ModifiedAfter), now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", ModifiedAfter, err)
+	}
+	modifiedBefore, err := parseTimeOrAge(viper.GetString(ModifiedBefore), now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", ModifiedBefore, err)
+	}
+	sortOrder := viper.GetString(Sort)
+	if sortOrder != filewalker.SortNone && sortOrder != filewalker.SortName && sortOrder != filewalker.SortSize {
+		return nil, fmt.Errorf("invalid --%s '%s': must be %s or %s", Sort, sortOrder, filewalker.SortName, filewalker.SortSize)
+	}
+	shard, shards := 1, 1
+	if value := viper.GetString(Shard); value != "" {
+		if shard, shards, err = filewalker.ParseShard(value); err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", Shard, err)
+		}
+	}
+	shardBy := viper.GetString(ShardBy)
+	if shardBy != filewalker.ShardByHash && shardBy != filewalker.ShardBySize {
+		return nil, fmt.Errorf("invalid --%s '%s': must be %s or %s", ShardBy, shardBy, filewalker.ShardByHash, filewalker.ShardBySize)
+	}
+
 	return filewalker.New(
 		filewalker.WithFs(fs),
 		filewalker.WithRecursive(viper.GetBool(Recursive)),
 		filewalker.WithFollowSymlinks(viper.GetBool(FollowSymlinks)),
 		filewalker.WithSuffixes(viper.GetStringSlice(Suffixes)),
+		filewalker.WithNestedArchives(viper.GetBool(NestedArchives)),
+		filewalker.WithTmpDir(viper.GetString(TempDir)),
+		filewalker.WithInclude(include),
+		filewalker.WithExclude(exclude),
+		filewalker.WithSizeRange(util.ParseSizeInBytes(viper.GetString(MinSize)), util.ParseSizeInBytes(viper.GetString(MaxSize))),
+		filewalker.WithModifiedRange(modifiedAfter, modifiedBefore),
+		filewalker.WithMaxDepth(viper.GetInt(MaxDepth)),
+		filewalker.WithSort(sortOrder),
+		filewalker.WithShard(shard, shards, shardBy),
 	), nil
 }
+
+// parseTimeOrAge parses a date, a timestamp or an age like 7d or 36h relative to now. The empty
+// string is the zero time.
+func parseTimeOrAge(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid date or age '%s'", value)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return time.Time{}, fmt.Errorf("invalid date or age '%s'", value)
+	}
+	return now.Add(-age), nil
+}
@@ -2,10 +2,12 @@ package flag
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -19,6 +21,15 @@ const (
 
 	IndexDir     = "index-dir"
 	IndexDirHelp = `directory used to store index data`
+
+	IndexHash     = "index-hash"
+	IndexHashHelp = `store a hash of samples of the content of each file in the index, in addition to its size
+and modification time, so replaced files are detected even if those are unchanged`
+
+	IndexVerify     = "index-verify"
+	IndexVerifyHelp = `recheck all cached results against the hash of the content of the files on disk before
+processing, instead of trusting their size and modification time. Results of files that have changed
+or no longer exist, and results cached without --index-hash, are removed and recomputed`
 )
 
 type IndexFlags struct{}
@@ -35,6 +46,8 @@ func (f IndexFlags) AddFlags(cmd *cobra.Command) {
 	flags.BoolP(KeepIndex, "k", false, KeepIndexHelp)
 	flags.BoolP(NewIndex, "K", false, NewIndexHelp)
 	flags.String(IndexDir, cacheDir, IndexDirHelp)
+	flags.Bool(IndexHash, false, IndexHashHelp)
+	flags.Bool(IndexVerify, false, IndexVerifyHelp)
 
 	if err := cmd.MarkFlagDirname(IndexDir); err != nil {
 		panic(err)
@@ -53,10 +66,30 @@ func (f IndexFlags) NewIndex() bool {
 	return viper.GetBool(NewIndex)
 }
 
+func (f IndexFlags) IndexHash() bool {
+	return viper.GetBool(IndexHash)
+}
+
+func (f IndexFlags) IndexVerify() bool {
+	return viper.GetBool(IndexVerify)
+}
+
 func (f IndexFlags) ToDigestIndex() (*index.DigestIndex, error) {
 	return index.NewDigestIndex(f.IndexDir(), f.KeepIndex(), f.NewIndex())
 }
 
-func (f IndexFlags) ToFileIndex() (*index.FileIndex, error) {
-	return index.NewFileIndex(f.IndexDir(), f.KeepIndex(), f.NewIndex())
+// ToFileIndex returns the file index. With --index-verify the cached results of the files in fs
+// are verified before they are used.
+func (f IndexFlags) ToFileIndex(fs afero.Fs) (*index.FileIndex, error) {
+	fileIndex, err := index.NewFileIndex(f.IndexDir(), f.KeepIndex(), f.NewIndex(), index.WithHash(f.IndexHash()), index.WithVerify(f.IndexVerify()))
+	if err != nil || !f.IndexVerify() {
+		return fileIndex, err
+	}
+	removed, err := fileIndex.Verify(fs)
+	if err != nil {
+		fileIndex.Close()
+		return nil, fmt.Errorf("failed to verify file index: %w", err)
+	}
+	slog.Info("Verified file index", "removed", removed)
+	return fileIndex, nil
 }
@@ -0,0 +1,25 @@
+package flag
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	Provenance     = "provenance"
+	ProvenanceHelp = `write a metadata record documenting the source of each input file.
+The record holds the path, size and sha256 digest of the input file, the software,
+the repairs applied and the validation errors found. Every converted record refers
+to it with the WARC-Provenance-ID header field.`
+)
+
+type ProvenanceFlags struct {
+}
+
+func (f ProvenanceFlags) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool(Provenance, false, ProvenanceHelp)
+}
+
+func (f ProvenanceFlags) Provenance() bool {
+	return viper.GetBool(Provenance)
+}
@@ -38,3 +38,17 @@ func (r RepairFlags) ToWarcRecordOptions() []gowarc.WarcRecordOption {
 		gowarc.WithFixWarcFieldsBlockErrors(true),
 	}
 }
+
+// Repairs describes the repairs done by the options returned by ToWarcRecordOptions.
+func (r RepairFlags) Repairs() []string {
+	if !r.Repair() {
+		return nil
+	}
+	return []string{
+		"fixed syntax errors",
+		"fixed WARC-fields block errors",
+		"added missing and fixed wrong digests",
+		"added missing and fixed wrong Content-Length",
+		"added missing WARC-Record-ID",
+	}
+}
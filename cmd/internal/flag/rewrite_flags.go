@@ -0,0 +1,42 @@
+package flag
+
+import (
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/rewrite"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	Rules     = "rules"
+	RulesHelp = `YAML file with rules rewriting WARC and HTTP header fields of matching records before they are written.
+Each rule has a match (record-type, warc-header, http-header, missing-warc-header, missing-http-header)
+and a list of actions (set, delete, rename, replace, shift-time) applied to the WARC or HTTP header.`
+
+	DryRun     = "dry-run"
+	DryRunHelp = `list the records affected by the rules and the rules applied to them without writing any files`
+)
+
+type RewriteFlags struct {
+}
+
+func (f RewriteFlags) AddFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.String(Rules, "", RulesHelp)
+	flags.Bool(DryRun, false, DryRunHelp)
+}
+
+func (f RewriteFlags) Rules() string {
+	return viper.GetString(Rules)
+}
+
+func (f RewriteFlags) DryRun() bool {
+	return viper.GetBool(DryRun)
+}
+
+// ToRules loads the rules file, or returns nil if no rules file is given.
+func (f RewriteFlags) ToRules() (*rewrite.Rules, error) {
+	if f.Rules() == "" {
+		return nil, nil
+	}
+	return rewrite.Load(f.Rules())
+}
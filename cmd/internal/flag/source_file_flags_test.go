@@ -0,0 +1,76 @@
+package flag
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSrcFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		null     bool
+		expected []SrcFile
+		wantErr  bool
+	}{
+		{
+			name:  "lines",
+			input: "# comment\na.warc\r\n\n  \nb.warc\t1234\nc.warc\t0\t1\n",
+			expected: []SrcFile{
+				{Path: "a.warc"},
+				{Path: "b.warc", Offset: 1234, HasOffset: true},
+				{Path: "c.warc", HasOffset: true, Count: 1},
+			},
+		},
+		{
+			name:     "null",
+			input:    "a b.warc\x00#c\td.warc\x00\x00e.warc",
+			null:     true,
+			expected: []SrcFile{{Path: "a b.warc"}, {Path: "#c\td.warc"}, {Path: "e.warc"}},
+		},
+		{name: "invalid offset", input: "a.warc\tx\n", wantErr: true},
+		{name: "too many fields", input: "a.warc\t1\t2\t3\n", wantErr: true},
+		{name: "zero count", input: "a.warc\t1\t0\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSrcFiles(strings.NewReader(tt.input), tt.null)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadSrcFileListRejectsOffsets(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(name, []byte("a.warc\nb.warc\t1234\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if paths, err := ReadSrcFileList(name); err == nil {
+		t.Errorf("expected error for a line with an offset, got %v", paths)
+	}
+
+	if err := os.WriteFile(name, []byte("a.warc\nb.warc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := ReadSrcFileList(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{"a.warc", "b.warc"}) {
+		t.Errorf("expected [a.warc b.warc], got %v", paths)
+	}
+}
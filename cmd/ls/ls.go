@@ -113,7 +113,7 @@ func (f ListFlags) ToListOptions() (*ListOptions, error) {
 	}
 
 	opts := f.WarcRecordOptionFlags.ToWarcRecordOptions()
-	if !f.WarcRecordOptionFlags.StrictValidation() && !fieldsNeedParsedBlock(f.Fields()) {
+	if !f.WarcRecordOptionFlags.StrictValidation() && !FieldsNeedParsedBlock(f.Fields()) {
 		opts = append(opts, gowarc.WithSkipParseBlock())
 	}
 
@@ -200,37 +200,33 @@ func (o *ListOptions) Run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
+	defer o.fileWalker.Close()
+
 	workerPool := workerpool.New(ctx, o.concurrency)
 	defer workerPool.CloseWait()
 
-	for _, path := range o.paths {
-		err := o.fileWalker.Walk(ctx, path, func(fs afero.Fs, path string, err error) error {
-			if err != nil {
-				return err
-			}
-
-			workerPool.Submit(func() {
-				err := o.handleFile(ctx, fs, path)
-				if err != nil {
-					if !o.continueOnError {
-						cancel()
-					}
-					var recordErr warc.RecordError
-					if errors.As(err, &recordErr) {
-						slog.Error(recordErr.Error(), "path", path, "offset", recordErr.Offset())
-					} else {
-						slog.Error(err.Error(), "path", path)
-					}
-				}
-			})
-
-			return nil
-		})
+	return o.fileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
 		if err != nil {
 			return err
 		}
-	}
-	return nil
+
+		workerPool.Submit(func() {
+			err := o.handleFile(ctx, fs, path)
+			if err != nil {
+				if !o.continueOnError {
+					cancel()
+				}
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error(recordErr.Error(), "path", path, "offset", recordErr.Offset())
+				} else {
+					slog.Error(err.Error(), "path", path)
+				}
+			}
+		})
+
+		return nil
+	})
 }
 
 // listFile reads a warc file and writes the records to the output
@@ -239,7 +235,7 @@ func (o *ListOptions) handleFile(ctx context.Context, fs afero.Fs, path string)
 	if err != nil {
 		return err
 	}
-	warcFileReader, err := gowarc.NewWarcFileReaderFromStream(f, o.offset, o.warcRecordOptions...)
+	warcFileReader, err := warc.NewReaderFromStream(f, o.offset, o.warcRecordOptions...)
 	if err != nil {
 		return err
 	}
@@ -29,7 +29,8 @@ func selectedFields(format string) []byte {
 	return fields
 }
 
-func fieldsNeedParsedBlock(format string) bool {
+// FieldsNeedParsedBlock reports whether any of the fields in format is read from the HTTP header.
+func FieldsNeedParsedBlock(format string) bool {
 	for _, field := range selectedFields(format) {
 		switch field {
 		case 'm', 's':
@@ -0,0 +1,590 @@
+package recompress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warczstd"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = warcwriterconfig.CompressionGzip
+	compressionZstd = warcwriterconfig.CompressionZstd
+)
+
+type RecompressOptions struct {
+	paths              []string
+	concurrency        int
+	minWARCDiskFree    int64
+	continueOnError    bool
+	compression        string
+	warcRecordOptions  []gowarc.WarcRecordOption
+	warcWriterConfig   *warcwriterconfig.WarcWriterConfig
+	fileWalker         *filewalker.FileWalker
+	fileIndex          *index.FileIndex
+	openInputFileHook  hooks.OpenInputFileHook
+	closeInputFileHook hooks.CloseInputFileHook
+	outputFiles        sync.Map
+	size               atomic.Int64
+	newSize            atomic.Int64
+}
+
+type RecompressFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	IndexFlags            flag.IndexFlags
+	WarcWriterConfigFlags *flag.WarcWriterConfigFlags
+	OutputHookFlags       *flag.OutputHookFlags
+	InputHookFlags        *flag.InputHookFlags
+	UtilFlags             flag.UtilFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewRecompressFlags() RecompressFlags {
+	return RecompressFlags{
+		OutputHookFlags:       &flag.OutputHookFlags{},
+		InputHookFlags:        &flag.InputHookFlags{},
+		WarcWriterConfigFlags: &flag.WarcWriterConfigFlags{},
+	}
+}
+
+func (f RecompressFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".warc", ".warc.gz", ".warc.zst"}))
+	f.IndexFlags.AddFlags(cmd)
+	f.WarcWriterConfigFlags.AddFlags(cmd, flag.WithDefaultOneToOne(true))
+	f.OutputHookFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.UtilFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+	cmd.Flags().String(flag.TempDir, os.TempDir(), flag.TempDirHelp)
+}
+
+func (f RecompressFlags) ToRecompressOptions() (*RecompressOptions, error) {
+	if !f.WarcWriterConfigFlags.OneToOne() {
+		return nil, fmt.Errorf("recompress requires --%s", flag.OneToOne)
+	}
+	// records are copied as they are, a new warcinfo record would change the content of the file
+	if f.WarcWriterConfigFlags.WarcInfoTemplate() != "" {
+		return nil, fmt.Errorf("recompress does not support --%s", flag.WarcInfoTemplate)
+	}
+	wwc, err := f.WarcWriterConfigFlags.ToWarcWriterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warc writer config: %w", err)
+	}
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+
+	compression := compressionNone
+	if wwc.Compress {
+		compression = wwc.CompressionFormat
+	}
+
+	return &RecompressOptions{
+		concurrency:      f.ConcurrencyFlags.Concurrency(),
+		minWARCDiskFree:  f.UtilFlags.MinFreeDisk(),
+		compression:      compression,
+		warcWriterConfig: wwc,
+		fileWalker:       fileWalker,
+		// records are copied as they are, so there is nothing to gain from parsing or validating them
+		warcRecordOptions: []gowarc.WarcRecordOption{
+			gowarc.WithBufferTmpDir(viper.GetString(flag.TempDir)),
+			gowarc.WithNoValidation(),
+			gowarc.WithSkipParseBlock(),
+		},
+		paths:              fileList,
+		fileIndex:          fileIndex,
+		openInputFileHook:  openInputFileHook,
+		closeInputFileHook: closeInputFileHook,
+		continueOnError:    f.ErrorFlags.ContinueOnError(),
+	}, nil
+}
+
+func NewCmdRecompress() *cobra.Command {
+	flags := NewRecompressFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "recompress FILE/DIR ...",
+		Short: "Recompress WARC files with one compressed member per record",
+		Long: `Recompress WARC files so that every record is compressed on its own.
+
+WARC files compressed as a whole, or with several records in each gzip member, can only be
+read from the start. Recompressing them with one gzip member (or zstd frame) per record makes
+every record accessible by its offset, which is what indexes and replay tools depend on.
+
+Files already compressed one record at a time in the requested format are skipped. Records are
+copied unchanged. After a file is written it is read back and the number of records and a digest
+of their ids and content are compared with the source. The size of the source and the output, and
+the number of records per compressed member of the source, are reported for every file.
+
+Output files are named after the source files, so use --output-dir or --prefix to avoid
+overwriting the sources.`,
+		Example: `  # Recompress whole-file gzipped WARC files to per-record gzip
+  warc recompress -w out/ in/
+
+  # Recompress to per-record zstd with a dictionary trained on the first records
+  warc recompress -w out/ --compression-format zstd --zstd-train-dictionary 1000 in/`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToRecompressOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *RecompressOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.paths = append(o.paths, args...)
+	o.warcWriterConfig.OutputFileFunc = func(srcFileName string, fileName string, size int64) {
+		o.outputFiles.Store(srcFileName, outputFile{name: fileName, size: size})
+	}
+	return nil
+}
+
+func (o *RecompressOptions) Validate() error {
+	if len(o.paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	return nil
+}
+
+func (o *RecompressOptions) Run() error {
+	done := make(chan struct{})
+	exitCode := 0
+
+	defer func() {
+		<-done
+		os.Exit(exitCode)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	results := make(chan stat.Result)
+	go func() {
+		defer close(done)
+
+		stats := stat.NewStats()
+		defer func() {
+			slog.Info("Total", "files", stats.Files, "errors", stats.Errors, "records", stats.Records,
+				"size", o.size.Load(), "newSize", o.newSize.Load())
+		}()
+
+		for result := range results {
+			slog := slog.With("path", result.Name())
+			for _, err := range result.Errors() {
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error("Recompress error", "error", recordErr.Error(), "offset", recordErr.Offset())
+				} else {
+					slog.Error("Recompress error", "error", err.Error())
+				}
+			}
+			stats.Merge(result)
+		}
+		if stats.Errors > 0 {
+			exitCode = 1
+		}
+	}()
+	defer close(results)
+
+	if o.fileIndex != nil {
+		defer o.fileIndex.Close()
+	}
+	defer o.warcWriterConfig.Close()
+
+	defer o.fileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.concurrency)
+	defer workerPool.CloseWait()
+
+	return o.fileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.minWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.warcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.warcWriterConfig.OutDir, "error", err)
+					return
+				}
+				if diskFree < o.minWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.warcWriterConfig.OutDir)
+					return
+				}
+			}
+
+			result, err := filewalker.Preposterous(fs, path, o.openInputFileHook, o.closeInputFileHook, o.fileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			}
+			if err != nil {
+				if !o.continueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
+
+			results <- result
+		})
+
+		return nil
+	})
+}
+
+type outputFile struct {
+	name string
+	size int64
+}
+
+// scanResult describes the records of a WARC file.
+type scanResult struct {
+	compression string
+	size        int64
+	records     int64
+	// members is the number of gzip members or zstd frames in the file
+	members int64
+	digest  []byte
+}
+
+// perRecord reports whether every record of the file is compressed on its own.
+func (s scanResult) perRecord() bool {
+	return s.compression != compressionNone && s.records == s.members
+}
+
+func (o *RecompressOptions) handleFile(fs afero.Fs, path string) (stat.Result, error) {
+	result := stat.NewResult(path)
+
+	source, err := o.scan(fs, path)
+	if err != nil {
+		return result, err
+	}
+	slog := slog.With("path", path, "records", source.records, "compression", source.compression)
+	if source.compression == o.compression && (source.perRecord() || source.compression == compressionNone) {
+		slog.Info("Skipped file already compressed per record")
+		return nil, filewalker.ErrSkipFile
+	}
+	if err := o.assertNotSource(path); err != nil {
+		return result, err
+	}
+
+	err = o.recompress(fs, path, result)
+	value, ok := o.outputFiles.LoadAndDelete(path)
+	if !ok {
+		if err == nil {
+			err = errors.New("no output file was written")
+		}
+		return result, err
+	}
+	// an output file written to a remote output directory is uploaded when complete, so it is
+	// read back and removed where it ended up
+	output := value.(outputFile)
+	outputFs, name, fsErr := o.warcWriterConfig.OutputFs(output.name)
+	if fsErr != nil {
+		return result, errors.Join(err, fsErr)
+	}
+	if err != nil {
+		_ = outputFs.Remove(name)
+		return result, err
+	}
+	recompressed, err := o.verify(outputFs, name, source)
+	if err != nil {
+		_ = outputFs.Remove(name)
+		return result, err
+	}
+
+	o.size.Add(source.size)
+	o.newSize.Add(output.size)
+	recordsPerMember := float64(source.records)
+	if source.members > 0 {
+		recordsPerMember /= float64(source.members)
+	}
+	slog.Info("Recompressed file", "output", output.name, "newCompression", recompressed.compression,
+		"recordsPerMember", fmt.Sprintf("%.1f", recordsPerMember), "size", source.size, "newSize", output.size,
+		"change", fmt.Sprintf("%+.1f%%", percentChange(source.size, output.size)))
+
+	return result, nil
+}
+
+// assertNotSource fails if the output file would overwrite the source file.
+func (o *RecompressOptions) assertNotSource(path string) error {
+	overwrites, err := o.warcWriterConfig.OverwritesSource(path)
+	if err != nil {
+		return err
+	}
+	if overwrites {
+		return fmt.Errorf("output would overwrite the source file, use --%s or --%s", flag.OutputDir, flag.FilePrefix)
+	}
+	return nil
+}
+
+// verify reads back the output file and compares its records with the records of the source.
+func (o *RecompressOptions) verify(fs afero.Fs, name string, source scanResult) (scanResult, error) {
+	recompressed, err := o.scan(fs, name)
+	if err != nil {
+		return recompressed, fmt.Errorf("failed to read back %s: %w", name, err)
+	}
+	if recompressed.records != source.records {
+		return recompressed, fmt.Errorf("%s has %d records, the source has %d", name, recompressed.records, source.records)
+	}
+	if !bytes.Equal(recompressed.digest, source.digest) {
+		return recompressed, fmt.Errorf("the records of %s do not match the records of the source", name)
+	}
+	return recompressed, nil
+}
+
+// recompress copies the records of the file at path to the WARC writer. The writer is closed
+// also on errors, so that the partial output file can be removed.
+func (o *RecompressOptions) recompress(fs afero.Fs, path string, result stat.Result) (err error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	warcFileReader, err := warc.NewReaderFromStream(file, 0, o.warcRecordOptions...)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to create warc file reader: %w", err)
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	var writer warcwriterconfig.WarcWriter
+	defer func() {
+		if writer != nil && err != nil {
+			_ = writer.Close()
+		}
+	}()
+	for record, err := range warcFileReader.Records() {
+		if err != nil {
+			return warc.ErrorFrom(record, err)
+		}
+		if writer == nil {
+			warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+			if err != nil {
+				warcDate = o.warcWriterConfig.DefaultTime
+			}
+			writer, err = o.warcWriterConfig.GetWarcWriter(path, warcDate)
+			if err != nil {
+				_ = record.Close()
+				return warc.ErrorFrom(record, err)
+			}
+		}
+		result.IncrRecords()
+		writeResponse := writer.Write(record.WarcRecord)
+		_ = record.Close()
+		if len(writeResponse) > 0 && writeResponse[0].Err != nil {
+			return warc.ErrorFrom(record, writeResponse[0].Err)
+		}
+	}
+	if writer == nil {
+		return errors.New("no records found")
+	}
+	closeErr := writer.Close()
+	writer = nil
+	return closeErr
+}
+
+// scan reads all records of the file at path. The gzip members or zstd frames are counted from a
+// copy of the bytes read by the WARC reader, so the file is only read once.
+func (o *RecompressOptions) scan(fs afero.Fs, path string) (s scanResult, err error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return s, err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return s, err
+	}
+	s.size = info.Size()
+
+	var magic [4]byte
+	n, _ := io.ReadFull(file, magic[:])
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return s, err
+	}
+	s.compression = detectCompression(magic[:n])
+
+	pr, pw := io.Pipe()
+	var members int64
+	counted := make(chan error, 1)
+	go func() {
+		var err error
+		members, err = countMembers(pr, s.compression)
+		// keep consuming, so that reading the records never blocks
+		_, _ = io.Copy(io.Discard, pr)
+		counted <- err
+	}()
+	defer func() {
+		_ = pw.CloseWithError(err)
+		countErr := <-counted
+		if err == nil && countErr != nil {
+			err = fmt.Errorf("failed to count compressed members: %w", countErr)
+		}
+		s.members = members
+	}()
+
+	tee := io.TeeReader(file, pw)
+	warcFileReader, err := warc.NewReaderFromStream(tee, 0, o.warcRecordOptions...)
+	if err != nil {
+		return s, fmt.Errorf("failed to create warc file reader: %w", err)
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	digest := sha256.New()
+	for record, err := range warcFileReader.Records() {
+		if err != nil {
+			return s, warc.ErrorFrom(record, err)
+		}
+		s.records++
+		err := digestRecord(digest, record.WarcRecord)
+		_ = record.Close()
+		if err != nil {
+			return s, warc.ErrorFrom(record, err)
+		}
+	}
+	// pass on data after the last record, which the WARC reader may leave unread
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return s, err
+	}
+	s.digest = digest.Sum(nil)
+	return s, nil
+}
+
+// countMembers returns the number of gzip members or zstd frames read from r.
+func countMembers(r io.Reader, compression string) (int64, error) {
+	switch compression {
+	case compressionGzip:
+		br := bufio.NewReader(r)
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		var members int64
+		for {
+			gz.Multistream(false)
+			if _, err := io.Copy(io.Discard, gz); err != nil {
+				return members, err
+			}
+			members++
+			if err := gz.Reset(br); errors.Is(err, io.EOF) {
+				return members, nil
+			} else if err != nil {
+				return members, err
+			}
+		}
+	case compressionZstd:
+		return warczstd.CountFrames(r)
+	default:
+		return 0, nil
+	}
+}
+
+// digestRecord adds the id and block of a record to digest.
+func digestRecord(digest hash.Hash, warcRecord gowarc.WarcRecord) error {
+	_, _ = io.WriteString(digest, warcRecord.RecordId())
+	block, err := warcRecord.Block().RawBytes()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(digest, block)
+	return err
+}
+
+func detectCompression(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return compressionGzip
+	case warczstd.IsZstd(magic):
+		return compressionZstd
+	default:
+		return compressionNone
+	}
+}
+
+func percentChange(size, newSize int64) float64 {
+	if size == 0 {
+		return 0
+	}
+	return float64(newSize-size) / float64(size) * 100
+}
@@ -0,0 +1,177 @@
+package recompress
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipMembers(t *testing.T, members ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, member := range members {
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write([]byte(member))
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+	}
+	return buf.Bytes()
+}
+
+func zstdFrames(t *testing.T, frames ...string) []byte {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer func() { _ = encoder.Close() }()
+	var b []byte
+	for _, frame := range frames {
+		b = encoder.EncodeAll([]byte(frame), b)
+	}
+	return b
+}
+
+func TestCountMembers(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     []byte
+		compression string
+		want        int64
+	}{
+		{"whole file gzip", gzipMembers(t, "WARC/1.1\r\n\r\n\r\n\r\nWARC/1.1\r\n\r\n\r\n\r\n"), compressionGzip, 1},
+		{"gzip per record", gzipMembers(t, "WARC/1.1\r\n\r\n\r\n\r\n", "WARC/1.1\r\n\r\n\r\n\r\n"), compressionGzip, 2},
+		{"zstd per record", zstdFrames(t, "WARC/1.1\r\n\r\n\r\n\r\n", "WARC/1.1\r\n\r\n\r\n\r\n"), compressionZstd, 2},
+		{"uncompressed", []byte("WARC/1.1\r\n\r\n\r\n\r\n"), compressionNone, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.compression, detectCompression(tt.content[:4]))
+
+			members, err := countMembers(bytes.NewReader(tt.content), tt.compression)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, members)
+		})
+	}
+}
+
+func TestScanResultPerRecord(t *testing.T) {
+	assert.True(t, scanResult{compression: compressionGzip, records: 3, members: 3}.perRecord())
+	assert.False(t, scanResult{compression: compressionGzip, records: 3, members: 1}.perRecord())
+	assert.False(t, scanResult{compression: compressionNone, records: 3}.perRecord())
+}
+
+func testRecords(n int) string {
+	var records strings.Builder
+	for i := range n {
+		content := fmt.Sprintf("content of record %d", i)
+		fmt.Fprintf(&records, "WARC/1.1\r\n"+
+			"WARC-Type: resource\r\n"+
+			"WARC-Record-ID: <urn:uuid:00000000-0000-0000-0000-%012d>\r\n"+
+			"WARC-Date: 2024-01-01T00:00:00Z\r\n"+
+			"WARC-Target-URI: http://example.com/%d\r\n"+
+			"Content-Type: text/plain\r\n"+
+			"Content-Length: %d\r\n"+
+			"\r\n%s\r\n\r\n", i, i, len(content), content)
+	}
+	return records.String()
+}
+
+func TestRecompressWholeFileGzipToPerRecord(t *testing.T) {
+	inDir := t.TempDir()
+	outDir := t.TempDir()
+	src := filepath.Join(inDir, "test.warc.gz")
+	require.NoError(t, os.WriteFile(src, gzipMembers(t, testRecords(3)), 0o644))
+
+	wwc, err := warcwriterconfig.New("recompress",
+		warcwriterconfig.WithOutDir(outDir),
+		warcwriterconfig.WithOneToOneWriter(true),
+		warcwriterconfig.WithBufferTmpDir(t.TempDir()))
+	require.NoError(t, err)
+	o := &RecompressOptions{
+		compression:      compressionGzip,
+		warcWriterConfig: wwc,
+		warcRecordOptions: []gowarc.WarcRecordOption{
+			gowarc.WithBufferTmpDir(t.TempDir()),
+			gowarc.WithNoValidation(),
+			gowarc.WithSkipParseBlock(),
+		},
+	}
+	require.NoError(t, o.Complete(nil, nil))
+
+	source, err := o.scan(afero.NewOsFs(), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), source.records)
+	assert.Equal(t, int64(1), source.members)
+
+	result, err := o.handleFile(afero.NewOsFs(), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.Records())
+
+	outputs, err := filepath.Glob(filepath.Join(outDir, "*"))
+	require.NoError(t, err)
+	require.Len(t, outputs, 1)
+	recompressed, err := o.scan(afero.NewOsFs(), outputs[0])
+	require.NoError(t, err)
+	assert.Equal(t, compressionGzip, recompressed.compression)
+	assert.True(t, recompressed.perRecord(), "every record should be compressed on its own")
+	assert.Equal(t, source.digest, recompressed.digest)
+
+	// the output is skipped when recompressed again
+	_, err = o.handleFile(afero.NewOsFs(), outputs[0])
+	assert.ErrorIs(t, err, filewalker.ErrSkipFile)
+}
+
+func TestRecompressToRemoteOutput(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "test.warc.gz")
+	require.NoError(t, os.WriteFile(src, gzipMembers(t, testRecords(3)), 0o644))
+
+	remoteFs := afero.NewMemMapFs()
+	wwc, err := warcwriterconfig.New("recompress",
+		warcwriterconfig.WithOutDir("mem://out"),
+		warcwriterconfig.WithOutputFs(remoteFs),
+		warcwriterconfig.WithOneToOneWriter(true),
+		warcwriterconfig.WithBufferTmpDir(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { _ = wwc.Close() }()
+	o := &RecompressOptions{
+		compression:      compressionGzip,
+		warcWriterConfig: wwc,
+		warcRecordOptions: []gowarc.WarcRecordOption{
+			gowarc.WithBufferTmpDir(t.TempDir()),
+			gowarc.WithNoValidation(),
+			gowarc.WithSkipParseBlock(),
+		},
+	}
+	require.NoError(t, o.Complete(nil, nil))
+
+	source, err := o.scan(afero.NewOsFs(), src)
+	require.NoError(t, err)
+
+	// the output file is verified after it is uploaded and removed from the staging directory
+	result, err := o.handleFile(afero.NewOsFs(), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.Records())
+
+	outputs, err := afero.Glob(remoteFs, "*")
+	require.NoError(t, err)
+	require.Len(t, outputs, 1)
+	recompressed, err := o.scan(remoteFs, outputs[0])
+	require.NoError(t, err)
+	assert.True(t, recompressed.perRecord(), "every record should be compressed on its own")
+	assert.Equal(t, source.digest, recompressed.digest)
+
+	staged, err := filepath.Glob(filepath.Join(wwc.OutDir, "*"))
+	require.NoError(t, err)
+	assert.Empty(t, staged)
+}
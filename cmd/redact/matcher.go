@@ -0,0 +1,147 @@
+package redact
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+const (
+	matchedByUrl        = "url"
+	matchedByUrlPattern = "url-pattern"
+	matchedById         = "id"
+	matchedByDigest     = "digest"
+)
+
+// matcher selects the records to redact.
+type matcher struct {
+	urls        map[string]bool
+	urlPrefixes []string
+	urlPattern  *regexp.Regexp
+	ids         map[string]bool
+	digests     map[string]bool
+}
+
+func newMatcher() *matcher {
+	return &matcher{
+		urls:    make(map[string]bool),
+		ids:     make(map[string]bool),
+		digests: make(map[string]bool),
+	}
+}
+
+// addUrl adds a URL to redact. A URL ending with '*' matches all URLs starting with the rest.
+func (m *matcher) addUrl(url string) {
+	if prefix, ok := strings.CutSuffix(url, "*"); ok {
+		m.urlPrefixes = append(m.urlPrefixes, prefix)
+	} else {
+		m.urls[url] = true
+	}
+}
+
+func (m *matcher) addId(id string) {
+	m.ids[normalizeId(id)] = true
+}
+
+func (m *matcher) addDigest(digest string) {
+	m.digests[strings.ToLower(digest)] = true
+}
+
+// add adds an entry of a redaction list, which is a record ID, a digest or a URL.
+func (m *matcher) add(entry string) {
+	switch {
+	case strings.HasPrefix(entry, "<urn:") || strings.HasPrefix(entry, "urn:"):
+		m.addId(entry)
+	case isDigest(entry):
+		m.addDigest(entry)
+	default:
+		m.addUrl(entry)
+	}
+}
+
+// addList adds the entries of a redaction list file with one entry per line. Empty lines and lines
+// starting with '#' are ignored.
+func (m *matcher) addList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open redaction list: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m.add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read redaction list: %w", err)
+	}
+	return nil
+}
+
+func (m *matcher) empty() bool {
+	return len(m.urls) == 0 && len(m.urlPrefixes) == 0 && m.urlPattern == nil && len(m.ids) == 0 && len(m.digests) == 0
+}
+
+// match returns what matched the record, or an empty string if the record is not redacted.
+// The warcinfo records describing the files are never redacted.
+func (m *matcher) match(record gowarc.WarcRecord) string {
+	return m.matchHeader(record.Type(), record.WarcHeader().Get)
+}
+
+// matchHeader matches the record type and WARC header fields of a record, given by get.
+func (m *matcher) matchHeader(recordType gowarc.RecordType, get func(name string) string) string {
+	if recordType == gowarc.Warcinfo {
+		return ""
+	}
+	if len(m.ids) > 0 && m.ids[normalizeId(get(gowarc.WarcRecordID))] {
+		return matchedById
+	}
+	if len(m.digests) > 0 {
+		for _, name := range []string{gowarc.WarcPayloadDigest, gowarc.WarcBlockDigest} {
+			if digest := get(name); digest != "" && m.digests[strings.ToLower(digest)] {
+				return matchedByDigest
+			}
+		}
+	}
+	uri := get(gowarc.WarcTargetURI)
+	if uri == "" {
+		return ""
+	}
+	if m.urls[uri] {
+		return matchedByUrl
+	}
+	for _, prefix := range m.urlPrefixes {
+		if strings.HasPrefix(uri, prefix) {
+			return matchedByUrl
+		}
+	}
+	if m.urlPattern != nil && m.urlPattern.MatchString(uri) {
+		return matchedByUrlPattern
+	}
+	return ""
+}
+
+func normalizeId(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "<>")
+}
+
+// isDigest reports whether s is a labelled digest like 'sha1:AB12...'.
+func isDigest(s string) bool {
+	algorithm, value, ok := strings.Cut(s, ":")
+	if !ok || value == "" {
+		return false
+	}
+	switch strings.ToLower(algorithm) {
+	case "md5", "sha1", "sha-1", "sha256", "sha-256", "sha512", "sha-512":
+		return !strings.Contains(value, "/")
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package redact
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+func TestMatcher(t *testing.T) {
+	list := "# takedown 2024-17\nhttp://example.com/a\n\n<urn:uuid:2b3c4d5e-0000-4000-8000-000000000001>\nsha1:ABCDEFGHIJKLMNOPQRSTUVWXYZ234567\nhttp://example.com/private/*\n"
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newMatcher()
+	if err := m.addList(path); err != nil {
+		t.Fatal(err)
+	}
+	m.urlPattern = regexp.MustCompile(`^https://secret\.`)
+
+	tests := []struct {
+		name       string
+		recordType gowarc.RecordType
+		header     map[string]string
+		want       string
+	}{
+		{"url", gowarc.Response, map[string]string{gowarc.WarcTargetURI: "http://example.com/a"}, matchedByUrl},
+		{"url prefix", gowarc.Request, map[string]string{gowarc.WarcTargetURI: "http://example.com/private/b"}, matchedByUrl},
+		{"url pattern", gowarc.Response, map[string]string{gowarc.WarcTargetURI: "https://secret.example.com/"}, matchedByUrlPattern},
+		{"id", gowarc.Metadata, map[string]string{gowarc.WarcRecordID: "<urn:uuid:2b3c4d5e-0000-4000-8000-000000000001>"}, matchedById},
+		{"payload digest", gowarc.Revisit, map[string]string{gowarc.WarcPayloadDigest: "sha1:abcdefghijklmnopqrstuvwxyz234567"}, matchedByDigest},
+		{"no match", gowarc.Response, map[string]string{gowarc.WarcTargetURI: "http://example.com/b"}, ""},
+		{"warcinfo", gowarc.Warcinfo, map[string]string{gowarc.WarcTargetURI: "http://example.com/a"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			get := func(name string) string { return tt.header[name] }
+			if got := m.matchHeader(tt.recordType, get); got != tt.want {
+				t.Errorf("matchHeader() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDigest(t *testing.T) {
+	for s, want := range map[string]bool{
+		"sha1:ABCDEFGHIJKLMNOPQRSTUVWXYZ234567": true,
+		"sha256:0123abcd":                       true,
+		"http://example.com/":                   false,
+		"sha1:":                                 false,
+		"urn:uuid:1234":                         false,
+	} {
+		if got := isDigest(s); got != want {
+			t.Errorf("isDigest(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,597 @@
+package redact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/rewrite"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	RedactUrl     = "url"
+	RedactUrlHelp = `redact records with this target URI; a URI ending with '*' matches all URIs starting with the rest.
+Repeat the flag or use a comma-separated list`
+
+	RedactUrlPattern     = "url-pattern"
+	RedactUrlPatternHelp = `redact records with a target URI matching this regular expression`
+
+	RedactId     = "id"
+	RedactIdHelp = `redact records with this record ID; repeat the flag or use a comma-separated list`
+
+	RedactDigest     = "digest"
+	RedactDigestHelp = `redact records with this payload or block digest, e.g. 'sha1:ABC...'; repeat the flag or use a comma-separated list`
+
+	RedactList     = "list"
+	RedactListHelp = `file with one URI, record ID or digest to redact per line. Lines starting with '#' are ignored`
+
+	Mode     = "mode"
+	ModeHelp = `how matching records are redacted. One of:
+	tombstone - replace the record with a metadata record referring to it and holding the reason
+	truncate  - keep the record with its WARC and HTTP header, but without payload`
+
+	Reason     = "reason"
+	ReasonHelp = `reason for the redaction, kept in tombstones and in the audit log`
+
+	AuditLog     = "audit-log"
+	AuditLogHelp = `file the redacted records are listed in as JSON lines. A relative path is relative to the output directory,
+or to the working directory when the output directory is remote`
+
+	modeTombstone = "tombstone"
+	modeTruncate  = "truncate"
+)
+
+type RedactOptions struct {
+	paths                []string
+	concurrency          int
+	minWARCDiskFree      int64
+	continueOnError      bool
+	matcher              *matcher
+	mode                 string
+	reason               string
+	auditLogPath         string
+	auditLog             *auditLog
+	warcRecordOptions    []gowarc.WarcRecordOption
+	recordBuilderOptions []gowarc.WarcRecordOption
+	warcWriterConfig     *warcwriterconfig.WarcWriterConfig
+	fileWalker           *filewalker.FileWalker
+	fileIndex            *index.FileIndex
+	openInputFileHook    hooks.OpenInputFileHook
+	closeInputFileHook   hooks.CloseInputFileHook
+}
+
+type RedactFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	IndexFlags            flag.IndexFlags
+	WarcWriterConfigFlags *flag.WarcWriterConfigFlags
+	OutputHookFlags       *flag.OutputHookFlags
+	InputHookFlags        *flag.InputHookFlags
+	UtilFlags             flag.UtilFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewRedactFlags() RedactFlags {
+	return RedactFlags{
+		OutputHookFlags:       &flag.OutputHookFlags{},
+		InputHookFlags:        &flag.InputHookFlags{},
+		WarcWriterConfigFlags: &flag.WarcWriterConfigFlags{},
+	}
+}
+
+func (f RedactFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".warc", ".warc.gz", ".warc.zst"}))
+	f.IndexFlags.AddFlags(cmd)
+	f.WarcWriterConfigFlags.AddFlags(cmd, flag.WithDefaultOneToOne(true))
+	f.OutputHookFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.UtilFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+
+	flags := cmd.Flags()
+	flags.String(flag.TempDir, os.TempDir(), flag.TempDirHelp)
+	flags.StringSlice(RedactUrl, nil, RedactUrlHelp)
+	flags.String(RedactUrlPattern, "", RedactUrlPatternHelp)
+	flags.StringSlice(RedactId, nil, RedactIdHelp)
+	flags.StringSlice(RedactDigest, nil, RedactDigestHelp)
+	flags.String(RedactList, "", RedactListHelp)
+	flags.String(Mode, modeTombstone, ModeHelp)
+	flags.String(Reason, "", ReasonHelp)
+	flags.String(AuditLog, "redactions.jsonl", AuditLogHelp)
+
+	if err := cmd.RegisterFlagCompletionFunc(Mode, flag.SliceCompletion{modeTombstone, modeTruncate}.CompletionFn); err != nil {
+		panic(err)
+	}
+}
+
+func (f RedactFlags) ToRedactOptions() (*RedactOptions, error) {
+	matcher := newMatcher()
+	for _, url := range viper.GetStringSlice(RedactUrl) {
+		matcher.addUrl(url)
+	}
+	for _, id := range viper.GetStringSlice(RedactId) {
+		matcher.addId(id)
+	}
+	for _, digest := range viper.GetStringSlice(RedactDigest) {
+		matcher.addDigest(digest)
+	}
+	if pattern := viper.GetString(RedactUrlPattern); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", RedactUrlPattern, err)
+		}
+		matcher.urlPattern = re
+	}
+	if list := viper.GetString(RedactList); list != "" {
+		if err := matcher.addList(list); err != nil {
+			return nil, err
+		}
+	}
+
+	wwc, err := f.WarcWriterConfigFlags.ToWarcWriterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warc writer config: %w", err)
+	}
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+
+	tmpDir := viper.GetString(flag.TempDir)
+	return &RedactOptions{
+		concurrency:      f.ConcurrencyFlags.Concurrency(),
+		minWARCDiskFree:  f.UtilFlags.MinFreeDisk(),
+		continueOnError:  f.ErrorFlags.ContinueOnError(),
+		matcher:          matcher,
+		mode:             viper.GetString(Mode),
+		reason:           viper.GetString(Reason),
+		auditLogPath:     viper.GetString(AuditLog),
+		warcWriterConfig: wwc,
+		// records that are not redacted are copied as they are
+		warcRecordOptions: []gowarc.WarcRecordOption{
+			gowarc.WithBufferTmpDir(tmpDir),
+			gowarc.WithNoValidation(),
+			gowarc.WithSkipParseBlock(),
+		},
+		recordBuilderOptions: []gowarc.WarcRecordOption{
+			gowarc.WithVersion(wwc.WarcVersion),
+			gowarc.WithBufferTmpDir(tmpDir),
+			gowarc.WithAddMissingDigest(true),
+			gowarc.WithAddMissingContentLength(true),
+			gowarc.WithAddMissingRecordId(true),
+		},
+		fileWalker:         fileWalker,
+		paths:              fileList,
+		fileIndex:          fileIndex,
+		openInputFileHook:  openInputFileHook,
+		closeInputFileHook: closeInputFileHook,
+	}, nil
+}
+
+func NewCmdRedact() *cobra.Command {
+	flags := NewRedactFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "redact FILE/DIR ...",
+		Short: "Copy WARC files with matching records redacted",
+		Long: `Copy WARC files, replacing the records matching a URI, record ID or digest.
+
+Matching records are replaced by a metadata record (tombstone) referring to the removed record
+and holding the reason for the redaction, or truncated to their WARC and HTTP header. Digests
+and lengths of the replaced records are computed anew. All other records are copied unchanged.
+Records are matched by their WARC-Target-URI, WARC-Record-ID, WARC-Payload-Digest or
+WARC-Block-Digest. Warcinfo records are never redacted.
+
+Every redacted record is listed in the audit log with the file and offset it was read from,
+what matched it and the reason.
+
+Output files are named after the source files, so use --output-dir or --prefix to avoid
+overwriting the sources.`,
+		Example: `  # Replace all records of a site with tombstones
+  warc redact -w out/ --url 'http://example.com/*' --reason 'takedown 2024-17' in/
+
+  # Truncate the records listed in a file
+  warc redact -w out/ --list takedown.txt --mode truncate --reason 'privacy' in/`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToRedactOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *RedactOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.paths = append(o.paths, args...)
+	// the output directory is a local staging directory when writing to remote storage
+	if !filepath.IsAbs(o.auditLogPath) && o.warcWriterConfig.OutputUrl == "" {
+		o.auditLogPath = filepath.Join(o.warcWriterConfig.OutDir, o.auditLogPath)
+	}
+	return nil
+}
+
+func (o *RedactOptions) Validate() error {
+	if len(o.paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	if o.matcher.empty() {
+		return fmt.Errorf("nothing to redact, use --%s, --%s, --%s, --%s or --%s", RedactUrl, RedactUrlPattern, RedactId, RedactDigest, RedactList)
+	}
+	if o.mode != modeTombstone && o.mode != modeTruncate {
+		return fmt.Errorf("unknown mode '%s', must be %s or %s", o.mode, modeTombstone, modeTruncate)
+	}
+	if o.reason == "" {
+		return fmt.Errorf("missing --%s", Reason)
+	}
+	return nil
+}
+
+func (o *RedactOptions) Run() error {
+	auditLog, err := openAuditLog(o.auditLogPath)
+	if err != nil {
+		return err
+	}
+	o.auditLog = auditLog
+
+	done := make(chan struct{})
+	exitCode := 0
+
+	defer func() {
+		<-done
+		if err := o.auditLog.Close(); err != nil {
+			slog.Error("Failed to close audit log", "path", o.auditLogPath, "error", err)
+			exitCode = 1
+		}
+		os.Exit(exitCode)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	results := make(chan stat.Result)
+	go func() {
+		defer close(done)
+
+		stats := stat.NewStats()
+		defer func() {
+			slog.Info("Total", "files", stats.Files, "errors", stats.Errors, "records", stats.Records,
+				"redacted", o.auditLog.count(), "auditLog", o.auditLogPath)
+		}()
+
+		for result := range results {
+			slog := slog.With("path", result.Name())
+			for _, err := range result.Errors() {
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error("Redact error", "error", recordErr.Error(), "offset", recordErr.Offset())
+				} else {
+					slog.Error("Redact error", "error", err.Error())
+				}
+			}
+			slog.Info("Redacted file", "errors", result.ErrorCount(), "records", result.Records())
+			stats.Merge(result)
+		}
+		if stats.Errors > 0 {
+			exitCode = 1
+		}
+	}()
+	defer close(results)
+
+	if o.fileIndex != nil {
+		defer o.fileIndex.Close()
+	}
+	defer o.warcWriterConfig.Close()
+
+	defer o.fileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.concurrency)
+	defer workerPool.CloseWait()
+
+	return o.fileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.minWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.warcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.warcWriterConfig.OutDir, "error", err)
+					return
+				}
+				if diskFree < o.minWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.warcWriterConfig.OutDir)
+					return
+				}
+			}
+
+			result, err := filewalker.Preposterous(fs, path, o.openInputFileHook, o.closeInputFileHook, o.fileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			}
+			if err != nil {
+				if !o.continueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
+
+			results <- result
+		})
+
+		return nil
+	})
+}
+
+func (o *RedactOptions) handleFile(fs afero.Fs, path string) (stat.Result, error) {
+	result := stat.NewResult(path)
+
+	overwrites, err := o.warcWriterConfig.OverwritesSource(path)
+	if err != nil {
+		return nil, err
+	}
+	if overwrites {
+		return nil, fmt.Errorf("output would overwrite the source file, use --%s or --%s", flag.OutputDir, flag.FilePrefix)
+	}
+
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	warcFileReader, err := warc.NewReaderFromStream(file, 0, o.warcRecordOptions...)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to create warc file reader: %w", err)
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	var writer warcwriterconfig.WarcWriter
+	if o.warcWriterConfig.OneToOneWriter {
+		defer func() {
+			if writer != nil {
+				_ = writer.Close()
+			}
+		}()
+	}
+
+	for record, err := range warcFileReader.Records() {
+		if err != nil {
+			return result, warc.ErrorFrom(record, err)
+		}
+		if writer == nil || !o.warcWriterConfig.OneToOneWriter {
+			warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+			if err != nil {
+				warcDate = o.warcWriterConfig.DefaultTime
+			}
+			writer, err = o.warcWriterConfig.GetWarcWriter(path, warcDate)
+			if err != nil {
+				_ = record.Close()
+				return result, warc.ErrorFrom(record, err)
+			}
+		}
+		err = o.handleRecord(writer, path, record, result)
+		if err != nil {
+			return result, warc.ErrorFrom(record, err)
+		}
+	}
+	return result, nil
+}
+
+func (o *RedactOptions) handleRecord(writer warcwriterconfig.WarcWriter, path string, record gowarc.Record, result stat.Result) error {
+	defer record.Close()
+
+	result.IncrRecords()
+
+	warcRecord := record.WarcRecord
+	matchedBy := o.matcher.match(warcRecord)
+	if matchedBy != "" {
+		var err error
+		if o.mode == modeTruncate {
+			warcRecord, err = o.truncate(warcRecord)
+		} else {
+			warcRecord, err = o.tombstone(warcRecord)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to redact record: %w", err)
+		}
+		defer func() { _ = warcRecord.Close() }()
+	}
+
+	if writeResponse := writer.Write(warcRecord); len(writeResponse) > 0 && writeResponse[0].Err != nil {
+		return writeResponse[0].Err
+	}
+
+	if matchedBy != "" {
+		header := record.WarcRecord.WarcHeader()
+		return o.auditLog.write(auditEntry{
+			Time:        time.Now().UTC(),
+			File:        path,
+			Offset:      record.Offset,
+			RecordId:    header.Get(gowarc.WarcRecordID),
+			RecordType:  record.WarcRecord.Type().String(),
+			TargetUri:   header.Get(gowarc.WarcTargetURI),
+			MatchedBy:   matchedBy,
+			Mode:        o.mode,
+			Reason:      o.reason,
+			NewRecordId: warcRecord.WarcHeader().Get(gowarc.WarcRecordID),
+		})
+	}
+	return nil
+}
+
+// tombstone returns a metadata record replacing the record.
+func (o *RedactOptions) tombstone(record gowarc.WarcRecord) (gowarc.WarcRecord, error) {
+	header := record.WarcHeader()
+	rb := gowarc.NewRecordBuilder(gowarc.Metadata, o.recordBuilderOptions...)
+	for _, name := range []string{gowarc.WarcDate, gowarc.WarcTargetURI, gowarc.WarcWarcinfoID} {
+		if value := header.Get(name); value != "" {
+			rb.AddWarcHeader(name, value)
+		}
+	}
+	rb.AddWarcHeader(gowarc.WarcRefersTo, header.Get(gowarc.WarcRecordID))
+	rb.AddWarcHeader(gowarc.ContentType, "application/warc-fields")
+
+	block := &gowarc.WarcFields{}
+	block.Add("redacted-record-id", header.Get(gowarc.WarcRecordID))
+	block.Add("redacted-record-type", record.Type().String())
+	block.Add("reason", o.reason)
+	block.Add("redaction-date", time.Now().UTC().Format(time.RFC3339))
+	if _, err := rb.WriteString(block.String()); err != nil {
+		return nil, err
+	}
+	tombstone, _, err := rb.Build()
+	return tombstone, err
+}
+
+// truncate returns the record without payload. The HTTP header of HTTP messages is kept.
+func (o *RedactOptions) truncate(record gowarc.WarcRecord) (gowarc.WarcRecord, error) {
+	header := record.WarcHeader()
+	rb := gowarc.NewRecordBuilder(record.Type(), o.recordBuilderOptions...)
+	for _, field := range *header {
+		switch field.Name {
+		case gowarc.WarcType, gowarc.ContentLength, gowarc.WarcBlockDigest, gowarc.WarcPayloadDigest,
+			gowarc.WarcIdentifiedPayloadType, gowarc.WarcTruncated:
+			continue
+		}
+		rb.AddWarcHeader(field.Name, field.Value)
+	}
+	rb.AddWarcHeader(gowarc.WarcTruncated, "unspecified")
+
+	if strings.HasPrefix(header.Get(gowarc.ContentType), "application/http") {
+		block, err := record.Block().RawBytes()
+		if err != nil {
+			return nil, err
+		}
+		httpHeader, _, err := rewrite.ReadHttpHeader(block)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := rb.Write(httpHeader); err != nil {
+			return nil, err
+		}
+	}
+	truncated, _, err := rb.Build()
+	return truncated, err
+}
+
+type auditEntry struct {
+	Time        time.Time `json:"time"`
+	File        string    `json:"file"`
+	Offset      int64     `json:"offset"`
+	RecordId    string    `json:"recordId"`
+	RecordType  string    `json:"recordType"`
+	TargetUri   string    `json:"targetUri,omitempty"`
+	MatchedBy   string    `json:"matchedBy"`
+	Mode        string    `json:"mode"`
+	Reason      string    `json:"reason"`
+	NewRecordId string    `json:"newRecordId"`
+}
+
+// auditLog lists the redacted records as JSON lines.
+type auditLog struct {
+	mu      sync.Mutex
+	f       *os.File
+	encoder *json.Encoder
+	entries int64
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &auditLog{f: f, encoder: json.NewEncoder(f)}, nil
+}
+
+func (a *auditLog) write(entry auditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries++
+	if err := a.encoder.Encode(entry); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+func (a *auditLog) count() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.entries
+}
+
+func (a *auditLog) Close() error {
+	return a.f.Close()
+}
@@ -0,0 +1,135 @@
+package redact
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+const (
+	testHttpHeader = "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 13\r\n\r\n"
+	testRecordId   = "<urn:uuid:2b3c4d5e-0000-4000-8000-000000000001>"
+)
+
+func testRedactOptions() *RedactOptions {
+	return &RedactOptions{
+		reason: "takedown 2024-17",
+		recordBuilderOptions: []gowarc.WarcRecordOption{
+			gowarc.WithVersion(gowarc.V1_1),
+			gowarc.WithAddMissingDigest(true),
+			gowarc.WithAddMissingContentLength(true),
+			gowarc.WithAddMissingRecordId(true),
+		},
+	}
+}
+
+func testResponse(t *testing.T) gowarc.WarcRecord {
+	t.Helper()
+	rb := gowarc.NewRecordBuilder(gowarc.Response, testRedactOptions().recordBuilderOptions...)
+	rb.AddWarcHeader(gowarc.WarcRecordID, testRecordId)
+	rb.AddWarcHeader(gowarc.WarcDate, "2024-01-02T03:04:05Z")
+	rb.AddWarcHeader(gowarc.WarcTargetURI, "http://example.com/a")
+	rb.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	if _, err := rb.WriteString(testHttpHeader + "<html></html>"); err != nil {
+		t.Fatal(err)
+	}
+	record, _, err := rb.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = record.Close() })
+	return record
+}
+
+// checkBlock checks that the Content-Length and the block digest of the record match its block and
+// returns the block.
+func checkBlock(t *testing.T, record gowarc.WarcRecord) string {
+	t.Helper()
+	r, err := record.Block().RawBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := record.WarcHeader()
+	if got, want := header.Get(gowarc.ContentLength), strconv.Itoa(len(block)); got != want {
+		t.Errorf("Content-Length = %s, want %s", got, want)
+	}
+	sum := sha1.Sum(block)
+	if got, want := header.Get(gowarc.WarcBlockDigest), "sha1:"+base32.StdEncoding.EncodeToString(sum[:]); got != want {
+		t.Errorf("WARC-Block-Digest = %s, want %s", got, want)
+	}
+	return string(block)
+}
+
+func TestTombstone(t *testing.T) {
+	o := testRedactOptions()
+	tombstone, err := o.tombstone(testResponse(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tombstone.Close() }()
+
+	if tombstone.Type() != gowarc.Metadata {
+		t.Errorf("type = %s, want %s", tombstone.Type(), gowarc.Metadata)
+	}
+	header := tombstone.WarcHeader()
+	for name, want := range map[string]string{
+		gowarc.WarcRefersTo:  testRecordId,
+		gowarc.WarcTargetURI: "http://example.com/a",
+		gowarc.WarcDate:      "2024-01-02T03:04:05Z",
+		gowarc.ContentType:   "application/warc-fields",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if header.Get(gowarc.WarcRecordID) == testRecordId {
+		t.Errorf("tombstone has the record id of the redacted record")
+	}
+
+	block := checkBlock(t, tombstone)
+	for _, want := range []string{
+		"redacted-record-id: " + testRecordId,
+		"redacted-record-type: response",
+		"reason: takedown 2024-17",
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("block %q does not contain %q", block, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	o := testRedactOptions()
+	truncated, err := o.truncate(testResponse(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = truncated.Close() }()
+
+	if truncated.Type() != gowarc.Response {
+		t.Errorf("type = %s, want %s", truncated.Type(), gowarc.Response)
+	}
+	header := truncated.WarcHeader()
+	if got := header.Get(gowarc.WarcTruncated); got != "unspecified" {
+		t.Errorf("WARC-Truncated = %q, want %q", got, "unspecified")
+	}
+	if got := header.Get(gowarc.WarcRecordID); got != testRecordId {
+		t.Errorf("WARC-Record-ID = %q, want %q", got, testRecordId)
+	}
+	if got := header.Get(gowarc.WarcTargetURI); got != "http://example.com/a" {
+		t.Errorf("WARC-Target-URI = %q, want %q", got, "http://example.com/a")
+	}
+
+	if block := checkBlock(t, truncated); block != testHttpHeader {
+		t.Errorf("block = %q, want the HTTP header %q", block, testHttpHeader)
+	}
+}
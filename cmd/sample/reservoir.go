@@ -0,0 +1,180 @@
+package sample
+
+import (
+	"cmp"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+const (
+	stratumHost   = "host"
+	stratumMime   = "mime"
+	stratumStatus = "status"
+
+	// keyBits is the number of bits of a sample key
+	keyBits = 53
+)
+
+// sampled is a record selected by the sampling.
+type sampled struct {
+	fs      afero.Fs
+	path    string
+	offset  int64
+	key     uint64
+	stratum string
+}
+
+// sampleKey returns the sample key of a record, which is a pseudo-random number in [0, 2^53) given
+// by the seed and the record ID. Records are sampled by their keys, so the sample depends only on
+// the seed and the records and not on the order or concurrency the files are read with. Records
+// without an ID are keyed by the path and offset they are read from.
+func sampleKey(seed int64, recordId string, path string, offset int64) uint64 {
+	hash := sha256.New()
+	hash.Write([]byte(strconv.FormatInt(seed, 10)))
+	hash.Write([]byte{0})
+	if recordId != "" {
+		hash.Write([]byte(recordId))
+	} else {
+		hash.Write([]byte(path))
+		hash.Write([]byte{0})
+		hash.Write([]byte(strconv.FormatInt(offset, 10)))
+	}
+	return binary.BigEndian.Uint64(hash.Sum(nil)) >> (64 - keyBits)
+}
+
+// threshold returns the sample key below which a fraction of percent of the records are.
+func threshold(percent float64) uint64 {
+	if percent >= 100 {
+		return 1 << keyBits
+	}
+	return uint64(percent / 100 * (1 << keyBits))
+}
+
+// parseStrata parses a comma-separated list of the fields records are stratified by.
+func parseStrata(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var strata []string
+	for _, field := range strings.Split(s, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		switch field {
+		case stratumHost, stratumMime, stratumStatus:
+			strata = append(strata, field)
+		default:
+			return nil, fmt.Errorf("unknown stratum '%s', must be %s, %s or %s", field, stratumHost, stratumMime, stratumStatus)
+		}
+	}
+	return strata, nil
+}
+
+// stratumOf returns the stratum of a record, which is the values of the fields records are
+// stratified by joined by spaces.
+func stratumOf(record gowarc.WarcRecord, strata []string) string {
+	if len(strata) == 0 {
+		return ""
+	}
+	values := make([]string, len(strata))
+	for i, field := range strata {
+		switch field {
+		case stratumHost:
+			values[i] = warc.Hostname(record)
+		case stratumMime:
+			mimeType, _, _ := strings.Cut(warc.MIMEType(record), ";")
+			values[i] = strings.ToLower(strings.TrimSpace(mimeType))
+		case stratumStatus:
+			values[i] = strconv.Itoa(warc.StatusCode(record))
+		}
+		if values[i] == "" {
+			values[i] = "-"
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+// reservoir keeps the records with the smallest sample keys below a threshold, up to size records
+// per stratum. Keeping the smallest keys is a reservoir sampling that can be done for each file
+// and merged afterwards.
+type reservoir struct {
+	// size is the maximum number of records per stratum, or 0 for no maximum
+	size      int
+	threshold uint64
+	strata    map[string]*maxKeyHeap
+}
+
+func newReservoir(size int, threshold uint64) *reservoir {
+	return &reservoir{
+		size:      size,
+		threshold: threshold,
+		strata:    make(map[string]*maxKeyHeap),
+	}
+}
+
+// offer adds the record to the reservoir if its key is among the smallest of its stratum.
+func (r *reservoir) offer(s sampled) {
+	if s.key >= r.threshold {
+		return
+	}
+	h, ok := r.strata[s.stratum]
+	if !ok {
+		h = &maxKeyHeap{}
+		r.strata[s.stratum] = h
+	}
+	if r.size == 0 || h.Len() < r.size {
+		heap.Push(h, s)
+		return
+	}
+	if s.key < (*h)[0].key {
+		(*h)[0] = s
+		heap.Fix(h, 0)
+	}
+}
+
+// merge adds the records of another reservoir.
+func (r *reservoir) merge(other *reservoir) {
+	for _, h := range other.strata {
+		for _, s := range *h {
+			r.offer(s)
+		}
+	}
+}
+
+// samples returns the sampled records sorted by path and offset.
+func (r *reservoir) samples() []sampled {
+	var samples []sampled
+	for _, h := range r.strata {
+		samples = append(samples, *h...)
+	}
+	slices.SortFunc(samples, func(a, b sampled) int {
+		return cmp.Or(cmp.Compare(a.path, b.path), cmp.Compare(a.offset, b.offset))
+	})
+	return samples
+}
+
+// maxKeyHeap is a heap of sampled records with the largest key on top.
+type maxKeyHeap []sampled
+
+func (h maxKeyHeap) Len() int           { return len(h) }
+func (h maxKeyHeap) Less(i, j int) bool { return h[i].key > h[j].key }
+func (h maxKeyHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *maxKeyHeap) Push(x any) {
+	*h = append(*h, x.(sampled))
+}
+
+func (h *maxKeyHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,90 @@
+package sample
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSampleKey(t *testing.T) {
+	a := sampleKey(1, "<urn:uuid:1>", "a.warc", 0)
+	if b := sampleKey(1, "<urn:uuid:1>", "b.warc", 100); a != b {
+		t.Errorf("key of record depends on path and offset: %d != %d", a, b)
+	}
+	if b := sampleKey(2, "<urn:uuid:1>", "a.warc", 0); a == b {
+		t.Errorf("key of record does not depend on seed")
+	}
+	if a >= 1<<keyBits {
+		t.Errorf("key %d out of range", a)
+	}
+	if sampleKey(1, "", "a.warc", 0) == sampleKey(1, "", "a.warc", 1) {
+		t.Errorf("records without ID at different offsets have the same key")
+	}
+}
+
+func TestReservoir(t *testing.T) {
+	var records []sampled
+	for i := range 1000 {
+		records = append(records, sampled{
+			path:    fmt.Sprintf("file-%d.warc", i%7),
+			offset:  int64(i),
+			key:     sampleKey(42, fmt.Sprintf("<urn:uuid:%d>", i), "", 0),
+			stratum: fmt.Sprintf("host-%d", i%3),
+		})
+	}
+
+	// sampling all records at once
+	want := newReservoir(10, threshold(100))
+	for _, s := range records {
+		want.offer(s)
+	}
+
+	// sampling per file and merging
+	files := make(map[string]*reservoir)
+	for _, s := range records {
+		if files[s.path] == nil {
+			files[s.path] = newReservoir(10, threshold(100))
+		}
+		files[s.path].offer(s)
+	}
+	got := newReservoir(10, threshold(100))
+	for _, r := range files {
+		got.merge(r)
+	}
+
+	wantSamples := want.samples()
+	gotSamples := got.samples()
+	if len(wantSamples) != 30 {
+		t.Fatalf("expected 10 records from each of 3 strata, got %d", len(wantSamples))
+	}
+	if len(gotSamples) != len(wantSamples) {
+		t.Fatalf("expected %d records, got %d", len(wantSamples), len(gotSamples))
+	}
+	for i := range wantSamples {
+		if gotSamples[i].path != wantSamples[i].path || gotSamples[i].offset != wantSamples[i].offset {
+			t.Errorf("sample %d: expected %s:%d, got %s:%d", i, wantSamples[i].path, wantSamples[i].offset, gotSamples[i].path, gotSamples[i].offset)
+		}
+	}
+}
+
+func TestReservoirPercent(t *testing.T) {
+	r := newReservoir(0, threshold(10))
+	for i := range 10000 {
+		r.offer(sampled{offset: int64(i), key: sampleKey(0, fmt.Sprintf("<urn:uuid:%d>", i), "", 0)})
+	}
+	if n := len(r.samples()); n < 800 || n > 1200 {
+		t.Errorf("expected about 1000 of 10000 records, got %d", n)
+	}
+}
+
+func TestParseStrata(t *testing.T) {
+	strata, err := parseStrata("host, Status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strata) != 2 || strata[0] != stratumHost || strata[1] != stratumStatus {
+		t.Errorf("unexpected strata %v", strata)
+	}
+	if _, err := parseStrata("host,size"); err == nil {
+		t.Error("expected error for unknown stratum")
+	}
+}
@@ -0,0 +1,393 @@
+package sample
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/ls"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filter"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	Count     = "count"
+	CountHelp = `number of records to sample, per stratum when stratified`
+
+	Percent     = "percent"
+	PercentHelp = `percentage of the records to sample`
+
+	Seed     = "seed"
+	SeedHelp = `seed of the sampling. The same seed gives the same sample of the same records`
+
+	StratifyBy     = "stratify-by"
+	StratifyByHelp = `comma-separated list of fields to sample each combination of separately. Fields are:
+	host   - host of the target URI
+	mime   - content type of the HTTP payload
+	status - HTTP status code`
+
+	Warc     = "warc"
+	WarcHelp = `write the sampled records to WARC files instead of listing them`
+)
+
+type SampleOptions struct {
+	paths             []string
+	count             int
+	percent           float64
+	seed              int64
+	strata            []string
+	concurrency       int
+	continueOnError   bool
+	filter            *filter.RecordFilter
+	writer            ls.Writer
+	warcWriterConfig  *warcwriterconfig.WarcWriterConfig
+	fileWalker        *filewalker.FileWalker
+	warcRecordOptions []gowarc.WarcRecordOption
+
+	mu        sync.Mutex
+	reservoir *reservoir
+	records   int64
+}
+
+type SampleFlags struct {
+	FileWalkerFlags       flag.FileWalkerFlags
+	FilterFlags           flag.FilterFlags
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	WarcWriterConfigFlags *flag.WarcWriterConfigFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewSampleFlags() SampleFlags {
+	return SampleFlags{
+		WarcWriterConfigFlags: &flag.WarcWriterConfigFlags{},
+	}
+}
+
+func (f SampleFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd)
+	f.FilterFlags.AddFlags(cmd)
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.WarcWriterConfigFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+
+	flags := cmd.Flags()
+	flags.Int(Count, 0, CountHelp)
+	flags.Float64(Percent, 0, PercentHelp)
+	flags.Int64(Seed, 0, SeedHelp)
+	flags.String(StratifyBy, "", StratifyByHelp)
+	flags.Bool(Warc, false, WarcHelp)
+	flags.StringP(ls.Delimiter, "d", " ", ls.DelimiterHelp)
+	flags.StringP(ls.Fields, "F", "", ls.FieldsHelp)
+	flags.Bool("json", false, "output as JSON lines")
+
+	if err := cmd.RegisterFlagCompletionFunc(StratifyBy, flag.SliceCompletion{stratumHost, stratumMime, stratumStatus}.CompletionFn); err != nil {
+		panic(err)
+	}
+}
+
+func (f SampleFlags) ToSampleOptions() (*SampleOptions, error) {
+	filter, err := f.FilterFlags.ToFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	strata, err := parseStrata(viper.GetString(StratifyBy))
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+
+	fields := viper.GetString(ls.Fields)
+
+	o := &SampleOptions{
+		paths:           paths,
+		count:           viper.GetInt(Count),
+		percent:         viper.GetFloat64(Percent),
+		seed:            viper.GetInt64(Seed),
+		strata:          strata,
+		concurrency:     f.ConcurrencyFlags.Concurrency(),
+		continueOnError: f.ErrorFlags.ContinueOnError(),
+		filter:          filter,
+		fileWalker:      fileWalker,
+	}
+
+	if viper.GetBool(Warc) {
+		o.warcWriterConfig, err = f.WarcWriterConfigFlags.ToWarcWriterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create warc writer config: %w", err)
+		}
+	} else if viper.GetBool("json") {
+		o.writer = ls.NewJSONWriter(os.Stdout, fields)
+	} else {
+		o.writer, err = ls.NewRecordWriter(os.Stdout, fields, viper.GetString(ls.Delimiter))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	o.warcRecordOptions = f.WarcRecordOptionFlags.ToWarcRecordOptions()
+	needParsedBlock := f.FilterFlags.ResponseCode() != "" || len(f.FilterFlags.MimeType()) > 0 || o.needParsedBlock(fields)
+	if !f.WarcRecordOptionFlags.StrictValidation() && !needParsedBlock {
+		o.warcRecordOptions = append(o.warcRecordOptions, gowarc.WithSkipParseBlock())
+	}
+
+	return o, nil
+}
+
+// needParsedBlock reports whether the HTTP header of the records is needed to stratify or list them.
+func (o *SampleOptions) needParsedBlock(fields string) bool {
+	for _, stratum := range o.strata {
+		if stratum == stratumMime || stratum == stratumStatus {
+			return true
+		}
+	}
+	return o.warcWriterConfig == nil && ls.FieldsNeedParsedBlock(fields)
+}
+
+// NewCmdSample creates the sample command
+func NewCmdSample() *cobra.Command {
+	flags := NewSampleFlags()
+
+	cmd := &cobra.Command{
+		Use:   "sample FILE/DIR ...",
+		Short: "Sample WARC records",
+		Long: `Select a random, reproducible sample of the records in WARC files.
+
+Every record gets a pseudo-random key given by the seed and its record ID, and the records with
+the smallest keys are sampled. The same seed gives the same sample of the same records, no matter
+how the files are named, ordered or read in parallel. Use --count to sample a number of records,
+--percent to sample a percentage of them, or both to sample a percentage up to a number of records.
+
+With --stratify-by the records are grouped by host, MIME type and/or HTTP status code and
+--count records are sampled from each group.
+
+The sampled records are listed like with 'warc ls', sorted by file and offset, or written to
+new WARC files with --warc.`,
+		Example: `  # List 100 random records
+  warc sample --count 100 -r collection/
+
+  # Sample 5 responses per host and status code to new WARC files
+  warc sample --count 5 --stratify-by host,status -t response --warc -w qa/ -r collection/
+
+  # List one percent of the records with another seed
+  warc sample --percent 1 --seed 42 -r collection/`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToSampleOptions()
+			if err != nil {
+				return err
+			}
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+// Complete completes the options
+func (o *SampleOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.paths = append(o.paths, args...)
+	t := threshold(100)
+	if o.percent > 0 {
+		t = threshold(o.percent)
+	}
+	o.reservoir = newReservoir(o.count, t)
+	return nil
+}
+
+// Validate validates the options
+func (o *SampleOptions) Validate() error {
+	if len(o.paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	if o.count < 0 {
+		return fmt.Errorf("--%s must not be negative", Count)
+	}
+	if o.percent < 0 || o.percent > 100 {
+		return fmt.Errorf("--%s must be between 0 and 100", Percent)
+	}
+	if o.count == 0 && o.percent == 0 {
+		return fmt.Errorf("missing --%s or --%s", Count, Percent)
+	}
+	if o.warcWriterConfig != nil && o.warcWriterConfig.OneToOneWriter {
+		return fmt.Errorf("--%s can not be used with --%s", flag.OneToOne, Warc)
+	}
+	return nil
+}
+
+// Run runs the sample command
+func (o *SampleOptions) Run() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	defer o.fileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.concurrency)
+
+	err := o.fileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			err := o.handleFile(ctx, fs, path)
+			if err != nil {
+				if !o.continueOnError {
+					cancel()
+				}
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error(recordErr.Error(), "path", path, "offset", recordErr.Offset())
+				} else {
+					slog.Error(err.Error(), "path", path)
+				}
+			}
+		})
+
+		return nil
+	})
+	if err != nil {
+		workerPool.CloseWait()
+		return err
+	}
+	workerPool.CloseWait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	samples := o.reservoir.samples()
+	slog.Info("Sampled records", "records", o.records, "sampled", len(samples), "strata", len(o.reservoir.strata), "seed", o.seed)
+
+	if o.warcWriterConfig != nil {
+		defer o.warcWriterConfig.Close()
+	}
+	for _, s := range samples {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := o.writeSample(s); err != nil {
+			if !o.continueOnError {
+				return err
+			}
+			slog.Error(err.Error(), "path", s.path, "offset", s.offset)
+		}
+	}
+	return nil
+}
+
+// handleFile samples the records of a file and merges the sample into the sample of all files
+func (o *SampleOptions) handleFile(ctx context.Context, fs afero.Fs, path string) error {
+	f, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	warcFileReader, err := warc.NewReaderFromStream(f, 0, o.warcRecordOptions...)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	fileReservoir := newReservoir(o.count, o.reservoir.threshold)
+	var records int64
+	defer func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.reservoir.merge(fileReservoir)
+		o.records += records
+	}()
+
+	for record, err := range warc.Compose(warcFileReader.Records(), o.filter, 0, 0) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return warc.ErrorFrom(record, err)
+		}
+		records++
+		fileReservoir.offer(sampled{
+			fs:      fs,
+			path:    path,
+			offset:  record.Offset,
+			key:     sampleKey(o.seed, warc.RecordID(record.WarcRecord), path, record.Offset),
+			stratum: stratumOf(record.WarcRecord, o.strata),
+		})
+		_ = record.Close()
+	}
+	return nil
+}
+
+// writeSample reads the sampled record again and lists it or writes it to a WARC file
+func (o *SampleOptions) writeSample(s sampled) error {
+	f, err := s.fs.Open(s.path)
+	if err != nil {
+		return err
+	}
+	warcFileReader, err := warc.NewReaderFromStream(f, s.offset, o.warcRecordOptions...)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	record, err := warcFileReader.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read sampled record: %w", err)
+	}
+	defer record.Close()
+
+	if o.warcWriterConfig == nil {
+		return o.writer.WriteRecord(record, s.path)
+	}
+
+	warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+	if err != nil {
+		warcDate = o.warcWriterConfig.DefaultTime
+	}
+	writer, err := o.warcWriterConfig.GetWarcWriter(s.path, warcDate)
+	if err != nil {
+		return err
+	}
+	if writeResponse := writer.Write(record.WarcRecord); len(writeResponse) > 0 && writeResponse[0].Err != nil {
+		return writeResponse[0].Err
+	}
+	return nil
+}
@@ -101,7 +101,7 @@ func (f ValidateFlags) ToOptions() (*ValidateOptions, error) {
 	}
 	var fileIndex *index.FileIndex
 	if f.IndexFlags.KeepIndex() {
-		fileIndex, err = f.IndexFlags.ToFileIndex()
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file index: %w", err)
 		}
@@ -225,39 +225,35 @@ func (o *ValidateOptions) Run() error {
 		defer o.FileIndex.Close()
 	}
 
+	defer o.FileWalker.Close()
+
 	workerPool := workerpool.New(ctx, o.concurrency)
 	defer workerPool.CloseWait()
 
-	for _, path := range o.paths {
-		err := o.FileWalker.Walk(ctx, path, func(fs afero.Fs, path string, err error) error {
-			if err != nil {
-				return err
-			}
+	return o.FileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
 
-			workerPool.Submit(func() {
-				result, err := filewalker.Preposterous(fs, path, o.openInputFileHook, o.closeInputFileHook, o.FileIndex, o.handleFile)
-				if errors.Is(err, filewalker.ErrSkipFile) {
-					return
-				} else if err != nil {
-					if !o.continueOnError {
-						cancel()
-					}
-					if result == nil {
-						result = stat.NewResult(path)
-					}
-					result.AddError(err)
+		workerPool.Submit(func() {
+			result, err := filewalker.Preposterous(fs, path, o.openInputFileHook, o.closeInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.continueOnError {
+					cancel()
 				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
 
-				results <- result
-			})
-
-			return nil
+			results <- result
 		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+
+		return nil
+	})
 }
 
 func (o *ValidateOptions) handleFile(fs afero.Fs, path string) (stat.Result, error) {
@@ -274,7 +270,7 @@ func (o *ValidateOptions) handleFile(fs afero.Fs, path string) (stat.Result, err
 		result.SetHash(countingReader.Hash())
 	}()
 
-	warcFileReader, err := gowarc.NewWarcFileReaderFromStream(countingReader, o.offset, o.warcRecordOptions...)
+	warcFileReader, err := warc.NewReaderFromStream(countingReader, o.offset, o.warcRecordOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create warc file reader: %w", err)
 	}
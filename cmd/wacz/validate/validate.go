@@ -0,0 +1,459 @@
+package validate
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/internal/flag"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/wacz"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+type ValidateWaczOptions struct {
+	paths              []string
+	concurrency        int
+	continueOnError    bool
+	FileIndex          *index.FileIndex
+	FileWalker         *filewalker.FileWalker
+	warcRecordOptions  []gowarc.WarcRecordOption
+	openInputFileHook  hooks.OpenInputFileHook
+	closeInputFileHook hooks.CloseInputFileHook
+}
+
+type ValidateWaczFlags struct {
+	IndexFlags            flag.IndexFlags
+	InputHookFlags        *flag.InputHookFlags
+	FileWalkerFlags       flag.FileWalkerFlags
+	WarcRecordOptionFlags flag.WarcRecordOptionFlags
+	ConcurrencyFlags      flag.ConcurrencyFlags
+	ErrorFlags            flag.ErrorFlags
+}
+
+func NewValidateWaczFlags() ValidateWaczFlags {
+	return ValidateWaczFlags{
+		InputHookFlags: &flag.InputHookFlags{},
+	}
+}
+
+func (f ValidateWaczFlags) AddFlags(cmd *cobra.Command) {
+	f.FileWalkerFlags.AddFlags(cmd, flag.WithDefaultSuffixes([]string{".wacz"}))
+	f.IndexFlags.AddFlags(cmd)
+	f.WarcRecordOptionFlags.AddFlags(cmd)
+	f.InputHookFlags.AddFlags(cmd)
+	f.ConcurrencyFlags.AddFlags(cmd)
+	f.ErrorFlags.AddFlags(cmd)
+}
+
+func (f ValidateWaczFlags) ToOptions() (*ValidateWaczOptions, error) {
+	fileList, err := flag.ReadSrcFileList(f.FileWalkerFlags.SrcFileListFlags.SrcFileList())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from source file: %w", err)
+	}
+	fileWalker, err := f.FileWalkerFlags.ToFileWalker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file walker: %w", err)
+	}
+	var fileIndex *index.FileIndex
+	if f.IndexFlags.KeepIndex() {
+		fileIndex, err = f.IndexFlags.ToFileIndex(fileWalker.Fs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file index: %w", err)
+		}
+	}
+	openInputFileHook, err := f.InputHookFlags.ToOpenInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open input file hook: %w", err)
+	}
+	closeInputFileHook, err := f.InputHookFlags.ToCloseInputFileHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create close input file hook: %w", err)
+	}
+
+	return &ValidateWaczOptions{
+		paths:              fileList,
+		FileWalker:         fileWalker,
+		FileIndex:          fileIndex,
+		concurrency:        f.ConcurrencyFlags.Concurrency(),
+		continueOnError:    f.ErrorFlags.ContinueOnError(),
+		warcRecordOptions:  f.WarcRecordOptionFlags.ToWarcRecordOptions(),
+		openInputFileHook:  openInputFileHook,
+		closeInputFileHook: closeInputFileHook,
+	}, nil
+}
+
+func NewCmdValidateWacz() *cobra.Command {
+	flags := NewValidateWaczFlags()
+
+	var cmd = &cobra.Command{
+		Use:   "validate FILE/DIR ...",
+		Short: "Validate WACZ files",
+		Long: `Validate the structure and content of WACZ files.
+
+The following checks are made for each WACZ file:
+	- every resource in datapackage.json exists and has the listed size and hash
+	- every file in the archive is listed as a resource in datapackage.json
+	- every pages/*.jsonl file has a valid header and pages with url and ts
+	- every index entry in indexes/ points to a record at the given offset in archive/
+	- every record in the WARC files in archive/ passes normal record validation`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o, err := flags.ToOptions()
+			if err != nil {
+				return err
+			}
+			err = o.Complete(cmd, args)
+			if err != nil {
+				return err
+			}
+			err = o.Validate()
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			err = o.Run()
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			return err
+		},
+		ValidArgsFunction: flag.SuffixCompletionFn,
+	}
+
+	flags.AddFlags(cmd)
+
+	return cmd
+}
+
+func (o *ValidateWaczOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.paths = append(o.paths, args...)
+	return nil
+}
+
+func (o *ValidateWaczOptions) Validate() error {
+	if len(o.paths) == 0 {
+		return errors.New("missing file or directory name")
+	}
+	return nil
+}
+
+func (o *ValidateWaczOptions) Run() error {
+	exitCode := 0
+	done := make(chan struct{})
+
+	defer func() {
+		<-done
+		os.Exit(exitCode)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	results := make(chan stat.Result)
+	go func() {
+		defer close(done)
+
+		stats := stat.NewStats()
+		defer func() {
+			slog.Info("Total", "files", stats.Files, "errors", stats.Errors, "records", stats.Records)
+		}()
+
+		for result := range results {
+			slog := slog.With("path", result.Name())
+			for _, err := range result.Errors() {
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error("Validation error", "error", err.Error(), "offset", recordErr.Offset())
+				} else {
+					slog.Error("Validation error", "error", err.Error())
+				}
+			}
+			slog.Info("Validated file", "errors", result.ErrorCount(), "records", result.Records())
+			stats.Merge(result)
+		}
+		if stats.Errors > 0 {
+			exitCode = 1
+		}
+	}()
+	defer close(results)
+
+	if o.FileIndex != nil {
+		defer o.FileIndex.Close()
+	}
+
+	defer o.FileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.concurrency)
+	defer workerPool.CloseWait()
+
+	return o.FileWalker.WalkAll(ctx, o.paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			result, err := filewalker.Preposterous(fs, path, o.openInputFileHook, o.closeInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			} else if err != nil {
+				if !o.continueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
+
+			results <- result
+		})
+
+		return nil
+	})
+}
+
+func (o *ValidateWaczOptions) handleFile(fs afero.Fs, path string) (stat.Result, error) {
+	result := stat.NewResult(path)
+
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := wacz.Open(file, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	o.validateDataPackage(archive, result)
+	o.validatePages(archive, result)
+	o.validateIndexes(archive, result)
+	o.validateRecords(archive, result)
+
+	return result, nil
+}
+
+// validateDataPackage checks that datapackage.json and the archive content agree.
+func (o *ValidateWaczOptions) validateDataPackage(archive *wacz.Archive, result stat.Result) {
+	dataPackage, err := archive.DataPackage()
+	if err != nil {
+		result.AddError(err)
+		return
+	}
+	if dataPackage.Profile != "data-package" {
+		result.AddError(fmt.Errorf("%s: unexpected profile: %q", wacz.DataPackageName, dataPackage.Profile))
+	}
+
+	listed := make(map[string]struct{}, len(dataPackage.Resources))
+	for _, resource := range dataPackage.Resources {
+		listed[path.Clean(resource.Path)] = struct{}{}
+		if err := archive.VerifyResource(resource); err != nil {
+			result.AddError(err)
+		}
+	}
+	for _, name := range archive.Files() {
+		if name == wacz.DataPackageName || name == wacz.DataPackageDigestName {
+			continue
+		}
+		if _, ok := listed[name]; !ok {
+			result.AddError(fmt.Errorf("%s: file is not listed in %s", name, wacz.DataPackageName))
+		}
+	}
+}
+
+// validatePages checks all page lists in the pages directory.
+func (o *ValidateWaczOptions) validatePages(archive *wacz.Archive, result stat.Result) {
+	if !archive.Has(path.Join(wacz.PagesDir, "pages.jsonl")) {
+		result.AddError(fmt.Errorf("%s: missing", path.Join(wacz.PagesDir, "pages.jsonl")))
+	}
+	for _, name := range archive.FilesIn(wacz.PagesDir) {
+		if !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		r, err := archive.Open(name)
+		if err != nil {
+			result.AddError(err)
+			continue
+		}
+		pages, errs := wacz.ValidatePages(r)
+		_ = r.Close()
+		for _, err := range errs {
+			result.AddError(fmt.Errorf("%s: %w", name, err))
+		}
+		slog.Debug("Validated pages", "name", name, "pages", pages)
+	}
+}
+
+// validateIndexes checks that every index entry points to a record in one of the archived WARC files.
+func (o *ValidateWaczOptions) validateIndexes(archive *wacz.Archive, result stat.Result) {
+	var indexes []string
+	for _, name := range archive.FilesIn(wacz.IndexesDir) {
+		switch {
+		case strings.HasSuffix(name, ".cdx"), strings.HasSuffix(name, ".cdxj"),
+			strings.HasSuffix(name, ".cdx.gz"), strings.HasSuffix(name, ".cdxj.gz"):
+			indexes = append(indexes, name)
+		}
+	}
+	if len(indexes) == 0 {
+		result.AddError(fmt.Errorf("%s: no CDX or CDXJ index found", wacz.IndexesDir))
+		return
+	}
+
+	// errors opening a WARC file are reported once, not once per index entry
+	failedFiles := make(map[string]struct{})
+
+	for _, name := range indexes {
+		entries := 0
+		err := func() error {
+			f, err := archive.Open(name)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+
+			var r io.Reader = f
+			if strings.HasSuffix(name, ".gz") {
+				gz, err := gzip.NewReader(f)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = gz.Close() }()
+				r = gz
+			}
+
+			for entry, err := range wacz.ReadIndex(r) {
+				if err != nil {
+					result.AddError(fmt.Errorf("%s: %w", name, err))
+					continue
+				}
+				entries++
+				warcName := path.Join(wacz.ArchiveDir, entry.Filename)
+				if _, failed := failedFiles[warcName]; failed {
+					continue
+				}
+				if !archive.Has(warcName) {
+					failedFiles[warcName] = struct{}{}
+					result.AddError(fmt.Errorf("%s: line %d: referenced file %s does not exist", name, entry.Line, warcName))
+					continue
+				}
+				if err := o.checkIndexEntry(archive, warcName, entry); err != nil {
+					if errors.Is(err, wacz.ErrNotStored) {
+						failedFiles[warcName] = struct{}{}
+					}
+					result.AddError(fmt.Errorf("%s: line %d: %w", name, entry.Line, err))
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			result.AddError(fmt.Errorf("%s: %w", name, err))
+		}
+		slog.Debug("Validated index", "name", name, "entries", entries)
+	}
+}
+
+// checkIndexEntry reads the record the index entry points to and compares it with the entry.
+func (o *ValidateWaczOptions) checkIndexEntry(archive *wacz.Archive, warcName string, entry wacz.IndexEntry) error {
+	section, err := archive.Section(warcName)
+	if err != nil {
+		return err
+	}
+
+	opts := append([]gowarc.WarcRecordOption{}, o.warcRecordOptions...)
+	opts = append(opts, gowarc.WithSkipParseBlock())
+	warcFileReader, err := gowarc.NewWarcFileReaderFromStream(section, entry.Offset, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	record, err := warcFileReader.Next()
+	if err != nil {
+		return fmt.Errorf("no record found at offset %d in %s: %w", entry.Offset, warcName, err)
+	}
+	defer record.Close()
+
+	if record.Offset != entry.Offset {
+		return fmt.Errorf("record in %s found at offset %d, index says %d", warcName, record.Offset, entry.Offset)
+	}
+	if entry.Length > 0 && record.Size != entry.Length {
+		return fmt.Errorf("record at offset %d in %s has length %d, index says %d", entry.Offset, warcName, record.Size, entry.Length)
+	}
+	if entry.URL != "" {
+		if uri := warc.URL(record.WarcRecord); uri != entry.URL {
+			return fmt.Errorf("record at offset %d in %s has target URI %q, index says %q", entry.Offset, warcName, uri, entry.URL)
+		}
+	}
+	return nil
+}
+
+// validateRecords runs normal record validation over all WARC files in the archive directory.
+func (o *ValidateWaczOptions) validateRecords(archive *wacz.Archive, result stat.Result) {
+	warcNames := archive.FilesIn(wacz.ArchiveDir)
+	if len(warcNames) == 0 {
+		result.AddError(fmt.Errorf("%s: no WARC files found", wacz.ArchiveDir))
+	}
+	for _, name := range warcNames {
+		if err := o.validateWarcFile(archive, name, result); err != nil {
+			result.AddError(fmt.Errorf("%s: %w", name, err))
+		}
+	}
+}
+
+func (o *ValidateWaczOptions) validateWarcFile(archive *wacz.Archive, name string, result stat.Result) error {
+	var r io.Reader
+	section, err := archive.Section(name)
+	if errors.Is(err, wacz.ErrNotStored) {
+		// Not randomly accessible, but the records can still be read sequentially
+		result.AddError(err)
+		rc, err := archive.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rc.Close() }()
+		r = rc
+	} else if err != nil {
+		return err
+	} else {
+		r = section
+	}
+
+	warcFileReader, err := gowarc.NewWarcFileReaderFromStream(r, 0, o.warcRecordOptions...)
+	if err != nil {
+		return fmt.Errorf("failed to create warc file reader: %w", err)
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	for record, err := range warcFileReader.Records() {
+		if err != nil {
+			return warc.ErrorFrom(record, err)
+		}
+		result.IncrRecords()
+		for _, err := range record.Validation {
+			result.AddError(fmt.Errorf("%s: %w", name, warc.ErrorFrom(record, err)))
+		}
+		record.Close()
+	}
+	return nil
+}
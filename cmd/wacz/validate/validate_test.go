@@ -0,0 +1,157 @@
+package validate
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pages = `{"format": "json-pages-1.0", "id": "pages", "title": "All Pages"}
+{"url": "http://example.com/", "ts": "2024-01-01T12:00:00Z"}
+`
+
+// testWarc returns an uncompressed WARC file with a resource record for each path and the offsets
+// and lengths of the records.
+func testWarc(paths ...string) (string, []int, []int) {
+	var warc strings.Builder
+	var offsets, lengths []int
+	for i, p := range paths {
+		content := "content of " + p
+		sum := sha1.Sum([]byte(content))
+		offsets = append(offsets, warc.Len())
+		fmt.Fprintf(&warc, "WARC/1.1\r\n"+
+			"WARC-Type: resource\r\n"+
+			"WARC-Record-ID: <urn:uuid:00000000-0000-0000-0000-%012d>\r\n"+
+			"WARC-Date: 2024-01-01T12:00:00Z\r\n"+
+			"WARC-Target-URI: http://example.com%s\r\n"+
+			"WARC-Block-Digest: sha1:%s\r\n"+
+			"Content-Type: text/plain\r\n"+
+			"Content-Length: %d\r\n"+
+			"\r\n%s\r\n\r\n", i, p, base32.StdEncoding.EncodeToString(sum[:]), len(content), content)
+		lengths = append(lengths, warc.Len()-offsets[i])
+	}
+	return warc.String(), offsets, lengths
+}
+
+// indexLine returns a CDXJ line for the record of a path at offset in data.warc.
+func indexLine(p string, offset int, length int) string {
+	return fmt.Sprintf(`com,example)%s 20240101120000 {"url": "http://example.com%s", "offset": %d, "length": %d, "filename": "data.warc"}`+"\n", p, p, offset, length)
+}
+
+func writeWacz(t *testing.T, fs afero.Fs, name string, files map[string]string, listed []string) {
+	t.Helper()
+
+	var resources string
+	for i, name := range listed {
+		sum := sha256.Sum256([]byte(files[name]))
+		if i > 0 {
+			resources += ","
+		}
+		resources += fmt.Sprintf(`{"name": %q, "path": %q, "hash": "sha256:%s", "bytes": %d}`, name, name, hex.EncodeToString(sum[:]), len(files[name]))
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	if listed != nil {
+		w, err := zw.Create("datapackage.json")
+		require.NoError(t, err)
+		_, err = fmt.Fprintf(w, `{"profile": "data-package", "wacz_version": "1.1.1", "resources": [%s]}`, resources)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, afero.WriteFile(fs, name, buf.Bytes(), 0o644))
+}
+
+func TestValidateWaczFile(t *testing.T) {
+	warc, offsets, lengths := testWarc("/a", "/b")
+	validFiles := func(index string) map[string]string {
+		return map[string]string{
+			"pages/pages.jsonl":  pages,
+			"indexes/index.cdxj": index,
+			"archive/data.warc":  warc,
+		}
+	}
+	validListed := []string{"pages/pages.jsonl", "indexes/index.cdxj", "archive/data.warc"}
+	tests := []struct {
+		name       string
+		files      map[string]string
+		listed     []string
+		wantErrors int64
+	}{
+		{
+			name:       "empty archive",
+			files:      map[string]string{},
+			wantErrors: 4, // missing datapackage.json, pages.jsonl, index and WARC files
+		},
+		{
+			name:       "no index and no WARC files",
+			files:      map[string]string{"pages/pages.jsonl": pages},
+			listed:     []string{"pages/pages.jsonl"},
+			wantErrors: 2,
+		},
+		{
+			name:       "unlisted file",
+			files:      map[string]string{"pages/pages.jsonl": pages, "extra.txt": "x"},
+			listed:     []string{"pages/pages.jsonl"},
+			wantErrors: 3,
+		},
+		{
+			name:       "index references missing file",
+			files:      map[string]string{"pages/pages.jsonl": pages, "indexes/index.cdxj": `com,example)/ 20240101120000 {"url": "http://example.com/", "offset": 0, "length": 10, "filename": "missing.warc"}` + "\n"},
+			listed:     []string{"pages/pages.jsonl", "indexes/index.cdxj"},
+			wantErrors: 2, // missing referenced file and no WARC files
+		},
+		{
+			name:       "valid archive",
+			files:      validFiles(indexLine("/a", offsets[0], lengths[0]) + indexLine("/b", offsets[1], lengths[1])),
+			listed:     validListed,
+			wantErrors: 0,
+		},
+		{
+			name:       "index entry with wrong offset",
+			files:      validFiles(indexLine("/a", offsets[0], lengths[0]) + indexLine("/b", offsets[1]+1, lengths[1])),
+			listed:     validListed,
+			wantErrors: 1,
+		},
+		{
+			name:       "index entry with wrong length",
+			files:      validFiles(indexLine("/a", offsets[0], lengths[0]) + indexLine("/b", offsets[1], lengths[1]+1)),
+			listed:     validListed,
+			wantErrors: 1,
+		},
+		{
+			name:       "index entry with wrong URL",
+			files:      validFiles(indexLine("/a", offsets[0], lengths[0]) + indexLine("/c", offsets[1], lengths[1])),
+			listed:     validListed,
+			wantErrors: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			writeWacz(t, fs, "/test.wacz", tt.files, tt.listed)
+
+			o := &ValidateWaczOptions{}
+			result, err := o.handleFile(fs, "/test.wacz")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantErrors, result.ErrorCount(), "errors: %v", result.Errors())
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package wacz
+
+import (
+	"github.com/nationallibraryofnorway/warchaeology/v5/cmd/wacz/validate"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdWacz() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "wacz",
+		Short: "Work with WACZ files. Use subcommands for the supported operations",
+		Long:  ``,
+	}
+
+	// Subcommands
+	cmd.AddCommand(validate.NewCmdValidateWacz())
+
+	return cmd
+}
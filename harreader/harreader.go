@@ -0,0 +1,157 @@
+package harreader
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"time"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/har"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+// HarReader reads a HAR file and returns its entries as WARC records. Each entry becomes a
+// response record followed by a request record that refers to it with WARC-Concurrent-To.
+// Entries without a response (status 0), e.g. blocked or aborted requests, are skipped.
+// Entries are decoded one at a time as they are read.
+type HarReader struct {
+	fs                afero.Fs
+	filename          string
+	defaultTime       time.Time
+	warcRecordOptions []gowarc.WarcRecordOption
+	file              afero.File
+	decoder           *har.Decoder
+	pending           *gowarc.Record
+	index             int
+}
+
+func NewHarReader(fileSystem afero.Fs, filename string, defaultTime time.Time, warcRecordOptions ...gowarc.WarcRecordOption) (*HarReader, error) {
+	return &HarReader{
+		fs:                fileSystem,
+		filename:          filename,
+		defaultTime:       defaultTime,
+		warcRecordOptions: warcRecordOptions,
+	}, nil
+}
+
+func (harReader *HarReader) open() error {
+	file, err := harReader.fs.Open(harReader.filename)
+	if err != nil {
+		return err
+	}
+	harReader.file = file
+	harReader.decoder = har.NewDecoder(file)
+	return nil
+}
+
+func (harReader *HarReader) Next() (gowarc.Record, error) {
+	if harReader.decoder == nil {
+		if err := harReader.open(); err != nil {
+			return gowarc.Record{}, err
+		}
+	}
+	if harReader.pending != nil {
+		record := *harReader.pending
+		harReader.pending = nil
+		return record, nil
+	}
+
+	for {
+		entry, err := harReader.decoder.Next()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("entry %d: %w", harReader.index, err)
+			}
+			return gowarc.Record{}, err
+		}
+		harReader.index++
+		if entry.Response.Status == 0 {
+			continue
+		}
+
+		warcDate, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+		if err != nil {
+			warcDate = harReader.defaultTime
+		}
+
+		response, err := harReader.buildResponse(entry, warcDate)
+		if err != nil {
+			return response, fmt.Errorf("entry %d: %w", harReader.index-1, err)
+		}
+		responseId := response.WarcRecord.WarcHeader().Get(gowarc.WarcRecordID)
+		request, err := harReader.buildRequest(entry, warcDate, responseId)
+		if err != nil {
+			_ = response.Close()
+			return request, fmt.Errorf("entry %d: %w", harReader.index-1, err)
+		}
+		harReader.pending = &request
+		return response, nil
+	}
+}
+
+func (harReader *HarReader) buildResponse(entry har.Entry, warcDate time.Time) (gowarc.Record, error) {
+	message, err := entry.Response.HTTPMessage()
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+	warcRecordBuilder := gowarc.NewRecordBuilder(gowarc.Response, harReader.warcRecordOptions...)
+	warcRecordBuilder.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	if entry.ServerIPAddress != "" {
+		warcRecordBuilder.AddWarcHeader(gowarc.WarcIPAddress, entry.ServerIPAddress)
+	}
+	return harReader.build(warcRecordBuilder, entry, warcDate, message)
+}
+
+func (harReader *HarReader) buildRequest(entry har.Entry, warcDate time.Time, responseId string) (gowarc.Record, error) {
+	message, err := entry.Request.HTTPMessage()
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+	warcRecordBuilder := gowarc.NewRecordBuilder(gowarc.Request, harReader.warcRecordOptions...)
+	warcRecordBuilder.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=request")
+	if responseId != "" {
+		warcRecordBuilder.AddWarcHeader(gowarc.WarcConcurrentTo, responseId)
+	}
+	return harReader.build(warcRecordBuilder, entry, warcDate, message)
+}
+
+func (harReader *HarReader) build(warcRecordBuilder gowarc.WarcRecordBuilder, entry har.Entry, warcDate time.Time, message []byte) (gowarc.Record, error) {
+	warcRecordBuilder.AddWarcHeader(gowarc.WarcTargetURI, entry.Request.URL)
+	warcRecordBuilder.AddWarcHeaderTime(gowarc.WarcDate, warcDate)
+	if _, err := warcRecordBuilder.Write(message); err != nil {
+		return gowarc.Record{}, err
+	}
+	warcRecord, validation, err := warcRecordBuilder.Build()
+	return gowarc.Record{WarcRecord: warcRecord, Validation: validation}, err
+}
+
+func (harReader *HarReader) Records() iter.Seq2[gowarc.Record, error] {
+	return func(yield func(gowarc.Record, error) bool) {
+		for {
+			record, err := harReader.Next()
+			if err == io.EOF {
+				return
+			}
+			if !yield(record, err) {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (harReader *HarReader) Close() error {
+	if harReader.pending != nil {
+		_ = harReader.pending.Close()
+		harReader.pending = nil
+	}
+	if harReader.file != nil {
+		err := harReader.file.Close()
+		harReader.file = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package httrackreader
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// CacheEntry is an entry in the cache of a HTTrack project.
+type CacheEntry struct {
+	URL           string
+	Date          time.Time
+	StatusCode    int
+	StatusMessage string
+	// Header holds the HTTP headers HTTrack kept for the response
+	Header http.Header
+	// SavePath is the path the payload was saved to while harvesting
+	SavePath string
+	// file is the zip entry holding the payload if it was stored in the cache
+	file *zip.File
+}
+
+// internal headers added by HTTrack to the headers stored in new.zip
+const (
+	headerInCache       = "X-In-Cache"
+	headerStatusCode    = "X-Statuscode"
+	headerStatusMessage = "X-Statusmessage"
+	headerSize          = "X-Size"
+	headerAddr          = "X-Addr"
+	headerFil           = "X-Fil"
+	headerSave          = "X-Save"
+	headerCharset       = "X-Charset"
+)
+
+const (
+	zipLocalHeaderSignature = 0x04034b50
+	zipLocalHeaderLen       = 30
+)
+
+// ReadZipCache reads the entries of a new.zip cache file.
+//
+// HTTrack stores the HTTP headers of each entry as text in the extra field of the local file
+// header, which is not exposed by archive/zip, so it is read directly from the file.
+func ReadZipCache(r io.ReaderAt, size int64) ([]CacheEntry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache: %w", err)
+	}
+	var entries []CacheEntry
+	for _, f := range zr.File {
+		extra, err := localExtra(r, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read headers of %s: %w", f.Name, err)
+		}
+		entry := parseZipEntry(f.Name, extra)
+		entry.Date = f.Modified
+		if entry.Header.Get(headerInCache) == "1" {
+			entry.file = f
+		}
+		entry.Header.Del(headerInCache)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseZipEntry(name string, extra []byte) CacheEntry {
+	header := http.Header{}
+	scanner := bufio.NewScanner(bytes.NewReader(extra))
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	entry := CacheEntry{
+		URL:           cacheURL(name),
+		StatusMessage: header.Get(headerStatusMessage),
+		SavePath:      header.Get(headerSave),
+		Header:        header,
+	}
+	entry.StatusCode, _ = strconv.Atoi(header.Get(headerStatusCode))
+	if charset := header.Get(headerCharset); charset != "" && !strings.Contains(header.Get("Content-Type"), "charset") {
+		header.Set("Content-Type", header.Get("Content-Type")+"; charset="+charset)
+	}
+	for _, h := range []string{headerStatusCode, headerStatusMessage, headerSize, headerAddr, headerFil, headerSave, headerCharset} {
+		header.Del(h)
+	}
+	return entry
+}
+
+// localExtra returns the extra field of the local file header of a zip entry. The header ends
+// right before the data, so it is found by searching backwards from the data offset for a
+// local header signature whose name and extra lengths add up.
+func localExtra(r io.ReaderAt, f *zip.File) ([]byte, error) {
+	dataOffset, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	nameLen := int64(len(f.Name))
+	window := min(dataOffset, zipLocalHeaderLen+nameLen+0xffff)
+	buf := make([]byte, window)
+	if _, err := r.ReadAt(buf, dataOffset-window); err != nil {
+		return nil, err
+	}
+	for extraLen := int64(0); zipLocalHeaderLen+nameLen+extraLen <= window; extraLen++ {
+		start := window - zipLocalHeaderLen - nameLen - extraLen
+		h := buf[start:]
+		if binary.LittleEndian.Uint32(h) != zipLocalHeaderSignature {
+			continue
+		}
+		if int64(binary.LittleEndian.Uint16(h[26:])) != nameLen || int64(binary.LittleEndian.Uint16(h[28:])) != extraLen {
+			continue
+		}
+		return h[zipLocalHeaderLen+nameLen:], nil
+	}
+	return nil, errors.New("local file header not found")
+}
+
+// cacheURL returns the URL of a cache entry. HTTrack leaves out the scheme for http URLs.
+func cacheURL(name string) string {
+	if strings.Contains(name, "://") {
+		return name
+	}
+	return "http://" + name
+}
+
+// ReadTxtCache reads the entries of a new.txt transfer log. The log only has the time of day
+// of each transfer, so the day is taken from the given date, which should be the modification
+// time of the log. Transfers that failed are skipped.
+func ReadTxtCache(r io.Reader, date time.Time) ([]CacheEntry, error) {
+	var entries []CacheEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "date\t") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("malformed line: %q", line)
+		}
+		statusCode, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("malformed status code in line: %q", line)
+		}
+		if statusCode <= 0 {
+			continue
+		}
+
+		header := http.Header{}
+		if fields[5] != "" {
+			header.Set("Content-Type", fields[5])
+		}
+		if k, v, ok := strings.Cut(fields[6], ":"); ok && v != "" {
+			switch k {
+			case "date":
+				header.Set("Last-Modified", v)
+			case "etag":
+				header.Set("Etag", v)
+			}
+		}
+
+		entry := CacheEntry{
+			URL:           cacheURL(fields[7]),
+			Date:          timeOfDay(date, fields[0]),
+			StatusCode:    statusCode,
+			StatusMessage: statusMessage(fields[4]),
+			Header:        header,
+			SavePath:      fields[8],
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// statusMessage extracts the server message from a status field like "added ('OK')".
+func statusMessage(status string) string {
+	_, msg, ok := strings.Cut(status, "('")
+	if !ok {
+		return ""
+	}
+	msg, _, _ = strings.Cut(msg, "')")
+	return msg
+}
+
+// timeOfDay combines the day of date with a time of day like 17:41:18. Since the log is
+// written while harvesting, a time later than the time of date belongs to the day before.
+func timeOfDay(date time.Time, clock string) time.Time {
+	t, err := time.Parse(time.TimeOnly, clock)
+	if err != nil || date.IsZero() {
+		return date
+	}
+	d := time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), t.Second(), 0, date.Location())
+	if d.After(date) {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// resolveSavePath finds the file saved by HTTrack in the project directory. The save path is
+// the path used while harvesting, which may be absolute and from another system, so trailing
+// segments are matched against the project directory.
+func resolveSavePath(fs afero.Fs, projectDir string, savePath string) (string, bool) {
+	if savePath == "" {
+		return "", false
+	}
+	segments := strings.Split(strings.ReplaceAll(savePath, "\\", "/"), "/")
+	for i := range segments {
+		candidate := filepath.Join(append([]string{projectDir}, segments[i:]...)...)
+		if info, err := fs.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
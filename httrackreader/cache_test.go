@@ -0,0 +1,103 @@
+package httrackreader
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadZipCache(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	modified := time.Date(2007, 1, 2, 3, 4, 6, 0, time.UTC)
+	files := []struct {
+		name    string
+		headers string
+		content string
+	}{
+		{
+			name:    "www.example.com/index.html",
+			headers: "X-In-Cache: 1\r\nX-StatusCode: 200\r\nX-StatusMessage: OK\r\nX-Size: 6\r\nContent-Type: text/html\r\nX-Charset: iso-8859-1\r\nLast-Modified: Mon, 01 Jan 2007 00:00:00 GMT\r\nX-Addr: www.example.com\r\nX-Fil: /index.html\r\nX-Save: www.example.com/index.html\r\n",
+			content: "<html>",
+		},
+		{
+			name:    "https://www.example.com/logo.gif",
+			headers: "X-In-Cache: 0\r\nX-StatusCode: 200\r\nX-StatusMessage: OK\r\nContent-Type: image/gif\r\nX-Save: C:\\My Web Sites\\example\\www.example.com\\logo.gif\r\n",
+		},
+	}
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Extra: []byte(f.headers), Modified: modified})
+		require.NoError(t, err)
+		_, err = w.Write([]byte(f.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	entries, err := ReadZipCache(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "http://www.example.com/index.html", entries[0].URL)
+	assert.Equal(t, 200, entries[0].StatusCode)
+	assert.Equal(t, "OK", entries[0].StatusMessage)
+	assert.Equal(t, "text/html; charset=iso-8859-1", entries[0].Header.Get("Content-Type"))
+	assert.Equal(t, "Mon, 01 Jan 2007 00:00:00 GMT", entries[0].Header.Get("Last-Modified"))
+	assert.Empty(t, entries[0].Header.Get("X-Save"))
+	assert.Empty(t, entries[0].Header.Get("X-In-Cache"))
+	assert.True(t, entries[0].Date.Equal(modified))
+	require.NotNil(t, entries[0].file)
+	rc, err := entries[0].file.Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "<html>", string(content))
+
+	assert.Equal(t, "https://www.example.com/logo.gif", entries[1].URL)
+	assert.Nil(t, entries[1].file)
+	assert.Equal(t, `C:\My Web Sites\example\www.example.com\logo.gif`, entries[1].SavePath)
+}
+
+func TestReadTxtCache(t *testing.T) {
+	log := "date\tsize'/'remotesize\tflags(request:Update,Range state:File response:Modified,Chunked,gZipped)\tstatuscode\tstatus ('servermsg')\tMIME\tEtag|Date\tURL\tlocalfile\t(from URL)\n" +
+		"23:59:58\t5010/5010\t---M--\t200\tadded ('OK')\ttext/html\tdate:Mon, 01 Jan 2007 00:00:00 GMT\twww.example.com/\tC:/My Web Sites/example/www.example.com/index.html\t(from )\n" +
+		"00:00:02\t0/0\t------\t-5\terror ('Unable to get server address')\t\t\twww.example.org/\t\t(from www.example.com/)\n" +
+		"00:00:03\t120/120\t---M--\t404\tadded ('Not Found')\ttext/html\tetag:\"abc\"\twww.example.com/missing\texample/www.example.com/missing.html\t(from www.example.com/)\n"
+
+	date := time.Date(2007, 1, 2, 0, 10, 0, 0, time.UTC)
+	entries, err := ReadTxtCache(strings.NewReader(log), date)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "http://www.example.com/", entries[0].URL)
+	assert.Equal(t, time.Date(2007, 1, 1, 23, 59, 58, 0, time.UTC), entries[0].Date)
+	assert.Equal(t, "OK", entries[0].StatusMessage)
+	assert.Equal(t, "Mon, 01 Jan 2007 00:00:00 GMT", entries[0].Header.Get("Last-Modified"))
+
+	assert.Equal(t, 404, entries[1].StatusCode)
+	assert.Equal(t, "Not Found", entries[1].StatusMessage)
+	assert.Equal(t, time.Date(2007, 1, 2, 0, 0, 3, 0, time.UTC), entries[1].Date)
+	assert.Equal(t, `"abc"`, entries[1].Header.Get("Etag"))
+
+	_, err = ReadTxtCache(strings.NewReader("00:00:03\t120/120\n"), date)
+	assert.Error(t, err)
+}
+
+func TestResolveSavePath(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/harvest/example/www.example.com/logo.gif", []byte("GIF"), 0o644))
+
+	got, ok := resolveSavePath(fs, "/harvest/example", `C:\My Web Sites\example\www.example.com\logo.gif`)
+	assert.True(t, ok)
+	assert.Equal(t, "/harvest/example/www.example.com/logo.gif", got)
+
+	_, ok = resolveSavePath(fs, "/harvest/example", "www.example.com/missing.gif")
+	assert.False(t, ok)
+}
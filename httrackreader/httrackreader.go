@@ -0,0 +1,183 @@
+package httrackreader
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+// HttrackReader reads the cache of a HTTrack project and returns each cached transfer as a
+// response record with the HTTP headers HTTrack kept.
+//
+// The cache is either hts-cache/new.zip, which has the headers and, for some entries, the
+// payload, or the older hts-cache/new.txt transfer log. Payloads that are not in the cache are
+// read from where HTTrack saved them in the project directory. Records whose payload cannot be
+// found are marked with WARC-Truncated.
+type HttrackReader struct {
+	fs                afero.Fs
+	cacheFilename     string
+	projectDir        string
+	defaultTime       time.Time
+	warcRecordOptions []gowarc.WarcRecordOption
+	cacheFile         afero.File
+	entries           []CacheEntry
+	index             int
+	loaded            bool
+}
+
+func NewHttrackReader(fileSystem afero.Fs, cacheFilename string, defaultTime time.Time, warcRecordOptions ...gowarc.WarcRecordOption) (*HttrackReader, error) {
+	return &HttrackReader{
+		fs:                fileSystem,
+		cacheFilename:     cacheFilename,
+		projectDir:        filepath.Dir(filepath.Dir(cacheFilename)),
+		defaultTime:       defaultTime,
+		warcRecordOptions: warcRecordOptions,
+	}, nil
+}
+
+func (httrackReader *HttrackReader) load() error {
+	httrackReader.loaded = true
+
+	file, err := httrackReader.fs.Open(httrackReader.cacheFilename)
+	if err != nil {
+		return err
+	}
+	// payloads stored in the cache are read from the file, so it is kept open until Close
+	httrackReader.cacheFile = file
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if filepath.Ext(httrackReader.cacheFilename) == ".zip" {
+		httrackReader.entries, err = ReadZipCache(file, info.Size())
+	} else {
+		httrackReader.entries, err = ReadTxtCache(file, info.ModTime())
+	}
+	return err
+}
+
+func (httrackReader *HttrackReader) Next() (gowarc.Record, error) {
+	if !httrackReader.loaded {
+		if err := httrackReader.load(); err != nil {
+			return gowarc.Record{}, err
+		}
+	}
+	if httrackReader.index >= len(httrackReader.entries) {
+		return gowarc.Record{}, io.EOF
+	}
+	entry := httrackReader.entries[httrackReader.index]
+	httrackReader.index++
+
+	record, err := httrackReader.buildRecord(entry)
+	if err != nil {
+		return record, fmt.Errorf("%s: %w", entry.URL, err)
+	}
+	return record, nil
+}
+
+func (httrackReader *HttrackReader) buildRecord(entry CacheEntry) (gowarc.Record, error) {
+	warcDate := entry.Date
+	if warcDate.IsZero() {
+		warcDate = httrackReader.defaultTime
+	}
+
+	payload, size, err := httrackReader.openPayload(entry)
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+	if payload != nil {
+		defer func() { _ = payload.Close() }()
+	}
+
+	warcRecordBuilder := gowarc.NewRecordBuilder(gowarc.Response, httrackReader.warcRecordOptions...)
+	warcRecordBuilder.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	warcRecordBuilder.AddWarcHeader(gowarc.WarcTargetURI, entry.URL)
+	warcRecordBuilder.AddWarcHeaderTime(gowarc.WarcDate, warcDate)
+	if payload == nil {
+		warcRecordBuilder.AddWarcHeader(gowarc.WarcTruncated, "unspecified")
+	}
+
+	statusMessage := entry.StatusMessage
+	if statusMessage == "" {
+		statusMessage = http.StatusText(entry.StatusCode)
+	}
+	header := entry.Header.Clone()
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	if _, err = fmt.Fprintf(warcRecordBuilder, "HTTP/1.1 %d %s\r\n", entry.StatusCode, statusMessage); err != nil {
+		return gowarc.Record{}, err
+	}
+	if err = header.Write(warcRecordBuilder); err != nil {
+		return gowarc.Record{}, err
+	}
+	if _, err = warcRecordBuilder.WriteString("\r\n"); err != nil {
+		return gowarc.Record{}, err
+	}
+	if payload != nil {
+		if _, err = warcRecordBuilder.ReadFrom(payload); err != nil {
+			return gowarc.Record{}, err
+		}
+	}
+
+	warcRecord, validation, err := warcRecordBuilder.Build()
+	return gowarc.Record{WarcRecord: warcRecord, Validation: validation}, err
+}
+
+// openPayload opens the payload of an entry from the cache or from the project directory. It
+// returns a nil reader if the payload is not found.
+func (httrackReader *HttrackReader) openPayload(entry CacheEntry) (io.ReadCloser, int64, error) {
+	if entry.file != nil {
+		rc, err := entry.file.Open()
+		if err != nil {
+			return nil, 0, err
+		}
+		return rc, int64(entry.file.UncompressedSize64), nil
+	}
+	savePath, ok := resolveSavePath(httrackReader.fs, httrackReader.projectDir, entry.SavePath)
+	if !ok {
+		return nil, 0, nil
+	}
+	f, err := httrackReader.fs.Open(savePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (httrackReader *HttrackReader) Records() iter.Seq2[gowarc.Record, error] {
+	return func(yield func(gowarc.Record, error) bool) {
+		for {
+			record, err := httrackReader.Next()
+			if err == io.EOF {
+				return
+			}
+			if !yield(record, err) {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (httrackReader *HttrackReader) Close() error {
+	if httrackReader.cacheFile != nil {
+		return httrackReader.cacheFile.Close()
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package derive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/index"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/workerpool"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+// Source tells which WARC file a record was read from.
+type Source struct {
+	Path       string
+	Compressed bool
+}
+
+// Derived is the content of a record derived from a record of a WARC file.
+type Derived struct {
+	Type        gowarc.RecordType
+	ContentType string
+	Content     []byte
+}
+
+// DeriveFunc derives a record from a record read from source, or returns nil if nothing is
+// derived from the record.
+type DeriveFunc func(record gowarc.Record, source Source) (*Derived, error)
+
+// Options are the options of the commands deriving records from WARC files.
+type Options struct {
+	Paths              []string
+	Concurrency        int
+	MinWARCDiskFree    int64
+	Repair             bool
+	ContinueOnError    bool
+	Offset             int64
+	RecordNum          int
+	RecordCount        int
+	Force              bool
+	WarcRecordOptions  []gowarc.WarcRecordOption
+	WarcWriterConfig   *warcwriterconfig.WarcWriterConfig
+	FileWalker         *filewalker.FileWalker
+	FileIndex          *index.FileIndex
+	OpenInputFileHook  hooks.OpenInputFileHook
+	CloseInputFileHook hooks.CloseInputFileHook
+	Derive             DeriveFunc
+}
+
+// Run derives records from the records of the files below the paths and writes them with the
+// WARC writer.
+func (o *Options) Run() error {
+	done := make(chan struct{})
+	exitCode := 0
+
+	defer func() {
+		<-done
+		os.Exit(exitCode)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	results := make(chan stat.Result)
+	go func() {
+		defer close(done)
+
+		stats := stat.NewStats()
+		defer func() {
+			slog.Info("Total", "files", stats.Files, "errors", stats.Errors, "records", stats.Records)
+		}()
+
+		for result := range results {
+			slog := slog.With("path", result.Name())
+			for _, err := range result.Errors() {
+				var recordErr warc.RecordError
+				if errors.As(err, &recordErr) {
+					slog.Error("Validation error", "error", recordErr.Error(), "offset", recordErr.Offset())
+				} else {
+					slog.Error("Validation error", "error", err.Error())
+				}
+			}
+			slog.Info("Derived file", "errors", result.ErrorCount(), "records", result.Records())
+			stats.Merge(result)
+		}
+		if stats.Errors > 0 {
+			exitCode = 1
+		}
+	}()
+	defer close(results)
+
+	if o.FileIndex != nil {
+		defer o.FileIndex.Close()
+	}
+	defer o.WarcWriterConfig.Close()
+
+	defer o.FileWalker.Close()
+
+	workerPool := workerpool.New(ctx, o.Concurrency)
+	defer workerPool.CloseWait()
+
+	return o.FileWalker.WalkAll(ctx, o.Paths, func(fs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+
+		workerPool.Submit(func() {
+			// Assert WARC disk has enough free space
+			if o.MinWARCDiskFree > 0 {
+				diskFree, err := util.DiskFree(o.WarcWriterConfig.OutDir)
+				if err != nil {
+					cancel()
+					slog.Error("Failed to get free space on device", "path", o.WarcWriterConfig.OutDir, "error", err)
+					return
+				}
+				if diskFree < o.MinWARCDiskFree {
+					cancel()
+					slog.Error("Not enough free space on device", "bytesFree", diskFree, "path", o.WarcWriterConfig.OutDir)
+					return
+				}
+			}
+
+			result, err := filewalker.Preposterous(fs, path, o.OpenInputFileHook, o.CloseInputFileHook, o.FileIndex, o.handleFile)
+			if errors.Is(err, filewalker.ErrSkipFile) {
+				return
+			}
+			if err != nil {
+				if !o.ContinueOnError {
+					cancel()
+				}
+				if result == nil {
+					result = stat.NewResult(path)
+				}
+				result.AddError(err)
+			}
+
+			results <- result
+		})
+
+		return nil
+	})
+}
+
+func (o *Options) handleFile(fs afero.Fs, path string) (stat.Result, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var magic [4]byte
+	n, err := io.ReadFull(file, magic[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	source := Source{Path: path, Compressed: warc.IsCompressed(magic[:n])}
+
+	warcFileReader, err := warc.NewReaderFromStream(file, o.Offset, o.WarcRecordOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warc file reader: %w", err)
+	}
+	defer func() { _ = warcFileReader.Close() }()
+
+	var writer warcwriterconfig.WarcWriter
+	if o.WarcWriterConfig.OneToOneWriter {
+		defer func() {
+			if writer != nil {
+				_ = writer.Close()
+			}
+		}()
+	}
+
+	result := stat.NewResult(path)
+
+	var lastOffset int64 = -1
+
+	records := warc.Compose(warcFileReader.Records(), nil, o.RecordNum, o.RecordCount)
+	for record, err := range records {
+		if err != nil {
+			// When forcing, avoid infinite loop by ensuring the iterator moves forward
+			if o.Force && lastOffset != record.Offset {
+				slog.Warn(err.Error(), "offset", record.Offset, "path", path)
+				lastOffset = record.Offset
+				continue
+			}
+			return result, warc.ErrorFrom(record, err)
+		}
+
+		if writer == nil || !o.WarcWriterConfig.OneToOneWriter {
+			warcDate, err := record.WarcRecord.WarcHeader().GetTime(gowarc.WarcDate)
+			if err != nil {
+				return result, warc.ErrorFrom(record, err)
+			}
+			writer, err = o.WarcWriterConfig.GetWarcWriter(path, warcDate)
+			if err != nil {
+				return result, warc.ErrorFrom(record, err)
+			}
+		}
+		err = o.handleRecord(writer, source, record, result)
+		if err != nil {
+			return result, warc.ErrorFrom(record, err)
+		}
+	}
+	return result, nil
+}
+
+// handleRecord writes the record derived from record. A record which can't be derived from is
+// counted as an error of the file and skipped, only failing to write stops the file.
+func (o *Options) handleRecord(warcFileWriter warcwriterconfig.WarcWriter, source Source, record gowarc.Record, result stat.Result) error {
+	defer record.Close()
+
+	result.IncrRecords()
+
+	if len(record.Validation) > 0 {
+		for _, err := range record.Validation {
+			result.AddError(warc.ErrorFrom(record, err))
+		}
+	}
+
+	derived, err := o.Derive(record, source)
+	if err != nil {
+		result.AddError(warc.ErrorFrom(record, err))
+		return nil
+	}
+	if derived == nil {
+		return nil
+	}
+
+	warcRecordBuilder := gowarc.NewRecordBuilder(derived.Type, o.WarcRecordOptions...)
+	warcRecordBuilder.AddWarcHeader(gowarc.ContentType, derived.ContentType)
+	addReferenceHeaders(warcRecordBuilder, record.WarcRecord)
+	if _, err = warcRecordBuilder.Write(derived.Content); err != nil {
+		return err
+	}
+	return writeRecord(warcFileWriter, warcRecordBuilder)
+}
+
+// addReferenceHeaders makes a derived record refer to the record it was derived from.
+func addReferenceHeaders(warcRecordBuilder gowarc.WarcRecordBuilder, warcRecord gowarc.WarcRecord) {
+	header := warcRecord.WarcHeader()
+	warcRecordBuilder.AddWarcHeader(gowarc.WarcRefersTo, header.Get(gowarc.WarcRecordID))
+	warcRecordBuilder.AddWarcHeader(gowarc.WarcDate, header.Get(gowarc.WarcDate))
+	if targetURI := header.Get(gowarc.WarcTargetURI); targetURI != "" {
+		warcRecordBuilder.AddWarcHeader(gowarc.WarcTargetURI, targetURI)
+	}
+}
+
+func writeRecord(warcFileWriter warcwriterconfig.WarcWriter, warcRecordBuilder gowarc.WarcRecordBuilder) error {
+	warcRecord, _, err := warcRecordBuilder.Build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = warcRecord.Close()
+	}()
+	if writeResponse := warcFileWriter.Write(warcRecord); len(writeResponse) > 0 {
+		return writeResponse[0].Err
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package derive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title> Test
+    page </title>
+  <base href="https://example.com/">
+  <meta charset="utf-8">
+  <meta name="description" content="A test page">
+  <meta property="og:title" content="Test">
+  <link rel="stylesheet" href="style.css" type="text/css">
+  <script src="app.js"></script>
+  <style>body { color: red }</style>
+</head>
+<body>
+  <header><a href="/">Home</a></header>
+  <nav><ul><li><a href="/a">A</a></li><li><a href="/b">B</a></li></ul></nav>
+  <main>
+    <h1>Heading</h1>
+    <p>First paragraph with a <a href="/link" title="Link">link</a> in it.</p>
+    <div><a href="/x">Only a link</a></div>
+    <p hidden>Hidden text</p>
+    <img src="image.png" alt="An image">
+    <script>var x = 1;</script>
+  </main>
+  <footer>Copyright</footer>
+</body>
+</html>`
+
+func TestParseHTML(t *testing.T) {
+	metadata, err := ParseHTML(strings.NewReader(testHTML))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Test page", metadata.Head.Title)
+	assert.Equal(t, "https://example.com/", metadata.Head.Base)
+	assert.Equal(t, []Meta{
+		{Charset: "utf-8"},
+		{Name: "description", Content: "A test page"},
+		{Property: "og:title", Content: "Test"},
+	}, metadata.Head.Metas)
+	assert.Equal(t, []Link{{Path: "LINK@/href", URL: "style.css", Rel: "stylesheet", Type: "text/css"}}, metadata.Head.Link)
+	assert.Equal(t, []Link{{Path: "SCRIPT@/src", URL: "app.js"}}, metadata.Head.Scripts)
+	assert.Equal(t, []Link{
+		{Path: "A@/href", URL: "/", Text: "Home"},
+		{Path: "A@/href", URL: "/a", Text: "A"},
+		{Path: "A@/href", URL: "/b", Text: "B"},
+		{Path: "A@/href", URL: "/link", Text: "link", Title: "Link"},
+		{Path: "A@/href", URL: "/x", Text: "Only a link"},
+		{Path: "IMG@/src", URL: "image.png", Alt: "An image"},
+	}, metadata.Links)
+}
+
+func TestExtractText(t *testing.T) {
+	text, err := ExtractText(strings.NewReader(testHTML))
+	require.NoError(t, err)
+	assert.Equal(t, "Heading\nFirst paragraph with a link in it.", text)
+}
+
+func TestDecodedPayload(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, _ = w.Write([]byte("bl\xe5b\xe6r"))
+	_ = w.Close()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		want   string
+	}{
+		{
+			name:   "identity",
+			header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			body:   []byte("blåbær"),
+			want:   "blåbær",
+		},
+		{
+			name:   "gzip latin1",
+			header: http.Header{"Content-Type": {"text/plain; charset=iso-8859-1"}, "Content-Encoding": {"gzip"}},
+			body:   gz.Bytes(),
+			want:   "blåbær",
+		},
+		{
+			name:   "chunked",
+			header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}, "Transfer-Encoding": {"chunked"}},
+			body:   []byte("3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n"),
+			want:   "abcde",
+		},
+		{
+			name:   "already dechunked",
+			header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}, "Transfer-Encoding": {"chunked"}},
+			body:   []byte("abcde"),
+			want:   "abcde",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := decodedPayload(tt.header, tt.body)
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestHandleRecordSkipsRecordsFailingToDerive(t *testing.T) {
+	o := &Options{
+		Derive: func(record gowarc.Record, source Source) (*Derived, error) {
+			return nil, errors.New("unsupported content encoding")
+		},
+	}
+	result := stat.NewResult("test.warc")
+	record := gowarc.Record{Offset: 42}
+
+	err := o.handleRecord(nil, Source{Path: "test.warc"}, record, result)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Records())
+	require.Equal(t, int64(1), result.ErrorCount())
+
+	var recordErr warc.RecordError
+	require.ErrorAs(t, result.Errors()[0], &recordErr)
+	assert.Equal(t, int64(42), recordErr.Offset())
+}
@@ -0,0 +1,164 @@
+package derive
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLMetadata is the metadata extracted from a HTML document, laid out as in the
+// HTML-Metadata object of Common Crawl WAT files.
+type HTMLMetadata struct {
+	Head  Head   `json:"Head"`
+	Links []Link `json:"Links,omitempty"`
+}
+
+type Head struct {
+	Title   string `json:"Title,omitempty"`
+	Base    string `json:"Base,omitempty"`
+	Metas   []Meta `json:"Metas,omitempty"`
+	Link    []Link `json:"Link,omitempty"`
+	Scripts []Link `json:"Scripts,omitempty"`
+}
+
+type Meta struct {
+	Name      string `json:"name,omitempty"`
+	Property  string `json:"property,omitempty"`
+	HttpEquiv string `json:"http-equiv,omitempty"`
+	Charset   string `json:"charset,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// Link is a URL found in a document. Path tells where it was found, like A@/href for the href
+// attribute of an anchor. URLs are kept as they appear in the document.
+type Link struct {
+	Path  string `json:"path"`
+	URL   string `json:"url"`
+	Text  string `json:"text,omitempty"`
+	Rel   string `json:"rel,omitempty"`
+	Title string `json:"title,omitempty"`
+	Alt   string `json:"alt,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// linkAttributes are the attributes holding URLs for each element.
+var linkAttributes = map[atom.Atom][]string{
+	atom.A:          {"href"},
+	atom.Area:       {"href"},
+	atom.Link:       {"href"},
+	atom.Img:        {"src"},
+	atom.Script:     {"src"},
+	atom.Iframe:     {"src"},
+	atom.Frame:      {"src"},
+	atom.Form:       {"action"},
+	atom.Embed:      {"src"},
+	atom.Object:     {"data"},
+	atom.Source:     {"src"},
+	atom.Video:      {"src", "poster"},
+	atom.Audio:      {"src"},
+	atom.Input:      {"src"},
+	atom.Blockquote: {"cite"},
+	atom.Q:          {"cite"},
+}
+
+// ParseHTML extracts the title, meta tags and links of a HTML document.
+func ParseHTML(r io.Reader) (*HTMLMetadata, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &HTMLMetadata{}
+	metadata.walk(doc, false)
+	return metadata, nil
+}
+
+func (m *HTMLMetadata) walk(n *html.Node, inHead bool) {
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.Head:
+			inHead = true
+		case atom.Title:
+			if m.Head.Title == "" {
+				m.Head.Title = collapseSpace(textOf(n))
+			}
+		case atom.Base:
+			if m.Head.Base == "" {
+				m.Head.Base = attr(n, "href")
+			}
+		case atom.Meta:
+			meta := Meta{
+				Name:      attr(n, "name"),
+				Property:  attr(n, "property"),
+				HttpEquiv: attr(n, "http-equiv"),
+				Charset:   attr(n, "charset"),
+				Content:   attr(n, "content"),
+			}
+			if meta != (Meta{}) {
+				m.Head.Metas = append(m.Head.Metas, meta)
+			}
+		}
+		for _, name := range linkAttributes[n.DataAtom] {
+			m.addLink(n, name, inHead)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		m.walk(c, inHead)
+	}
+}
+
+func (m *HTMLMetadata) addLink(n *html.Node, name string, inHead bool) {
+	url := strings.TrimSpace(attr(n, name))
+	if url == "" {
+		return
+	}
+	link := Link{
+		Path:  strings.ToUpper(n.Data) + "@/" + name,
+		URL:   url,
+		Rel:   attr(n, "rel"),
+		Title: attr(n, "title"),
+		Alt:   attr(n, "alt"),
+		Type:  attr(n, "type"),
+	}
+	if n.DataAtom == atom.A || n.DataAtom == atom.Area {
+		link.Text = collapseSpace(textOf(n))
+	}
+	switch {
+	case n.DataAtom == atom.Link:
+		m.Head.Link = append(m.Head.Link, link)
+	case n.DataAtom == atom.Script && inHead:
+		m.Head.Scripts = append(m.Head.Scripts, link)
+	default:
+		m.Links = append(m.Links, link)
+	}
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// textOf returns the concatenated text of the descendants of a node.
+func textOf(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
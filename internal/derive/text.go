@@ -0,0 +1,105 @@
+package derive
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxLinkDensity is the largest share of a text block that may be link text before the block
+// is considered navigation and dropped.
+const maxLinkDensity = 0.5
+
+// skippedElements are elements whose text is never part of the main content.
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Menu: true,
+	atom.Form: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Object: true,
+}
+
+// blockElements are elements that start a new block of text.
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Body: true, atom.Br: true,
+	atom.Dd: true, atom.Details: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true, atom.Li: true, atom.Main: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true, atom.Summary: true,
+	atom.Table: true, atom.Td: true, atom.Th: true, atom.Tr: true, atom.Ul: true,
+}
+
+// ExtractText returns the main text of a HTML document with one line per block of text.
+//
+// Boilerplate is removed by skipping elements like scripts, navigation, headers and footers,
+// and by dropping blocks that mostly consist of link text.
+func ExtractText(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	e := &textExtractor{}
+	e.walk(doc, false)
+	e.flush()
+	return strings.Join(e.blocks, "\n"), nil
+}
+
+type textExtractor struct {
+	blocks    []string
+	text      strings.Builder
+	linkChars int
+}
+
+func (e *textExtractor) walk(n *html.Node, inLink bool) {
+	switch n.Type {
+	case html.TextNode:
+		e.text.WriteString(n.Data)
+		if inLink {
+			e.linkChars += utf8.RuneCountInString(collapseSpace(n.Data))
+		}
+		return
+	case html.ElementNode:
+		if skippedElements[n.DataAtom] || isHidden(n) {
+			return
+		}
+		if n.DataAtom == atom.A {
+			inLink = true
+		}
+	}
+	block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+	if block {
+		e.flush()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.walk(c, inLink)
+	}
+	if block {
+		e.flush()
+	}
+}
+
+// flush ends the current block and keeps it unless it is empty or mostly links.
+func (e *textExtractor) flush() {
+	text := collapseSpace(e.text.String())
+	if text != "" && float64(e.linkChars)/float64(utf8.RuneCountInString(text)) <= maxLinkDensity {
+		e.blocks = append(e.blocks, text)
+	}
+	e.text.Reset()
+	e.linkChars = 0
+}
+
+func isHidden(n *html.Node) bool {
+	for _, a := range n.Attr {
+		switch {
+		case a.Key == "hidden":
+			return true
+		case a.Key == "aria-hidden" && a.Val == "true":
+			return true
+		case a.Key == "style" && strings.Contains(strings.ReplaceAll(a.Val, " ", ""), "display:none"):
+			return true
+		}
+	}
+	return false
+}
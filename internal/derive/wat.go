@@ -0,0 +1,176 @@
+package derive
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// WAT is the metadata of a WARC record, laid out as in Common Crawl WAT files.
+type WAT struct {
+	Container Container `json:"Container"`
+	Envelope  Envelope  `json:"Envelope"`
+}
+
+// Container tells where the record was read from.
+type Container struct {
+	Filename   string `json:"Filename"`
+	Compressed bool   `json:"Compressed"`
+	Offset     string `json:"Offset"`
+}
+
+type Envelope struct {
+	Format             string            `json:"Format"`
+	BlockDigest        string            `json:"Block-Digest,omitempty"`
+	WARCHeaderMetadata map[string]string `json:"WARC-Header-Metadata"`
+	PayloadMetadata    PayloadMetadata   `json:"Payload-Metadata"`
+}
+
+type PayloadMetadata struct {
+	ActualContentType    string                `json:"Actual-Content-Type,omitempty"`
+	WARCInfoMetadata     map[string]string     `json:"WARC-Info-Metadata,omitempty"`
+	HTTPRequestMetadata  *HTTPRequestMetadata  `json:"HTTP-Request-Metadata,omitempty"`
+	HTTPResponseMetadata *HTTPResponseMetadata `json:"HTTP-Response-Metadata,omitempty"`
+}
+
+type HTTPRequestMetadata struct {
+	RequestMessage RequestMessage    `json:"Request-Message"`
+	Headers        map[string]string `json:"Headers"`
+	HeadersLength  string            `json:"Headers-Length"`
+	EntityLength   string            `json:"Entity-Length"`
+}
+
+type RequestMessage struct {
+	Method  string `json:"Method"`
+	Path    string `json:"Path"`
+	Version string `json:"Version"`
+}
+
+type HTTPResponseMetadata struct {
+	ResponseMessage ResponseMessage   `json:"Response-Message"`
+	Headers         map[string]string `json:"Headers"`
+	HeadersLength   string            `json:"Headers-Length"`
+	EntityLength    string            `json:"Entity-Length"`
+	HTMLMetadata    *HTMLMetadata     `json:"HTML-Metadata,omitempty"`
+}
+
+type ResponseMessage struct {
+	Version string `json:"Version"`
+	Status  string `json:"Status"`
+	Reason  string `json:"Reason"`
+}
+
+// NewWAT extracts the metadata of a record read from the named WARC file, which is gzip or zstd
+// compressed if compressed is true.
+func NewWAT(record gowarc.Record, filename string, compressed bool) (*WAT, error) {
+	warcRecord := record.WarcRecord
+	wat := &WAT{
+		Container: Container{
+			Filename:   filename,
+			Compressed: compressed,
+			Offset:     strconv.FormatInt(record.Offset, 10),
+		},
+		Envelope: Envelope{
+			Format:             "WARC",
+			BlockDigest:        warcRecord.WarcHeader().Get(gowarc.WarcBlockDigest),
+			WARCHeaderMetadata: map[string]string{},
+			PayloadMetadata: PayloadMetadata{
+				ActualContentType: warcRecord.WarcHeader().Get(gowarc.ContentType),
+			},
+		},
+	}
+	for _, field := range *warcRecord.WarcHeader() {
+		wat.Envelope.WARCHeaderMetadata[field.Name] = field.Value
+	}
+
+	payloadMetadata := &wat.Envelope.PayloadMetadata
+	switch block := warcRecord.Block().(type) {
+	case gowarc.HttpRequestBlock:
+		method, path, version := block.HttpRequestLine()
+		body, err := payloadOf(block)
+		if err != nil {
+			return nil, err
+		}
+		payloadMetadata.HTTPRequestMetadata = &HTTPRequestMetadata{
+			RequestMessage: RequestMessage{Method: method, Path: path, Version: version},
+			Headers:        headerMap(block.HttpHeader()),
+			HeadersLength:  strconv.Itoa(len(block.ProtocolHeaderBytes())),
+			EntityLength:   strconv.Itoa(len(body)),
+		}
+	case gowarc.HttpResponseBlock:
+		body, err := payloadOf(block)
+		if err != nil {
+			return nil, err
+		}
+		metadata := &HTTPResponseMetadata{
+			ResponseMessage: ResponseMessage{
+				Version: protocolOf(block),
+				Status:  strconv.Itoa(block.HttpStatusCode()),
+				Reason:  reasonOf(block),
+			},
+			Headers:       headerMap(block.HttpHeader()),
+			HeadersLength: strconv.Itoa(len(block.ProtocolHeaderBytes())),
+			EntityLength:  strconv.Itoa(len(body)),
+		}
+		if header := block.HttpHeader(); header != nil && isHTML(header.Get("Content-Type")) {
+			r, err := decodedPayload(*header, body)
+			if err != nil {
+				return nil, err
+			}
+			metadata.HTMLMetadata, err = ParseHTML(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse HTML: %w", err)
+			}
+		}
+		payloadMetadata.HTTPResponseMetadata = metadata
+	case gowarc.WarcFieldsBlock:
+		if warcRecord.Type() == gowarc.Warcinfo {
+			payloadMetadata.WARCInfoMetadata = map[string]string{}
+			for _, field := range *block.WarcFields() {
+				payloadMetadata.WARCInfoMetadata[field.Name] = field.Value
+			}
+		}
+	}
+	return wat, nil
+}
+
+// headerMap flattens a HTTP header. Repeated fields are joined with commas.
+func headerMap(header *http.Header) map[string]string {
+	m := map[string]string{}
+	if header == nil {
+		return m
+	}
+	for name, values := range *header {
+		m[name] = strings.Join(values, ", ")
+	}
+	return m
+}
+
+// protocolOf returns the protocol from the status line of a response block.
+func protocolOf(block gowarc.ProtocolHeaderBlock) string {
+	line, _, _ := bytes.Cut(block.ProtocolHeaderBytes(), []byte("\n"))
+	protocol, _, _ := strings.Cut(strings.TrimSpace(string(line)), " ")
+	return protocol
+}
+
+// reasonOf returns the reason phrase from the status line of a response block.
+func reasonOf(block gowarc.HttpResponseBlock) string {
+	status := block.HttpStatusLine()
+	if code, reason, ok := strings.Cut(status, " "); ok && code == strconv.Itoa(block.HttpStatusCode()) {
+		return reason
+	}
+	return status
+}
+
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
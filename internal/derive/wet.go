@@ -0,0 +1,105 @@
+package derive
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"github.com/nlnwa/gowarc/v3"
+	"golang.org/x/net/html/charset"
+)
+
+// Text extracts the plain text of a response or resource record. The boolean is false if the
+// record has no HTML or plain text payload.
+func Text(warcRecord gowarc.WarcRecord) (string, bool, error) {
+	var header http.Header
+	var contentType string
+	switch warcRecord.Type() {
+	case gowarc.Response:
+		block, ok := warcRecord.Block().(gowarc.HttpResponseBlock)
+		if !ok || block.HttpHeader() == nil || block.HttpStatusCode() != http.StatusOK {
+			return "", false, nil
+		}
+		header = *block.HttpHeader()
+		contentType = header.Get("Content-Type")
+	case gowarc.Resource:
+		header = http.Header{}
+		contentType = warcRecord.WarcHeader().Get(gowarc.ContentType)
+		header.Set("Content-Type", contentType)
+	default:
+		return "", false, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !isHTML(contentType) && mediaType != "text/plain" {
+		return "", false, nil
+	}
+
+	var body []byte
+	var err error
+	if block, ok := warcRecord.Block().(gowarc.PayloadBlock); ok {
+		body, err = payloadOf(block)
+	} else {
+		body, err = readAll(warcRecord.Block().RawBytes())
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	r, err := decodedPayload(header, body)
+	if err != nil {
+		return "", false, err
+	}
+	if mediaType == "text/plain" {
+		text, err := io.ReadAll(r)
+		return strings.TrimSpace(string(text)), true, err
+	}
+	text, err := ExtractText(r)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	return text, true, nil
+}
+
+func payloadOf(block gowarc.PayloadBlock) ([]byte, error) {
+	return readAll(block.PayloadBytes())
+}
+
+func readAll(r io.Reader, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// decodedPayload removes the transfer and content encoding of a HTTP payload and converts it
+// to UTF-8 using the charset of the Content-Type header or the document itself.
+func decodedPayload(header http.Header, body []byte) (io.Reader, error) {
+	if strings.EqualFold(header.Get("Transfer-Encoding"), "chunked") {
+		// the payload may already have been dechunked by the crawler
+		if dechunked, err := io.ReadAll(httputil.NewChunkedReader(bytes.NewReader(body))); err == nil {
+			body = dechunked
+		}
+	}
+	var r io.Reader = bytes.NewReader(body)
+	switch strings.ToLower(header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case "deflate":
+		r = flate.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", header.Get("Content-Encoding"))
+	}
+	return charset.NewReader(r, header.Get("Content-Type"))
+}
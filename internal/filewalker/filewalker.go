@@ -2,12 +2,15 @@ package filewalker
 
 import (
 	"context"
+	"errors"
+	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	archivefs "github.com/nationallibraryofnorway/warchaeology/v5/internal/fs"
 	"github.com/spf13/afero"
@@ -18,7 +21,36 @@ type FileWalker struct {
 	FollowSymlinks bool
 	Suffixes       []string
 	Fs             afero.Fs
+	// Include holds the patterns of which files must match one, if any
+	Include []*Glob
+	// Exclude holds the patterns of files and directories that are skipped
+	Exclude []*Glob
+	// MinSize and MaxSize are the limits of the size of files, if not zero
+	MinSize int64
+	MaxSize int64
+	// ModifiedAfter and ModifiedBefore are the limits of the modification time of files, if not zero
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// MaxDepth is the maximum depth of files below the input path when recursive, like the
+	// -maxdepth of find, or unlimited if zero. Archives do not add to the depth.
+	MaxDepth int
+	// Sort is the order files are passed to the walk function in. Files are listed before
+	// they are processed if not SortNone.
+	Sort string
+	// Shard is the 1-based index of the shard of Shards processed, or all files if Shards is
+	// less than two
+	Shard  int
+	Shards int
+	// ShardBy is how files are assigned to shards
+	ShardBy string
+	// NestedArchives makes the walk descend into archives found in archives, which is the default
+	NestedArchives bool
+	// TmpDir is the directory archives are extracted to, or the default directory for temporary
+	// files if empty
+	TmpDir         string
 	processedPaths StringSet
+	// mounts are the archives mounted during walks, released by Close
+	mounts []io.Closer
 }
 
 func WithRecursive(recursive bool) func(*FileWalker) {
@@ -39,6 +71,64 @@ func WithSuffixes(suffixes []string) func(*FileWalker) {
 	}
 }
 
+func WithInclude(include []*Glob) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.Include = include
+	}
+}
+
+func WithExclude(exclude []*Glob) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.Exclude = exclude
+	}
+}
+
+func WithSizeRange(minSize, maxSize int64) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.MinSize = minSize
+		w.MaxSize = maxSize
+	}
+}
+
+func WithModifiedRange(after, before time.Time) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.ModifiedAfter = after
+		w.ModifiedBefore = before
+	}
+}
+
+func WithMaxDepth(maxDepth int) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.MaxDepth = maxDepth
+	}
+}
+
+func WithSort(sort string) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.Sort = sort
+	}
+}
+
+func WithShard(shard, shards int, shardBy string) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.Shard = shard
+		w.Shards = shards
+		w.ShardBy = shardBy
+	}
+}
+
+func WithNestedArchives(nestedArchives bool) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.NestedArchives = nestedArchives
+	}
+}
+
+func WithTmpDir(tmpDir string) func(*FileWalker) {
+	return func(w *FileWalker) {
+		w.TmpDir = tmpDir
+	}
+}
+
 func WithFs(fs afero.Fs) func(*FileWalker) {
 	return func(w *FileWalker) {
 		w.Fs = fs
@@ -48,6 +138,7 @@ func WithFs(fs afero.Fs) func(*FileWalker) {
 func New(options ...func(*FileWalker)) *FileWalker {
 	opts := &FileWalker{
 		processedPaths: NewStringSet(),
+		NestedArchives: true,
 	}
 	for _, opt := range options {
 		opt(opts)
@@ -55,6 +146,20 @@ func New(options ...func(*FileWalker)) *FileWalker {
 	return opts
 }
 
+// Close releases the archives mounted during walks and the filesystem of the walker if it is an
+// archive. Files passed to the walk function can't be read after Close.
+func (fw *FileWalker) Close() error {
+	var errs []error
+	for _, mount := range fw.mounts {
+		errs = append(errs, mount.Close())
+	}
+	fw.mounts = nil
+	if closer, ok := fw.Fs.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
 func (fw *FileWalker) hasSuffix(path string) bool {
 	if len(fw.Suffixes) == 0 {
 		return true
@@ -67,11 +172,66 @@ func (fw *FileWalker) hasSuffix(path string) bool {
 	return false
 }
 
+// accepts reports whether a file passes the include patterns and the size and modification
+// time limits.
+func (fw *FileWalker) accepts(path string, info fs.FileInfo) bool {
+	if len(fw.Include) > 0 && !matchAny(fw.Include, path) {
+		return false
+	}
+	if fw.MinSize > 0 && info.Size() < fw.MinSize {
+		return false
+	}
+	if fw.MaxSize > 0 && info.Size() > fw.MaxSize {
+		return false
+	}
+	if !fw.ModifiedAfter.IsZero() && !info.ModTime().After(fw.ModifiedAfter) {
+		return false
+	}
+	if !fw.ModifiedBefore.IsZero() && !info.ModTime().Before(fw.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// depth returns the number of path elements of path below root.
+func depth(root string, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
+
+// visitFunc is called by walkDir for each file, with info nil if err is not.
+type visitFunc func(fs afero.Fs, path string, info fs.FileInfo, err error) error
+
+// WalkAll walks the paths one after the other like Walk, except that files are assigned to shards
+// by size over the files of all the paths.
+func (fw *FileWalker) WalkAll(ctx context.Context, paths []string, walkFn func(fs afero.Fs, path string, err error) error) error {
+	if fw.Shards > 1 && fw.ShardBy == ShardBySize {
+		return fw.walkSorted(ctx, paths, walkFn)
+	}
+	for _, path := range paths {
+		if err := fw.Walk(ctx, path, walkFn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (fw *FileWalker) Walk(ctx context.Context, path string, walkFn func(fs afero.Fs, path string, err error) error) error {
-	return fw.walkDir(ctx, fw.Fs, path, path, "", walkFn)
+	if fw.Sort != SortNone || (fw.Shards > 1 && fw.ShardBy == ShardBySize) {
+		return fw.walkSorted(ctx, []string{path}, walkFn)
+	}
+	return fw.walkDir(ctx, fw.Fs, path, path, "", func(fs afero.Fs, name string, _ fs.FileInfo, err error) error {
+		if err == nil && fw.Shards > 1 && fw.ShardBy != ShardBySize && hashShard(shardKey(path, name), fw.Shards) != fw.Shard {
+			return nil
+		}
+		return walkFn(fs, name, err)
+	})
 }
 
-func (fw *FileWalker) walkDir(ctx context.Context, currentFs afero.Fs, root string, dirName string, mountPrefix string, walkFn func(fs afero.Fs, path string, err error) error) error {
+func (fw *FileWalker) walkDir(ctx context.Context, currentFs afero.Fs, root string, dirName string, mountPrefix string, walkFn visitFunc) error {
 	walkImpl := func(walkFn filepath.WalkFunc) error {
 		// Use the custom walk with path.Join (forward slashes) for virtual
 		// filesystems (zip, tar, ftp) where entry names use forward slashes.
@@ -82,19 +242,25 @@ func (fw *FileWalker) walkDir(ctx context.Context, currentFs afero.Fs, root stri
 		}
 		return afero.Walk(currentFs, dirName, walkFn)
 	}
+	// files in archives are passed to walkFn by their virtual path in a filesystem resolving it
+	walkFs := currentFs
+	if mountPrefix != "" {
+		walkFs = &mountFs{Fs: currentFs, prefix: mountPrefix + "!"}
+	}
 	return walkImpl(func(path string, info fs.FileInfo, err error) error {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
-		if err != nil {
-			return walkFn(currentFs, path, err)
-		}
 
 		logicalPath := path
 		if mountPrefix != "" {
 			logicalPath = mountPrefix + "!" + path
 		}
 
+		if err != nil {
+			return walkFn(walkFs, logicalPath, nil, err)
+		}
+
 		if info.IsDir() {
 			// skip already processed directories
 			if fw.processedPaths.Contains(logicalPath) {
@@ -110,6 +276,14 @@ func (fw *FileWalker) walkDir(ctx context.Context, currentFs afero.Fs, root stri
 			if !fw.Recursive {
 				return filepath.SkipDir
 			}
+			// skip directories with files deeper than the maximum depth
+			if fw.MaxDepth > 0 && depth(root, path) >= fw.MaxDepth {
+				return filepath.SkipDir
+			}
+			// the trailing slash lets patterns like '**/tmp/**' exclude the directory itself
+			if matchAny(fw.Exclude, logicalPath) || matchAny(fw.Exclude, logicalPath+"/") {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -132,13 +306,27 @@ func (fw *FileWalker) walkDir(ctx context.Context, currentFs afero.Fs, root stri
 			return fw.walkDir(ctx, currentFs, root, linkPath, mountPrefix, walkFn)
 		}
 
-		mountedFs, resolveErr := archivefs.ResolveFilesystem(currentFs, path)
-		if resolveErr == nil && mountedFs != currentFs {
-			return fw.walkDir(ctx, mountedFs, "/", "/", logicalPath, walkFn)
+		if matchAny(fw.Exclude, logicalPath) {
+			return nil
+		}
+
+		// archive files are walked as filesystems unless the suffixes explicitly ask for them,
+		// archives in archives unless turned off
+		if (len(fw.Suffixes) == 0 || !fw.hasSuffix(path)) && (mountPrefix == "" || fw.NestedArchives) {
+			mountedFs, err := archivefs.MountArchive(currentFs, path, archivefs.WithTmpDir(fw.TmpDir))
+			if err != nil {
+				return walkFn(walkFs, logicalPath, nil, err)
+			}
+			if mountedFs != nil {
+				if closer, ok := mountedFs.(io.Closer); ok {
+					fw.mounts = append(fw.mounts, closer)
+				}
+				return fw.walkDir(ctx, mountedFs, "/", "/", logicalPath, walkFn)
+			}
 		}
 
-		// filter files by suffix
-		if !fw.hasSuffix(path) {
+		// filter files by suffix, patterns, size and modification time
+		if !fw.hasSuffix(path) || !fw.accepts(logicalPath, info) {
 			return nil
 		}
 		// skip already processed files
@@ -148,7 +336,7 @@ func (fw *FileWalker) walkDir(ctx context.Context, currentFs afero.Fs, root stri
 			fw.processedPaths.Add(logicalPath)
 		}
 
-		return walkFn(currentFs, path, nil)
+		return walkFn(walkFs, logicalPath, info, nil)
 	})
 }
 
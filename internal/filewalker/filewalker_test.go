@@ -1,11 +1,18 @@
 package filewalker_test
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"io"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/filewalker"
 	"github.com/spf13/afero"
@@ -100,6 +107,7 @@ func TestFilewalker_Walk_ResolvesWACZAsFilesystem(t *testing.T) {
 		filewalker.WithRecursive(true),
 		filewalker.WithSuffixes([]string{".txt"}),
 	)
+	defer func() { _ = fw.Close() }()
 
 	var got []string
 	err = fw.Walk(context.Background(), "/sample.wacz", func(wfs afero.Fs, path string, err error) error {
@@ -116,5 +124,519 @@ func TestFilewalker_Walk_ResolvesWACZAsFilesystem(t *testing.T) {
 		t.Fatalf("Walk() error = %v", err)
 	}
 
-	assert.Equal(t, []string{"/nested/record.txt"}, got)
+	assert.Equal(t, []string{"/sample.wacz!/nested/record.txt"}, got)
+}
+
+func TestFilewalker_Walk_NestedArchives(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+
+	// outer.tar contains inner.zip, which contains a.warc.gz and deep.tgz containing b.warc.gz
+	var tgz bytes.Buffer
+	gw := gzip.NewWriter(&tgz)
+	writeTar(t, gw, map[string]string{"b.warc.gz": "b"})
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var inner bytes.Buffer
+	zw := zip.NewWriter(&inner)
+	for name, content := range map[string]string{"dir/a.warc.gz": "a", "deep.tgz": tgz.String()} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var outer bytes.Buffer
+	writeTar(t, &outer, map[string]string{"inner.zip": inner.String(), "c.warc.gz": "c"})
+	if err := afero.WriteFile(memfs, "/data/outer.tar", outer.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(nestedArchives bool) (map[string]string, func() error) {
+		fw := filewalker.New(
+			filewalker.WithFs(memfs),
+			filewalker.WithRecursive(true),
+			filewalker.WithSuffixes([]string{".warc.gz"}),
+			filewalker.WithNestedArchives(nestedArchives),
+		)
+		got := map[string]string{}
+		err := fw.Walk(context.Background(), "/data", func(wfs afero.Fs, path string, err error) error {
+			if err != nil {
+				return err
+			}
+			content, err := afero.ReadFile(wfs, path)
+			if err != nil {
+				return err
+			}
+			got[path] = string(content)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		return got, fw.Close
+	}
+
+	got, closeWalker := walk(false)
+	assert.NoError(t, closeWalker())
+	assert.Equal(t, map[string]string{"/data/outer.tar!/c.warc.gz": "c"}, got)
+
+	got, closeWalker = walk(true)
+	assert.NoError(t, closeWalker())
+	assert.Equal(t, map[string]string{
+		"/data/outer.tar!/c.warc.gz":                      "c",
+		"/data/outer.tar!/inner.zip!/dir/a.warc.gz":       "a",
+		"/data/outer.tar!/inner.zip!/deep.tgz!/b.warc.gz": "b",
+	}, got)
+}
+
+func TestFilewalker_Walk_ArchivesReleasedOnClose(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+	var outer bytes.Buffer
+	writeTar(t, &outer, map[string]string{"a.warc.gz": "a"})
+	if err := afero.WriteFile(memfs, "/data/outer.tar", outer.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fw := filewalker.New(
+		filewalker.WithFs(memfs),
+		filewalker.WithSuffixes([]string{".warc.gz"}),
+	)
+	var files []afero.Fs
+	err := fw.Walk(context.Background(), "/data", func(wfs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+		files = append(files, wfs)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected one file, got %d", len(files))
+	}
+
+	// files are read after the walk, until the walker is closed
+	content, err := afero.ReadFile(files[0], "/data/outer.tar!/a.warc.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(content))
+	assert.NoError(t, fw.Close())
+	_, err = files[0].Stat("/data/outer.tar!/a.warc.gz")
+	assert.Error(t, err)
+}
+
+// sevenZip is a 7z archive holding the files bar and foo with their names and a newline as content
+const sevenZip = "\x37\x7a\xbc\xaf\x27\x1c\x00\x04\xa0\x47\xa5\x88\x08\x00\x00\x00\x00\x00\x00\x00\x66\x00\x00\x00\x00\x00\x00\x00" +
+	"\xdd\x91\xf3\xf1\x62\x61\x72\x0a\x66\x6f\x6f\x0a\x01\x04\x06\x00\x02\x09\x04\x04\x00\x07\x0b\x02\x00\x01\x01\x00" +
+	"\x01\x01\x00\x0c\x04\x04\x00\x08\x0a\x01\xe9\xb3\xa2\x04\xa8\x65\x32\x7e\x00\x00\x05\x02\x19\x05\x00\x00\x00\x00" +
+	"\x00\x11\x11\x00\x62\x00\x61\x00\x72\x00\x00\x00\x66\x00\x6f\x00\x6f\x00\x00\x00\x19\x02\x00\x00\x14\x12\x01\x00" +
+	"\x00\x85\x33\x73\xf2\x63\xd6\x01\x00\x58\x02\x72\xf2\x63\xd6\x01\x15\x0a\x01\x00\x20\x80\xa4\x81\x20\x80\xa4\x81" +
+	"\x00\x00"
+
+func TestFilewalker_Walk_SevenZip(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+	if err := afero.WriteFile(memfs, "/data/archive.7z", []byte(sevenZip), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	fw := filewalker.New(
+		filewalker.WithFs(memfs),
+		filewalker.WithSuffixes([]string{"foo", "bar"}),
+		filewalker.WithTmpDir(tmpDir),
+	)
+	got := map[string]string{}
+	err := fw.Walk(context.Background(), "/data", func(wfs afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+		content, err := afero.ReadFile(wfs, path)
+		if err != nil {
+			return err
+		}
+		got[path] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	assert.Equal(t, map[string]string{
+		"/data/archive.7z!/bar": "bar\n",
+		"/data/archive.7z!/foo": "foo\n",
+	}, got)
+
+	// the archive is extracted to the temporary directory until the walker is closed
+	entries, err := os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, entries)
+	assert.NoError(t, fw.Close())
+	entries, err = os.ReadDir(tmpDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestFilewalker_Walk_UnreadableArchive(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+	if err := afero.WriteFile(memfs, "/data/archive.7z", []byte("7z"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fw := filewalker.New(
+		filewalker.WithFs(memfs),
+		filewalker.WithSuffixes([]string{".warc.gz"}),
+		filewalker.WithTmpDir(t.TempDir()),
+	)
+	var walkErr error
+	err := fw.Walk(context.Background(), "/data", func(_ afero.Fs, path string, err error) error {
+		if path == "/data/archive.7z" {
+			walkErr = err
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Error(t, walkErr)
+}
+
+func writeTar(t *testing.T, w io.Writer, files map[string]string) {
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilewalker_Walk_WACZMatchingSuffixIsNotResolved(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if _, err := zw.Create("archive/data.warc.gz"); err != nil {
+		t.Fatalf("zip create: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	if err := afero.WriteFile(memfs, "/sample.wacz", buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("write wacz: %v", err)
+	}
+
+	fw := filewalker.New(
+		filewalker.WithFs(memfs),
+		filewalker.WithSuffixes([]string{".wacz"}),
+	)
+
+	var got []string
+	err := fw.Walk(context.Background(), "/sample.wacz", func(_ afero.Fs, path string, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	assert.Equal(t, []string{"/sample.wacz"}, got)
+}
+
+func TestGlob_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.warc.gz", "/data/a.warc.gz", true},
+		{"*.warc.gz", "/data/a.warc", false},
+		{"a?.warc", "/data/ab.warc", true},
+		{"[ab].warc", "/data/c.warc", false},
+		{"[!ab].warc", "/data/c.warc", true},
+		{"**/tmp/**", "/data/tmp/a.warc", true},
+		{"**/tmp/**", "tmp/a.warc", true},
+		{"**/tmp/**", "/data/tmpx/a.warc", false},
+		{"/data/*/a.warc", "/data/x/a.warc", true},
+		{"/data/*/a.warc", "/data/x/y/a.warc", false},
+		{"/data/**/a.warc", "/data/a.warc", true},
+		{"/data/**/a.warc", "/data/x/y/a.warc", true},
+		{"**/inner.zip!/**", "/data/outer.tar!/inner.zip!/a.warc", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			glob, err := filewalker.CompileGlob(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, glob.Match(tt.path))
+		})
+	}
+
+	if _, err := filewalker.CompileGlob("[ab"); err == nil {
+		t.Error("expected error for unterminated character class")
+	}
+}
+
+func TestFilewalker_Walk_Predicates(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for name, size := range map[string]int{
+		"/data/a.warc":          10,
+		"/data/big.warc":        1000,
+		"/data/x/b.warc":        10,
+		"/data/x/tmp/c.warc":    10,
+		"/data/x/y/d.warc":      10,
+		"/data/x/y/old.warc":    10,
+		"/data/x/y/z/e.warc.gz": 10,
+	} {
+		if err := afero.WriteFile(memfs, name, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := recent
+		if strings.Contains(name, "old") {
+			modTime = old
+		}
+		if err := memfs.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustCompile := func(patterns ...string) []*filewalker.Glob {
+		globs, err := filewalker.CompileGlobs(patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return globs
+	}
+
+	tests := []struct {
+		name     string
+		options  []func(*filewalker.FileWalker)
+		expected []string
+	}{
+		{"exclude directory", []func(*filewalker.FileWalker){filewalker.WithExclude(mustCompile("**/tmp/**", "**/y/**"))},
+			[]string{"/data/a.warc", "/data/big.warc", "/data/x/b.warc"}},
+		{"include", []func(*filewalker.FileWalker){filewalker.WithInclude(mustCompile("*.gz", "/data/x/*.warc"))},
+			[]string{"/data/x/b.warc", "/data/x/y/z/e.warc.gz"}},
+		{"size", []func(*filewalker.FileWalker){filewalker.WithSizeRange(100, 0)},
+			[]string{"/data/big.warc"}},
+		{"modified", []func(*filewalker.FileWalker){filewalker.WithModifiedRange(time.Time{}, recent.Add(-time.Hour))},
+			[]string{"/data/x/y/old.warc"}},
+		{"max depth", []func(*filewalker.FileWalker){filewalker.WithMaxDepth(2)},
+			[]string{"/data/a.warc", "/data/big.warc", "/data/x/b.warc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]func(*filewalker.FileWalker){
+				filewalker.WithFs(memfs),
+				filewalker.WithRecursive(true),
+				filewalker.WithSuffixes([]string{".warc", ".warc.gz"}),
+			}, tt.options...)
+			fw := filewalker.New(options...)
+
+			var got []string
+			err := fw.Walk(context.Background(), "/data", func(_ afero.Fs, path string, err error) error {
+				if err != nil {
+					return err
+				}
+				got = append(got, path)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestFilewalker_Walk_SortAndShard(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+	sizes := map[string]int{
+		"/data/a.warc":   40,
+		"/data/b.warc":   10,
+		"/data/c.warc":   30,
+		"/data/d/e.warc": 20,
+		"/data/d/f.warc": 20,
+		"/data/g.warc":   10,
+	}
+	for name, size := range sizes {
+		if err := afero.WriteFile(memfs, name, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(t *testing.T, options ...func(*filewalker.FileWalker)) []string {
+		t.Helper()
+		fw := filewalker.New(append([]func(*filewalker.FileWalker){
+			filewalker.WithFs(memfs),
+			filewalker.WithRecursive(true),
+		}, options...)...)
+		var got []string
+		err := fw.Walk(context.Background(), "/data", func(_ afero.Fs, path string, err error) error {
+			if err != nil {
+				return err
+			}
+			got = append(got, path)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	t.Run("sort by size", func(t *testing.T) {
+		expected := []string{"/data/a.warc", "/data/c.warc", "/data/d/e.warc", "/data/d/f.warc", "/data/b.warc", "/data/g.warc"}
+		if got := walk(t, filewalker.WithSort(filewalker.SortSize)); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("sort by name", func(t *testing.T) {
+		expected := []string{"/data/a.warc", "/data/b.warc", "/data/c.warc", "/data/d/e.warc", "/data/d/f.warc", "/data/g.warc"}
+		if got := walk(t, filewalker.WithSort(filewalker.SortName)); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	for _, shardBy := range []string{filewalker.ShardByHash, filewalker.ShardBySize} {
+		t.Run("shard by "+shardBy, func(t *testing.T) {
+			const shards = 3
+			seen := map[string]int{}
+			var totals []int
+			for shard := 1; shard <= shards; shard++ {
+				files := walk(t, filewalker.WithShard(shard, shards, shardBy))
+				// the assignment does not depend on the sort order
+				sorted := walk(t, filewalker.WithShard(shard, shards, shardBy), filewalker.WithSort(filewalker.SortName))
+				if !slices.Equal(files, sorted) {
+					t.Errorf("shard %d: expected %v when sorted, got %v", shard, files, sorted)
+				}
+				total := 0
+				for _, file := range files {
+					seen[file]++
+					total += sizes[file]
+				}
+				totals = append(totals, total)
+			}
+			for name := range sizes {
+				if seen[name] != 1 {
+					t.Errorf("expected %s in exactly one shard, got %d", name, seen[name])
+				}
+			}
+			if shardBy == filewalker.ShardBySize && !slices.Equal(totals, []int{50, 40, 40}) {
+				t.Errorf("expected balanced shard sizes, got %v", totals)
+			}
+		})
+	}
+}
+
+func TestFilewalker_WalkAll_ShardBySize(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+	sizes := map[string]int{
+		"/data/a.warc": 40,
+		"/data/b.warc": 10,
+		"/data/c.warc": 30,
+		"/data/e.warc": 20,
+		"/data/f.warc": 20,
+		"/data/g.warc": 10,
+	}
+	var paths []string
+	for name, size := range sizes {
+		if err := afero.WriteFile(memfs, name, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, name)
+	}
+	slices.Sort(paths)
+
+	const shards = 3
+	seen := map[string]int{}
+	var totals []int
+	for shard := 1; shard <= shards; shard++ {
+		fw := filewalker.New(
+			filewalker.WithFs(memfs),
+			filewalker.WithShard(shard, shards, filewalker.ShardBySize),
+		)
+		total := 0
+		// the files are given as several input paths, like a source file list
+		err := fw.WalkAll(context.Background(), paths, func(_ afero.Fs, path string, err error) error {
+			if err != nil {
+				return err
+			}
+			seen[path]++
+			total += sizes[path]
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		totals = append(totals, total)
+	}
+	for name := range sizes {
+		if seen[name] != 1 {
+			t.Errorf("expected %s in exactly one shard, got %d", name, seen[name])
+		}
+	}
+	if !slices.Equal(totals, []int{50, 40, 40}) {
+		t.Errorf("expected balanced shard sizes, got %v", totals)
+	}
+}
+
+func TestFilewalker_Walk_ShardByHashCleansInputPath(t *testing.T) {
+	memfs := afero.NewMemMapFs()
+	for _, name := range []string{"/data/a.warc", "/data/b.warc", "/data/c.warc", "/data/d.warc"} {
+		if err := afero.WriteFile(memfs, name, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(path string, shard int) []string {
+		fw := filewalker.New(
+			filewalker.WithFs(memfs),
+			filewalker.WithShard(shard, 2, filewalker.ShardByHash),
+		)
+		var got []string
+		err := fw.Walk(context.Background(), path, func(_ afero.Fs, path string, err error) error {
+			if err != nil {
+				return err
+			}
+			got = append(got, filepath.Base(path))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// a trailing slash does not change which files are in a shard
+	for shard := 1; shard <= 2; shard++ {
+		if got, want := walk("/data/", shard), walk("/data", shard); !slices.Equal(got, want) {
+			t.Errorf("shard %d: expected %v, got %v", shard, want, got)
+		}
+	}
+}
+
+func TestParseShard(t *testing.T) {
+	shard, shards, err := filewalker.ParseShard("2/4")
+	if err != nil || shard != 2 || shards != 4 {
+		t.Errorf("expected 2/4, got %d/%d, %v", shard, shards, err)
+	}
+	for _, invalid := range []string{"", "2", "0/4", "5/4", "1/0", "a/b"} {
+		if _, _, err := filewalker.ParseShard(invalid); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
 }
@@ -0,0 +1,103 @@
+package filewalker
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Glob is a compiled glob pattern matching paths.
+//
+// '*' matches any sequence of characters except '/', '?' matches any single character except
+// '/', '[...]' matches a character class and '**' matches any sequence of characters including
+// '/'. A '**/' prefix or '/**/' infix also matches no directories, so '**/tmp/**' matches both
+// 'tmp/a' and 'data/tmp/a'. Patterns without '/' are matched against the base name of paths,
+// others against the whole path.
+type Glob struct {
+	pattern string
+	re      *regexp.Regexp
+	base    bool
+}
+
+// CompileGlob compiles a glob pattern.
+func CompileGlob(pattern string) (*Glob, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' && (i == 1 || pattern[i-2] == '/') {
+					// '**/' matches zero or more directories
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid glob pattern %q: unterminated character class", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	return &Glob{pattern: pattern, re: re, base: !strings.Contains(pattern, "/")}, nil
+}
+
+// CompileGlobs compiles a list of glob patterns.
+func CompileGlobs(patterns []string) ([]*Glob, error) {
+	var globs []*Glob
+	for _, pattern := range patterns {
+		glob, err := CompileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		globs = append(globs, glob)
+	}
+	return globs, nil
+}
+
+func (g *Glob) String() string {
+	return g.pattern
+}
+
+// Match reports whether the path matches the pattern.
+func (g *Glob) Match(path string) bool {
+	path = filepath.ToSlash(path)
+	if g.base {
+		path = path[strings.LastIndexByte(path, '/')+1:]
+	}
+	return g.re.MatchString(path)
+}
+
+// matchAny reports whether the path matches any of the globs.
+func matchAny(globs []*Glob, path string) bool {
+	for _, glob := range globs {
+		if glob.Match(path) {
+			return true
+		}
+	}
+	return false
+}
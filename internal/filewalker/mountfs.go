@@ -0,0 +1,73 @@
+package filewalker
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// mountFs is the filesystem of an archive file found during a walk, addressed by the virtual
+// paths of its files like outer.tar!/inner.zip!/file.warc.gz. Names without the virtual path of
+// the archive as prefix are used as is.
+type mountFs struct {
+	afero.Fs
+	// prefix is the virtual path of the archive followed by '!'
+	prefix string
+}
+
+func (m *mountFs) path(name string) string {
+	if rest, ok := strings.CutPrefix(name, m.prefix); ok {
+		return rest
+	}
+	return name
+}
+
+func (m *mountFs) Create(name string) (afero.File, error) {
+	return m.Fs.Create(m.path(name))
+}
+
+func (m *mountFs) Mkdir(name string, perm os.FileMode) error {
+	return m.Fs.Mkdir(m.path(name), perm)
+}
+
+func (m *mountFs) MkdirAll(path string, perm os.FileMode) error {
+	return m.Fs.MkdirAll(m.path(path), perm)
+}
+
+func (m *mountFs) Open(name string) (afero.File, error) {
+	return m.Fs.Open(m.path(name))
+}
+
+func (m *mountFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	return m.Fs.OpenFile(m.path(name), flag, perm)
+}
+
+func (m *mountFs) Remove(name string) error {
+	return m.Fs.Remove(m.path(name))
+}
+
+func (m *mountFs) RemoveAll(path string) error {
+	return m.Fs.RemoveAll(m.path(path))
+}
+
+func (m *mountFs) Rename(oldname, newname string) error {
+	return m.Fs.Rename(m.path(oldname), m.path(newname))
+}
+
+func (m *mountFs) Stat(name string) (os.FileInfo, error) {
+	return m.Fs.Stat(m.path(name))
+}
+
+func (m *mountFs) Chmod(name string, mode os.FileMode) error {
+	return m.Fs.Chmod(m.path(name), mode)
+}
+
+func (m *mountFs) Chown(name string, uid, gid int) error {
+	return m.Fs.Chown(m.path(name), uid, gid)
+}
+
+func (m *mountFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return m.Fs.Chtimes(m.path(name), atime, mtime)
+}
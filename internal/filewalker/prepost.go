@@ -15,10 +15,19 @@ var ErrSkipFile = errors.New("skip file")
 
 type FileHandler func(fs afero.Fs, path string) (stat.Result, error)
 
-// Preposterous wraps the PrePostHook function with result caching.
+// Preposterous wraps the PrePostHook function with result caching. Cached results are only
+// reused if the file has the same fingerprint as when it was processed.
 func Preposterous(fs afero.Fs, path string, preHook hooks.OpenInputFileHook, postHook hooks.CloseInputFileHook, fileIndex *index.FileIndex, fn FileHandler) (stat.Result, error) {
+	var fingerprint index.Fingerprint
 	if fileIndex != nil {
-		result, err := fileIndex.GetFileStats(path)
+		var err error
+		// the fingerprint is taken before processing, so changes while processing are detected
+		// by the next run
+		fingerprint, err = fileIndex.Fingerprint(fs, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file fingerprint: %w", err)
+		}
+		result, err := fileIndex.GetFileStats(path, fingerprint)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get file stats: %w", err)
 		}
@@ -31,7 +40,7 @@ func Preposterous(fs afero.Fs, path string, preHook hooks.OpenInputFileHook, pos
 	result, resultErr := PrePostHook(fs, path, preHook, postHook, fn)
 
 	if fileIndex != nil && resultErr == nil {
-		if err := fileIndex.SaveFileStats(path, result); err != nil {
+		if err := fileIndex.SaveFileStats(path, fingerprint, result); err != nil {
 			return nil, fmt.Errorf("failed to save file stats: %w", err)
 		}
 	}
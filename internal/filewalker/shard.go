@@ -0,0 +1,180 @@
+package filewalker
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Orders of the files passed to the walk function.
+const (
+	// SortNone passes files as they are found, which is by name within each directory
+	SortNone = ""
+	// SortName passes files ordered by path
+	SortName = "name"
+	// SortSize passes the largest files first, which lets concurrent workers finish at about
+	// the same time
+	SortSize = "size"
+)
+
+// Ways files are assigned to shards.
+const (
+	// ShardByHash assigns files to shards by the hash of their path
+	ShardByHash = "hash"
+	// ShardBySize assigns files to shards so that the shards have about the same total size
+	ShardBySize = "size"
+)
+
+// ParseShard parses a shard given as i/n, where i is the 1-based index of the shard and n the
+// number of shards.
+func ParseShard(s string) (shard int, shards int, err error) {
+	i, n, ok := strings.Cut(s, "/")
+	if ok {
+		shard, err = strconv.Atoi(strings.TrimSpace(i))
+		if err == nil {
+			shards, err = strconv.Atoi(strings.TrimSpace(n))
+		}
+	}
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("invalid shard '%s': must be i/n, like 1/4", s)
+	}
+	if shards < 1 || shard < 1 || shard > shards {
+		return 0, 0, fmt.Errorf("invalid shard '%s': index must be from 1 to the number of shards", s)
+	}
+	return shard, shards, nil
+}
+
+// shardKey returns the path of a file relative to the directory of the input path it was found
+// in, so that hosts with the input mounted at different places assign files the same way.
+func shardKey(root string, path string) string {
+	rel, err := filepath.Rel(filepath.Dir(filepath.Clean(root)), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// hashShard returns the 1-based shard of n a key is assigned to.
+func hashShard(key string, n int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum64()%uint64(n)) + 1
+}
+
+type walkedFile struct {
+	fs   afero.Fs
+	path string
+	key  string
+	size int64
+}
+
+// sizeShards assigns files to n shards by handing the largest remaining file to the shard with
+// the smallest total size, or with the fewest files if equal, and returns the 1-based shard of
+// each file. The assignment only depends on the keys and sizes of the files.
+func sizeShards(files []walkedFile, n int) []int {
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := files[order[i]], files[order[j]]
+		if a.size != b.size {
+			return a.size > b.size
+		}
+		return a.key < b.key
+	})
+
+	sizes := make([]int64, n)
+	counts := make([]int, n)
+	assigned := make([]int, len(files))
+	for _, i := range order {
+		shard := 0
+		for s := 1; s < n; s++ {
+			if sizes[s] < sizes[shard] || (sizes[s] == sizes[shard] && counts[s] < counts[shard]) {
+				shard = s
+			}
+		}
+		sizes[shard] += files[i].size
+		counts[shard]++
+		assigned[i] = shard + 1
+	}
+	return assigned
+}
+
+// walkSorted lists the files below the paths before passing those of the shard to walkFn in the
+// sort order, one path after the other. Files are assigned to shards over all paths. Errors are
+// passed to walkFn as they are found.
+func (fw *FileWalker) walkSorted(ctx context.Context, paths []string, walkFn func(fs afero.Fs, path string, err error) error) error {
+	// the files of each path
+	inputs := make([][]walkedFile, len(paths))
+	for i, path := range paths {
+		err := fw.walkDir(ctx, fw.Fs, path, path, "", func(fs afero.Fs, name string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return walkFn(fs, name, err)
+			}
+			inputs[i] = append(inputs[i], walkedFile{fs: fs, path: name, key: shardKey(path, name), size: info.Size()})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if fw.Shards > 1 {
+		fw.inShard(inputs)
+	}
+
+	for _, files := range inputs {
+		switch fw.Sort {
+		case SortName:
+			sort.SliceStable(files, func(i, j int) bool { return files[i].path < files[j].path })
+		case SortSize:
+			sort.SliceStable(files, func(i, j int) bool {
+				if files[i].size != files[j].size {
+					return files[i].size > files[j].size
+				}
+				return files[i].path < files[j].path
+			})
+		}
+
+		for _, file := range files {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := walkFn(file.fs, file.path, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inShard keeps the files of each input in the shard of the walker.
+func (fw *FileWalker) inShard(inputs [][]walkedFile) {
+	var assigned []int
+	if fw.ShardBy == ShardBySize {
+		var files []walkedFile
+		for _, input := range inputs {
+			files = append(files, input...)
+		}
+		assigned = sizeShards(files, fw.Shards)
+	}
+	i := 0
+	for n, input := range inputs {
+		shard := input[:0]
+		for _, file := range input {
+			if assigned != nil && assigned[i] == fw.Shard || assigned == nil && hashShard(file.key, fw.Shards) == fw.Shard {
+				shard = append(shard, file)
+			}
+			i++
+		}
+		inputs[n] = shard
+	}
+}
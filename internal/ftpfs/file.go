@@ -3,7 +3,10 @@ package ftpfs
 import (
 	"io"
 	"os"
+	"path"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/jackc/puddle"
 	"github.com/jlaffaye/ftp"
@@ -152,3 +155,114 @@ func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 func (f *File) WriteString(s string) (ret int, err error) {
 	return 0, syscall.EROFS
 }
+
+// writeFile is a file opened for writing. The content is streamed to the server as it is
+// written and the temporary file renamed when the file is closed.
+type writeFile struct {
+	resource *puddle.Resource
+	name     string
+	fullName string
+	tmpName  string
+	pw       *io.PipeWriter
+	done     chan error
+	size     int64
+	closed   bool
+}
+
+func newWriteFile(res *puddle.Resource, name string, fullName string) *writeFile {
+	dir, base := path.Split(fullName)
+	f := &writeFile{
+		resource: res,
+		name:     name,
+		fullName: fullName,
+		tmpName:  dir + "." + base + "." + strconv.FormatInt(time.Now().UnixNano(), 36) + ".tmp",
+		done:     make(chan error, 1),
+	}
+	pr, pw := io.Pipe()
+	f.pw = pw
+	go func() {
+		err := f.ftpClient().Stor(f.tmpName, pr)
+		// stop writes if the upload failed
+		_ = pr.CloseWithError(err)
+		f.done <- err
+	}()
+	return f
+}
+
+func (f *writeFile) ftpClient() *ftp.ServerConn {
+	return f.resource.Value().(*ftp.ServerConn)
+}
+
+func (f *writeFile) Write(b []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := f.pw.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *writeFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Close completes the upload and renames the temporary file to the name of the file. If the
+// upload failed, the temporary file is removed.
+func (f *writeFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	defer f.resource.Release()
+
+	_ = f.pw.Close()
+	err := <-f.done
+	if err == nil {
+		err = f.ftpClient().Rename(f.tmpName, f.fullName)
+	}
+	if err != nil {
+		_ = f.ftpClient().Delete(f.tmpName)
+		return &os.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+func (f *writeFile) Name() string {
+	return f.name
+}
+
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	return &FileInfo{entry: &ftp.Entry{Name: path.Base(f.fullName), Type: ftp.EntryTypeFile, Size: uint64(f.size), Time: time.Now()}, fullName: f.fullName}, nil
+}
+
+func (f *writeFile) Sync() error {
+	return nil
+}
+
+func (f *writeFile) Truncate(size int64) error {
+	return syscall.ENOTSUP
+}
+
+func (f *writeFile) Read(b []byte) (int, error) {
+	return 0, syscall.EBADF
+}
+
+func (f *writeFile) ReadAt(b []byte, off int64) (int, error) {
+	return 0, syscall.EBADF
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, syscall.ESPIPE
+}
+
+func (f *writeFile) WriteAt(b []byte, off int64) (int, error) {
+	return 0, syscall.ESPIPE
+}
+
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, syscall.ENOTDIR
+}
+
+func (f *writeFile) Readdirnames(n int) ([]string, error) {
+	return nil, syscall.ENOTDIR
+}
@@ -2,7 +2,12 @@ package ftpfs
 
 import (
 	"context"
+	"errors"
+	"net/textproto"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,9 +22,12 @@ import (
 // package available at github.com/jlaffaye/ftp.
 type Fs struct {
 	pool *puddle.Pool
+	root string
 }
 
-func New(addr, user, passwd string, poolSize int32) afero.Fs {
+// New returns a filesystem for the files below root on the FTP server at addr. If root is
+// empty, paths are used as given, so relative paths are relative to the login directory.
+func New(addr, user, passwd, root string, poolSize int32) afero.Fs {
 	constructor := func(ctx context.Context) (any, error) {
 		c, err := ftp.Dial(addr, ftp.DialWithContext(ctx))
 		if err != nil {
@@ -39,21 +47,73 @@ func New(addr, user, passwd string, poolSize int32) afero.Fs {
 	pool := puddle.NewPool(constructor, destructor, poolSize)
 	return &Fs{
 		pool: pool,
+		root: root,
 	}
 }
 
 func (s Fs) Name() string { return "ftpfs" }
 
+// path returns the path of name on the server.
+func (s Fs) path(name string) string {
+	name = filepath.ToSlash(name)
+	if s.root == "" {
+		return name
+	}
+	return path.Join(s.root, name)
+}
+
+// do calls fn with a connection of the pool.
+func (s Fs) do(fn func(c *ftp.ServerConn) error) error {
+	res, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer res.Release()
+	return fn(res.Value().(*ftp.ServerConn))
+}
+
+// Create creates a file for writing. The content is uploaded to a temporary name in the same
+// directory and renamed to name when the file is closed, so a file is never seen partially
+// written. The file holds a connection of the pool until it is closed.
 func (s Fs) Create(name string) (afero.File, error) {
-	return nil, syscall.EROFS
+	res, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return newWriteFile(res, name, s.path(name)), nil
 }
 
 func (s Fs) Mkdir(name string, perm os.FileMode) error {
-	return syscall.EROFS
+	return s.do(func(c *ftp.ServerConn) error {
+		return c.MakeDir(s.path(name))
+	})
 }
 
-func (s Fs) MkdirAll(path string, perm os.FileMode) error {
-	return syscall.EROFS
+// MkdirAll creates the directories of path that do not exist. A directory is known to exist if
+// it can be made the working directory.
+func (s Fs) MkdirAll(name string, perm os.FileMode) error {
+	return s.do(func(c *ftp.ServerConn) error {
+		return withCurrentDir(c, func() error {
+			full := s.path(name)
+			var dir string
+			if strings.HasPrefix(full, "/") {
+				dir = "/"
+			}
+			for _, elem := range strings.Split(full, "/") {
+				if elem == "" || elem == "." {
+					continue
+				}
+				dir = path.Join(dir, elem)
+				if err := c.ChangeDir(dir); err == nil {
+					continue
+				}
+				if err := c.MakeDir(dir); err != nil {
+					return &os.PathError{Op: "mkdir", Path: dir, Err: err}
+				}
+			}
+			return nil
+		})
+	})
 }
 
 func (s Fs) Open(name string) (afero.File, error) {
@@ -61,26 +121,56 @@ func (s Fs) Open(name string) (afero.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	return FileOpen(res, name)
+	f, err := FileOpen(res, s.path(name))
+	if err != nil {
+		res.Release()
+		return nil, err
+	}
+	return f, nil
 }
 
 func (s Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
 	if flag == os.O_RDONLY {
 		return s.Open(name)
 	}
-	return nil, syscall.EROFS
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 && flag&os.O_CREATE != 0 && flag&os.O_APPEND == 0 {
+		return s.Create(name)
+	}
+	return nil, syscall.ENOTSUP
 }
 
+// Remove removes a file or an empty directory.
 func (s Fs) Remove(name string) error {
-	return syscall.EROFS
+	return s.do(func(c *ftp.ServerConn) error {
+		err := c.Delete(s.path(name))
+		if err != nil && c.RemoveDir(s.path(name)) == nil {
+			return nil
+		}
+		return err
+	})
 }
 
-func (s Fs) RemoveAll(path string) error {
-	return syscall.EROFS
+// RemoveAll removes a file or a directory and its content. Since FTP servers reply the same to
+// missing and inaccessible files, it is not an error if name could not be found.
+func (s Fs) RemoveAll(name string) error {
+	return s.do(func(c *ftp.ServerConn) error {
+		if c.Delete(s.path(name)) == nil {
+			return nil
+		}
+		return withCurrentDir(c, func() error {
+			err := c.RemoveDirRecur(s.path(name))
+			if isFileUnavailable(err) {
+				return nil
+			}
+			return err
+		})
+	})
 }
 
 func (s Fs) Rename(oldname, newname string) error {
-	return syscall.EROFS
+	return s.do(func(c *ftp.ServerConn) error {
+		return c.Rename(s.path(oldname), s.path(newname))
+	})
 }
 
 func (s Fs) Stat(name string) (os.FileInfo, error) {
@@ -93,13 +183,33 @@ func (s Fs) Stat(name string) (os.FileInfo, error) {
 }
 
 func (s Fs) Chmod(name string, mode os.FileMode) error {
-	return syscall.EROFS
+	return syscall.ENOTSUP
 }
 
 func (s Fs) Chown(name string, uid, gid int) error {
-	return syscall.EROFS
+	return syscall.ENOTSUP
 }
 
 func (s Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	return syscall.EROFS
+	return syscall.ENOTSUP
+}
+
+// withCurrentDir calls fn and restores the working directory of the connection, which is
+// changed by fn, since relative paths of later users of the connection are resolved against it.
+func withCurrentDir(c *ftp.ServerConn, fn func() error) error {
+	cwd, err := c.CurrentDir()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	if cdErr := c.ChangeDir(cwd); err == nil {
+		err = cdErr
+	}
+	return err
+}
+
+// isFileUnavailable reports whether err is the reply of the server to a missing file.
+func isFileUnavailable(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code == ftp.StatusFileUnavailable
 }
@@ -0,0 +1,251 @@
+package ftpfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// fakeFtp is an in-memory stand-in for the parts of an FTP server used by Fs.
+type fakeFtp struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+	// stored holds the names files were uploaded to
+	stored []string
+}
+
+func newFakeFtp(t *testing.T) (*fakeFtp, string) {
+	f := &fakeFtp{files: make(map[string][]byte), dirs: map[string]bool{"/": true}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, listener.Addr().String()
+}
+
+func (f *fakeFtp) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	cwd := "/"
+	var data net.Listener
+	var renameFrom string
+
+	reply("220 ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		name := path.Join(cwd, arg)
+		if strings.HasPrefix(arg, "/") {
+			name = path.Clean(arg)
+		}
+
+		f.mu.Lock()
+		switch cmd {
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 ok")
+		case "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "STOR":
+			reply("150 ok")
+			f.mu.Unlock()
+			dataConn, _ := data.Accept()
+			content, _ := io.ReadAll(dataConn)
+			_ = dataConn.Close()
+			_ = data.Close()
+			f.mu.Lock()
+			f.files[name] = content
+			f.stored = append(f.stored, name)
+			reply("226 done")
+		case "LIST":
+			if !f.dirs[name] {
+				_ = data.Close()
+				reply("550 not found")
+				break
+			}
+			reply("150 ok")
+			dataConn, _ := data.Accept()
+			for _, entry := range f.entries(name) {
+				if f.dirs[path.Join(name, entry)] {
+					_, _ = fmt.Fprintf(dataConn, "drwxr-xr-x 1 ftp ftp 0 Jan 02 2024 %s\r\n", entry)
+				} else {
+					_, _ = fmt.Fprintf(dataConn, "-rw-r--r-- 1 ftp ftp %d Jan 02 2024 %s\r\n", len(f.files[path.Join(name, entry)]), entry)
+				}
+			}
+			_ = dataConn.Close()
+			_ = data.Close()
+			reply("226 done")
+		case "RNFR":
+			renameFrom = name
+			reply("350 ready")
+		case "RNTO":
+			if content, ok := f.files[renameFrom]; ok {
+				delete(f.files, renameFrom)
+				f.files[name] = content
+				reply("250 ok")
+			} else {
+				reply("550 not found")
+			}
+		case "MKD":
+			if f.dirs[name] || !f.dirs[path.Dir(name)] {
+				reply("550 cannot create")
+			} else {
+				f.dirs[name] = true
+				reply("257 created")
+			}
+		case "CWD":
+			if f.dirs[name] {
+				cwd = name
+				reply("250 ok")
+			} else {
+				reply("550 not found")
+			}
+		case "CDUP":
+			cwd = path.Dir(cwd)
+			reply("250 ok")
+		case "PWD":
+			reply(`257 "%s"`, cwd)
+		case "DELE":
+			if _, ok := f.files[name]; ok {
+				delete(f.files, name)
+				reply("250 ok")
+			} else {
+				reply("550 not found")
+			}
+		case "RMD":
+			if f.dirs[name] && len(f.entries(name)) == 0 {
+				delete(f.dirs, name)
+				reply("250 ok")
+			} else {
+				reply("550 cannot remove")
+			}
+		case "QUIT":
+			reply("221 bye")
+			f.mu.Unlock()
+			return
+		default:
+			reply("502 not implemented")
+		}
+		f.mu.Unlock()
+	}
+}
+
+// entries returns the sorted names of the files and directories in dir.
+func (f *fakeFtp) entries(dir string) []string {
+	var names []string
+	for name := range f.files {
+		if path.Dir(name) == dir {
+			names = append(names, path.Base(name))
+		}
+	}
+	for name := range f.dirs {
+		if name != "/" && path.Dir(name) == dir {
+			names = append(names, path.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCreate(t *testing.T) {
+	fake, addr := newFakeFtp(t)
+	fs := New(addr, "user", "secret", "/out", 1)
+
+	if err := fs.MkdirAll("2024/01", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.dirs["/out"] || !fake.dirs["/out/2024/01"] {
+		t.Fatalf("expected directories to be created, got %v", fake.dirs)
+	}
+	// existing directories are not an error
+	if err := fs.MkdirAll("2024", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Create("2024/01/file.warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("content"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(fake.files["/out/2024/01/file.warc.gz"]); got != "content" {
+		t.Errorf("expected content, got %q", got)
+	}
+	if len(fake.stored) != 1 || !strings.HasPrefix(fake.stored[0], "/out/2024/01/.file.warc.gz.") {
+		t.Errorf("expected upload to a temporary name, got %v", fake.stored)
+	}
+	if len(fake.files) != 1 {
+		t.Errorf("expected temporary file to be renamed, got %v", fake.files)
+	}
+}
+
+func TestRenameRemove(t *testing.T) {
+	fake, addr := newFakeFtp(t)
+	fake.dirs["/a"] = true
+	fake.dirs["/a/b"] = true
+	fake.files["/a/b/c.warc"] = []byte("c")
+	fake.files["/a/d.warc"] = []byte("d")
+	fake.files["/e.warc"] = []byte("e")
+	fs := New(addr, "user", "secret", "", 1)
+
+	if err := fs.Rename("/e.warc", "/f.warc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/f.warc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/a"); err == nil {
+		t.Error("expected error removing directory that is not empty")
+	}
+	if err := fs.RemoveAll("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("/missing"); err != nil {
+		t.Errorf("expected no error removing missing file, got %v", err)
+	}
+	if len(fake.files) != 0 || len(fake.dirs) != 1 {
+		t.Errorf("expected everything to be removed, got %v and %v", fake.files, fake.dirs)
+	}
+
+	// the working directory is restored for later users of the connection
+	if err := afero.WriteFile(fs, "g.warc", []byte("g"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.files["/g.warc"]; !ok {
+		t.Errorf("expected file in the login directory, got %v", fake.files)
+	}
+}
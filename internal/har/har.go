@@ -0,0 +1,294 @@
+// Package har implements the parts of the HTTP Archive (HAR) 1.2 format needed to move
+// request/response pairs between HAR files and WARC records.
+//
+// See http://www.softwareishard.com/blog/har-12-spec/
+package har
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const Version = "1.2"
+
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string   `json:"version"`
+	Creator Creator  `json:"creator"`
+	Browser *Creator `json:"browser,omitempty"`
+	Pages   []Page   `json:"pages,omitempty"`
+	Entries []Entry  `json:"entries"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Page struct {
+	StartedDateTime string `json:"startedDateTime"`
+	ID              string `json:"id"`
+	Title           string `json:"title"`
+}
+
+type Entry struct {
+	Pageref         string   `json:"pageref,omitempty"`
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"`
+	Connection      string   `json:"connection,omitempty"`
+	Comment         string   `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type PostData struct {
+	MimeType string      `json:"mimeType"`
+	Params   []NameValue `json:"params,omitempty"`
+	Text     string      `json:"text"`
+}
+
+type Content struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// Decode reads a HAR document.
+func Decode(r io.Reader) (*HAR, error) {
+	var h HAR
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return nil, fmt.Errorf("failed to decode HAR: %w", err)
+	}
+	return &h, nil
+}
+
+// Decoder reads the entries of a HAR document one at a time, so that the entries do not have
+// to be held in memory. Members of the log other than the entries are skipped.
+type Decoder struct {
+	decoder *json.Decoder
+	started bool
+	done    bool
+}
+
+// NewDecoder returns a decoder reading a HAR document from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{decoder: json.NewDecoder(r)}
+}
+
+// start reads the document up to the first entry. It reports whether the log has entries.
+func (d *Decoder) start() (bool, error) {
+	if err := d.expectDelim('{'); err != nil {
+		return false, err
+	}
+	if found, err := d.findMember("log"); !found || err != nil {
+		return false, err
+	}
+	if err := d.expectDelim('{'); err != nil {
+		return false, err
+	}
+	if found, err := d.findMember("entries"); !found || err != nil {
+		return false, err
+	}
+	if err := d.expectDelim('['); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// findMember skips the members of an object until the member named name and reports whether it
+// was found before the end of the object.
+func (d *Decoder) findMember(name string) (bool, error) {
+	for d.decoder.More() {
+		token, err := d.decoder.Token()
+		if err != nil {
+			return false, err
+		}
+		if token == name {
+			return true, nil
+		}
+		var skip json.RawMessage
+		if err := d.decoder.Decode(&skip); err != nil {
+			return false, err
+		}
+	}
+	return false, d.expectDelim('}')
+}
+
+func (d *Decoder) expectDelim(delim json.Delim) error {
+	token, err := d.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected '%s', got %v", delim, token)
+	}
+	return nil
+}
+
+// Next returns the next entry of the document, or io.EOF after the last entry.
+func (d *Decoder) Next() (Entry, error) {
+	if d.done {
+		return Entry{}, io.EOF
+	}
+	if !d.started {
+		d.started = true
+		hasEntries, err := d.start()
+		if err != nil {
+			d.done = true
+			return Entry{}, fmt.Errorf("failed to decode HAR: %w", err)
+		}
+		if !hasEntries {
+			d.done = true
+			return Entry{}, io.EOF
+		}
+	}
+	if !d.decoder.More() {
+		d.done = true
+		if err := d.expectDelim(']'); err != nil {
+			return Entry{}, fmt.Errorf("failed to decode HAR: %w", err)
+		}
+		return Entry{}, io.EOF
+	}
+	var entry Entry
+	if err := d.decoder.Decode(&entry); err != nil {
+		d.done = true
+		return Entry{}, fmt.Errorf("failed to decode HAR entry: %w", err)
+	}
+	return entry, nil
+}
+
+// Encode writes a HAR document as indented JSON.
+func Encode(w io.Writer, h *HAR) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(h); err != nil {
+		return fmt.Errorf("failed to encode HAR: %w", err)
+	}
+	return nil
+}
+
+// New returns an empty HAR document with the given creator.
+func New(creator Creator) *HAR {
+	return &HAR{Log: Log{Version: Version, Creator: creator, Entries: []Entry{}}}
+}
+
+// Encoder writes a HAR document one entry at a time, so that the entries do not have to be
+// held in memory. The document is complete when the encoder is closed.
+type Encoder struct {
+	w       io.Writer
+	creator Creator
+	entries int
+	started bool
+}
+
+// NewEncoder returns an encoder writing a HAR document with the given creator to w.
+func NewEncoder(w io.Writer, creator Creator) *Encoder {
+	return &Encoder{w: w, creator: creator}
+}
+
+func (e *Encoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	creator, err := json.MarshalIndent(e.creator, "    ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode HAR: %w", err)
+	}
+	version, _ := json.Marshal(Version)
+	_, err = fmt.Fprintf(e.w, "{\n  \"log\": {\n    \"version\": %s,\n    \"creator\": %s,\n    \"entries\": [", version, creator)
+	return err
+}
+
+// Encode writes an entry.
+func (e *Encoder) Encode(entry Entry) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(entry, "      ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode HAR entry: %w", err)
+	}
+	separator := ",\n      "
+	if e.entries == 0 {
+		separator = "\n      "
+	}
+	e.entries++
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+// Close ends the document. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	end := "\n    ]\n  }\n}\n"
+	if e.entries == 0 {
+		end = "]\n  }\n}\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
@@ -0,0 +1,216 @@
+package har
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHar = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "WebInspector", "version": "537.36"},
+    "entries": [
+      {
+        "startedDateTime": "2024-01-01T12:00:00.000Z",
+        "time": 12.5,
+        "request": {
+          "method": "POST",
+          "url": "https://example.com/form?a=1",
+          "httpVersion": "h2",
+          "headers": [
+            {"name": ":authority", "value": "example.com"},
+            {"name": "content-type", "value": "application/x-www-form-urlencoded"},
+            {"name": "content-length", "value": "999"}
+          ],
+          "queryString": [{"name": "a", "value": "1"}],
+          "cookies": [],
+          "postData": {"mimeType": "application/x-www-form-urlencoded", "text": "b=2"},
+          "headersSize": -1,
+          "bodySize": 3
+        },
+        "response": {
+          "status": 200,
+          "statusText": "",
+          "httpVersion": "h2",
+          "headers": [
+            {"name": "content-type", "value": "image/gif"},
+            {"name": "content-encoding", "value": "gzip"}
+          ],
+          "cookies": [],
+          "content": {"size": 3, "mimeType": "image/gif", "text": "R0lG", "encoding": "base64"},
+          "redirectURL": "",
+          "headersSize": -1,
+          "bodySize": -1
+        },
+        "cache": {},
+        "timings": {"send": 1, "wait": 10, "receive": 1.5}
+      }
+    ]
+  }
+}`
+
+func TestDecode(t *testing.T) {
+	h, err := Decode(strings.NewReader(testHar))
+	require.NoError(t, err)
+	require.Len(t, h.Log.Entries, 1)
+	assert.Equal(t, "WebInspector", h.Log.Creator.Name)
+	assert.Equal(t, "https://example.com/form?a=1", h.Log.Entries[0].Request.URL)
+
+	_, err = Decode(strings.NewReader("{"))
+	assert.Error(t, err)
+}
+
+func TestDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf, Creator{Name: "warc", Version: "test"})
+	for _, url := range []string{"https://example.com/1", "https://example.com/2"} {
+		require.NoError(t, encoder.Encode(Entry{Request: NewRequest(http.MethodGet, url, "HTTP/1.1", http.Header{}, nil)}))
+	}
+	require.NoError(t, encoder.Close())
+
+	tests := []struct {
+		name string
+		har  string
+		want []string
+	}{
+		{"single entry", testHar, []string{"https://example.com/form?a=1"}},
+		{"encoded", buf.String(), []string{"https://example.com/1", "https://example.com/2"}},
+		{"members after and before entries", `{"log": {"pages": [{"id": "p"}], "entries": [{"request": {"url": "a"}}], "comment": "c"}, "x": 1}`, []string{"a"}},
+		{"no entries", `{"log": {"version": "1.2"}}`, nil},
+		{"empty entries", `{"log": {"entries": []}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(tt.har))
+			var got []string
+			for {
+				entry, err := decoder.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, entry.Request.URL)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, invalid := range []string{"{", `{"log": []}`, `{"log": {"entries": [{"request": 1}]}}`, `{"log": {"entries": [{}`} {
+		decoder := NewDecoder(strings.NewReader(invalid))
+		var err error
+		for err == nil {
+			_, err = decoder.Next()
+		}
+		assert.NotEqual(t, io.EOF, err, invalid)
+	}
+}
+
+func TestHTTPVersion(t *testing.T) {
+	tests := map[string]string{
+		"":         "HTTP/1.1",
+		"http/1.0": "HTTP/1.0",
+		"HTTP/1.1": "HTTP/1.1",
+		"h2":       "HTTP/2.0",
+		"http/2.0": "HTTP/2.0",
+		"h3":       "HTTP/3.0",
+		"unknown":  "HTTP/1.1",
+	}
+	for version, want := range tests {
+		assert.Equal(t, want, HTTPVersion(version), version)
+	}
+}
+
+func TestRequest_HTTPMessage(t *testing.T) {
+	h, err := Decode(strings.NewReader(testHar))
+	require.NoError(t, err)
+
+	message, err := h.Log.Entries[0].Request.HTTPMessage()
+	require.NoError(t, err)
+
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(message)))
+	require.NoError(t, err)
+	assert.Equal(t, "POST", request.Method)
+	assert.Equal(t, "/form?a=1", request.RequestURI)
+	assert.Equal(t, "example.com", request.Host)
+	assert.Equal(t, int64(3), request.ContentLength)
+	assert.Empty(t, request.Header.Get(":authority"))
+}
+
+func TestResponse_HTTPMessage(t *testing.T) {
+	h, err := Decode(strings.NewReader(testHar))
+	require.NoError(t, err)
+
+	message, err := h.Log.Entries[0].Response.HTTPMessage()
+	require.NoError(t, err)
+
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(message)), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "200 OK", response.Status)
+	assert.Equal(t, 2, response.ProtoMajor)
+	assert.Equal(t, int64(3), response.ContentLength)
+	assert.Empty(t, response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "gzip", response.Header.Get("X-Archive-Orig-Content-Encoding"))
+	assert.True(t, strings.HasSuffix(string(message), "GIF"))
+
+	invalid := Response{Status: 200, Content: Content{Text: "!", Encoding: "base64"}}
+	_, err = invalid.HTTPMessage()
+	assert.Error(t, err)
+}
+
+func TestNewResponse(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte("<html>hello</html>"))
+	require.NoError(t, gz.Close())
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Encoding", "gzip")
+	header.Set("Location", "https://example.com/next")
+
+	response := NewResponse("HTTP/1.1", 301, "301 Moved Permanently", header, compressed.Bytes())
+	assert.Equal(t, "Moved Permanently", response.StatusText)
+	assert.Equal(t, "<html>hello</html>", response.Content.Text)
+	assert.Empty(t, response.Content.Encoding)
+	assert.Equal(t, int64(18), response.Content.Size)
+	assert.Equal(t, "https://example.com/next", response.RedirectURL)
+
+	binary := NewResponse("HTTP/1.1", 200, "200 OK", http.Header{"Content-Type": {"image/gif"}}, []byte("GIF"))
+	assert.Equal(t, "base64", binary.Content.Encoding)
+	assert.Equal(t, "R0lG", binary.Content.Text)
+}
+
+func TestNewRequest(t *testing.T) {
+	request := NewRequest("GET", "https://example.com/?b=2&a=1", "HTTP/1.1", http.Header{"Accept": {"*/*"}}, nil)
+	assert.Equal(t, []NameValue{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}, request.QueryString)
+	assert.Equal(t, []NameValue{{Name: "Accept", Value: "*/*"}}, request.Headers)
+	assert.Nil(t, request.PostData)
+}
+
+func TestEncoder(t *testing.T) {
+	for _, entries := range []int{0, 2} {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf, Creator{Name: "warc", Version: "test"})
+		for i := 0; i < entries; i++ {
+			entry := Entry{StartedDateTime: "2024-01-01T12:00:00Z"}
+			entry.Request = NewRequest(http.MethodGet, "https://example.com/", "HTTP/1.1", http.Header{}, nil)
+			require.NoError(t, encoder.Encode(entry))
+		}
+		require.NoError(t, encoder.Close())
+
+		h, err := Decode(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, Version, h.Log.Version)
+		assert.Equal(t, "warc", h.Log.Creator.Name)
+		assert.Len(t, h.Log.Entries, entries)
+	}
+}
@@ -0,0 +1,237 @@
+package har
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// origHeaderPrefix is prepended to headers that no longer describe the body after conversion.
+const origHeaderPrefix = "X-Archive-Orig-"
+
+// HTTPVersion normalizes the HTTP version of a HAR entry into a protocol string accepted by
+// HTTP parsers, e.g. "h2" becomes "HTTP/2.0". An empty version defaults to HTTP/1.1.
+func HTTPVersion(version string) string {
+	switch v := strings.ToUpper(strings.TrimSpace(version)); v {
+	case "":
+		return "HTTP/1.1"
+	case "H2", "HTTP/2", "HTTP/2.0":
+		return "HTTP/2.0"
+	case "H3", "HTTP/3", "HTTP/3.0":
+		return "HTTP/3.0"
+	default:
+		if !strings.HasPrefix(v, "HTTP/") {
+			return "HTTP/1.1"
+		}
+		return v
+	}
+}
+
+// HTTPMessage returns the request as a raw HTTP message.
+func (r Request) HTTPMessage() ([]byte, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request url: %w", err)
+	}
+	var body []byte
+	if r.PostData != nil {
+		body = []byte(r.PostData.Text)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s %s\r\n", r.Method, u.RequestURI(), HTTPVersion(r.HTTPVersion))
+	header := headerOf(r.Headers, len(body))
+	if header.Get("Host") == "" && u.Host != "" {
+		header.Set("Host", u.Host)
+	}
+	writeHeader(&buf, header)
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// HTTPMessage returns the response as a raw HTTP message.
+//
+// HAR stores the decoded content, so Content-Encoding and Transfer-Encoding are renamed
+// with an X-Archive-Orig- prefix and Content-Length is set to the length of the content.
+func (r Response) HTTPMessage() ([]byte, error) {
+	body := []byte(r.Content.Text)
+	if r.Content.Encoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.Content.Text); err != nil {
+			return nil, fmt.Errorf("invalid base64 content: %w", err)
+		}
+	}
+
+	statusText := r.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(r.Status)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d %s\r\n", HTTPVersion(r.HTTPVersion), r.Status, statusText)
+	writeHeader(&buf, headerOf(r.Headers, len(body)))
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// headerOf converts HAR headers into a http.Header describing a body of the given length.
+// HTTP/2 pseudo headers are dropped.
+func headerOf(headers []NameValue, bodyLength int) http.Header {
+	header := http.Header{}
+	for _, h := range headers {
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		switch http.CanonicalHeaderKey(h.Name) {
+		case "Content-Length":
+			continue
+		case "Content-Encoding", "Transfer-Encoding":
+			header.Add(origHeaderPrefix+h.Name, h.Value)
+		default:
+			header.Add(h.Name, h.Value)
+		}
+	}
+	if bodyLength > 0 {
+		header.Set("Content-Length", strconv.Itoa(bodyLength))
+	}
+	return header
+}
+
+func writeHeader(buf *bytes.Buffer, header http.Header) {
+	_ = header.Write(buf)
+	buf.WriteString("\r\n")
+}
+
+// NewRequest creates a HAR request from the parts of a HTTP request.
+func NewRequest(method string, target string, protocol string, header http.Header, body []byte) Request {
+	request := Request{
+		Method:      method,
+		URL:         target,
+		HTTPVersion: protocol,
+		Cookies:     []Cookie{},
+		Headers:     nameValues(header),
+		QueryString: []NameValue{},
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	if u, err := url.Parse(target); err == nil {
+		request.QueryString = queryString(u.Query())
+	}
+	if len(body) > 0 {
+		request.PostData = &PostData{MimeType: header.Get("Content-Type"), Text: string(body)}
+	}
+	return request
+}
+
+// NewResponse creates a HAR response from the parts of a HTTP response. The body is decoded
+// according to its Transfer-Encoding and Content-Encoding before it is stored as content.
+func NewResponse(protocol string, status int, statusText string, header http.Header, body []byte) Response {
+	content := Content{MimeType: header.Get("Content-Type")}
+	if decoded, err := decodeBody(header, body); err == nil {
+		content.Compression = int64(len(body) - len(decoded))
+		body = decoded
+	}
+	content.Size = int64(len(body))
+	if len(body) > 0 {
+		if isText(content.MimeType) && utf8.Valid(body) {
+			content.Text = string(body)
+		} else {
+			content.Text = base64.StdEncoding.EncodeToString(body)
+			content.Encoding = "base64"
+		}
+	}
+	return Response{
+		Status:      status,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(statusText, strconv.Itoa(status))),
+		HTTPVersion: protocol,
+		Cookies:     []Cookie{},
+		Headers:     nameValues(header),
+		Content:     content,
+		RedirectURL: header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+}
+
+func decodeBody(header http.Header, body []byte) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(body)
+	if strings.EqualFold(header.Get("Transfer-Encoding"), "chunked") {
+		r = httputil.NewChunkedReader(r)
+	}
+	switch strings.ToLower(header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	case "deflate":
+		fr := flate.NewReader(r)
+		defer func() { _ = fr.Close() }()
+		r = fr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", header.Get("Content-Encoding"))
+	}
+	return io.ReadAll(r)
+}
+
+func isText(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+func nameValues(header http.Header) []NameValue {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	nv := make([]NameValue, 0, len(header))
+	for _, k := range keys {
+		for _, v := range header[k] {
+			nv = append(nv, NameValue{Name: k, Value: v})
+		}
+	}
+	return nv
+}
+
+func queryString(values url.Values) []NameValue {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	nv := make([]NameValue, 0, len(values))
+	for _, k := range keys {
+		for _, v := range values[k] {
+			nv = append(nv, NameValue{Name: k, Value: v})
+		}
+	}
+	return nv
+}
@@ -0,0 +1,77 @@
+package har
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// RequestFromRecord creates a HAR request from a WARC request record.
+func RequestFromRecord(record gowarc.WarcRecord) (Request, error) {
+	block, ok := record.Block().(gowarc.HttpRequestBlock)
+	if !ok {
+		return Request{}, fmt.Errorf("record %s is not a HTTP request", record.RecordId())
+	}
+	method, _, protocol := block.HttpRequestLine()
+	body, err := payload(block)
+	if err != nil {
+		return Request{}, fmt.Errorf("failed to read request payload: %w", err)
+	}
+	return NewRequest(method, record.WarcHeader().GetId(gowarc.WarcTargetURI), protocol, headerOrEmpty(block.HttpHeader()), body), nil
+}
+
+// EntryFromRecord creates a HAR entry from a WARC response record. Since a HAR entry must
+// have a request, a minimal GET request is filled in until the caller replaces it with the
+// request paired with the response.
+func EntryFromRecord(record gowarc.WarcRecord) (Entry, error) {
+	block, ok := record.Block().(gowarc.HttpResponseBlock)
+	if !ok {
+		return Entry{}, fmt.Errorf("record %s is not a HTTP response", record.RecordId())
+	}
+
+	date, err := record.WarcHeader().GetTime(gowarc.WarcDate)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to parse %s: %w", gowarc.WarcDate, err)
+	}
+
+	body, err := payload(block)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to read response payload: %w", err)
+	}
+
+	protocol := protocolOf(block)
+	return Entry{
+		StartedDateTime: date.UTC().Format(time.RFC3339Nano),
+		Request:         NewRequest(http.MethodGet, record.WarcHeader().GetId(gowarc.WarcTargetURI), protocol, http.Header{}, nil),
+		Response:        NewResponse(protocol, block.HttpStatusCode(), block.HttpStatusLine(), headerOrEmpty(block.HttpHeader()), body),
+		ServerIPAddress: record.WarcHeader().Get(gowarc.WarcIPAddress),
+		Timings:         Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+	}, nil
+}
+
+func payload(block gowarc.PayloadBlock) ([]byte, error) {
+	r, err := block.PayloadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func headerOrEmpty(header *http.Header) http.Header {
+	if header == nil {
+		return http.Header{}
+	}
+	return *header
+}
+
+// protocolOf returns the protocol from the status line of a response block.
+func protocolOf(block gowarc.ProtocolHeaderBlock) string {
+	line, _, _ := bytes.Cut(block.ProtocolHeaderBytes(), []byte("\n"))
+	protocol, _, _ := strings.Cut(strings.TrimSpace(string(line)), " ")
+	return protocol
+}
@@ -0,0 +1,196 @@
+package httpfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// File is a file or directory opened for reading.
+//
+// Content is requested in ranges of the read-ahead size and buffered, so the many small reads of
+// a WARC reader are served from the buffer.
+type File struct {
+	fs      *Fs
+	name    string
+	url     string
+	info    *FileInfo
+	pos     int64
+	buf     []byte
+	bufPos  int64
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (f *File) Close() error {
+	f.buf = nil
+	return nil
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *File) Sync() error {
+	return nil
+}
+
+func (f *File) Truncate(size int64) error {
+	return syscall.EROFS
+}
+
+func (f *File) Read(b []byte) (int, error) {
+	n, err := f.ReadAt(b, f.pos)
+	f.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads from the buffer, filling it from off if it does not hold off.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	if f.info.dir {
+		return 0, syscall.EISDIR
+	}
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+	n := 0
+	for n < len(b) {
+		if f.info.size >= 0 && off >= f.info.size {
+			return n, io.EOF
+		}
+		if off < f.bufPos || off >= f.bufPos+int64(len(f.buf)) {
+			if err := f.fill(off, len(b)-n); err != nil {
+				return n, err
+			}
+		}
+		c := copy(b[n:], f.buf[off-f.bufPos:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// fill fills the buffer from off with a range request of at least the read-ahead size.
+func (f *File) fill(off int64, size int) error {
+	size = max(size, f.fs.readAhead)
+	end := off + int64(size) - 1
+	if f.info.size >= 0 {
+		end = min(end, f.info.size-1)
+	}
+
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", off, end)}}
+	resp, err := f.fs.get(context.Background(), f.url, header)
+	if resp != nil && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// servers not supporting range requests send the whole file
+	if resp.StatusCode != http.StatusPartialContent && off > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			if err == io.EOF {
+				return io.EOF
+			}
+			return err
+		}
+	}
+
+	buf := f.buf[:0]
+	if cap(buf) < int(end-off+1) {
+		buf = make([]byte, 0, end-off+1)
+	}
+	n, err := io.ReadFull(resp.Body, buf[:end-off+1])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if n == 0 {
+		return io.EOF
+	}
+	f.buf = buf[:n]
+	f.bufPos = off
+	return nil
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.pos + offset
+	case io.SeekEnd:
+		if f.info.size < 0 {
+			return 0, syscall.ESPIPE
+		}
+		pos = f.info.size + offset
+	default:
+		return 0, syscall.EINVAL
+	}
+	if pos < 0 {
+		return 0, syscall.EINVAL
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.dir {
+		return nil, syscall.ENOTDIR
+	}
+	if !f.listed {
+		entries, err := f.fs.readdir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+		f.listed = true
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(f.entries))
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *File) Readdirnames(n int) (names []string, err error) {
+	entries, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return
+}
+
+func (f *File) Write(b []byte) (n int, err error) {
+	return 0, syscall.EROFS
+}
+
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, syscall.EROFS
+}
+
+func (f *File) WriteString(s string) (ret int, err error) {
+	return 0, syscall.EROFS
+}
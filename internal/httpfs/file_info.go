@@ -0,0 +1,44 @@
+package httpfs
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+const defaultFileMode = 0o444
+
+type FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (f FileInfo) Name() string {
+	return f.name
+}
+
+// Size returns the size of the file, or -1 if the server did not tell it.
+func (f FileInfo) Size() int64 {
+	return f.size
+}
+
+func (f FileInfo) Mode() fs.FileMode {
+	if f.dir {
+		return os.ModeDir | 0o555
+	}
+	return defaultFileMode
+}
+
+func (f FileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+func (f FileInfo) IsDir() bool {
+	return f.dir
+}
+
+func (f FileInfo) Sys() any {
+	return nil
+}
@@ -0,0 +1,322 @@
+// Package httpfs is a read-only afero.Fs for files published over HTTP(S).
+//
+// Files are read with range requests and buffered ahead, so reading from an offset does not
+// download the content before it. Since HTTP has no directory listing, directories are only known
+// from an optional manifest listing the paths of the files, one per line, relative to the URL of
+// the manifest. Empty lines and lines starting with '#' are ignored.
+package httpfs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// defaultReadAhead is the number of bytes requested at a time when reading sequentially.
+const defaultReadAhead = 1024 * 1024
+
+// Fs is an implementation of afero.Fs for the files below a base URL.
+type Fs struct {
+	base      *url.URL
+	client    *http.Client
+	readAhead int
+	manifest  string
+	// dirs holds the names of the entries of the directories listed in the manifest by path
+	dirs map[string][]string
+	// infos holds the file infos of files by path
+	infos sync.Map
+}
+
+type Option func(*Fs)
+
+// WithManifest sets the URL of the manifest listing the files, which may be relative to the
+// base URL.
+func WithManifest(manifest string) Option {
+	return func(fs *Fs) {
+		fs.manifest = manifest
+	}
+}
+
+// WithReadAhead sets the number of bytes requested at a time when reading sequentially.
+func WithReadAhead(readAhead int) Option {
+	return func(fs *Fs) {
+		fs.readAhead = readAhead
+	}
+}
+
+// WithClient sets the HTTP client used for requests.
+func WithClient(client *http.Client) Option {
+	return func(fs *Fs) {
+		fs.client = client
+	}
+}
+
+// New returns a filesystem for the files below the base URL. The manifest, if any, is read
+// when the filesystem is created.
+func New(base string, options ...Option) (*Fs, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme '%s' of base URL", u.Scheme)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+		u.RawPath = ""
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	fs := &Fs{
+		base:      u,
+		client:    http.DefaultClient,
+		readAhead: defaultReadAhead,
+	}
+	for _, option := range options {
+		option(fs)
+	}
+	if fs.manifest != "" {
+		if err := fs.readManifest(); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+func (s *Fs) Name() string { return "httpfs" }
+
+// rel returns the path of name relative to the base URL, without leading slash.
+func rel(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// url returns the URL of the file with name.
+func (s *Fs) url(name string) string {
+	return s.base.ResolveReference(&url.URL{Path: rel(name)}).String()
+}
+
+// readManifest reads the manifest and registers the directories of the files listed in it.
+// Files outside of the base URL are ignored.
+func (s *Fs) readManifest() error {
+	manifestUrl, err := s.base.Parse(s.manifest)
+	if err != nil {
+		return fmt.Errorf("invalid manifest URL: %w", err)
+	}
+	resp, err := s.get(context.Background(), manifestUrl.String(), http.Header{})
+	if err != nil {
+		return fmt.Errorf("failed to get manifest: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	s.dirs = map[string][]string{"": nil}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fileUrl, err := manifestUrl.Parse(line)
+		if err != nil {
+			return fmt.Errorf("invalid path in manifest: %s: %w", line, err)
+		}
+		if fileUrl.Scheme != s.base.Scheme || fileUrl.Host != s.base.Host || !strings.HasPrefix(fileUrl.Path, s.base.Path) {
+			continue
+		}
+		name := rel(strings.TrimPrefix(fileUrl.Path, s.base.Path))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		// register the file in its directory and the directories in their parents
+		for {
+			dir := path.Dir(name)
+			if dir == "." {
+				dir = ""
+			}
+			_, known := s.dirs[dir]
+			s.dirs[dir] = append(s.dirs[dir], path.Base(name))
+			if known || dir == "" {
+				break
+			}
+			name = dir
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return nil
+}
+
+// get sends a GET request and returns the response if its status is 2xx.
+func (s *Fs) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	return s.do(ctx, http.MethodGet, url, header)
+}
+
+// do sends a request and returns the response if its status is 2xx. On other statuses the closed
+// response is returned along with the error.
+func (s *Fs) do(ctx context.Context, method string, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: url, Err: os.ErrNotExist}
+	}
+	return resp, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+}
+
+// head returns the size and modification time of the file with name. Servers not allowing HEAD
+// requests are asked for the first byte of the file instead. The size is -1 if unknown.
+func (s *Fs) head(name string) (*FileInfo, error) {
+	url := s.url(name)
+	info := &FileInfo{name: path.Base("/" + rel(name)), size: -1}
+
+	resp, err := s.do(context.Background(), http.MethodHead, url, nil)
+	if err != nil && resp != nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = s.get(context.Background(), url, http.Header{"Range": {"bytes=0-0"}})
+		if err == nil {
+			_ = resp.Body.Close()
+			if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok {
+				resp.ContentLength = size
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.ContentLength >= 0 {
+		info.size = resp.ContentLength
+	}
+	info.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+// contentRangeSize returns the complete length of a Content-Range header like 'bytes 0-0/1234'.
+func contentRangeSize(contentRange string) (int64, bool) {
+	_, size, ok := strings.Cut(contentRange, "/")
+	if !ok || size == "*" {
+		return 0, false
+	}
+	var n int64
+	if _, err := fmt.Sscan(size, &n); err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func (s *Fs) Create(name string) (afero.File, error) {
+	return nil, syscall.EROFS
+}
+
+func (s *Fs) Mkdir(name string, perm os.FileMode) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Open(name string) (afero.File, error) {
+	info, err := s.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{fs: s, name: name, url: s.url(name), info: info}, nil
+}
+
+func (s *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag == os.O_RDONLY {
+		return s.Open(name)
+	}
+	return nil, syscall.EROFS
+}
+
+func (s *Fs) Remove(name string) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) RemoveAll(path string) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Rename(oldname, newname string) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Stat(name string) (os.FileInfo, error) {
+	return s.stat(name)
+}
+
+func (s *Fs) stat(name string) (*FileInfo, error) {
+	p := rel(name)
+	if _, ok := s.dirs[p]; ok || p == "" {
+		return &FileInfo{name: path.Base("/" + p), dir: true}, nil
+	}
+	if info, ok := s.infos.Load(p); ok {
+		return info.(*FileInfo), nil
+	}
+	info, err := s.head(name)
+	if err != nil {
+		return nil, err
+	}
+	s.infos.Store(p, info)
+	return info, nil
+}
+
+// readdir returns the file infos of the entries of the directory listed in the manifest.
+func (s *Fs) readdir(name string) ([]os.FileInfo, error) {
+	if s.dirs == nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNoManifest}
+	}
+	p := rel(name)
+	entries := s.dirs[p]
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := s.stat(path.Join(p, entry))
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *Fs) Chmod(name string, mode os.FileMode) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Chown(name string, uid, gid int) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return syscall.EROFS
+}
+
+var errNoManifest = errors.New("directories can only be listed from a manifest")
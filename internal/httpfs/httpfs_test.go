@@ -0,0 +1,162 @@
+package httpfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// testServer serves files and records the Range headers of the GET requests of files.
+type testServer struct {
+	files    map[string]string
+	noHead   bool
+	noRanges bool
+	mu       sync.Mutex
+	ranges   []string
+	headers  int
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	content, ok := s.files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	if r.Method == http.MethodHead {
+		s.headers++
+	} else if !strings.HasSuffix(r.URL.Path, ".txt") {
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+	}
+	s.mu.Unlock()
+
+	if s.noHead && r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.noRanges {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, "", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), bytes.NewReader([]byte(content)))
+}
+
+func newTestFs(t *testing.T, server *testServer, options ...Option) *Fs {
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	fs, err := New(ts.URL+"/warcs", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestRead(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		server *testServer
+		ranges []string
+	}{
+		{
+			name:   "range requests",
+			server: &testServer{},
+			ranges: []string{"bytes=0-3", "bytes=4-7", "bytes=20-25"},
+		},
+		{
+			name:   "no head and no range requests",
+			server: &testServer{noHead: true, noRanges: true},
+			ranges: []string{"bytes=0-0", "bytes=0-3", "bytes=4-7", "bytes=20-25"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "abcdefghijklmnopqrstuvwxyz"
+			tt.server.files = map[string]string{"/warcs/a.warc": content}
+			fs := newTestFs(t, tt.server, WithReadAhead(4))
+
+			f, err := fs.Open("/a.warc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			if info, _ := f.Stat(); info.Size() != int64(len(content)) {
+				t.Errorf("expected size %d, got %d", len(content), info.Size())
+			}
+
+			b := make([]byte, 3)
+			for _, want := range []string{"abc", "def"} {
+				if _, err := io.ReadFull(f, b); err != nil || string(b) != want {
+					t.Fatalf("expected %s, got %q, %v", want, b, err)
+				}
+			}
+			if _, err := f.Seek(-6, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			rest, err := io.ReadAll(f)
+			if err != nil || string(rest) != "uvwxyz" {
+				t.Fatalf("expected uvwxyz, got %q, %v", rest, err)
+			}
+			if strings.Join(tt.server.ranges, ",") != strings.Join(tt.ranges, ",") {
+				t.Errorf("expected ranges %v, got %v", tt.ranges, tt.server.ranges)
+			}
+		})
+	}
+}
+
+func TestManifest(t *testing.T) {
+	server := &testServer{files: map[string]string{
+		"/warcs/manifest.txt":      "# files\na.warc.gz\n2024/b.warc.gz\n\n2024/01/c.warc.gz\n/warcs/2024/b.warc.gz\n/other/d.warc.gz\n",
+		"/warcs/a.warc.gz":         "a",
+		"/warcs/2024/b.warc.gz":    "bb",
+		"/warcs/2024/01/c.warc.gz": "ccc",
+	}}
+	fs := newTestFs(t, server, WithManifest("manifest.txt"))
+
+	var walked []string
+	err := afero.Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, fmt.Sprintf("%s %t %d", path, info.IsDir(), info.Size()))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/ true 0",
+		"/2024 true 0",
+		"/2024/01 true 0",
+		"/2024/01/c.warc.gz false 3",
+		"/2024/b.warc.gz false 2",
+		"/a.warc.gz false 1",
+	}
+	if strings.Join(walked, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(walked, "\n"))
+	}
+	if server.headers != 3 {
+		t.Errorf("expected one HEAD request per file, got %d", server.headers)
+	}
+}
+
+func TestNoManifest(t *testing.T) {
+	fs := newTestFs(t, &testServer{files: map[string]string{"/warcs/a.warc": "a"}})
+
+	if _, err := fs.Stat("missing.warc"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+	if _, err := afero.ReadDir(fs, "/"); err == nil {
+		t.Error("expected error when listing a directory without manifest")
+	}
+	b, err := afero.ReadFile(fs, "a.warc")
+	if err != nil || string(b) != "a" {
+		t.Errorf("expected a, got %q, %v", b, err)
+	}
+}
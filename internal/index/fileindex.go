@@ -1,21 +1,47 @@
 package index
 
 import (
+	"bytes"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/spf13/afero"
 )
 
+// FileIndex caches the results of processed files by path along with the fingerprint of the
+// file, so a file replaced with another file of the same name is processed again.
 type FileIndex struct {
 	dir       string
 	db        *badger.DB
 	keepIndex bool
+	hash      bool
+	verify    bool
 }
 
-func NewFileIndex(indexDir string, keepIndex, newIndex bool) (*FileIndex, error) {
+type FileIndexOption func(*FileIndex)
+
+// WithHash makes the index store the sampled hash of the content of files along with their
+// size and modification time.
+func WithHash(hash bool) FileIndexOption {
+	return func(idx *FileIndex) {
+		idx.hash = hash
+	}
+}
+
+// WithVerify makes the index recheck cached results against the sampled hash of the content of
+// the files instead of trusting their size and modification time. Cached results without a
+// hash are stale.
+func WithVerify(verify bool) FileIndexOption {
+	return func(idx *FileIndex) {
+		idx.verify = verify
+	}
+}
+
+func NewFileIndex(indexDir string, keepIndex, newIndex bool, options ...FileIndexOption) (*FileIndex, error) {
 	dir := filepath.Join(indexDir, "file-index")
 
 	db, err := badger.Open(badger.DefaultOptions(dir).WithLoggingLevel(badger.WARNING))
@@ -28,6 +54,9 @@ func NewFileIndex(indexDir string, keepIndex, newIndex bool) (*FileIndex, error)
 		db:        db,
 		keepIndex: keepIndex,
 	}
+	for _, option := range options {
+		option(idx)
+	}
 
 	if newIndex {
 		if err = db.DropAll(); err != nil {
@@ -39,14 +68,30 @@ func NewFileIndex(indexDir string, keepIndex, newIndex bool) (*FileIndex, error)
 	return idx, nil
 }
 
-func (idx *FileIndex) GetFileStats(key string) (result stat.Result, err error) {
+// Fingerprint returns the fingerprint of the file at path, with the sampled hash of its content
+// if the index stores or verifies hashes.
+func (idx *FileIndex) Fingerprint(fs afero.Fs, path string) (Fingerprint, error) {
+	return NewFingerprint(fs, path, idx.hash || idx.verify)
+}
+
+// GetFileStats returns the cached result of the file with key, or nil if there is none or the
+// file has changed since the result was saved.
+func (idx *FileIndex) GetFileStats(key string, fingerprint Fingerprint) (result stat.Result, err error) {
 	err = runWithConflictRetry(func() error {
+		result = nil
 		return idx.db.View(func(txn *badger.Txn) error {
 			item, err := txn.Get([]byte(key))
 			if err != nil {
 				return err
 			}
 			return item.Value(func(val []byte) error {
+				cached, val, err := unmarshalEntry(val)
+				if errors.Is(err, errNoFingerprint) || (err == nil && !cached.matches(fingerprint, idx.verify)) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
 				result = stat.NewResult(key)
 				return result.UnmarshalBinary(val)
 			})
@@ -58,7 +103,73 @@ func (idx *FileIndex) GetFileStats(key string) (result stat.Result, err error) {
 	return
 }
 
-func (idx *FileIndex) SaveFileStats(key string, result stat.Result) error {
+// Verify rechecks all cached results against the fingerprints of their files in fs, with the
+// sampled hash of their content, and removes the results of files that have changed, were cached
+// without a hash or no longer exist. Results of files in archives, named by virtual paths like
+// outer.tar!/file.warc.gz, are checked when they are looked up. It returns the number of results
+// removed.
+func (idx *FileIndex) Verify(fs afero.Fs) (int, error) {
+	var stale [][]byte
+	err := idx.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			if strings.Contains(string(key), "!/") {
+				continue
+			}
+			var cached Fingerprint
+			err := item.Value(func(val []byte) error {
+				var err error
+				cached, _, err = unmarshalEntry(val)
+				if err == nil {
+					// the hash refers to the value, which is only valid in this function
+					cached.Hash = bytes.Clone(cached.Hash)
+				}
+				return err
+			})
+			if errors.Is(err, errNoFingerprint) {
+				stale = append(stale, key)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			current, err := NewFingerprint(fs, string(key), true)
+			if errors.Is(err, os.ErrNotExist) {
+				stale = append(stale, key)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !cached.matches(current, true) {
+				stale = append(stale, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch := idx.db.NewWriteBatch()
+	defer batch.Cancel()
+	for _, key := range stale {
+		if err := batch.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	if err := batch.Flush(); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+// SaveFileStats saves the result of the file with key and its fingerprint when processed. A nil
+// result removes the cached result.
+func (idx *FileIndex) SaveFileStats(key string, fingerprint Fingerprint, result stat.Result) error {
 	err := runWithConflictRetry(func() error {
 		return idx.db.Update(func(txn *badger.Txn) error {
 			if result == nil {
@@ -68,7 +179,7 @@ func (idx *FileIndex) SaveFileStats(key string, result stat.Result) error {
 			if err != nil {
 				return err
 			}
-			return txn.Set([]byte(key), val)
+			return txn.Set([]byte(key), marshalEntry(fingerprint, val))
 		})
 	})
 	return err
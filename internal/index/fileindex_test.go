@@ -2,8 +2,11 @@ package index
 
 import (
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/badger/v3"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/spf13/afero"
 )
 
 func TestFileIndex_SaveAndGetFileStats(t *testing.T) {
@@ -18,11 +21,12 @@ func TestFileIndex_SaveAndGetFileStats(t *testing.T) {
 	result.IncrDuplicates()
 	result.AddError(testError("boom"))
 
-	if err := idx.SaveFileStats("a.warc", result); err != nil {
+	fingerprint := Fingerprint{Size: 10, ModTime: time.Unix(1700000000, 5)}
+	if err := idx.SaveFileStats("a.warc", fingerprint, result); err != nil {
 		t.Fatal(err)
 	}
 
-	got, err := idx.GetFileStats("a.warc")
+	got, err := idx.GetFileStats("a.warc", fingerprint)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -41,7 +45,7 @@ func TestFileIndex_GetMissingFileStats(t *testing.T) {
 	}
 	defer idx.Close()
 
-	got, err := idx.GetFileStats("missing.warc")
+	got, err := idx.GetFileStats("missing.warc", Fingerprint{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,6 +54,201 @@ func TestFileIndex_GetMissingFileStats(t *testing.T) {
 	}
 }
 
+func TestFileIndex_ChangedFile(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	hash := []byte{1, 2, 3}
+	saved := Fingerprint{Size: 10, ModTime: modTime, Hash: hash}
+
+	tests := []struct {
+		name    string
+		verify  bool
+		current Fingerprint
+		want    bool
+	}{
+		{"unchanged", false, Fingerprint{Size: 10, ModTime: modTime}, true},
+		{"size changed", false, Fingerprint{Size: 11, ModTime: modTime}, false},
+		{"modification time changed", false, Fingerprint{Size: 10, ModTime: modTime.Add(time.Second)}, false},
+		{"hash changed", false, Fingerprint{Size: 10, ModTime: modTime, Hash: []byte{1, 2, 4}}, false},
+		{"verified", true, Fingerprint{Size: 10, ModTime: modTime, Hash: hash}, true},
+		{"verified hash changed", true, Fingerprint{Size: 10, ModTime: modTime, Hash: []byte{1, 2, 4}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, err := NewFileIndex(t.TempDir(), true, true, WithVerify(tt.verify))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer idx.Close()
+
+			if err := idx.SaveFileStats("a.warc", saved, stat.NewResult("a.warc")); err != nil {
+				t.Fatal(err)
+			}
+			got, err := idx.GetFileStats("a.warc", tt.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got != nil) != tt.want {
+				t.Errorf("expected cached result %t, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFileIndex_VerifyWithoutHash(t *testing.T) {
+	idx, err := NewFileIndex(t.TempDir(), true, true, WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	fingerprint := Fingerprint{Size: 10}
+	if err := idx.SaveFileStats("a.warc", fingerprint, stat.NewResult("a.warc")); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint.Hash = []byte{1}
+	got, err := idx.GetFileStats("a.warc", fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Error("expected result cached without hash to be stale when verifying")
+	}
+}
+
+func TestFileIndex_Verify(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"unchanged.warc", "changed.warc", "unhashed.warc"} {
+		if err := afero.WriteFile(fs, name, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx, err := NewFileIndex(t.TempDir(), true, true, WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	save := func(key string, hash bool) {
+		fingerprint := Fingerprint{Size: 7}
+		if hash {
+			if fingerprint, err = NewFingerprint(fs, key, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := idx.SaveFileStats(key, fingerprint, stat.NewResult(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("unchanged.warc", true)
+	save("changed.warc", true)
+	save("unhashed.warc", false)
+	save("outer.tar!/inner.warc", false)
+	if err := afero.WriteFile(fs, "deleted.warc", []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	save("deleted.warc", true)
+	if err := fs.Remove("deleted.warc"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same size and modification time, but another content
+	info, err := fs.Stat("changed.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "changed.warc", []byte("CONTENT"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chtimes("changed.warc", info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := idx.Verify(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("expected 3 removed results, got %d", removed)
+	}
+	err = idx.db.View(func(txn *badger.Txn) error {
+		for key, want := range map[string]bool{
+			"unchanged.warc":        true,
+			"changed.warc":          false,
+			"unhashed.warc":         false,
+			"deleted.warc":          false,
+			"outer.tar!/inner.warc": true,
+		} {
+			_, err := txn.Get([]byte(key))
+			if got := err == nil; got != want {
+				t.Errorf("%s: expected cached result %t, got %t", key, want, got)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	large := make([]byte, 4*sampleSize)
+	if err := afero.WriteFile(fs, "large.warc", large, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewFingerprint(fs, "large.warc", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Size != int64(len(large)) || len(a.Hash) == 0 {
+		t.Fatalf("unexpected fingerprint %+v", a)
+	}
+
+	// a change in a sampled region changes the hash
+	large[len(large)/2] = 1
+	if err := afero.WriteFile(fs, "large.warc", large, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewFingerprint(fs, "large.warc", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a.Hash) == string(b.Hash) {
+		t.Error("expected hash to change with the content")
+	}
+
+	c, err := NewFingerprint(fs, "large.warc", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Hash != nil {
+		t.Error("expected no hash")
+	}
+}
+
+func TestFileIndex_LegacyEntry(t *testing.T) {
+	idx, err := NewFileIndex(t.TempDir(), true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	// entries without fingerprint are stale
+	val, _ := stat.NewResult("a.warc").MarshalBinary()
+	if err := idx.db.Update(func(txn *badger.Txn) error { return txn.Set([]byte("a.warc"), val) }); err != nil {
+		t.Fatal(err)
+	}
+	got, err := idx.GetFileStats("a.warc", Fingerprint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Error("expected entry without fingerprint to be stale")
+	}
+}
+
 type testError string
 
 func (e testError) Error() string { return string(e) }
@@ -0,0 +1,139 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// sampleSize is the size of each of the samples of a file hashed by sampledHash.
+const sampleSize = 64 * 1024
+
+// Fingerprint identifies the content of a file without reading all of it. A file replaced with
+// another file of the same name is detected by its size, modification time or hash.
+type Fingerprint struct {
+	Size    int64
+	ModTime time.Time
+	// Hash is the sampled hash of the content, or nil if not computed
+	Hash []byte
+}
+
+// NewFingerprint returns the fingerprint of the file at path, computing the sampled hash of
+// its content if hash is true.
+func NewFingerprint(fs afero.Fs, path string, hash bool) (Fingerprint, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	fingerprint := Fingerprint{Size: info.Size(), ModTime: info.ModTime()}
+	if hash {
+		if fingerprint.Hash, err = sampledHash(fs, path, info.Size()); err != nil {
+			return Fingerprint{}, fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+	}
+	return fingerprint, nil
+}
+
+// sampledHash returns the SHA-256 digest of the size and the first, middle and last samples of
+// the file. Files no larger than three samples are hashed in full.
+func sampledHash(fs afero.Fs, path string, size int64) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, size)
+	if size <= 3*sampleSize {
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		return h.Sum(nil), nil
+	}
+	buf := make([]byte, sampleSize)
+	for _, offset := range []int64{0, size/2 - sampleSize/2, size - sampleSize} {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(f, buf); err != nil {
+			return nil, err
+		}
+		h.Write(buf)
+	}
+	return h.Sum(nil), nil
+}
+
+// matches reports whether the fingerprint of a cached entry matches the current fingerprint of
+// the file. The hashes are compared if both are known, and if verify is true the cached entry
+// must have a hash.
+func (f Fingerprint) matches(current Fingerprint, verify bool) bool {
+	if f.Size != current.Size || !f.ModTime.Equal(current.ModTime) {
+		return false
+	}
+	if f.Hash != nil && current.Hash != nil {
+		return bytes.Equal(f.Hash, current.Hash)
+	}
+	return !verify
+}
+
+// fingerprintMagic prefixes the values of entries with a fingerprint. Entries written by earlier
+// versions without it are considered stale.
+var fingerprintMagic = []byte("wfi\x01")
+
+var errNoFingerprint = errors.New("entry has no fingerprint")
+
+// marshalEntry encodes the fingerprint followed by the encoded result.
+func marshalEntry(fingerprint Fingerprint, result []byte) []byte {
+	b := bytes.Clone(fingerprintMagic)
+	b = binary.AppendVarint(b, fingerprint.Size)
+	var modTime int64
+	if !fingerprint.ModTime.IsZero() {
+		modTime = fingerprint.ModTime.UnixNano()
+	}
+	b = binary.AppendVarint(b, modTime)
+	b = binary.AppendUvarint(b, uint64(len(fingerprint.Hash)))
+	b = append(b, fingerprint.Hash...)
+	return append(b, result...)
+}
+
+// unmarshalEntry decodes the fingerprint and returns the encoded result following it.
+func unmarshalEntry(data []byte) (Fingerprint, []byte, error) {
+	if !bytes.HasPrefix(data, fingerprintMagic) {
+		return Fingerprint{}, nil, errNoFingerprint
+	}
+	data = data[len(fingerprintMagic):]
+
+	var fingerprint Fingerprint
+	size, n := binary.Varint(data)
+	if n <= 0 {
+		return Fingerprint{}, nil, errors.New("invalid fingerprint size")
+	}
+	fingerprint.Size = size
+	data = data[n:]
+
+	modTime, n := binary.Varint(data)
+	if n <= 0 {
+		return Fingerprint{}, nil, errors.New("invalid fingerprint modification time")
+	}
+	if modTime != 0 {
+		fingerprint.ModTime = time.Unix(0, modTime)
+	}
+	data = data[n:]
+
+	hashLen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < hashLen {
+		return Fingerprint{}, nil, errors.New("invalid fingerprint hash")
+	}
+	data = data[n:]
+	if hashLen > 0 {
+		fingerprint.Hash = data[:hashLen]
+	}
+	return fingerprint, data[hashLen:], nil
+}
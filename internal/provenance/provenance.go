@@ -0,0 +1,155 @@
+// Package provenance documents the source of converted records in metadata records.
+//
+// A provenance record is a metadata record written after the records converted from an input
+// file. It holds the path, size and digest of the input file, the software and repairs used in
+// the conversion and the validation errors found. Every converted record refers to it with the
+// WARC-Provenance-ID header field.
+package provenance
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/stat"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warcwriterconfig"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+// WarcProvenanceID is the header field referring a converted record to the provenance record of
+// its input file.
+const WarcProvenanceID = "WARC-Provenance-ID"
+
+// Provenance collects the provenance of the records converted from one input file.
+type Provenance struct {
+	fs          afero.Fs
+	path        string
+	id          string
+	description string
+	repairs     []string
+	lastDate    time.Time
+}
+
+// New creates the provenance of the input file at path. The description tells what the input
+// file was converted from and repairs lists the repairs applied to its records.
+func New(fs afero.Fs, path string, description string, repairs []string) (*Provenance, error) {
+	id, err := newRecordId()
+	if err != nil {
+		return nil, err
+	}
+	return &Provenance{
+		fs:          fs,
+		path:        path,
+		id:          id,
+		description: description,
+		repairs:     repairs,
+	}, nil
+}
+
+// Link refers the converted record to the provenance record.
+func (p *Provenance) Link(record gowarc.WarcRecord) {
+	record.WarcHeader().Set(WarcProvenanceID, p.id)
+	if date, err := record.WarcHeader().GetTime(gowarc.WarcDate); err == nil && date.After(p.lastDate) {
+		p.lastDate = date
+	}
+}
+
+// Date returns the WARC-Date of the provenance record. It is the latest WARC-Date of the converted
+// records, so the record is written to the same output file as them, or the current time if no
+// records were converted.
+func (p *Provenance) Date() time.Time {
+	if p.lastDate.IsZero() {
+		return time.Now().UTC()
+	}
+	return p.lastDate
+}
+
+// Record builds the provenance record from the result of the conversion. The conversion error,
+// if any, is recorded along with the validation errors of the result. The time of the conversion
+// is kept in the block since the WARC-Date of the record is given by Date.
+func (p *Provenance) Record(result stat.Result, conversionErr error, opts ...gowarc.WarcRecordOption) (gowarc.WarcRecord, error) {
+	size, digest, err := digestFile(p.fs, p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute digest of source file: %w", err)
+	}
+
+	now := time.Now().UTC()
+	date := p.Date()
+
+	block := &gowarc.WarcFields{}
+	block.Add("source", p.path)
+	block.Add("source-size", fmt.Sprintf("%d", size))
+	block.Add("source-digest", digest)
+	block.Add("software", version.SoftwareVersion())
+	block.Add("description", p.description)
+	block.Add("conversion-date", now.Format(time.RFC3339))
+	if result != nil {
+		block.Add("records", fmt.Sprintf("%d", result.Records()))
+	}
+	for _, repair := range p.repairs {
+		block.Add("repair", repair)
+	}
+	if result != nil {
+		for _, err := range result.Errors() {
+			block.Add("validation-error", err.Error())
+		}
+	}
+	if conversionErr != nil {
+		block.Add("conversion-error", conversionErr.Error())
+	}
+
+	rb := gowarc.NewRecordBuilder(gowarc.Metadata, opts...)
+	rb.AddWarcHeader(gowarc.WarcRecordID, p.id)
+	rb.AddWarcHeaderTime(gowarc.WarcDate, date)
+	rb.AddWarcHeader(gowarc.ContentType, "application/warc-fields")
+	if _, err := rb.WriteString(block.String()); err != nil {
+		return nil, err
+	}
+	record, _, err := rb.Build()
+	return record, err
+}
+
+// Write builds the provenance record and writes it with w.
+func (p *Provenance) Write(w warcwriterconfig.WarcWriter, result stat.Result, conversionErr error, opts ...gowarc.WarcRecordOption) error {
+	record, err := p.Record(result, conversionErr, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = record.Close() }()
+	if responses := w.Write(record); len(responses) > 0 {
+		return responses[0].Err
+	}
+	return nil
+}
+
+// digestFile returns the size and the sha256 digest of a file.
+func digestFile(fs afero.Fs, path string) (int64, string, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newRecordId returns a WARC-Record-ID holding a random (version 4) UUID.
+func newRecordId() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
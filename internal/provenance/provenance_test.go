@@ -0,0 +1,36 @@
+package provenance
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestDigestFile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "file.arc", []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	size, digest, err := digestFile(fs, "file.arc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 3 {
+		t.Errorf("digestFile() size = %d, want 3", size)
+	}
+	want := "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if digest != want {
+		t.Errorf("digestFile() digest = %s, want %s", digest, want)
+	}
+}
+
+func TestNewRecordId(t *testing.T) {
+	id, err := newRecordId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^<urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}>$`).MatchString(id) {
+		t.Errorf("newRecordId() = %s, not a version 4 UUID", id)
+	}
+}
@@ -0,0 +1,111 @@
+package rewrite
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// Fields is an ordered list of header fields. Names are compared case-insensitively.
+type Fields []gowarc.NameValue
+
+// Get returns the first value of the field name.
+func (f Fields) Get(name string) string {
+	for _, field := range f {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Has reports whether the field name is present.
+func (f Fields) Has(name string) bool {
+	for _, field := range f {
+		if strings.EqualFold(field.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Fields) match(name string, re *regexp.Regexp) bool {
+	for _, field := range f {
+		if strings.EqualFold(field.Name, name) && re.MatchString(field.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set sets the value of the field name, replacing all its values, and reports whether the fields
+// changed. A missing field is added last.
+func (f *Fields) Set(name, value string) bool {
+	fields := (*f)[:0:0]
+	found, changed := false, false
+	for _, field := range *f {
+		if !strings.EqualFold(field.Name, name) {
+			fields = append(fields, field)
+			continue
+		}
+		if found || field.Value != value {
+			changed = true
+		}
+		if !found {
+			fields = append(fields, gowarc.NameValue{Name: field.Name, Value: value})
+			found = true
+		}
+	}
+	if !found {
+		fields = append(fields, gowarc.NameValue{Name: name, Value: value})
+		changed = true
+	}
+	*f = fields
+	return changed
+}
+
+// Delete deletes all values of the field name and reports whether the fields changed.
+func (f *Fields) Delete(name string) bool {
+	fields := (*f)[:0:0]
+	for _, field := range *f {
+		if !strings.EqualFold(field.Name, name) {
+			fields = append(fields, field)
+		}
+	}
+	changed := len(fields) != len(*f)
+	*f = fields
+	return changed
+}
+
+// Rename renames the field name to newName and reports whether the fields changed.
+func (f *Fields) Rename(name, newName string) bool {
+	changed := false
+	for i, field := range *f {
+		if strings.EqualFold(field.Name, name) && field.Name != newName {
+			(*f)[i].Name = newName
+			changed = true
+		}
+	}
+	return changed
+}
+
+// apply replaces every value of the field name by the result of fn and reports whether the fields
+// changed.
+func (f *Fields) apply(name string, fn func(string) (string, error)) (bool, error) {
+	changed := false
+	for i, field := range *f {
+		if !strings.EqualFold(field.Name, name) {
+			continue
+		}
+		value, err := fn(field.Value)
+		if err != nil {
+			return changed, err
+		}
+		if value != field.Value {
+			(*f)[i].Value = value
+			changed = true
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,124 @@
+package rewrite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// Rewrite applies the rules to a record given by its type, WARC header and raw block. It returns
+// the rewritten WARC header and block and the names of the rules applied. The block is returned
+// unchanged unless an HTTP header field was changed.
+//
+// When the HTTP header is changed, the WARC-Block-Digest and Content-Length fields are removed
+// since they no longer apply to the block.
+func (r *Rules) Rewrite(recordType gowarc.RecordType, warcHeader Fields, block io.Reader) (Fields, io.Reader, []string, error) {
+	warcHeader = append(Fields(nil), warcHeader...)
+
+	var http *httpHeader
+	if r.httpHeader && strings.HasPrefix(warcHeader.Get(gowarc.ContentType), "application/http") {
+		var err error
+		if http, block, err = readHttpHeader(block); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var applied []string
+	httpChanged := false
+	for _, rule := range r.rules {
+		if !rule.match(recordType, warcHeader, http) {
+			continue
+		}
+		for _, a := range rule.actions {
+			fields := &warcHeader
+			if a.http {
+				if http == nil {
+					continue
+				}
+				fields = &http.fields
+			}
+			changed, err := a.apply(fields)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("%s: %w", rule.name, err)
+			}
+			httpChanged = httpChanged || (a.http && changed)
+		}
+		applied = append(applied, rule.name)
+	}
+
+	if http != nil {
+		if httpChanged {
+			warcHeader.Delete(gowarc.WarcBlockDigest)
+			warcHeader.Delete(gowarc.ContentLength)
+			block = io.MultiReader(bytes.NewReader(http.bytes()), block)
+		} else {
+			block = io.MultiReader(bytes.NewReader(http.raw), block)
+		}
+	}
+	return warcHeader, block, applied, nil
+}
+
+// httpHeader is the start line and header fields of an HTTP message.
+type httpHeader struct {
+	raw       []byte
+	startLine string
+	fields    Fields
+}
+
+// readHttpHeader reads the HTTP header at the start of block and returns it with a reader for the
+// rest of the block.
+func readHttpHeader(block io.Reader) (*httpHeader, io.Reader, error) {
+	br := bufio.NewReader(block)
+	h := &httpHeader{}
+	for {
+		line, err := br.ReadString('\n')
+		h.raw = append(h.raw, line...)
+		if err != nil {
+			if err == io.EOF {
+				// a truncated header is passed on as it is
+				return h, br, nil
+			}
+			return nil, nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			return h, br, nil
+		case h.startLine == "" && len(h.fields) == 0:
+			h.startLine = line
+		case (line[0] == ' ' || line[0] == '\t') && len(h.fields) > 0:
+			h.fields[len(h.fields)-1].Value += " " + strings.TrimSpace(line)
+		default:
+			name, value, _ := strings.Cut(line, ":")
+			h.fields = append(h.fields, gowarc.NameValue{Name: name, Value: strings.TrimSpace(value)})
+		}
+	}
+}
+
+// ReadHttpHeader reads the HTTP header at the start of block, including the empty line ending it,
+// and returns it as it was read with a reader for the rest of the block.
+func ReadHttpHeader(block io.Reader) ([]byte, io.Reader, error) {
+	h, rest, err := readHttpHeader(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.raw, rest, nil
+}
+
+func (h *httpHeader) bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString(h.startLine)
+	b.WriteString("\r\n")
+	for _, field := range h.fields {
+		b.WriteString(field.Name)
+		b.WriteString(": ")
+		b.WriteString(field.Value)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,153 @@
+package rewrite
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+const rulesYaml = `
+rules:
+  - name: fix-ip
+    match:
+      record-type: [response]
+      warc-header:
+        WARC-IP-Address: '^10\.'
+    actions:
+      - action: set
+        name: WARC-IP-Address
+        value: 192.0.2.1
+  - name: encode-spaces
+    match:
+      warc-header:
+        WARC-Target-URI: ' '
+    actions:
+      - action: replace
+        name: WARC-Target-URI
+        regex: ' '
+        value: '%20'
+  - name: shift-date
+    actions:
+      - action: shift-time
+        name: WARC-Date
+        duration: -2h
+  - name: server
+    match:
+      http-header:
+        Server: nginx
+      missing-http-header: [X-Fixed]
+    actions:
+      - action: rename
+        header: http
+        name: Server
+        to: X-Server
+      - action: set
+        header: http
+        name: X-Fixed
+        value: "true"
+`
+
+const httpBlock = "HTTP/1.1 200 OK\r\nServer: nginx\r\nContent-Type: text/html\r\n\r\n<html></html>"
+
+func TestRewrite(t *testing.T) {
+	rules, err := Parse([]byte(rulesYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warcHeader := Fields{
+		{Name: gowarc.WarcType, Value: "response"},
+		{Name: gowarc.WarcTargetURI, Value: "http://example.com/a b"},
+		{Name: gowarc.WarcDate, Value: "2024-01-02T03:04:05Z"},
+		{Name: gowarc.WarcIPAddress, Value: "10.0.0.1"},
+		{Name: gowarc.ContentType, Value: "application/http;msgtype=response"},
+		{Name: gowarc.WarcBlockDigest, Value: "sha1:AAAA"},
+		{Name: gowarc.ContentLength, Value: "79"},
+	}
+	gotHeader, block, applied, err := rules.Rewrite(gowarc.Response, warcHeader, strings.NewReader(httpBlock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"fix-ip", "encode-spaces", "shift-date", "server"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	wantHeader := Fields{
+		{Name: gowarc.WarcType, Value: "response"},
+		{Name: gowarc.WarcTargetURI, Value: "http://example.com/a%20b"},
+		{Name: gowarc.WarcDate, Value: "2024-01-02T01:04:05Z"},
+		{Name: gowarc.WarcIPAddress, Value: "192.0.2.1"},
+		{Name: gowarc.ContentType, Value: "application/http;msgtype=response"},
+	}
+	if !reflect.DeepEqual(gotHeader, wantHeader) {
+		t.Errorf("header = %v, want %v", gotHeader, wantHeader)
+	}
+	b, err := io.ReadAll(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HTTP/1.1 200 OK\r\nX-Server: nginx\r\nContent-Type: text/html\r\nX-Fixed: true\r\n\r\n<html></html>"; string(b) != want {
+		t.Errorf("block = %q, want %q", b, want)
+	}
+
+	// the original header is not changed
+	if warcHeader.Get(gowarc.WarcIPAddress) != "10.0.0.1" {
+		t.Errorf("original header was changed")
+	}
+}
+
+func TestRewriteUnchangedBlock(t *testing.T) {
+	rules, err := Parse([]byte(rulesYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := "HTTP/1.1 200 OK\nServer: apache\n\nbody"
+	warcHeader := Fields{
+		{Name: gowarc.WarcDate, Value: "2024-01-02T03:04:05Z"},
+		{Name: gowarc.ContentType, Value: "application/http;msgtype=response"},
+		{Name: gowarc.WarcBlockDigest, Value: "sha1:AAAA"},
+	}
+	gotHeader, r, applied, err := rules.Rewrite(gowarc.Response, warcHeader, strings.NewReader(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"shift-date"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	if !gotHeader.Has(gowarc.WarcBlockDigest) {
+		t.Errorf("block digest removed from unchanged block")
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != block {
+		t.Errorf("block = %q, want %q", b, block)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{"no rules", "rules: []"},
+		{"unknown field", "rules:\n  - actions: [{action: delete, name: X}]\n    unknown: 1"},
+		{"no actions", "rules:\n  - name: a"},
+		{"unknown action", "rules:\n  - actions: [{action: drop, name: X}]"},
+		{"unknown record type", "rules:\n  - match: {record-type: [foo]}\n    actions: [{action: delete, name: X}]"},
+		{"invalid regex", "rules:\n  - match: {warc-header: {X: '('}}\n    actions: [{action: delete, name: X}]"},
+		{"warc type", "rules:\n  - actions: [{action: set, name: WARC-Type, value: resource}]"},
+		{"rename without name", "rules:\n  - actions: [{action: rename, name: X}]"},
+		{"invalid duration", "rules:\n  - actions: [{action: shift-time, name: WARC-Date, duration: 2}]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.rules)); err == nil {
+				t.Errorf("Parse() expected error")
+			}
+		})
+	}
+}
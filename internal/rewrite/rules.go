@@ -0,0 +1,329 @@
+// Package rewrite rewrites WARC and HTTP header fields of records by rules read from a file.
+//
+// A rules file is a YAML document with a list of rules. Each rule has a match, which must hold
+// for all its conditions, and a list of actions applied in order to the matching records:
+//
+//	rules:
+//	  - name: fix-ip
+//	    match:
+//	      record-type: [response, request]
+//	      warc-header:
+//	        WARC-IP-Address: '^10\.0\.0\.1$'
+//	    actions:
+//	      - action: set
+//	        name: WARC-IP-Address
+//	        value: 192.0.2.1
+//	  - name: encode-spaces
+//	    match:
+//	      warc-header:
+//	        WARC-Target-URI: ' '
+//	    actions:
+//	      - action: replace
+//	        name: WARC-Target-URI
+//	        regex: ' '
+//	        value: '%20'
+//	  - name: missing-content-type
+//	    match:
+//	      record-type: [response]
+//	      missing-warc-header: [Content-Type]
+//	    actions:
+//	      - action: set
+//	        name: Content-Type
+//	        value: application/http;msgtype=response
+//
+// Actions are one of set, delete, rename (to a new name), replace (every match of regex by value)
+// and shift-time (by duration). Actions apply to the WARC header unless header is 'http'.
+package rewrite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ActionSet       = "set"
+	ActionDelete    = "delete"
+	ActionRename    = "rename"
+	ActionReplace   = "replace"
+	ActionShiftTime = "shift-time"
+
+	HeaderWarc = "warc"
+	HeaderHttp = "http"
+)
+
+var recordTypes = map[string]gowarc.RecordType{
+	"warcinfo":     gowarc.Warcinfo,
+	"request":      gowarc.Request,
+	"response":     gowarc.Response,
+	"metadata":     gowarc.Metadata,
+	"revisit":      gowarc.Revisit,
+	"resource":     gowarc.Resource,
+	"continuation": gowarc.Continuation,
+	"conversion":   gowarc.Conversion,
+}
+
+type rulesFile struct {
+	Rules []ruleSpec `yaml:"rules"`
+}
+
+type ruleSpec struct {
+	Name    string       `yaml:"name"`
+	Match   matchSpec    `yaml:"match"`
+	Actions []actionSpec `yaml:"actions"`
+}
+
+type matchSpec struct {
+	RecordType        []string          `yaml:"record-type"`
+	WarcHeader        map[string]string `yaml:"warc-header"`
+	HttpHeader        map[string]string `yaml:"http-header"`
+	MissingWarcHeader []string          `yaml:"missing-warc-header"`
+	MissingHttpHeader []string          `yaml:"missing-http-header"`
+}
+
+type actionSpec struct {
+	Action   string `yaml:"action"`
+	Header   string `yaml:"header"`
+	Name     string `yaml:"name"`
+	Value    string `yaml:"value"`
+	To       string `yaml:"to"`
+	Regex    string `yaml:"regex"`
+	Duration string `yaml:"duration"`
+}
+
+// Rules is a compiled list of rules.
+type Rules struct {
+	rules []*rule
+	// httpHeader is true if any rule matches or changes HTTP header fields
+	httpHeader bool
+}
+
+type rule struct {
+	name              string
+	recordTypes       gowarc.RecordType
+	warcHeader        map[string]*regexp.Regexp
+	httpHeader        map[string]*regexp.Regexp
+	missingWarcHeader []string
+	missingHttpHeader []string
+	actions           []action
+}
+
+type action struct {
+	action   string
+	http     bool
+	name     string
+	value    string
+	to       string
+	regex    *regexp.Regexp
+	duration time.Duration
+}
+
+// Load reads and compiles the rules file at path.
+func Load(path string) (*Rules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	rules, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file '%s': %w", path, err)
+	}
+	return rules, nil
+}
+
+// Parse compiles the rules of a rules file.
+func Parse(b []byte) (*Rules, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	var f rulesFile
+	if err := decoder.Decode(&f); err != nil {
+		return nil, err
+	}
+	if len(f.Rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+
+	rules := &Rules{}
+	for i, spec := range f.Rules {
+		if spec.Name == "" {
+			spec.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		r, err := compileRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		if len(r.httpHeader) > 0 || len(r.missingHttpHeader) > 0 {
+			rules.httpHeader = true
+		}
+		for _, a := range r.actions {
+			rules.httpHeader = rules.httpHeader || a.http
+		}
+		rules.rules = append(rules.rules, r)
+	}
+	return rules, nil
+}
+
+func compileRule(spec ruleSpec) (*rule, error) {
+	r := &rule{
+		name:              spec.Name,
+		missingWarcHeader: spec.Match.MissingWarcHeader,
+		missingHttpHeader: spec.Match.MissingHttpHeader,
+	}
+	for _, name := range spec.Match.RecordType {
+		recordType, ok := recordTypes[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown record type '%s'", name)
+		}
+		r.recordTypes |= recordType
+	}
+	var err error
+	if r.warcHeader, err = compileHeaderMatch(spec.Match.WarcHeader); err != nil {
+		return nil, err
+	}
+	if r.httpHeader, err = compileHeaderMatch(spec.Match.HttpHeader); err != nil {
+		return nil, err
+	}
+
+	if len(spec.Actions) == 0 {
+		return nil, errors.New("no actions")
+	}
+	for _, a := range spec.Actions {
+		compiled, err := compileAction(a)
+		if err != nil {
+			return nil, err
+		}
+		r.actions = append(r.actions, compiled)
+	}
+	return r, nil
+}
+
+func compileHeaderMatch(match map[string]string) (map[string]*regexp.Regexp, error) {
+	if len(match) == 0 {
+		return nil, nil
+	}
+	compiled := make(map[string]*regexp.Regexp, len(match))
+	for name, expr := range match {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression for %s: %w", name, err)
+		}
+		compiled[name] = re
+	}
+	return compiled, nil
+}
+
+func compileAction(spec actionSpec) (action, error) {
+	a := action{
+		action: spec.Action,
+		name:   spec.Name,
+		value:  spec.Value,
+		to:     spec.To,
+	}
+	switch strings.ToLower(spec.Header) {
+	case "", HeaderWarc:
+	case HeaderHttp:
+		a.http = true
+	default:
+		return a, fmt.Errorf("unknown header '%s', must be %s or %s", spec.Header, HeaderWarc, HeaderHttp)
+	}
+	if a.name == "" {
+		return a, fmt.Errorf("missing name of header field for action '%s'", spec.Action)
+	}
+	// records are rebuilt with the type they were read with
+	if !a.http && (strings.EqualFold(a.name, gowarc.WarcType) || strings.EqualFold(a.to, gowarc.WarcType)) {
+		return a, fmt.Errorf("%s can not be rewritten", gowarc.WarcType)
+	}
+
+	switch spec.Action {
+	case ActionSet, ActionDelete:
+	case ActionRename:
+		if a.to == "" {
+			return a, fmt.Errorf("missing new name of %s", a.name)
+		}
+	case ActionReplace:
+		re, err := regexp.Compile(spec.Regex)
+		if err != nil {
+			return a, fmt.Errorf("invalid regular expression for %s: %w", a.name, err)
+		}
+		a.regex = re
+	case ActionShiftTime:
+		d, err := time.ParseDuration(spec.Duration)
+		if err != nil {
+			return a, fmt.Errorf("invalid duration for %s: %w", a.name, err)
+		}
+		a.duration = d
+	default:
+		return a, fmt.Errorf("unknown action '%s'", spec.Action)
+	}
+	return a, nil
+}
+
+func (r *rule) match(recordType gowarc.RecordType, warcHeader Fields, httpHeader *httpHeader) bool {
+	if r.recordTypes != 0 && recordType&r.recordTypes == 0 {
+		return false
+	}
+	if !matchHeader(warcHeader, r.warcHeader, r.missingWarcHeader) {
+		return false
+	}
+	if len(r.httpHeader) > 0 || len(r.missingHttpHeader) > 0 {
+		if httpHeader == nil {
+			return false
+		}
+		return matchHeader(httpHeader.fields, r.httpHeader, r.missingHttpHeader)
+	}
+	return true
+}
+
+func matchHeader(fields Fields, match map[string]*regexp.Regexp, missing []string) bool {
+	for name, re := range match {
+		if !fields.match(name, re) {
+			return false
+		}
+	}
+	for _, name := range missing {
+		if fields.Has(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply applies the action and reports whether the fields changed.
+func (a action) apply(fields *Fields) (bool, error) {
+	switch a.action {
+	case ActionSet:
+		return fields.Set(a.name, a.value), nil
+	case ActionDelete:
+		return fields.Delete(a.name), nil
+	case ActionRename:
+		return fields.Rename(a.name, a.to), nil
+	case ActionReplace:
+		return fields.apply(a.name, func(value string) (string, error) {
+			return a.regex.ReplaceAllString(value, a.value), nil
+		})
+	case ActionShiftTime:
+		return fields.apply(a.name, func(value string) (string, error) {
+			return shiftTime(value, a.duration)
+		})
+	}
+	return false, nil
+}
+
+// shiftTime shifts a time in the format of WARC-Date or of HTTP dates.
+func shiftTime(value string, d time.Duration) (string, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.Add(d).UTC().Format(time.RFC3339Nano), nil
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Add(d).UTC().Format(http.TimeFormat), nil
+	}
+	return "", fmt.Errorf("failed to parse time '%s'", value)
+}
@@ -0,0 +1,469 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	defaultRegion   = "us-east-1"
+)
+
+// Config holds the endpoint and credentials of an S3 compatible object store.
+type Config struct {
+	// Endpoint is the URL of the object store, e.g. http://localhost:9000. If empty, the AWS
+	// endpoint of the region is used.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// PathStyle addresses buckets by path instead of by host name. It is always used with a
+	// custom endpoint.
+	PathStyle bool
+}
+
+// ConfigFromEnv returns the configuration given by the standard AWS environment variables
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, AWS_REGION or AWS_DEFAULT_REGION, AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func ConfigFromEnv() Config {
+	return Config{
+		Endpoint:        firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// client makes signed requests to the objects of one bucket.
+type client struct {
+	config     Config
+	bucket     string
+	endpoint   *url.URL
+	httpClient *http.Client
+}
+
+func newClient(config Config, bucket string) (*client, error) {
+	if config.Region == "" {
+		config.Region = defaultRegion
+	}
+	var endpoint *url.URL
+	if config.Endpoint == "" {
+		endpoint = &url.URL{Scheme: "https", Host: "s3." + config.Region + ".amazonaws.com"}
+	} else {
+		var err error
+		if endpoint, err = url.Parse(config.Endpoint); err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+		}
+		if endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint: %s", config.Endpoint)
+		}
+		config.PathStyle = true
+	}
+	return &client{
+		config:     config,
+		bucket:     bucket,
+		endpoint:   endpoint,
+		httpClient: http.DefaultClient,
+	}, nil
+}
+
+// objectUrl returns the URL of the object with key, or of the bucket if key is empty.
+func (c *client) objectUrl(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	if c.config.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket + "/" + key
+	} else {
+		u.Host = c.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	// the path is sent as it is signed
+	u.RawPath = canonicalPath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a request for the object with key and returns the response if its status is 2xx.
+// Other responses are closed and returned as errors.
+func (c *client) do(ctx context.Context, method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.objectUrl(key, query).String(), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+	c.sign(req, time.Now().UTC())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil, responseError(method, key, resp)
+}
+
+// responseError returns the error of a failed request, which is os.ErrNotExist for missing objects.
+func responseError(method string, key string, resp *http.Response) error {
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = xml.Unmarshal(b, &s3Err)
+
+	if resp.StatusCode == http.StatusNotFound && s3Err.Code != "NoSuchBucket" && s3Err.Code != "NoSuchUpload" {
+		return &os.PathError{Op: strings.ToLower(method), Path: key, Err: os.ErrNotExist}
+	}
+	if s3Err.Code != "" {
+		return fmt.Errorf("s3 %s %s: %s: %s", method, key, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+}
+
+// sign signs the request with AWS signature version 4. Requests are sent anonymously if no
+// credentials are configured.
+func (c *client) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if c.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.config.SessionToken)
+	}
+	if c.config.AccessKeyID == "" {
+		return
+	}
+
+	signedHeaders, canonicalHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := strings.Join([]string{amzDate[:8], c.config.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSha256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := signingKey(c.config.SecretAccessKey, amzDate[:8], c.config.Region, "s3")
+	signature := hex.EncodeToString(hmacSha256(key, []byte(stringToSign)))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalHeaders returns the names and the canonical form of the signed headers, which are the
+// host and the x-amz-* headers.
+func canonicalHeaders(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		sb.WriteString(headers[name])
+		sb.WriteByte('\n')
+	}
+	return strings.Join(names, ";"), sb.String()
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSha256([]byte("AWS4"+secret), []byte(date))
+	key = hmacSha256(key, []byte(region))
+	key = hmacSha256(key, []byte(service))
+	return hmacSha256(key, []byte("aws4_request"))
+}
+
+func hmacSha256(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hexSha256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalPath encodes every segment of the path.
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery returns the query sorted by name with names and values encoded.
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes all but the unreserved characters.
+func uriEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '-' || b == '_' || b == '.' || b == '~' {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+// object is an object or a common prefix of a listing.
+type object struct {
+	key          string
+	size         int64
+	lastModified time.Time
+	prefix       bool
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list lists the objects and common prefixes with the prefix, grouped by the delimiter. At most
+// max entries are listed if max is positive.
+func (c *client) list(ctx context.Context, prefix string, delimiter string, max int) ([]object, error) {
+	var objects []object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		if max > 0 {
+			query.Set("max-keys", strconv.Itoa(max))
+		}
+		resp, err := c.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode listing of %s: %w", prefix, err)
+		}
+		for _, p := range result.CommonPrefixes {
+			objects = append(objects, object{key: p.Prefix, prefix: true})
+		}
+		for _, o := range result.Contents {
+			objects = append(objects, object{key: o.Key, size: o.Size, lastModified: o.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" || (max > 0 && len(objects) >= max) {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// head returns the size and modification time of the object with key.
+func (c *client) head(ctx context.Context, key string) (object, error) {
+	resp, err := c.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return object{}, err
+	}
+	_ = resp.Body.Close()
+	lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return object{key: key, size: resp.ContentLength, lastModified: lastModified}, nil
+}
+
+// get returns the content of the object with key from offset. If length is positive, at most
+// length bytes are returned.
+func (c *client) get(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if length > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.do(ctx, http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// put uploads an object in one request.
+func (c *client) put(ctx context.Context, key string, body []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, key, nil, nil, body)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// remove deletes the object with key.
+func (c *client) remove(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// createMultipartUpload starts a multipart upload and returns its ID.
+func (c *client) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var result struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode multipart upload of %s: %w", key, err)
+	}
+	if result.UploadId == "" {
+		return "", fmt.Errorf("missing upload ID of multipart upload of %s", key)
+	}
+	return result.UploadId, nil
+}
+
+// uploadPart uploads a part of a multipart upload and returns its ETag.
+func (c *client) uploadPart(ctx context.Context, key string, uploadId string, partNumber int, body []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadId}}
+	resp, err := c.do(ctx, http.MethodPut, key, query, nil, body)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("missing ETag of part %d of %s", partNumber, key)
+	}
+	return etag, nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// completeMultipartUpload completes a multipart upload of the parts.
+func (c *client) completeMultipartUpload(ctx context.Context, key string, uploadId string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadId}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// the request may fail after a 200 OK response, which is then told in the body
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var s3Err struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(b, &s3Err) == nil && s3Err.XMLName.Local == "Error" {
+		return fmt.Errorf("s3 complete multipart upload %s: %s: %s", key, s3Err.Code, s3Err.Message)
+	}
+	return nil
+}
+
+// abortMultipartUpload aborts a multipart upload and deletes its parts.
+func (c *client) abortMultipartUpload(ctx context.Context, key string, uploadId string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadId}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
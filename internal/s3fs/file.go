@@ -0,0 +1,302 @@
+package s3fs
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// File is an object or directory opened for reading.
+type File struct {
+	fs           *Fs
+	name         string
+	key          string
+	info         *FileInfo
+	body         io.ReadCloser
+	actualPos    int64
+	requestedPos int64
+	entries      []os.FileInfo
+	entriesRead  bool
+}
+
+func (f *File) Close() error {
+	if f.body != nil {
+		err := f.body.Close()
+		f.body = nil
+		return err
+	}
+	return nil
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *File) Sync() error {
+	return nil
+}
+
+func (f *File) Truncate(size int64) error {
+	return syscall.EBADF
+}
+
+// Read reads from the current position. The content is streamed from the position of the last
+// seek, so seeking forward does not read the skipped content.
+func (f *File) Read(b []byte) (n int, err error) {
+	if f.info.dir {
+		return 0, syscall.EISDIR
+	}
+	if f.body != nil && f.actualPos != f.requestedPos {
+		_ = f.body.Close()
+		f.body = nil
+	}
+	if f.body == nil {
+		if f.requestedPos >= f.info.size {
+			return 0, io.EOF
+		}
+		body, err := f.fs.client.get(context.Background(), f.key, f.requestedPos, 0)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+		f.actualPos = f.requestedPos
+	}
+	n, err = f.body.Read(b)
+	f.actualPos += int64(n)
+	f.requestedPos = f.actualPos
+	return
+}
+
+// ReadAt reads len(b) bytes from off with a ranged request.
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	if f.info.dir {
+		return 0, syscall.EISDIR
+	}
+	if off >= f.info.size {
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	body, err := f.fs.client.get(context.Background(), f.key, off, int64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = body.Close() }()
+	n, err = io.ReadFull(body, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.requestedPos + offset
+	case io.SeekEnd:
+		pos = f.info.size + offset
+	default:
+		return 0, syscall.EINVAL
+	}
+	if pos < 0 {
+		return 0, syscall.EINVAL
+	}
+	f.requestedPos = pos
+	return pos, nil
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.dir {
+		return nil, syscall.ENOTDIR
+	}
+	if !f.entriesRead {
+		entries, err := f.fs.readdir(f.key)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+		f.entriesRead = true
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(f.entries))
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *File) Readdirnames(n int) (names []string, err error) {
+	entries, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return
+}
+
+func (f *File) Write(b []byte) (n int, err error) {
+	return 0, syscall.EBADF
+}
+
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, syscall.EBADF
+}
+
+func (f *File) WriteString(s string) (ret int, err error) {
+	return 0, syscall.EBADF
+}
+
+// writeFile is an object opened for writing. The content is uploaded in parts as it is written
+// and the upload completed when the file is closed. Objects smaller than a part are uploaded in
+// one request when the file is closed.
+type writeFile struct {
+	fs       *Fs
+	name     string
+	key      string
+	buf      []byte
+	size     int64
+	uploadId string
+	parts    []completedPart
+	closed   bool
+	err      error
+}
+
+func newWriteFile(fs *Fs, name string) *writeFile {
+	return &writeFile{fs: fs, name: name, key: fs.key(name)}
+}
+
+func (f *writeFile) Write(b []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.buf = append(f.buf, b...)
+	f.size += int64(len(b))
+	for len(f.buf) >= f.fs.partSize {
+		if err := f.uploadPart(f.buf[:f.fs.partSize]); err != nil {
+			f.err = err
+			f.abort()
+			return 0, err
+		}
+		f.buf = append(f.buf[:0], f.buf[f.fs.partSize:]...)
+	}
+	return len(b), nil
+}
+
+func (f *writeFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *writeFile) uploadPart(part []byte) error {
+	ctx := context.Background()
+	if f.uploadId == "" {
+		uploadId, err := f.fs.client.createMultipartUpload(ctx, f.key)
+		if err != nil {
+			return err
+		}
+		f.uploadId = uploadId
+	}
+	partNumber := len(f.parts) + 1
+	etag, err := f.fs.client.uploadPart(ctx, f.key, f.uploadId, partNumber, part)
+	if err != nil {
+		return err
+	}
+	f.parts = append(f.parts, completedPart{PartNumber: partNumber, ETag: etag})
+	return nil
+}
+
+// abort aborts the multipart upload, if any, so the uploaded parts are not kept.
+func (f *writeFile) abort() {
+	if f.uploadId != "" {
+		_ = f.fs.client.abortMultipartUpload(context.Background(), f.key, f.uploadId)
+		f.uploadId = ""
+	}
+}
+
+// Close uploads the rest of the content and completes the upload.
+func (f *writeFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	if f.err != nil {
+		return f.err
+	}
+	defer f.fs.infos.Delete(f.key)
+
+	ctx := context.Background()
+	if f.uploadId == "" {
+		return f.fs.client.put(ctx, f.key, f.buf)
+	}
+	if len(f.buf) > 0 {
+		if err := f.uploadPart(f.buf); err != nil {
+			f.abort()
+			return err
+		}
+	}
+	if err := f.fs.client.completeMultipartUpload(ctx, f.key, f.uploadId, f.parts); err != nil {
+		f.abort()
+		return err
+	}
+	return nil
+}
+
+func (f *writeFile) Name() string {
+	return f.name
+}
+
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	return &FileInfo{name: f.name, size: f.size, modTime: time.Now()}, nil
+}
+
+func (f *writeFile) Sync() error {
+	return nil
+}
+
+func (f *writeFile) Truncate(size int64) error {
+	return syscall.ENOTSUP
+}
+
+func (f *writeFile) Read(b []byte) (int, error) {
+	return 0, syscall.EBADF
+}
+
+func (f *writeFile) ReadAt(b []byte, off int64) (int, error) {
+	return 0, syscall.EBADF
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, syscall.ESPIPE
+}
+
+func (f *writeFile) WriteAt(b []byte, off int64) (int, error) {
+	return 0, syscall.ESPIPE
+}
+
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, syscall.ENOTDIR
+}
+
+func (f *writeFile) Readdirnames(n int) ([]string, error) {
+	return nil, syscall.ENOTDIR
+}
@@ -0,0 +1,54 @@
+package s3fs
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const defaultFileMode = 0o644
+
+type FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func newFileInfo(object object) *FileInfo {
+	return &FileInfo{
+		name:    path.Base(strings.TrimSuffix(object.key, "/")),
+		size:    object.size,
+		modTime: object.lastModified,
+		dir:     object.prefix,
+	}
+}
+
+func (f FileInfo) Name() string {
+	return f.name
+}
+
+func (f FileInfo) Size() int64 {
+	return f.size
+}
+
+func (f FileInfo) Mode() fs.FileMode {
+	if f.dir {
+		return os.ModeDir | 0o755
+	}
+	return defaultFileMode
+}
+
+func (f FileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+func (f FileInfo) IsDir() bool {
+	return f.dir
+}
+
+func (f FileInfo) Sys() any {
+	return nil
+}
@@ -0,0 +1,194 @@
+// Package s3fs is an afero.Fs for a bucket in an S3 compatible object store.
+//
+// Object keys are read as paths with '/' separating directories, which exist as long as there are
+// objects below them. Files are read with ranged requests, so seeking does not read the skipped
+// content, and written with multipart uploads when they are closed.
+package s3fs
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// defaultPartSize is the size of the parts of multipart uploads. S3 requires at least 5 MiB
+// for all but the last part.
+const defaultPartSize = 16 * 1024 * 1024
+
+// Fs is an implementation of afero.Fs for the objects of a bucket below a prefix.
+type Fs struct {
+	client   *client
+	prefix   string
+	partSize int
+	// infos holds the file infos of listed objects by key, which saves a request for each
+	// object when walking directories
+	infos sync.Map
+}
+
+// New returns a filesystem for the objects in the bucket below prefix.
+func New(bucket string, prefix string, config Config) (*Fs, error) {
+	client, err := newClient(config, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &Fs{
+		client:   client,
+		prefix:   strings.Trim(prefix, "/"),
+		partSize: defaultPartSize,
+	}, nil
+}
+
+func (s *Fs) Name() string { return "s3fs" }
+
+// key returns the key of the object with name.
+func (s *Fs) key(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	switch {
+	case s.prefix == "":
+		return name
+	case name == "":
+		return s.prefix
+	default:
+		return s.prefix + "/" + name
+	}
+}
+
+func (s *Fs) Create(name string) (afero.File, error) {
+	return newWriteFile(s, name), nil
+}
+
+// Mkdir does nothing since directories exist as long as there are objects below them.
+func (s *Fs) Mkdir(name string, perm os.FileMode) error {
+	return nil
+}
+
+// MkdirAll does nothing since directories exist as long as there are objects below them.
+func (s *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+func (s *Fs) Open(name string) (afero.File, error) {
+	info, err := s.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{fs: s, name: name, key: s.key(name), info: info}, nil
+}
+
+func (s *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	switch {
+	case flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return s.Open(name)
+	case flag&os.O_APPEND != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOTSUP}
+	case flag&(os.O_CREATE|os.O_TRUNC) != 0:
+		return s.Create(name)
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOTSUP}
+}
+
+func (s *Fs) Remove(name string) error {
+	key := s.key(name)
+	s.infos.Delete(key)
+	return s.client.remove(context.Background(), key)
+}
+
+func (s *Fs) RemoveAll(name string) error {
+	key := s.key(name)
+	objects, err := s.client.list(context.Background(), dirPrefix(key), "", 0)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		s.infos.Delete(object.key)
+		if err := s.client.remove(context.Background(), object.key); err != nil {
+			return err
+		}
+	}
+	if err := s.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *Fs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOTSUP}
+}
+
+func (s *Fs) Stat(name string) (os.FileInfo, error) {
+	return s.stat(name)
+}
+
+func (s *Fs) stat(name string) (*FileInfo, error) {
+	key := s.key(name)
+	if key == "" {
+		return &FileInfo{name: "/", dir: true}, nil
+	}
+	if info, ok := s.infos.Load(key); ok {
+		return info.(*FileInfo), nil
+	}
+
+	object, err := s.client.head(context.Background(), key)
+	if err == nil {
+		return newFileInfo(object), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	// a directory exists if there are objects below it
+	objects, listErr := s.client.list(context.Background(), key+"/", "/", 1)
+	if listErr != nil {
+		return nil, listErr
+	}
+	if len(objects) == 0 {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return &FileInfo{name: path.Base(key), dir: true}, nil
+}
+
+// readdir lists the directory with key and remembers the file infos of its entries.
+func (s *Fs) readdir(key string) ([]os.FileInfo, error) {
+	prefix := dirPrefix(key)
+	objects, err := s.client.list(context.Background(), prefix, "/", 0)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(objects))
+	for _, object := range objects {
+		// skip markers of empty directories
+		if object.key == prefix {
+			continue
+		}
+		info := newFileInfo(object)
+		s.infos.Store(strings.TrimSuffix(object.key, "/"), info)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// dirPrefix returns the prefix of the keys of the objects in the directory with key.
+func dirPrefix(key string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+func (s *Fs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: syscall.ENOTSUP}
+}
+
+func (s *Fs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: syscall.ENOTSUP}
+}
+
+func (s *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: syscall.ENOTSUP}
+}
@@ -0,0 +1,316 @@
+package s3fs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// fakeS3 is an in-memory stand-in for the parts of an S3 compatible object store used by Fs.
+type fakeS3 struct {
+	t       *testing.T
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	nextId  int
+	// ranges holds the Range headers of the GET requests of objects
+	ranges []string
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		t:       t,
+		bucket:  bucket,
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		http.Error(w, "missing signature", http.StatusForbidden)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code><Message>no such bucket</Message></Error>")
+		return
+	}
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2":
+		f.list(w, query.Get("prefix"), query.Get("delimiter"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextId++
+		uploadId := strconv.Itoa(f.nextId)
+		f.uploads[uploadId] = make(map[int][]byte)
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadId)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, partNumber))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var content []byte
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"%d"`, i+1) {
+				http.Error(w, "invalid part", http.StatusBadRequest)
+				return
+			}
+			if i < len(complete.Parts)-1 && len(parts[part.PartNumber]) < minPartSize {
+				http.Error(w, "part too small", http.StatusBadRequest)
+				return
+			}
+			content = append(content, parts[part.PartNumber]...)
+		}
+		f.objects[key] = content
+		delete(f.uploads, query.Get("uploadId"))
+		_, _ = fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		content, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			f.ranges = append(f.ranges, r.Header.Get("Range"))
+		}
+		w.Header().Set("Last-Modified", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Format(http.TimeFormat))
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(content))
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string, delimiter string) {
+	var keys []string
+	prefixes := make(map[string]bool)
+	for key := range f.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				prefixes[key[:len(prefix)+i+1]] = true
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("<ListBucketResult><IsTruncated>false</IsTruncated>")
+	for p := range prefixes {
+		fmt.Fprintf(&sb, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", p)
+	}
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "<Contents><Key>%s</Key><LastModified>2024-01-02T03:04:05.000Z</LastModified><Size>%d</Size></Contents>", key, len(f.objects[key]))
+	}
+	sb.WriteString("</ListBucketResult>")
+	_, _ = io.WriteString(w, sb.String())
+}
+
+const minPartSize = 8
+
+func newTestFs(t *testing.T, prefix string) (*fakeS3, *Fs) {
+	fake, server := newFakeS3(t, "bucket")
+	fs, err := New("bucket", prefix, Config{
+		Endpoint:        server.URL,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.partSize = minPartSize
+	return fake, fs
+}
+
+func TestSigningKey(t *testing.T) {
+	// example from the AWS documentation of signature version 4
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("expected signing key %s, got %s", want, got)
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	query := map[string][]string{"prefix": {"a b/c"}, "list-type": {"2"}, "uploads": {""}}
+	want := "list-type=2&prefix=a%20b%2Fc&uploads="
+	if got := canonicalQuery(query); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	fake, fs := newTestFs(t, "collection")
+	fake.objects["collection/a.warc.gz"] = []byte("a")
+	fake.objects["collection/2024/b.warc.gz"] = []byte("bb")
+	fake.objects["collection/2024/01/c.warc.gz"] = []byte("ccc")
+	fake.objects["other/d.warc.gz"] = []byte("d")
+
+	var walked []string
+	err := afero.Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, fmt.Sprintf("%s %t %d", path, info.IsDir(), info.Size()))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/ true 0",
+		"/2024 true 0",
+		"/2024/01 true 0",
+		"/2024/01/c.warc.gz false 3",
+		"/2024/b.warc.gz false 2",
+		"/a.warc.gz false 1",
+	}
+	if strings.Join(walked, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(walked, "\n"))
+	}
+
+	if _, err := fs.Stat("missing.warc.gz"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+	if info, err := fs.Stat("2024"); err != nil || !info.IsDir() {
+		t.Errorf("expected directory, got %v, %v", info, err)
+	}
+}
+
+func TestReadSeek(t *testing.T) {
+	fake, fs := newTestFs(t, "")
+	fake.objects["file.warc"] = []byte("0123456789")
+
+	f, err := fs.Open("/file.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(f, b); err != nil || string(b) != "012" {
+		t.Fatalf("expected 012, got %q, %v", b, err)
+	}
+	if _, err := f.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil || string(rest) != "789" {
+		t.Fatalf("expected 789, got %q, %v", rest, err)
+	}
+	if n, err := f.ReadAt(b, 4); n != 3 || string(b) != "456" {
+		t.Fatalf("expected 456, got %q, %v", b[:n], err)
+	}
+	if n, err := f.ReadAt(b, 8); n != 2 || err != io.EOF {
+		t.Fatalf("expected 2 bytes and EOF, got %d, %v", n, err)
+	}
+
+	wantRanges := []string{"", "bytes=7-", "bytes=4-6", "bytes=8-10"}
+	if strings.Join(fake.ranges, ",") != strings.Join(wantRanges, ",") {
+		t.Errorf("expected ranges %v, got %v", wantRanges, fake.ranges)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"single request", "small"},
+		{"multipart", "0123456789abcdefghijklmnopqrstuvwxyz"},
+		{"multipart of whole parts", "0123456701234567"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, fs := newTestFs(t, "out")
+			f, err := fs.Create("dir/file.warc.gz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// write in pieces not aligned with the parts
+			for content := tt.content; content != ""; {
+				n := min(5, len(content))
+				if _, err := f.Write([]byte(content[:n])); err != nil {
+					t.Fatal(err)
+				}
+				content = content[n:]
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(fake.objects["out/dir/file.warc.gz"]); got != tt.content {
+				t.Errorf("expected %q, got %q", tt.content, got)
+			}
+			if len(fake.uploads) != 0 {
+				t.Errorf("expected no unfinished uploads, got %d", len(fake.uploads))
+			}
+		})
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	fake, fs := newTestFs(t, "")
+	fake.objects["a/b.warc"] = []byte("b")
+	fake.objects["a/c/d.warc"] = []byte("d")
+	fake.objects["e.warc"] = []byte("e")
+
+	if err := fs.RemoveAll("a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.objects) != 1 || fake.objects["e.warc"] == nil {
+		t.Errorf("expected only e.warc to remain, got %v", fake.objects)
+	}
+}
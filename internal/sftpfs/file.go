@@ -0,0 +1,142 @@
+package sftpfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	"github.com/jackc/puddle"
+	"github.com/pkg/sftp"
+)
+
+// File is a file or directory opened for reading. It holds a connection of the pool until it
+// is closed.
+type File struct {
+	file        *sftp.File
+	info        os.FileInfo
+	fullName    string
+	resource    *puddle.Resource
+	entries     []os.FileInfo
+	entriesRead bool
+}
+
+func fileOpen(res *puddle.Resource, name string, fullName string) (*File, error) {
+	f := &File{resource: res, fullName: fullName}
+	info, err := f.sftpClient().Stat(fullName)
+	if err != nil {
+		return nil, err
+	}
+	f.info = &FileInfo{FileInfo: info, name: path.Base(filepath.ToSlash(name))}
+	if !info.IsDir() {
+		f.file, err = f.sftpClient().Open(fullName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *File) Close() error {
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	if f.resource != nil {
+		f.resource.Release()
+		f.resource = nil
+	}
+	return err
+}
+
+func (f *File) sftpClient() *sftp.Client {
+	return f.resource.Value().(*conn).sftp
+}
+
+func (f *File) Name() string {
+	return f.info.Name()
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *File) Sync() error {
+	return nil
+}
+
+func (f *File) Truncate(size int64) error {
+	return syscall.EROFS
+}
+
+func (f *File) Read(b []byte) (n int, err error) {
+	if f.file == nil {
+		return 0, syscall.EISDIR
+	}
+	return f.file.Read(b)
+}
+
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	if f.file == nil {
+		return 0, syscall.EISDIR
+	}
+	return f.file.ReadAt(b, off)
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.file == nil {
+		return 0, syscall.EISDIR
+	}
+	return f.file.Seek(offset, whence)
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if f.file != nil {
+		return nil, syscall.ENOTDIR
+	}
+	if !f.entriesRead {
+		entries, err := f.sftpClient().ReadDir(f.fullName)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+		f.entriesRead = true
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(f.entries))
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *File) Readdirnames(n int) (names []string, err error) {
+	entries, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return
+}
+
+func (f *File) Write(b []byte) (n int, err error) {
+	return 0, syscall.EROFS
+}
+
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, syscall.EROFS
+}
+
+func (f *File) WriteString(s string) (ret int, err error) {
+	return 0, syscall.EROFS
+}
@@ -0,0 +1,16 @@
+package sftpfs
+
+import (
+	"os"
+)
+
+// FileInfo is the file info returned by the server with the name of the opened file, since
+// the server names the root of a relative path '.'.
+type FileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (f FileInfo) Name() string {
+	return f.name
+}
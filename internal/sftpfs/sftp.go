@@ -0,0 +1,241 @@
+// Package sftpfs is a read-only afero.Fs for files on an SFTP server.
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/jackc/puddle"
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Fs is an implementation of afero.Fs that utilizes functions from the sftp package.
+//
+// For detailed information on any method, please refer to the documentation of the sftp
+// package available at github.com/pkg/sftp.
+type Fs struct {
+	pool *puddle.Pool
+	root string
+}
+
+// conn is a pooled SSH connection with its SFTP session.
+type conn struct {
+	ssh  *ssh.Client
+	sftp *sftp.Client
+}
+
+// New returns a filesystem for the files below root on the SFTP server at addr. Relative roots
+// are relative to the home directory of the user.
+func New(addr string, root string, config *ssh.ClientConfig, poolSize int32) afero.Fs {
+	constructor := func(ctx context.Context) (any, error) {
+		dialer := net.Dialer{Timeout: config.Timeout}
+		netConn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, config)
+		if err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+		sshClient := ssh.NewClient(sshConn, chans, reqs)
+		sftpClient, err := sftp.NewClient(sshClient)
+		if err != nil {
+			_ = sshClient.Close()
+			return nil, err
+		}
+		return &conn{ssh: sshClient, sftp: sftpClient}, nil
+	}
+
+	destructor := func(value any) {
+		c := value.(*conn)
+		_ = c.sftp.Close()
+		_ = c.ssh.Close()
+	}
+
+	pool := puddle.NewPool(constructor, destructor, poolSize)
+	return &Fs{
+		pool: pool,
+		root: root,
+	}
+}
+
+// Config holds the authentication of a user.
+type Config struct {
+	User     string
+	Password string
+	// IdentityFile is the path of a private key. If empty, the default keys in ~/.ssh are tried.
+	IdentityFile string
+	// KnownHostsFile is the path of the known_hosts file used to verify the host key. If empty,
+	// ~/.ssh/known_hosts is used.
+	KnownHostsFile string
+	// InsecureIgnoreHostKey disables verification of the host key.
+	InsecureIgnoreHostKey bool
+}
+
+// defaultIdentityFiles are the private keys tried when no identity file is configured.
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// ClientConfig returns an SSH client configuration authenticating with the keys of a running
+// SSH agent, private keys and the password, in that order.
+func (c Config) ClientConfig() (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if agentConn, err := net.Dial("unix", socket); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	var signers []ssh.Signer
+	if c.IdentityFile != "" {
+		signer, err := readPrivateKey(c.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	} else if home != "" {
+		for _, name := range defaultIdentityFiles {
+			// keys that do not exist or need a passphrase are left to the agent
+			if signer, err := readPrivateKey(filepath.Join(home, ".ssh", name)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if c.InsecureIgnoreHostKey {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		knownHostsFile := c.KnownHostsFile
+		if knownHostsFile == "" {
+			if home == "" {
+				return nil, errors.New("failed to locate known_hosts file: no home directory")
+			}
+			knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		callback, err := knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known hosts: %w", err)
+		}
+		hostKeyCallback = callback
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+func readPrivateKey(name string) (ssh.Signer, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", name, err)
+	}
+	return signer, nil
+}
+
+func (s *Fs) Name() string { return "sftpfs" }
+
+// path returns the path of name on the server.
+func (s *Fs) path(name string) string {
+	name = filepath.ToSlash(name)
+	if s.root == "" {
+		return path.Clean(name)
+	}
+	return path.Join(s.root, name)
+}
+
+func (s *Fs) Create(name string) (afero.File, error) {
+	return nil, syscall.EROFS
+}
+
+func (s *Fs) Mkdir(name string, perm os.FileMode) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Open(name string) (afero.File, error) {
+	res, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	f, err := fileOpen(res, name, s.path(name))
+	if err != nil {
+		res.Release()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag == os.O_RDONLY {
+		return s.Open(name)
+	}
+	return nil, syscall.EROFS
+}
+
+func (s *Fs) Remove(name string) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) RemoveAll(path string) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Rename(oldname, newname string) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Stat(name string) (os.FileInfo, error) {
+	res, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Release()
+	info, err := res.Value().(*conn).sftp.Stat(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{FileInfo: info, name: path.Base(filepath.ToSlash(name))}, nil
+}
+
+func (s *Fs) Chmod(name string, mode os.FileMode) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Chown(name string, uid, gid int) error {
+	return syscall.EROFS
+}
+
+func (s *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return syscall.EROFS
+}
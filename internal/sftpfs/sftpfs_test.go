@@ -0,0 +1,202 @@
+package sftpfs
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestServer starts an SSH server serving an in-memory SFTP filesystem holding the files
+// and returns its address and host key.
+func newTestServer(t *testing.T, files map[string]string) (string, ssh.PublicKey) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "user" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	handlers := sftp.InMemHandler()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			netConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(netConn, config, handlers)
+		}
+	}()
+
+	// populate the filesystem through a client
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sftpClient.Close() }()
+	for name, content := range files {
+		if err := sftpClient.MkdirAll(name[:strings.LastIndex(name, "/")]); err != nil {
+			t.Fatal(err)
+		}
+		f, err := sftpClient.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+func serve(netConn net.Conn, config *ssh.ServerConfig, handlers sftp.Handlers) {
+	_, chans, reqs, err := ssh.NewServerConn(netConn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					server := sftp.NewRequestServer(channel, handlers)
+					_ = server.Serve()
+					_ = server.Close()
+				}
+			}
+		}()
+	}
+}
+
+func newTestFs(t *testing.T, root string, files map[string]string) afero.Fs {
+	addr, hostKey := newTestServer(t, files)
+	return New(addr, root, &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}, 2)
+}
+
+func TestWalk(t *testing.T) {
+	fs := newTestFs(t, "/collection", map[string]string{
+		"/collection/a.warc.gz":         "a",
+		"/collection/2024/b.warc.gz":    "bb",
+		"/collection/2024/01/c.warc.gz": "ccc",
+		"/other/d.warc.gz":              "d",
+	})
+
+	var walked []string
+	err := afero.Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			walked = append(walked, fmt.Sprintf("%s %s", path, info.Name()))
+		} else {
+			walked = append(walked, fmt.Sprintf("%s %s %d", path, info.Name(), info.Size()))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/ /",
+		"/2024 2024",
+		"/2024/01 01",
+		"/2024/01/c.warc.gz c.warc.gz 3",
+		"/2024/b.warc.gz b.warc.gz 2",
+		"/a.warc.gz a.warc.gz 1",
+	}
+	if strings.Join(walked, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(walked, "\n"))
+	}
+
+	if _, err := fs.Stat("missing.warc.gz"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestReadSeek(t *testing.T) {
+	fs := newTestFs(t, "", map[string]string{"/data/file.warc": "0123456789"})
+
+	f, err := fs.Open("/data/file.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(f, b); err != nil || string(b) != "012" {
+		t.Fatalf("expected 012, got %q, %v", b, err)
+	}
+	if _, err := f.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil || string(rest) != "789" {
+		t.Fatalf("expected 789, got %q, %v", rest, err)
+	}
+	if n, err := f.ReadAt(b, 4); n != 3 || string(b) != "456" {
+		t.Fatalf("expected 456, got %q, %v", b[:n], err)
+	}
+
+	if _, err := fs.Create("/data/new.warc"); err == nil {
+		t.Error("expected filesystem to be read-only")
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	addr, hostKey := newTestServer(t, nil)
+	fs := New(addr, "", &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("wrong")},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}, 1)
+	if _, err := fs.Stat("/"); err == nil {
+		t.Error("expected authentication to fail")
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"github.com/awesome-gocui/gocui"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/ui/model"
 	widgets "github.com/nationallibraryofnorway/warchaeology/v5/internal/ui/widget"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warc"
 	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
 )
 
 const (
@@ -43,6 +45,7 @@ type App struct {
 	modal string
 
 	// domain state
+	fs       afero.Fs
 	dir      string
 	files    []string
 	file     string
@@ -95,7 +98,13 @@ func NewApp(opts *Options) *App {
 		dir = wd
 	}
 
+	fs := opts.Fs
+	if fs == nil {
+		fs = afero.NewOsFs()
+	}
+
 	return &App{
+		fs:       fs,
 		dir:      dir,
 		files:    opts.Files,
 		suffixes: opts.Suffixes,
@@ -429,7 +438,7 @@ func (a *App) populateFiles(gui *gocui.Gui) error {
 		return nil
 	}
 
-	entries, err := os.ReadDir(a.dir)
+	entries, err := afero.ReadDir(a.fs, a.dir)
 	if err != nil {
 		return err
 	}
@@ -507,10 +516,24 @@ func (a *App) onRecordSelected(item RecordItem, ok bool) {
 	})
 }
 
+// openReader opens a reader of the WARC file at path starting at the record at offset.
+func (a *App) openReader(path string, offset int64) (warc.Reader, error) {
+	f, err := a.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := warc.NewReaderFromStream(f, offset, gowarc.WithBufferTmpDir(a.tmpDir))
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
 // loadRecords reads all records from path and streams them to the records
 // widget in batches. It returns when the file is exhausted or ctx is cancelled.
 func (a *App) loadRecords(ctx context.Context, path string) error {
-	reader, err := gowarc.NewWarcFileReader(path, 0, gowarc.WithBufferTmpDir(a.tmpDir))
+	reader, err := a.openReader(path, 0)
 	if err != nil {
 		return err
 	}
@@ -566,7 +589,7 @@ func (a *App) loadRecordDetails(g *gocui.Gui, path string, item RecordItem) {
 		a.recordPanel.RenderReadError(g, item.Err)
 		return
 	}
-	reader, err := gowarc.NewWarcFileReader(path, item.Offset, gowarc.WithBufferTmpDir(a.tmpDir))
+	reader, err := a.openReader(path, item.Offset)
 	if err != nil {
 		a.recordPanel.RenderErrors(g, []error{err})
 		return
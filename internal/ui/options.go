@@ -1,6 +1,10 @@
 package ui
 
+import "github.com/spf13/afero"
+
 type Options struct {
+	// Fs is the filesystem of Dir, or the local filesystem if nil
+	Fs       afero.Fs
 	Dir      string
 	Files    []string
 	Suffixes []string
@@ -0,0 +1,161 @@
+package wacz
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+)
+
+// IndexEntry is a single capture from a CDX or CDXJ index.
+type IndexEntry struct {
+	Line      int
+	SURT      string
+	Timestamp string
+	URL       string
+	Mime      string
+	Status    string
+	Digest    string
+	Filename  string
+	Offset    int64
+	Length    int64
+}
+
+// flexInt accepts both JSON numbers and numeric strings, as both are found in the wild.
+type flexInt int64
+
+func (i *flexInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = flexInt(v)
+	return nil
+}
+
+type cdxjFields struct {
+	URL      string  `json:"url"`
+	Mime     string  `json:"mime"`
+	Status   string  `json:"status"`
+	Digest   string  `json:"digest"`
+	Filename string  `json:"filename"`
+	Offset   flexInt `json:"offset"`
+	Length   flexInt `json:"length"`
+}
+
+// ReadIndex parses a CDXJ index or a classic CDX index with a " CDX" header line.
+//
+// Lines that cannot be parsed are yielded as errors and do not stop the iteration.
+func ReadIndex(r io.Reader) iter.Seq2[IndexEntry, error] {
+	return func(yield func(IndexEntry, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+		var cdxFields []string
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimRight(scanner.Text(), "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if strings.HasPrefix(line, " CDX ") || strings.HasPrefix(line, "CDX ") {
+				cdxFields = strings.Fields(line)[1:]
+				continue
+			}
+			var entry IndexEntry
+			var err error
+			if cdxFields != nil {
+				entry, err = parseCdxLine(line, cdxFields)
+			} else {
+				entry, err = parseCdxjLine(line)
+			}
+			entry.Line = lineNum
+			if err != nil {
+				err = fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			if !yield(entry, err) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(IndexEntry{Line: lineNum}, err)
+		}
+	}
+}
+
+func parseCdxjLine(line string) (IndexEntry, error) {
+	surt, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return IndexEntry{}, fmt.Errorf("malformed CDXJ line: missing timestamp")
+	}
+	timestamp, data, ok := strings.Cut(rest, " ")
+	if !ok {
+		return IndexEntry{}, fmt.Errorf("malformed CDXJ line: missing JSON block")
+	}
+	var fields cdxjFields
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return IndexEntry{}, fmt.Errorf("malformed CDXJ JSON block: %w", err)
+	}
+	return IndexEntry{
+		SURT:      surt,
+		Timestamp: timestamp,
+		URL:       fields.URL,
+		Mime:      fields.Mime,
+		Status:    fields.Status,
+		Digest:    fields.Digest,
+		Filename:  fields.Filename,
+		Offset:    int64(fields.Offset),
+		Length:    int64(fields.Length),
+	}, nil
+}
+
+// parseCdxLine parses a line according to the field letters of the CDX header.
+//
+// See https://iipc.github.io/warc-specifications/specifications/cdx-format/cdx-2015/
+func parseCdxLine(line string, cdxFields []string) (IndexEntry, error) {
+	values := strings.Fields(line)
+	if len(values) != len(cdxFields) {
+		return IndexEntry{}, fmt.Errorf("malformed CDX line: expected %d fields, got %d", len(cdxFields), len(values))
+	}
+	var entry IndexEntry
+	for i, field := range cdxFields {
+		value := values[i]
+		if value == "-" {
+			continue
+		}
+		var err error
+		switch field {
+		case "N":
+			entry.SURT = value
+		case "b":
+			entry.Timestamp = value
+		case "a":
+			entry.URL = value
+		case "m":
+			entry.Mime = value
+		case "s":
+			entry.Status = value
+		case "k":
+			entry.Digest = value
+		case "g":
+			entry.Filename = value
+		case "V", "v":
+			entry.Offset, err = strconv.ParseInt(value, 10, 64)
+		case "S":
+			entry.Length, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return IndexEntry{}, fmt.Errorf("malformed CDX field %s: %w", field, err)
+		}
+	}
+	return entry, nil
+}
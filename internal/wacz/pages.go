@@ -0,0 +1,87 @@
+package wacz
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	mytime "github.com/nationallibraryofnorway/warchaeology/v5/internal/time"
+)
+
+const pagesFormat = "json-pages-1.0"
+
+type pagesHeader struct {
+	Format string `json:"format"`
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+}
+
+// Page is an entry in a pages.jsonl file.
+type Page struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	TS    string `json:"ts"`
+	Title string `json:"title,omitempty"`
+}
+
+// ValidatePages checks a pages.jsonl file. The first line must be a header declaring the
+// json-pages-1.0 format and every following line must be a page with a url and a timestamp.
+//
+// It returns the number of pages read and the problems found.
+func ValidatePages(r io.Reader) (int, []error) {
+	var errs []error
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, []error{err}
+		}
+		return 0, []error{errors.New("missing header line")}
+	}
+	var header pagesHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		errs = append(errs, fmt.Errorf("line 1: malformed header: %w", err))
+	} else if !strings.HasPrefix(header.Format, pagesFormat) {
+		errs = append(errs, fmt.Errorf("line 1: unsupported format %q, expected %q", header.Format, pagesFormat))
+	}
+
+	pages := 0
+	lineNum := 1
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		pages++
+		var page Page
+		if err := json.Unmarshal(line, &page); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: malformed page: %w", lineNum, err))
+			continue
+		}
+		if page.URL == "" {
+			errs = append(errs, fmt.Errorf("line %d: missing url", lineNum))
+		}
+		if page.TS == "" {
+			errs = append(errs, fmt.Errorf("line %d: missing ts", lineNum))
+		} else if _, err := parseTimestamp(page.TS); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: malformed ts %q", lineNum, page.TS))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return pages, errs
+}
+
+func parseTimestamp(ts string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+		return t, nil
+	}
+	return mytime.From14ToTime(ts)
+}
@@ -0,0 +1,184 @@
+// Package wacz reads the structural parts of WACZ files: the datapackage,
+// the page lists and the CDX(J) indexes.
+//
+// See https://specs.webrecorder.net/wacz/1.1.1/
+package wacz
+
+import (
+	"archive/zip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	DataPackageName       = "datapackage.json"
+	DataPackageDigestName = "datapackage-digest.json"
+	ArchiveDir            = "archive"
+	IndexesDir            = "indexes"
+	PagesDir              = "pages"
+)
+
+// ErrNotStored is returned when random access is requested to a zip entry that is compressed.
+var ErrNotStored = errors.New("zip entry is compressed; WACZ requires stored (uncompressed) entries for random access")
+
+// Resource is an entry of the resources list in datapackage.json.
+type Resource struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Bytes int64  `json:"bytes"`
+}
+
+// DataPackage is the content of datapackage.json.
+type DataPackage struct {
+	Profile     string     `json:"profile"`
+	WaczVersion string     `json:"wacz_version"`
+	Title       string     `json:"title,omitempty"`
+	Created     string     `json:"created,omitempty"`
+	Software    string     `json:"software,omitempty"`
+	Resources   []Resource `json:"resources"`
+}
+
+// Archive gives access to the entries of a WACZ file.
+type Archive struct {
+	readerAt io.ReaderAt
+	zip      *zip.Reader
+	files    map[string]*zip.File
+}
+
+// Open opens a WACZ file from r which must be size bytes long.
+func Open(r io.ReaderAt, size int64) (*Archive, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip: %w", err)
+	}
+	archive := &Archive{
+		readerAt: r,
+		zip:      zipReader,
+		files:    make(map[string]*zip.File, len(zipReader.File)),
+	}
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		archive.files[path.Clean(f.Name)] = f
+	}
+	return archive, nil
+}
+
+// Files returns the sorted names of all regular files in the archive.
+func (a *Archive) Files() []string {
+	names := make([]string, 0, len(a.files))
+	for name := range a.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FilesIn returns the sorted names of all regular files in dir.
+func (a *Archive) FilesIn(dir string) []string {
+	var names []string
+	for _, name := range a.Files() {
+		if path.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Has reports whether the archive contains the named file.
+func (a *Archive) Has(name string) bool {
+	_, ok := a.files[path.Clean(name)]
+	return ok
+}
+
+// Open opens the named file for sequential reading.
+func (a *Archive) Open(name string) (io.ReadCloser, error) {
+	f, ok := a.files[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s: file not found in archive", name)
+	}
+	return f.Open()
+}
+
+// Section returns a random access reader for the named file.
+// The file must be stored without compression, otherwise ErrNotStored is returned.
+func (a *Archive) Section(name string) (*io.SectionReader, error) {
+	f, ok := a.files[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s: file not found in archive", name)
+	}
+	if f.Method != zip.Store {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotStored)
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(a.readerAt, offset, int64(f.UncompressedSize64)), nil
+}
+
+// DataPackage reads and parses datapackage.json.
+func (a *Archive) DataPackage() (*DataPackage, error) {
+	r, err := a.Open(DataPackageName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	dataPackage := &DataPackage{}
+	if err := json.NewDecoder(r).Decode(dataPackage); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", DataPackageName, err)
+	}
+	return dataPackage, nil
+}
+
+// VerifyResource checks that the resource exists in the archive and that its size and hash
+// match the values listed in datapackage.json.
+func (a *Archive) VerifyResource(resource Resource) error {
+	f, ok := a.files[path.Clean(resource.Path)]
+	if !ok {
+		return fmt.Errorf("%s: resource listed in %s is missing from archive", resource.Path, DataPackageName)
+	}
+	if resource.Bytes != int64(f.UncompressedSize64) {
+		return fmt.Errorf("%s: size mismatch: datapackage says %d bytes, archive has %d bytes", resource.Path, resource.Bytes, f.UncompressedSize64)
+	}
+	if resource.Hash == "" {
+		return fmt.Errorf("%s: missing hash in %s", resource.Path, DataPackageName)
+	}
+	algorithm, expected, ok := strings.Cut(resource.Hash, ":")
+	if !ok {
+		return fmt.Errorf("%s: malformed hash: %q", resource.Path, resource.Hash)
+	}
+	var h hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		h = sha256.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return fmt.Errorf("%s: unsupported hash algorithm: %s", resource.Path, algorithm)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", resource.Path, err)
+	}
+	defer func() { _ = r.Close() }()
+	if _, err := io.Copy(h, r); err != nil {
+		return fmt.Errorf("%s: %w", resource.Path, err)
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%s: hash mismatch: datapackage says %s, archive has %s:%s", resource.Path, resource.Hash, algorithm, actual)
+	}
+	return nil
+}
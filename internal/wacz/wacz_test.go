@@ -0,0 +1,156 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func createArchive(t *testing.T, files map[string]string, resources []Resource) *Archive {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	if resources != nil {
+		b, err := json.Marshal(DataPackage{Profile: "data-package", WaczVersion: "1.1.1", Resources: resources})
+		require.NoError(t, err)
+		w, err := zw.Create(DataPackageName)
+		require.NoError(t, err)
+		_, err = w.Write(b)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	archive, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	return archive
+}
+
+func TestArchive_VerifyResource(t *testing.T) {
+	content := "WARC/1.1\r\n"
+	files := map[string]string{"archive/data.warc": content}
+
+	tests := []struct {
+		name     string
+		resource Resource
+		wantErr  string
+	}{
+		{"ok", Resource{Path: "archive/data.warc", Hash: sha256Hash([]byte(content)), Bytes: int64(len(content))}, ""},
+		{"missing", Resource{Path: "archive/other.warc", Hash: sha256Hash([]byte(content)), Bytes: int64(len(content))}, "missing from archive"},
+		{"wrong size", Resource{Path: "archive/data.warc", Hash: sha256Hash([]byte(content)), Bytes: 1}, "size mismatch"},
+		{"wrong hash", Resource{Path: "archive/data.warc", Hash: sha256Hash([]byte("x")), Bytes: int64(len(content))}, "hash mismatch"},
+		{"unknown algorithm", Resource{Path: "archive/data.warc", Hash: "crc32:00", Bytes: int64(len(content))}, "unsupported hash algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := createArchive(t, files, []Resource{tt.resource})
+			dataPackage, err := archive.DataPackage()
+			require.NoError(t, err)
+			require.Len(t, dataPackage.Resources, 1)
+
+			err = archive.VerifyResource(dataPackage.Resources[0])
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestArchive_Section(t *testing.T) {
+	archive := createArchive(t, map[string]string{"archive/data.warc": "0123456789"}, nil)
+
+	section, err := archive.Section("archive/data.warc")
+	require.NoError(t, err)
+	_, err = section.Seek(5, io.SeekStart)
+	require.NoError(t, err)
+	b, err := io.ReadAll(section)
+	require.NoError(t, err)
+	assert.Equal(t, "56789", string(b))
+
+	assert.Equal(t, []string{"archive/data.warc"}, archive.FilesIn(ArchiveDir))
+}
+
+func TestReadIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   string
+		want    []IndexEntry
+		wantErr int
+	}{
+		{
+			name:  "cdxj",
+			index: `com,example)/ 20240101120000 {"url": "http://example.com/", "mime": "text/html", "status": "200", "offset": "123", "length": 456, "filename": "data.warc.gz"}` + "\n",
+			want: []IndexEntry{{Line: 1, SURT: "com,example)/", Timestamp: "20240101120000", URL: "http://example.com/", Mime: "text/html",
+				Status: "200", Filename: "data.warc.gz", Offset: 123, Length: 456}},
+		},
+		{
+			name:  "cdx",
+			index: " CDX N b a m s k r M S V g\ncom,example)/ 20240101120000 http://example.com/ text/html 200 ABC - - 456 123 data.warc.gz\n",
+			want: []IndexEntry{{Line: 2, SURT: "com,example)/", Timestamp: "20240101120000", URL: "http://example.com/", Mime: "text/html",
+				Status: "200", Digest: "ABC", Filename: "data.warc.gz", Offset: 123, Length: 456}},
+		},
+		{
+			name:    "malformed",
+			index:   "com,example)/ 20240101120000 {not json}\ncom,example)/\n",
+			wantErr: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []IndexEntry
+			errCount := 0
+			for entry, err := range ReadIndex(strings.NewReader(tt.index)) {
+				if err != nil {
+					errCount++
+					continue
+				}
+				got = append(got, entry)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, errCount)
+		})
+	}
+}
+
+func TestValidatePages(t *testing.T) {
+	tests := []struct {
+		name      string
+		pages     string
+		wantPages int
+		wantErrs  int
+	}{
+		{"ok", `{"format": "json-pages-1.0", "id": "pages"}` + "\n" + `{"url": "http://example.com/", "ts": "2024-01-01T12:00:00Z"}` + "\n" + `{"url": "http://example.com/a", "ts": "20240101120000"}` + "\n", 2, 0},
+		{"empty", "", 0, 1},
+		{"wrong format", `{"format": "other"}` + "\n", 0, 1},
+		{"missing fields", `{"format": "json-pages-1.0"}` + "\n" + `{"title": "x"}` + "\n", 1, 2},
+		{"bad timestamp", `{"format": "json-pages-1.0"}` + "\n" + `{"url": "http://example.com/", "ts": "yesterday"}` + "\n", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, errs := ValidatePages(strings.NewReader(tt.pages))
+			assert.Equal(t, tt.wantPages, pages)
+			assert.Len(t, errs, tt.wantErrs)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"iter"
+	"os"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warczstd"
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// Reader reads the records of a WARC file.
+type Reader interface {
+	Next() (gowarc.Record, error)
+	Records() iter.Seq2[gowarc.Record, error]
+	Close() error
+}
+
+// NewReader opens the WARC file at path and returns a reader starting at the record at offset.
+func NewReader(path string, offset int64, opts ...gowarc.WarcRecordOption) (Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReaderFromStream(f, offset, opts...)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// NewReaderFromStream returns a reader for an uncompressed, gzip or zstd compressed WARC file
+// starting at the record at offset. The compression is detected from the start of the file: a
+// reader that implements io.Seeker is rewound to the start first, any other reader must be
+// positioned at the start of the file even when offset is not zero.
+//
+// If r implements io.Closer, it is closed when the reader is closed.
+func NewReaderFromStream(r io.Reader, offset int64, opts ...gowarc.WarcRecordOption) (Reader, error) {
+	var magic [4]byte
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		n, err := io.ReadFull(seeker, magic[:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return newReader(r, warczstd.IsZstd(magic[:n]), offset, opts...)
+	}
+
+	// peek at the start of streams that can't be rewound
+	br := bufio.NewReader(r)
+	b, _ := br.Peek(len(magic))
+	var stream io.Reader = br
+	if closer, ok := r.(io.Closer); ok {
+		stream = readCloser{Reader: br, Closer: closer}
+	}
+	return newReader(stream, warczstd.IsZstd(b), offset, opts...)
+}
+
+// IsCompressed reports whether a WARC file starting with magic is gzip or zstd compressed.
+func IsCompressed(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte{0x1f, 0x8b}) || warczstd.IsZstd(magic)
+}
+
+func newReader(r io.Reader, zstd bool, offset int64, opts ...gowarc.WarcRecordOption) (Reader, error) {
+	if zstd {
+		reader, err := warczstd.NewReader(r, offset, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if closer, ok := r.(io.Closer); ok {
+			return closingReader{Reader: reader, closer: closer}, nil
+		}
+		return reader, nil
+	}
+	reader, err := gowarc.NewWarcFileReaderFromStream(r, offset, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closingReader closes the stream a zstd reader reads from along with the reader.
+type closingReader struct {
+	*warczstd.Reader
+	closer io.Closer
+}
+
+func (r closingReader) Close() error {
+	return errors.Join(r.Reader.Close(), r.closer.Close())
+}
@@ -1,35 +1,66 @@
 package warcwriterconfig
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/hooks"
 	"github.com/nationallibraryofnorway/warchaeology/v5/internal/util"
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/warczstd"
 	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
 )
 
 const DefaultDateFormat = "2006-1-2"
 
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// WarcWriter is implemented by gowarc.WarcFileWriter and warczstd.Writer.
+type WarcWriter interface {
+	Write(record ...gowarc.WarcRecord) []gowarc.WriteResponse
+	Rotate() error
+	Close() error
+}
+
 type WarcWriterConfig struct {
 	FilePrefix            string
 	DefaultTime           time.Time
 	OutDir                string
 	TmpDir                string
 	Flush                 bool
+	Compress              bool
+	CompressionFormat     string
 	WarcVersion           *gowarc.WarcVersion
 	WarcFileNameGenerator string
 	SubDirPattern         string
-	writers               map[string]*gowarc.WarcFileWriter
+	writers               map[string]WarcWriter
 	WarcInfoFunc          func(recordBuilder gowarc.WarcRecordBuilder) error
+	warcInfoTemplate      *template.Template
+	command               string
 	writersGuard          sync.Mutex
 	OneToOneWriter        bool
+	MaxRecords            int64
+	RotateBy              time.Duration
 	openOutputFileHook    hooks.OpenOutputFileHook
 	closeOutputFileHook   hooks.CloseOutputFileHook
+	// OutputUrl is the URL of the remote output directory, if any. Output files are then written
+	// to the local OutDir and uploaded when complete.
+	OutputUrl             string
+	remote                *remoteOutput
 	WarcFileWriterOptions []gowarc.WarcFileWriterOption
+	// OutputFileFunc, if set, is called with the source file name and the name and size of each
+	// output file written from it when the output file is complete. Only used by one to one writers.
+	OutputFileFunc func(srcFileName string, fileName string, size int64)
+	// ZstdWriterOptions are used instead of WarcFileWriterOptions when writing zstd compressed files
+	ZstdWriterOptions []warczstd.WriterOption
 }
 
 type WarcWriterOptions struct {
@@ -39,16 +70,23 @@ type WarcWriterOptions struct {
 	OpenOutputFileHook    string
 	CloseOutputFileHook   string
 	Compress              bool
+	CompressionFormat     string
 	CompressionLevel      int
+	ZstdDictionary        string
+	ZstdTrainingSamples   int
 	ConcurrentWriters     int
 	MaxFileSize           string
+	MaxRecords            int64
+	RotateBy              string
 	FilePrefix            string
 	SubDirPattern         string
 	WarcFileNameGenerator string
 	Flush                 bool
 	OneToOneWriter        bool
 	WarcInfoFunc          func(recordBuilder gowarc.WarcRecordBuilder) error
+	WarcInfoTemplate      string
 	TmpDir                string
+	OutputFs              afero.Fs
 }
 
 func defaultWarcWriterOptions() *WarcWriterOptions {
@@ -56,6 +94,7 @@ func defaultWarcWriterOptions() *WarcWriterOptions {
 		WarcVersion:       "1.1",
 		DefaultTime:       time.Now().Format(DefaultDateFormat),
 		Compress:          true,
+		CompressionFormat: CompressionGzip,
 		CompressionLevel:  1,
 		ConcurrentWriters: 1,
 	}
@@ -97,6 +136,24 @@ func WithCompress(compress bool) func(*WarcWriterOptions) {
 	}
 }
 
+func WithCompressionFormat(format string) func(*WarcWriterOptions) {
+	return func(w *WarcWriterOptions) {
+		w.CompressionFormat = format
+	}
+}
+
+func WithZstdDictionary(path string) func(*WarcWriterOptions) {
+	return func(w *WarcWriterOptions) {
+		w.ZstdDictionary = path
+	}
+}
+
+func WithZstdTrainingSamples(samples int) func(*WarcWriterOptions) {
+	return func(w *WarcWriterOptions) {
+		w.ZstdTrainingSamples = samples
+	}
+}
+
 func WithCompressionLevel(level int) func(*WarcWriterOptions) {
 	return func(w *WarcWriterOptions) {
 		w.CompressionLevel = level
@@ -115,6 +172,18 @@ func WithMaxFileSize(size string) func(*WarcWriterOptions) {
 	}
 }
 
+func WithMaxRecords(records int64) func(*WarcWriterOptions) {
+	return func(w *WarcWriterOptions) {
+		w.MaxRecords = records
+	}
+}
+
+func WithRotateBy(rotateBy string) func(*WarcWriterOptions) {
+	return func(w *WarcWriterOptions) {
+		w.RotateBy = rotateBy
+	}
+}
+
 func WithFilePrefix(prefix string) func(*WarcWriterOptions) {
 	return func(w *WarcWriterOptions) {
 		w.FilePrefix = prefix
@@ -151,12 +220,26 @@ func WithWarcInfoFunc(f func(recordBuilder gowarc.WarcRecordBuilder) error) func
 	}
 }
 
+func WithWarcInfoTemplate(path string) func(*WarcWriterOptions) {
+	return func(w *WarcWriterOptions) {
+		w.WarcInfoTemplate = path
+	}
+}
+
 func WithBufferTmpDir(tmpDir string) func(*WarcWriterOptions) {
 	return func(w *WarcWriterOptions) {
 		w.TmpDir = tmpDir
 	}
 }
 
+// WithOutputFs sets the filesystem of a remote output directory instead of resolving it from the
+// URL.
+func WithOutputFs(fs afero.Fs) func(*WarcWriterOptions) {
+	return func(w *WarcWriterOptions) {
+		w.OutputFs = fs
+	}
+}
+
 func New(cmd string, options ...func(*WarcWriterOptions)) (*WarcWriterConfig, error) {
 	o := defaultWarcWriterOptions()
 	for _, option := range options {
@@ -165,6 +248,13 @@ func New(cmd string, options ...func(*WarcWriterOptions)) (*WarcWriterConfig, er
 
 	var err error
 	var outDir string
+	var remote *remoteOutput
+	if isRemote(o.OutDir) {
+		if remote, err = newRemoteOutput(o.OutDir, o.TmpDir, o.OutputFs); err != nil {
+			return nil, err
+		}
+		o.OutDir = remote.stagingDir
+	}
 	if outDir, err = filepath.Abs(o.OutDir); err != nil {
 		return nil, err
 	}
@@ -204,6 +294,28 @@ func New(cmd string, options ...func(*WarcWriterOptions)) (*WarcWriterConfig, er
 		return nil, err
 	}
 
+	var warcInfoTemplate *template.Template
+	if o.WarcInfoTemplate != "" {
+		if warcInfoTemplate, err = parseWarcInfoTemplate(o.WarcInfoTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	rotateBy, err := ParseRotateBy(o.RotateBy)
+	if err != nil {
+		return nil, err
+	}
+	if o.MaxRecords < 0 {
+		return nil, fmt.Errorf("invalid maximum number of records: %d", o.MaxRecords)
+	}
+	if o.MaxRecords > 0 || rotateBy > 0 {
+		if o.OneToOneWriter {
+			return nil, errors.New("rotation by record count or capture time can not be combined with one to one writing")
+		}
+		// Records are counted and windows tracked per file, which requires writing one file at a time
+		o.ConcurrentWriters = 1
+	}
+
 	if o.OneToOneWriter {
 		// Only one writer with unrestricted size to allow for one to one mapping
 		o.ConcurrentWriters = 1
@@ -211,13 +323,41 @@ func New(cmd string, options ...func(*WarcWriterOptions)) (*WarcWriterConfig, er
 		o.WarcFileNameGenerator = "identity"
 	}
 
+	var zstdWriterOptions []warczstd.WriterOption
+	switch o.CompressionFormat {
+	case CompressionGzip:
+		if o.ZstdDictionary != "" || o.ZstdTrainingSamples > 0 {
+			return nil, fmt.Errorf("zstd dictionary options require compression format %s", CompressionZstd)
+		}
+	case CompressionZstd:
+		if o.ZstdDictionary != "" && o.ZstdTrainingSamples > 0 {
+			return nil, errors.New("a zstd dictionary can not be both given and trained")
+		}
+		zstdWriterOptions = []warczstd.WriterOption{
+			warczstd.WithCompressionLevel(o.CompressionLevel),
+			warczstd.WithMaxFileSize(util.ParseSizeInBytes(o.MaxFileSize)),
+			warczstd.WithFlush(o.Flush),
+			warczstd.WithTmpDir(o.TmpDir),
+			warczstd.WithDictionaryTraining(o.ZstdTrainingSamples),
+			warczstd.WithRecordOptions(gowarc.WithVersion(version), gowarc.WithBufferTmpDir(o.TmpDir)),
+		}
+		if o.ZstdDictionary != "" {
+			dictionary, err := os.ReadFile(o.ZstdDictionary)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read zstd dictionary: %w", err)
+			}
+			zstdWriterOptions = append(zstdWriterOptions, warczstd.WithDictionary(dictionary))
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression format: %s", o.CompressionFormat)
+	}
+
 	warcFileWriterOptions := []gowarc.WarcFileWriterOption{
 		gowarc.WithMaxConcurrentWriters(o.ConcurrentWriters),
 		gowarc.WithCompression(o.Compress),
 		gowarc.WithCompressionLevel(o.CompressionLevel),
 		gowarc.WithMaxFileSize(util.ParseSizeInBytes(o.MaxFileSize)),
 		gowarc.WithFlush(o.Flush),
-		gowarc.WithWarcInfoFunc(o.WarcInfoFunc),
 		gowarc.WithRecordOptions(gowarc.WithVersion(version), gowarc.WithBufferTmpDir(o.TmpDir)),
 	}
 
@@ -229,14 +369,24 @@ func New(cmd string, options ...func(*WarcWriterOptions)) (*WarcWriterConfig, er
 		WarcFileNameGenerator: o.WarcFileNameGenerator,
 		openOutputFileHook:    openOutputFileHook,
 		closeOutputFileHook:   closeOutputFileHook,
-		writers:               make(map[string]*gowarc.WarcFileWriter),
+		remote:                remote,
+		OutputUrl:             outputUrl(remote),
+		writers:               make(map[string]WarcWriter),
+		WarcInfoFunc:          o.WarcInfoFunc,
+		warcInfoTemplate:      warcInfoTemplate,
+		command:               cmd,
 		WarcFileWriterOptions: warcFileWriterOptions,
 		WarcVersion:           version,
 		OneToOneWriter:        o.OneToOneWriter,
+		MaxRecords:            o.MaxRecords,
+		RotateBy:              rotateBy,
+		Compress:              o.Compress,
+		CompressionFormat:     o.CompressionFormat,
+		ZstdWriterOptions:     zstdWriterOptions,
 	}, nil
 }
 
-func (w *WarcWriterConfig) GetWarcWriter(path string, warcDate time.Time) (*gowarc.WarcFileWriter, error) {
+func (w *WarcWriterConfig) GetWarcWriter(path string, warcDate time.Time) (WarcWriter, error) {
 	var namer gowarc.WarcFileNameGenerator
 	var dir string
 
@@ -252,27 +402,39 @@ func (w *WarcWriterConfig) GetWarcWriter(path string, warcDate time.Time) (*gowa
 		return nil, err
 	}
 
-	switch w.WarcFileNameGenerator {
-	case "identity":
+	var captureTimeNamer *captureTimeNamer
+	switch {
+	case w.WarcFileNameGenerator == "identity":
 		namer = NewIdentityNamer(path, w.FilePrefix, dir)
-	case "nedlib":
+	case w.WarcFileNameGenerator == "nedlib":
 		namer = NewNedlibNamer(path, w.FilePrefix, dir)
+	case w.rotates():
+		// rotated files are named by the capture time of their first record
+		captureTimeNamer = newCaptureTimeNamer(w.FilePrefix, dir)
+		namer = captureTimeNamer
 	default:
 		namer = NewDefaultNamer(w.FilePrefix, dir)
 	}
 
-	var ww *gowarc.WarcFileWriter
-
 	if w.OneToOneWriter {
-		opts := make([]gowarc.WarcFileWriterOption, 0, len(w.WarcFileWriterOptions)+3)
-		opts = append(opts, w.WarcFileWriterOptions...)
-		opts = append(opts,
-			gowarc.WithFileNameGenerator(namer),
-			gowarc.WithBeforeFileCreationHook(w.openOutputFileHook.WithSrcFileName(path).Run),
-			gowarc.WithAfterFileCreationHook(w.closeOutputFileHook.WithSrcFileName(path).Run),
-		)
-		ww = gowarc.NewWarcFileWriter(opts...)
-		return ww, nil
+		afterFileCreation := w.closeOutputFileHook.WithSrcFileName(path).Run
+		if w.OutputFileFunc != nil {
+			closeOutputFileHook := afterFileCreation
+			afterFileCreation = func(fileName string, size int64, warcInfoId string) error {
+				w.OutputFileFunc(path, fileName, size)
+				return closeOutputFileHook(fileName, size, warcInfoId)
+			}
+		}
+		if w.remote != nil {
+			closeOutputFileHook := afterFileCreation
+			afterFileCreation = func(fileName string, size int64, warcInfoId string) error {
+				if err := closeOutputFileHook(fileName, size, warcInfoId); err != nil {
+					return err
+				}
+				return w.remote.upload(fileName, size, warcInfoId)
+			}
+		}
+		return w.newWarcWriter(namer, w.warcInfoFunc(path), w.openOutputFileHook.WithSrcFileName(path).Run, afterFileCreation)
 	}
 
 	w.writersGuard.Lock()
@@ -283,15 +445,97 @@ func (w *WarcWriterConfig) GetWarcWriter(path string, warcDate time.Time) (*gowa
 		return ww, nil
 	}
 
-	opts := make([]gowarc.WarcFileWriterOption, 0, len(w.WarcFileWriterOptions)+1)
-	opts = append(opts, w.WarcFileWriterOptions...)
-	opts = append(opts, gowarc.WithFileNameGenerator(namer))
-	ww = gowarc.NewWarcFileWriter(opts...)
+	var afterFileCreation func(string, int64, string) error
+	if w.remote != nil {
+		afterFileCreation = w.remote.upload
+	}
+	warcInfoFunc := w.warcInfoFunc("")
+	ww, err := w.newWarcWriter(namer, warcInfoFunc, nil, afterFileCreation)
+	if err != nil {
+		return nil, err
+	}
+	if w.rotates() {
+		ww = &rotatingWriter{
+			writer:      ww,
+			namer:       captureTimeNamer,
+			maxRecords:  w.MaxRecords,
+			window:      w.RotateBy,
+			defaultTime: w.DefaultTime,
+			warcInfo:    warcInfoFunc != nil,
+		}
+	}
 	w.writers[subDir] = ww
 
 	return ww, nil
 }
 
+// OutputFs returns the filesystem holding the complete output file written to fileName and the name
+// of the file in it. Files written to a remote output directory are in the remote filesystem, since
+// the local file is removed when it is uploaded.
+func (w *WarcWriterConfig) OutputFs(fileName string) (afero.Fs, string, error) {
+	if w.remote == nil {
+		return afero.NewOsFs(), fileName, nil
+	}
+	name, err := w.remote.name(fileName)
+	if err != nil {
+		return nil, "", err
+	}
+	return w.remote.fs, name, nil
+}
+
+// OverwritesSource reports whether a file written from the input file at path would be written to
+// the directory of the input file with the same name, which happens when input file names are reused
+// without a prefix or subdirectory.
+func (w *WarcWriterConfig) OverwritesSource(path string) (bool, error) {
+	if w.remote != nil || w.WarcFileNameGenerator != "identity" || w.FilePrefix != "" || w.SubDirPattern != "" {
+		return false, nil
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return false, err
+	}
+	return dir == w.OutDir, nil
+}
+
+// rotates reports whether files are rotated by record count or capture time.
+func (w *WarcWriterConfig) rotates() bool {
+	return w.MaxRecords > 0 || w.RotateBy > 0
+}
+
+// newWarcWriter creates a gzip or uncompressed WARC writer, or a zstd WARC writer if that is the
+// configured compression format.
+func (w *WarcWriterConfig) newWarcWriter(namer gowarc.WarcFileNameGenerator, warcInfoFunc func(gowarc.WarcRecordBuilder) error, beforeFileCreation func(string) error, afterFileCreation func(string, int64, string) error) (WarcWriter, error) {
+	if w.Compress && w.CompressionFormat == CompressionZstd {
+		opts := make([]warczstd.WriterOption, 0, len(w.ZstdWriterOptions)+4)
+		opts = append(opts, w.ZstdWriterOptions...)
+		opts = append(opts, warczstd.WithFileNameGenerator(namer), warczstd.WithWarcInfoFunc(warcInfoFunc))
+		if beforeFileCreation != nil {
+			opts = append(opts, warczstd.WithBeforeFileCreationHook(beforeFileCreation))
+		}
+		if afterFileCreation != nil {
+			opts = append(opts, warczstd.WithAfterFileCreationHook(afterFileCreation))
+		}
+		return warczstd.NewWriter(opts...)
+	}
+
+	opts := make([]gowarc.WarcFileWriterOption, 0, len(w.WarcFileWriterOptions)+4)
+	opts = append(opts, w.WarcFileWriterOptions...)
+	opts = append(opts, gowarc.WithFileNameGenerator(namer))
+	if warcInfoFunc != nil {
+		opts = append(opts, gowarc.WithWarcInfoFunc(warcInfoFunc))
+	}
+	if beforeFileCreation != nil {
+		opts = append(opts, gowarc.WithBeforeFileCreationHook(beforeFileCreation))
+	}
+	if afterFileCreation != nil {
+		opts = append(opts, gowarc.WithAfterFileCreationHook(afterFileCreation))
+	}
+	return gowarc.NewWarcFileWriter(opts...), nil
+}
+
 func (w *WarcWriterConfig) Close() error {
 	var lastErr error
 	for _, writer := range w.writers {
@@ -300,5 +544,8 @@ func (w *WarcWriterConfig) Close() error {
 			lastErr = fmt.Errorf("error closing WARC writer: %w", err)
 		}
 	}
+	if w.remote != nil {
+		w.remote.close()
+	}
 	return lastErr
 }
@@ -12,6 +12,7 @@ import (
 func NewIdentityNamer(path, filePrefix, dir string) gowarc.WarcFileNameGenerator {
 	basename := filepath.Base(path)
 	basename = strings.TrimSuffix(basename, ".gz")
+	basename = strings.TrimSuffix(basename, ".zst")
 	basename = strings.TrimSuffix(basename, ".arc")
 	basename = strings.TrimSuffix(basename, ".warc")
 
@@ -0,0 +1,111 @@
+package warcwriterconfig
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/fs"
+	"github.com/spf13/afero"
+)
+
+// isRemote reports whether the output directory is a URL of a remote filesystem.
+func isRemote(outDir string) bool {
+	return strings.Contains(outDir, "://")
+}
+
+func outputUrl(remote *remoteOutput) string {
+	if remote == nil {
+		return ""
+	}
+	return remote.url
+}
+
+// remoteOutput uploads output files to a remote filesystem, like an S3 bucket or an FTP server.
+// Files are written to a local staging directory and uploaded when they are complete, since WARC
+// files are written with the local filesystem.
+type remoteOutput struct {
+	url        string
+	fs         afero.Fs
+	stagingDir string
+}
+
+// newRemoteOutput creates a staging directory for files uploaded to url. The filesystem is resolved
+// from the URL unless remoteFs is given.
+func newRemoteOutput(url string, tmpDir string, remoteFs afero.Fs) (*remoteOutput, error) {
+	if remoteFs == nil {
+		var err error
+		if remoteFs, err = fs.ResolveFilesystem(afero.NewOsFs(), url); err != nil {
+			return nil, fmt.Errorf("failed to resolve output filesystem '%s': %w", url, err)
+		}
+	}
+	stagingDir, err := os.MkdirTemp(tmpDir, "warc-output-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if stagingDir, err = filepath.EvalSymlinks(stagingDir); err != nil {
+		return nil, err
+	}
+	return &remoteOutput{url: url, fs: remoteFs, stagingDir: stagingDir}, nil
+}
+
+// upload uploads the complete output file to the same path relative to the remote output
+// directory as to the staging directory, creating its directory if needed, and removes the local
+// file. It has the signature of the after file creation hooks of the writers.
+func (r *remoteOutput) upload(fileName string, _ int64, _ string) error {
+	name, err := r.name(fileName)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	if dir := path.Dir(name); dir != "." {
+		if err := r.fs.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory %s in %s: %w", dir, r.url, err)
+		}
+	}
+	dst, err := r.fs.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to %s: %w", name, r.url, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("failed to upload %s to %s: %w", name, r.url, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to upload %s to %s: %w", name, r.url, err)
+	}
+	return os.Remove(fileName)
+}
+
+// name returns the name in the remote filesystem of the file staged at fileName.
+func (r *remoteOutput) name(fileName string) (string, error) {
+	rel, err := filepath.Rel(r.stagingDir, fileName)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("output file %s is not in the staging directory %s", fileName, r.stagingDir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// close removes the staging directory if all files are uploaded.
+func (r *remoteOutput) close() {
+	var dirs []string
+	_ = filepath.Walk(r.stagingDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	// remove subdirectories before their parents
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+}
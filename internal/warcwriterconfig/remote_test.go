@@ -0,0 +1,59 @@
+package warcwriterconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestRemoteOutputUpload(t *testing.T) {
+	stagingDir := t.TempDir()
+	remoteFs := afero.NewMemMapFs()
+	remote := &remoteOutput{url: "mem://", fs: remoteFs, stagingDir: stagingDir}
+
+	fileName := filepath.Join(stagingDir, "2024", "01", "file.warc.gz")
+	if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.upload(fileName, 7, ""); err != nil {
+		t.Fatal(err)
+	}
+	b, err := afero.ReadFile(remoteFs, "2024/01/file.warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "content" {
+		t.Errorf("expected uploaded content, got %q", b)
+	}
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("expected local file to be removed, got %v", err)
+	}
+
+	if err := remote.upload(filepath.Join(t.TempDir(), "other.warc.gz"), 0, ""); err == nil {
+		t.Error("expected error for file outside of staging directory")
+	}
+
+	remote.close()
+	if _, err := os.Stat(stagingDir); !os.IsNotExist(err) {
+		t.Errorf("expected staging directory to be removed, got %v", err)
+	}
+}
+
+func TestIsRemote(t *testing.T) {
+	for outDir, want := range map[string]bool{
+		"s3://bucket/prefix": true,
+		"ftp://host/out":     true,
+		"out":                false,
+		"/data/out":          false,
+	} {
+		if got := isRemote(outDir); got != want {
+			t.Errorf("isRemote(%q) = %t, want %t", outDir, got, want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package warcwriterconfig
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// captureTimeFormat is the format of the capture time in names of rotated files.
+const captureTimeFormat = "20060102150405"
+
+// ParseRotateBy parses a capture time window. Besides Go durations, 'hour' and 'day' are accepted.
+// An empty string means no window.
+func ParseRotateBy(rotateBy string) (time.Duration, error) {
+	switch strings.ToLower(rotateBy) {
+	case "":
+		return 0, nil
+	case "hour":
+		return time.Hour, nil
+	case "day":
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(rotateBy)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rotation window '%s': %w", rotateBy, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid rotation window '%s': must be positive", rotateBy)
+	}
+	return d, nil
+}
+
+// captureTimeNamer names files by the capture time of their first record instead of the time
+// the file is created.
+type captureTimeNamer struct {
+	mu          sync.Mutex
+	generator   *gowarc.PatternNameGenerator
+	captureTime time.Time
+}
+
+func newCaptureTimeNamer(filePrefix, dir string) *captureTimeNamer {
+	return &captureTimeNamer{
+		generator: &gowarc.PatternNameGenerator{
+			Pattern:   "%{prefix}s%{captureTime}s-%04{serial}d-%{hostOrIp}s.%{ext}s",
+			Prefix:    filePrefix,
+			Directory: dir,
+		},
+	}
+}
+
+func (n *captureTimeNamer) setCaptureTime(t time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.captureTime = t
+}
+
+func (n *captureTimeNamer) NewWarcfileName() (string, string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.generator.Params = map[string]any{"captureTime": n.captureTime.UTC().Format(captureTimeFormat)}
+	return n.generator.NewWarcfileName()
+}
+
+// rotatingWriter starts a new file when a file has reached the maximum number of records or when
+// a record belongs to another capture time window than the records of the current file. The
+// warcinfo record starting each file counts toward the maximum, but every file gets at least one
+// other record.
+//
+// Records are expected to be written roughly in capture time order, since every change of window
+// starts a new file.
+type rotatingWriter struct {
+	mu         sync.Mutex
+	writer     WarcWriter
+	namer      *captureTimeNamer // nil if files are not named by capture time
+	maxRecords int64
+	window     time.Duration
+	// defaultTime is used for records without a valid WARC-Date
+	defaultTime time.Time
+	// warcInfo tells whether the writer starts each file with a warcinfo record
+	warcInfo bool
+
+	fileName    string
+	records     int64 // records in the current file, including the warcinfo record
+	written     int64 // records written to the current file
+	windowStart time.Time
+	open        bool
+}
+
+func (r *rotatingWriter) Write(records ...gowarc.WarcRecord) []gowarc.WriteResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	responses := make([]gowarc.WriteResponse, 0, len(records))
+	for _, record := range records {
+		responses = append(responses, r.write(record))
+	}
+	return responses
+}
+
+func (r *rotatingWriter) write(record gowarc.WarcRecord) gowarc.WriteResponse {
+	captureTime, err := record.WarcHeader().GetTime(gowarc.WarcDate)
+	if err != nil {
+		captureTime = r.defaultTime
+	}
+	windowStart := captureTime
+	if r.window > 0 {
+		windowStart = captureTime.UTC().Truncate(r.window)
+	}
+
+	rotate := r.maxRecords > 0 && r.records >= r.maxRecords && r.written > 0
+	if r.window > 0 && !windowStart.Equal(r.windowStart) {
+		rotate = true
+	}
+	if r.open && rotate {
+		if err := r.writer.Rotate(); err != nil {
+			return gowarc.WriteResponse{Err: err}
+		}
+		r.open = false
+	}
+	if !r.open {
+		r.windowStart = windowStart
+		r.fileName = ""
+		r.startFile()
+		r.open = true
+	}
+	if r.namer != nil {
+		// names files opened by this record, including new files started because of the file size
+		r.namer.setCaptureTime(windowStart)
+	}
+
+	responses := r.writer.Write(record)
+	if len(responses) == 0 {
+		return gowarc.WriteResponse{}
+	}
+	response := responses[0]
+	// the writer may also have started a new file because of the file size
+	if response.FileName != "" && response.FileName != r.fileName {
+		if r.fileName != "" {
+			r.startFile()
+		}
+		r.fileName = response.FileName
+	}
+	r.records++
+	r.written++
+	return response
+}
+
+// startFile resets the record counts for a new file.
+func (r *rotatingWriter) startFile() {
+	r.records = 0
+	if r.warcInfo {
+		r.records = 1
+	}
+	r.written = 0
+}
+
+func (r *rotatingWriter) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.open = false
+	return r.writer.Rotate()
+}
+
+func (r *rotatingWriter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.open = false
+	return r.writer.Close()
+}
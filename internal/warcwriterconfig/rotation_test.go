@@ -0,0 +1,195 @@
+package warcwriterconfig
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+func TestParseRotateBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotateBy string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"empty", "", 0, false},
+		{"hour", "hour", time.Hour, false},
+		{"day", "Day", 24 * time.Hour, false},
+		{"duration", "15m", 15 * time.Minute, false},
+		{"zero", "0s", 0, true},
+		{"negative", "-1h", 0, true},
+		{"invalid", "week", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRotateBy(tt.rotateBy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRotateBy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRotateBy() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testRecord is a record named for checking which file it is written to.
+type testRecord struct {
+	gowarc.WarcRecord
+	name   string
+	header *gowarc.WarcFields
+}
+
+func (r testRecord) WarcHeader() *gowarc.WarcFields {
+	return r.header
+}
+
+func newTestRecord(name string, date string) testRecord {
+	header := &gowarc.WarcFields{}
+	header.Set(gowarc.WarcDate, date)
+	return testRecord{name: name, header: header}
+}
+
+// fakeWriter keeps the names of the records written to each file. Like the WARC writers it starts
+// every file with a warcinfo record if warcInfo is set, and it starts a new file before the records
+// in fullBefore, as if the file had reached its maximum size.
+type fakeWriter struct {
+	warcInfo   bool
+	fullBefore map[string]bool
+	files      [][]string
+	open       bool
+	closed     bool
+}
+
+func (w *fakeWriter) Write(records ...gowarc.WarcRecord) []gowarc.WriteResponse {
+	var responses []gowarc.WriteResponse
+	for _, record := range records {
+		name := record.(testRecord).name
+		if w.fullBefore[name] {
+			w.open = false
+		}
+		if !w.open {
+			w.files = append(w.files, nil)
+			if w.warcInfo {
+				w.files[len(w.files)-1] = append(w.files[len(w.files)-1], "warcinfo")
+			}
+			w.open = true
+		}
+		i := len(w.files) - 1
+		w.files[i] = append(w.files[i], name)
+		responses = append(responses, gowarc.WriteResponse{FileName: fmt.Sprintf("file-%d", i)})
+	}
+	return responses
+}
+
+func (w *fakeWriter) Rotate() error {
+	w.open = false
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.open = false
+	w.closed = true
+	return nil
+}
+
+func TestRotatingWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRecords int64
+		window     time.Duration
+		warcInfo   bool
+		fullBefore map[string]bool
+		records    [][2]string // name and WARC-Date
+		want       [][]string
+	}{
+		{
+			name:       "max records including warcinfo",
+			maxRecords: 3,
+			warcInfo:   true,
+			records:    [][2]string{{"a", ""}, {"b", ""}, {"c", ""}, {"d", ""}, {"e", ""}},
+			want:       [][]string{{"warcinfo", "a", "b"}, {"warcinfo", "c", "d"}, {"warcinfo", "e"}},
+		},
+		{
+			name:       "one record besides warcinfo",
+			maxRecords: 1,
+			warcInfo:   true,
+			records:    [][2]string{{"a", ""}, {"b", ""}},
+			want:       [][]string{{"warcinfo", "a"}, {"warcinfo", "b"}},
+		},
+		{
+			name:   "time windows",
+			window: time.Hour,
+			records: [][2]string{
+				{"a", "2024-01-01T10:10:00Z"},
+				{"b", "2024-01-01T10:50:00Z"},
+				{"c", "2024-01-01T11:05:00Z"},
+				{"d", "2024-01-01T11:30:00Z"},
+				{"e", "2024-01-01T13:00:00Z"},
+			},
+			want: [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			name:       "time windows and max records",
+			maxRecords: 2,
+			window:     time.Hour,
+			records: [][2]string{
+				{"a", "2024-01-01T10:10:00Z"},
+				{"b", "2024-01-01T10:20:00Z"},
+				{"c", "2024-01-01T10:30:00Z"},
+				{"d", "2024-01-01T11:00:00Z"},
+			},
+			want: [][]string{{"a", "b"}, {"c"}, {"d"}},
+		},
+		{
+			name:       "files started because of the file size",
+			maxRecords: 3,
+			warcInfo:   true,
+			fullBefore: map[string]bool{"b": true},
+			records:    [][2]string{{"a", ""}, {"b", ""}, {"c", ""}, {"d", ""}},
+			want:       [][]string{{"warcinfo", "a"}, {"warcinfo", "b", "c"}, {"warcinfo", "d"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &fakeWriter{warcInfo: tt.warcInfo, fullBefore: tt.fullBefore}
+			r := &rotatingWriter{writer: writer, maxRecords: tt.maxRecords, window: tt.window, warcInfo: tt.warcInfo}
+			for _, record := range tt.records {
+				responses := r.Write(newTestRecord(record[0], record[1]))
+				if len(responses) != 1 || responses[0].Err != nil {
+					t.Fatalf("unexpected write responses: %v", responses)
+				}
+			}
+			if !reflect.DeepEqual(writer.files, tt.want) {
+				t.Errorf("expected files %v, got %v", tt.want, writer.files)
+			}
+		})
+	}
+}
+
+func TestRotatingWriterRotateAndClose(t *testing.T) {
+	writer := &fakeWriter{}
+	r := &rotatingWriter{writer: writer, maxRecords: 2}
+
+	r.Write(newTestRecord("a", ""))
+	if err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	// rotating starts the count of the next file
+	r.Write(newTestRecord("b", ""), newTestRecord("c", ""), newTestRecord("d", ""))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !writer.closed {
+		t.Error("expected the underlying writer to be closed")
+	}
+
+	want := [][]string{{"a"}, {"b", "c"}, {"d"}}
+	if !reflect.DeepEqual(writer.files, want) {
+		t.Errorf("expected files %v, got %v", want, writer.files)
+	}
+}
@@ -0,0 +1,197 @@
+package warcwriterconfig
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nationallibraryofnorway/warchaeology/v5/internal/version"
+	"github.com/nlnwa/gowarc/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// WarcInfoData is the data available to warcinfo templates.
+type WarcInfoData struct {
+	// Command is the name of the command writing the file, e.g. 'arc'
+	Command string
+	// CommandLine is the full command line
+	CommandLine string
+	// Args are the arguments of the command line, i.e. the source files and flags
+	Args []string
+	// InputFile is the input file written to the file. It is empty when input files share output files.
+	InputFile string
+	// Time is the time the file is created
+	Time time.Time
+	// Hostname is the name of the host writing the file
+	Hostname string
+	// Software is the name and version of warchaeology
+	Software string
+	// Version is the version information of warchaeology
+	Version version.Info
+	// WarcVersion is the WARC version of the file, e.g. '1.1'
+	WarcVersion string
+}
+
+var warcInfoTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"base": filepath.Base,
+	"env":  os.Getenv,
+}
+
+// parseWarcInfoTemplate parses a warcinfo template file. The template must render a YAML mapping
+// of field names to a value or a list of values, e.g.:
+//
+//	operator: {{ env "USER" }}
+//	software: {{ .Software }}
+//	isPartOf: my-collection
+//	source:
+//	  - {{ .InputFile }}
+//
+// The template is executed once with sample data to report errors before any file is written.
+func parseWarcInfoTemplate(path string) (*template.Template, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read warcinfo template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(warcInfoTemplateFuncs).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse warcinfo template: %w", err)
+	}
+	if _, err := renderWarcInfoTemplate(tmpl, WarcInfoData{Time: time.Now()}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderWarcInfoTemplate executes the template and returns the fields in the order they appear.
+func renderWarcInfoTemplate(tmpl *template.Template, data WarcInfoData) ([]gowarc.NameValue, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute warcinfo template: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("warcinfo template did not render valid YAML: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("warcinfo template must render a mapping of field names to values")
+	}
+
+	var fields []gowarc.NameValue
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name, value := mapping.Content[i].Value, mapping.Content[i+1]
+		switch value.Kind {
+		case yaml.ScalarNode:
+			if value.Tag == "!!null" {
+				continue
+			}
+			fields = append(fields, gowarc.NameValue{Name: name, Value: value.Value})
+		case yaml.SequenceNode:
+			for _, v := range value.Content {
+				if v.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("warcinfo field '%s' must be a value or a list of values", name)
+				}
+				fields = append(fields, gowarc.NameValue{Name: name, Value: v.Value})
+			}
+		default:
+			return nil, fmt.Errorf("warcinfo field '%s' must be a value or a list of values", name)
+		}
+	}
+	return fields, nil
+}
+
+// warcInfoFunc returns the function writing the content of the warcinfo record of files written
+// from inputFile. Fields from the warcinfo template replace fields with the same name written by
+// the command.
+func (w *WarcWriterConfig) warcInfoFunc(inputFile string) func(recordBuilder gowarc.WarcRecordBuilder) error {
+	if w.warcInfoTemplate == nil {
+		return w.WarcInfoFunc
+	}
+	return func(recordBuilder gowarc.WarcRecordBuilder) error {
+		payload := &gowarc.WarcFields{}
+		if w.WarcInfoFunc != nil {
+			content := &contentBuffer{WarcRecordBuilder: recordBuilder}
+			if err := w.WarcInfoFunc(content); err != nil {
+				return err
+			}
+			for _, field := range parseFields(content.String()) {
+				payload.Add(field.Name, field.Value)
+			}
+		}
+
+		hostname, _ := os.Hostname()
+		fields, err := renderWarcInfoTemplate(w.warcInfoTemplate, WarcInfoData{
+			Command:     w.command,
+			CommandLine: strings.Join(os.Args, " "),
+			Args:        os.Args[1:],
+			InputFile:   inputFile,
+			Time:        time.Now().UTC(),
+			Hostname:    hostname,
+			Software:    version.SoftwareVersion(),
+			Version:     version.Version,
+			WarcVersion: fmt.Sprintf("%d.%d", w.WarcVersion.Major(), w.WarcVersion.Minor()),
+		})
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			payload.Delete(field.Name)
+		}
+		for _, field := range fields {
+			payload.Add(field.Name, field.Value)
+		}
+
+		_, err = recordBuilder.WriteString(payload.String())
+		return err
+	}
+}
+
+// contentBuffer holds back the content written by a warcinfo function so it can be merged with
+// the fields of the warcinfo template.
+type contentBuffer struct {
+	gowarc.WarcRecordBuilder
+	bytes.Buffer
+}
+
+func (c *contentBuffer) Write(p []byte) (int, error) {
+	return c.Buffer.Write(p)
+}
+
+func (c *contentBuffer) WriteString(s string) (int, error) {
+	return c.Buffer.WriteString(s)
+}
+
+func (c *contentBuffer) ReadFrom(r io.Reader) (int64, error) {
+	return c.Buffer.ReadFrom(r)
+}
+
+// parseFields parses 'name: value' lines. Continuation lines are appended to the previous value.
+func parseFields(content string) []gowarc.NameValue {
+	var fields []gowarc.NameValue
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields = append(fields, gowarc.NameValue{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+	return fields
+}
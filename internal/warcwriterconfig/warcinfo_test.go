@@ -0,0 +1,68 @@
+package warcwriterconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+func TestRenderWarcInfoTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     []gowarc.NameValue
+		wantErr  bool
+	}{
+		{
+			name:     "values and lists",
+			template: "operator: {{ .Command }}\nsource:\n  - {{ base .InputFile }}\n  - other.arc\nempty:\n",
+			want: []gowarc.NameValue{
+				{Name: "operator", Value: "arc"},
+				{Name: "source", Value: "input.arc"},
+				{Name: "source", Value: "other.arc"},
+			},
+		},
+		{name: "empty", template: "", want: nil},
+		{name: "not a mapping", template: "- a\n- b\n", wantErr: true},
+		{name: "nested mapping", template: "a:\n  b: c\n", wantErr: true},
+		{name: "unknown field", template: "a: {{ .Unknown }}\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "warcinfo.yaml")
+			if err := os.WriteFile(path, []byte(tt.template), 0644); err != nil {
+				t.Fatal(err)
+			}
+			tmpl, err := parseWarcInfoTemplate(path)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("parseWarcInfoTemplate() error = %v", err)
+				}
+				return
+			}
+			got, err := renderWarcInfoTemplate(tmpl, WarcInfoData{Command: "arc", InputFile: "/data/input.arc", Time: time.Now()})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderWarcInfoTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderWarcInfoTemplate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	got := parseFields("software: Warchaeology v5\r\nformat: WARC File Format 1.1\r\ndescription: a long\r\n  description\r\n\r\n")
+	want := []gowarc.NameValue{
+		{Name: "software", Value: "Warchaeology v5"},
+		{Name: "format", Value: "WARC File Format 1.1"},
+		{Name: "description", Value: "a long description"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFields() got = %v, want %v", got, want)
+	}
+}
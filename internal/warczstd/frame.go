@@ -0,0 +1,228 @@
+package warczstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// frameMagic starts every zstd frame.
+	frameMagic uint32 = 0xFD2FB528
+	// skippableFrameMagic starts skippable frames. The low four bits may have any value.
+	skippableFrameMagic uint32 = 0x184D2A50
+	skippableFrameMask  uint32 = 0xFFFFFFF0
+	// dictionaryFrameMagic is the skippable frame holding the dictionary of a .warc.zst file.
+	dictionaryFrameMagic uint32 = 0x184D2A5D
+	// dictionaryMagic starts dictionaries in the zstd dictionary format.
+	dictionaryMagic uint32 = 0xEC30A437
+)
+
+// IsZstd reports whether b starts with a zstd frame or a skippable frame.
+func IsZstd(b []byte) bool {
+	if len(b) < 4 {
+		return false
+	}
+	magic := binary.LittleEndian.Uint32(b)
+	return magic == frameMagic || magic&skippableFrameMask == skippableFrameMagic
+}
+
+// CountFrames returns the number of zstd frames in r. Skippable frames are not counted.
+func CountFrames(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var frames int64
+	for {
+		magic, err := br.Peek(4)
+		if len(magic) == 0 && errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+		if len(magic) < 4 {
+			return frames, fmt.Errorf("truncated zstd frame: %w", io.ErrUnexpectedEOF)
+		}
+		if binary.LittleEndian.Uint32(magic)&skippableFrameMask == skippableFrameMagic {
+			if _, err := skipSkippableFrame(br); err != nil {
+				return frames, err
+			}
+			continue
+		}
+		if _, err := io.Copy(io.Discard, newFrameReader(br)); err != nil {
+			return frames, err
+		}
+		frames++
+	}
+}
+
+// skipSkippableFrame moves past the skippable frame at the start of br and returns its size.
+func skipSkippableFrame(br *bufio.Reader) (int64, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return 0, fmt.Errorf("truncated skippable frame: %w", io.ErrUnexpectedEOF)
+	}
+	size := int64(binary.LittleEndian.Uint32(header[4:]))
+	if _, err := br.Discard(int(size)); err != nil {
+		return 0, fmt.Errorf("truncated skippable frame: %w", io.ErrUnexpectedEOF)
+	}
+	return int64(len(header)) + size, nil
+}
+
+const (
+	stateFrameHeader = iota
+	stateBlockHeader
+	stateChecksum
+	stateDone
+)
+
+// frameReader passes through exactly one zstd frame from r and returns io.EOF at the end of it.
+//
+// Only the frame and block headers are parsed, which is enough to find the end of the frame
+// without decompressing it.
+type frameReader struct {
+	r         io.Reader
+	header    [18]byte
+	pending   []byte // headers read but not yet returned
+	remaining int64  // block content or checksum bytes left to pass through
+	state     int
+	checksum  bool
+	n         int64 // bytes consumed from r
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{r: r}
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for {
+		if len(f.pending) > 0 {
+			n := copy(p, f.pending)
+			f.pending = f.pending[n:]
+			return n, nil
+		}
+		if f.remaining > 0 {
+			if int64(len(p)) > f.remaining {
+				p = p[:f.remaining]
+			}
+			n, err := f.r.Read(p)
+			f.remaining -= int64(n)
+			f.n += int64(n)
+			if errors.Is(err, io.EOF) {
+				if f.remaining > 0 || f.state != stateDone {
+					err = io.ErrUnexpectedEOF
+				} else {
+					err = nil
+				}
+			}
+			return n, err
+		}
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// skip moves to the end of the frame by seeking past block contents instead of reading them.
+// The underlying reader must implement io.Seeker.
+func (f *frameReader) skip() error {
+	seeker, ok := f.r.(io.Seeker)
+	if !ok {
+		_, err := io.Copy(io.Discard, f)
+		return err
+	}
+	for {
+		f.pending = nil
+		if f.remaining > 0 {
+			if _, err := seeker.Seek(f.remaining, io.SeekCurrent); err != nil {
+				return err
+			}
+			f.n += f.remaining
+			f.remaining = 0
+		}
+		if err := f.next(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// next reads the next header of the frame.
+func (f *frameReader) next() error {
+	switch f.state {
+	case stateFrameHeader:
+		if err := f.readHeader(f.header[:5]); err != nil {
+			return err
+		}
+		if magic := binary.LittleEndian.Uint32(f.header[:4]); magic != frameMagic {
+			return fmt.Errorf("not a zstd frame: magic number %#08x", magic)
+		}
+		descriptor := f.header[4]
+		if descriptor&0x08 != 0 {
+			return errors.New("invalid zstd frame header: reserved bit is set")
+		}
+		singleSegment := descriptor&0x20 != 0
+		f.checksum = descriptor&0x04 != 0
+
+		size := [4]int{0, 1, 2, 4}[descriptor&0x03]
+		if !singleSegment {
+			// window descriptor
+			size++
+		}
+		switch descriptor >> 6 {
+		case 0:
+			if singleSegment {
+				size++
+			}
+		case 1:
+			size += 2
+		case 2:
+			size += 4
+		case 3:
+			size += 8
+		}
+		if err := f.readHeader(f.header[5 : 5+size]); err != nil {
+			return err
+		}
+		f.pending = f.header[:5+size]
+		f.state = stateBlockHeader
+	case stateBlockHeader:
+		if err := f.readHeader(f.header[:3]); err != nil {
+			return err
+		}
+		f.pending = f.header[:3]
+		blockHeader := uint32(f.header[0]) | uint32(f.header[1])<<8 | uint32(f.header[2])<<16
+		last := blockHeader&1 != 0
+		size := int64(blockHeader >> 3)
+		switch (blockHeader >> 1) & 0x03 {
+		case 1:
+			// RLE blocks hold a single byte repeated size times
+			size = 1
+		case 3:
+			return errors.New("invalid zstd block type")
+		}
+		f.remaining = size
+		if last {
+			if f.checksum {
+				f.state = stateChecksum
+			} else {
+				f.state = stateDone
+			}
+		}
+	case stateChecksum:
+		f.remaining = 4
+		f.state = stateDone
+	case stateDone:
+		return io.EOF
+	}
+	return nil
+}
+
+// readHeader fills buf from r. Running out of input is only a clean io.EOF before the frame starts.
+func (f *frameReader) readHeader(buf []byte) error {
+	read, err := io.ReadFull(f.r, buf)
+	if errors.Is(err, io.EOF) && f.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	f.n += int64(read)
+	return err
+}
@@ -0,0 +1,273 @@
+package warczstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// maxDictionarySize guards against allocating memory for a corrupt dictionary frame header.
+const maxDictionarySize = 1 << 30
+
+// bufferSize is the size of the read buffer. The size of frames that fit in it is found without
+// seeking.
+const bufferSize = 64 * 1024
+
+// Reader reads records from a zstd compressed WARC file (.warc.zst).
+//
+// Each record is compressed as a zstd frame of its own, optionally preceded by a skippable frame
+// holding the dictionary used to compress them. Other skippable frames are ignored.
+//
+// The offset of a record is the offset of its compressed frame in the file. The compressed size is
+// only known when the underlying reader implements io.Seeker, otherwise the size of records is 0.
+type Reader struct {
+	seeker      io.ReadSeeker
+	br          *bufio.Reader
+	offset      int64
+	decoder     *zstd.Decoder
+	unmarshaler gowarc.Unmarshaler
+	frame       *frameReader
+}
+
+// NewReader creates a Reader reading from r starting at the record at offset. The caller is
+// responsible for closing r.
+func NewReader(r io.Reader, offset int64, opts ...gowarc.WarcRecordOption) (*Reader, error) {
+	reader := &Reader{
+		br:          bufio.NewReaderSize(r, bufferSize),
+		unmarshaler: gowarc.NewUnmarshaler(opts...),
+	}
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		reader.seeker = seeker
+	}
+
+	dict, err := reader.readDictionary()
+	if err != nil {
+		return nil, err
+	}
+	decoderOptions := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if dict != nil {
+		decoderOptions = append(decoderOptions, decoderDict(dict))
+	}
+	if reader.decoder, err = zstd.NewReader(nil, decoderOptions...); err != nil {
+		return nil, err
+	}
+
+	if offset > reader.offset {
+		if err := reader.seek(offset); err != nil {
+			reader.decoder.Close()
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+// readDictionary reads the dictionary frame if the file starts with one.
+func (r *Reader) readDictionary() ([]byte, error) {
+	magic, err := r.br.Peek(4)
+	if len(magic) < 4 || binary.LittleEndian.Uint32(magic) != dictionaryFrameMagic {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return nil, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(r.br, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read dictionary frame: %w", err)
+	}
+	size := binary.LittleEndian.Uint32(header[4:])
+	if size > maxDictionarySize {
+		return nil, fmt.Errorf("dictionary frame of %d bytes is too large", size)
+	}
+	dict := make([]byte, size)
+	if _, err := io.ReadFull(r.br, dict); err != nil {
+		return nil, fmt.Errorf("failed to read dictionary frame: %w", err)
+	}
+	r.offset = int64(len(header)) + int64(size)
+
+	// the dictionary may itself be zstd compressed
+	if len(dict) >= 4 && binary.LittleEndian.Uint32(dict) == frameMagic {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		if dict, err = decoder.DecodeAll(dict, nil); err != nil {
+			return nil, fmt.Errorf("failed to decompress dictionary: %w", err)
+		}
+	}
+	return dict, nil
+}
+
+// decoderDict returns the decoder option for a dictionary in the zstd dictionary format or a raw
+// content dictionary.
+func decoderDict(dict []byte) zstd.DOption {
+	if len(dict) >= 8 && binary.LittleEndian.Uint32(dict) == dictionaryMagic {
+		return zstd.WithDecoderDicts(dict)
+	}
+	return zstd.WithDecoderDictRaw(0, dict)
+}
+
+// seek moves to offset in the file.
+func (r *Reader) seek(offset int64) error {
+	if r.seeker != nil {
+		if _, err := r.seeker.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		r.br.Reset(r.seeker)
+	} else if _, err := r.br.Discard(int(offset - r.offset)); err != nil {
+		return err
+	}
+	r.offset = offset
+	return nil
+}
+
+// Next returns the next record of the file, or io.EOF when there are no more records.
+//
+// The record returned by the previous call must be closed before calling Next.
+func (r *Reader) Next() (gowarc.Record, error) {
+	if err := r.endFrame(); err != nil {
+		return gowarc.Record{Offset: r.offset}, err
+	}
+
+	for {
+		magic, err := r.br.Peek(4)
+		if len(magic) == 0 && errors.Is(err, io.EOF) {
+			return gowarc.Record{Offset: r.offset}, io.EOF
+		}
+		if len(magic) < 4 {
+			return gowarc.Record{Offset: r.offset}, fmt.Errorf("truncated zstd frame: %w", io.ErrUnexpectedEOF)
+		}
+		m := binary.LittleEndian.Uint32(magic)
+		if m == frameMagic {
+			break
+		}
+		if m&skippableFrameMask != skippableFrameMagic {
+			return gowarc.Record{Offset: r.offset}, fmt.Errorf("not a zstd frame: magic number %#08x", m)
+		}
+		size, err := skipSkippableFrame(r.br)
+		if err != nil {
+			return gowarc.Record{Offset: r.offset}, err
+		}
+		r.offset += size
+	}
+
+	record := gowarc.Record{Offset: r.offset}
+	if r.seeker != nil {
+		size, err := r.frameSize()
+		if err != nil {
+			return record, err
+		}
+		record.Size = size
+	}
+
+	r.frame = newFrameReader(r.br)
+	if err := r.decoder.Reset(r.frame); err != nil {
+		return record, err
+	}
+	warcRecord, _, validation, err := r.unmarshaler.Unmarshal(bufio.NewReader(r.decoder))
+	record.WarcRecord = warcRecord
+	record.Validation = validation
+	return record, err
+}
+
+// Records returns an iterator over the records of the file.
+func (r *Reader) Records() iter.Seq2[gowarc.Record, error] {
+	return func(yield func(gowarc.Record, error) bool) {
+		for {
+			record, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if !yield(record, err) {
+				return
+			}
+			// the next record can only be found after a record read from a frame
+			if err != nil && r.frame == nil {
+				return
+			}
+		}
+	}
+}
+
+// endFrame moves past the rest of the frame of the previous record.
+func (r *Reader) endFrame() error {
+	if r.frame == nil {
+		return nil
+	}
+	frame := r.frame
+	r.frame = nil
+	_, err := io.Copy(io.Discard, frame)
+	r.offset += frame.n
+	return err
+}
+
+// frameSize finds the compressed size of the frame at the current offset from its frame and block
+// headers. Headers in the read buffer are peeked at, and the file is only seeked in for frames
+// extending past the buffer, after which it is moved back to keep the buffer valid.
+func (r *Reader) frameSize() (int64, error) {
+	buf, _ := r.br.Peek(r.br.Size())
+	p := &peekSeeker{buf: buf, seeker: r.seeker, filePos: int64(len(buf))}
+	frame := newFrameReader(p)
+	err := frame.skip()
+	if restoreErr := p.restore(); restoreErr != nil {
+		return 0, restoreErr
+	}
+	return frame.n, err
+}
+
+// peekSeeker reads the bytes peeked from a file before reading on in the file itself. Seeking only
+// moves the read position, so the file is not seeked in until reading past the peeked bytes.
+type peekSeeker struct {
+	buf     []byte
+	seeker  io.ReadSeeker
+	pos     int64 // read position relative to the start of buf
+	filePos int64 // position of the file relative to the start of buf
+}
+
+func (p *peekSeeker) Read(b []byte) (int, error) {
+	if p.pos < int64(len(p.buf)) {
+		n := copy(b, p.buf[p.pos:])
+		p.pos += int64(n)
+		return n, nil
+	}
+	if p.filePos != p.pos {
+		if _, err := p.seeker.Seek(p.pos-p.filePos, io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		p.filePos = p.pos
+	}
+	n, err := p.seeker.Read(b)
+	p.pos += int64(n)
+	p.filePos += int64(n)
+	return n, err
+}
+
+// Seek moves the read position. Only io.SeekCurrent is supported.
+func (p *peekSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekCurrent {
+		return 0, errors.New("peekSeeker: only seeking from the current position is supported")
+	}
+	p.pos += offset
+	return p.pos, nil
+}
+
+// restore moves the file back to the end of the peeked bytes.
+func (p *peekSeeker) restore() error {
+	if p.filePos == int64(len(p.buf)) {
+		return nil
+	}
+	_, err := p.seeker.Seek(int64(len(p.buf))-p.filePos, io.SeekCurrent)
+	return err
+}
+
+// Close releases the resources of the reader. The underlying reader is not closed.
+func (r *Reader) Close() error {
+	r.decoder.Close()
+	return nil
+}
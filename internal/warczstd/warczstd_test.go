@@ -0,0 +1,257 @@
+package warczstd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, data []byte, opts ...zstd.EOption) []byte {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil, opts...)
+	require.NoError(t, err)
+	defer func() { _ = encoder.Close() }()
+	return encoder.EncodeAll(data, nil)
+}
+
+func TestFrameReader(t *testing.T) {
+	frames := [][]byte{
+		compress(t, []byte(strings.Repeat("WARC/1.1\r\nWARC-Type: response\r\n", 100))),
+		compress(t, bytes.Repeat([]byte{'a'}, 1<<18), zstd.WithEncoderCRC(false)),
+		compress(t, nil),
+	}
+	stream := bytes.Join(frames, nil)
+
+	t.Run("read", func(t *testing.T) {
+		r := bytes.NewReader(stream)
+		for _, frame := range frames {
+			got, err := io.ReadAll(newFrameReader(struct{ io.Reader }{r}))
+			require.NoError(t, err)
+			assert.Equal(t, frame, got)
+		}
+		assert.Zero(t, r.Len())
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		r := bytes.NewReader(stream)
+		for _, frame := range frames {
+			frameReader := newFrameReader(r)
+			require.NoError(t, frameReader.skip())
+			assert.Equal(t, int64(len(frame)), frameReader.n)
+		}
+		assert.Zero(t, r.Len())
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := io.ReadAll(newFrameReader(bytes.NewReader(frames[0][:len(frames[0])-1])))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("not a frame", func(t *testing.T) {
+		_, err := io.ReadAll(newFrameReader(strings.NewReader("WARC/1.1\r\n")))
+		assert.Error(t, err)
+	})
+}
+
+// seekCounter counts the seeks in a file.
+type seekCounter struct {
+	io.ReadSeeker
+	seeks int
+}
+
+func (s *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	s.seeks++
+	return s.ReadSeeker.Seek(offset, whence)
+}
+
+func TestFrameSize(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	large := make([]byte, 3*bufferSize)
+	for i := range large {
+		large[i] = byte(random.IntN(256))
+	}
+	frames := [][]byte{
+		compress(t, []byte(strings.Repeat("WARC/1.1\r\nWARC-Type: response\r\n", 100))),
+		compress(t, large, zstd.WithEncoderLevel(zstd.SpeedFastest)),
+		compress(t, []byte("WARC/1.1\r\n")),
+	}
+	require.Greater(t, len(frames[1]), bufferSize)
+
+	file := &seekCounter{ReadSeeker: bytes.NewReader(bytes.Join(frames, nil))}
+	r := &Reader{br: bufio.NewReaderSize(file, bufferSize), seeker: file}
+	for i, frame := range frames {
+		seeks := file.seeks
+		size, err := r.frameSize()
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(frame)), size)
+		if i != 1 {
+			assert.Equal(t, seeks, file.seeks, "frames in the buffer should not need seeking")
+		}
+
+		// the buffer is still valid after finding the size
+		got := make([]byte, size)
+		_, err = io.ReadFull(r.br, got)
+		require.NoError(t, err)
+		assert.Equal(t, frame, got)
+	}
+}
+
+func TestRecordsStopsAtUnreadableFrame(t *testing.T) {
+	reader, err := NewReader(strings.NewReader("WARC/1.1\r\n"), 0)
+	require.NoError(t, err)
+	defer func() { _ = reader.Close() }()
+
+	var errs int
+	for _, err := range reader.Records() {
+		require.Error(t, err)
+		errs++
+		require.Less(t, errs, 2, "records should stop after an error leaving no frame to skip")
+	}
+	assert.Equal(t, 1, errs)
+}
+
+func TestIsZstd(t *testing.T) {
+	var dictionaryFrame [4]byte
+	binary.LittleEndian.PutUint32(dictionaryFrame[:], dictionaryFrameMagic)
+
+	assert.True(t, IsZstd(compress(t, []byte("WARC/1.1"))))
+	assert.True(t, IsZstd(dictionaryFrame[:]))
+	assert.False(t, IsZstd([]byte("WARC/1.1")))
+	assert.False(t, IsZstd([]byte{0x1f, 0x8b}))
+}
+
+func TestTrain(t *testing.T) {
+	tr := &training{}
+	random := rand.New(rand.NewPCG(1, 2))
+	for i := range 50 {
+		body := make([]byte, 2000)
+		for j := range body {
+			body[j] = byte('a' + random.IntN(26))
+		}
+		tr.contents = append(tr.contents, fmt.Appendf(nil, "WARC/1.1\r\nWARC-Type: response\r\nWARC-Record-ID: <urn:uuid:%08d>\r\n"+
+			"WARC-Target-URI: http://example.com/%d\r\n\r\nHTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html>%s</html>", i, i, body))
+	}
+	dictionary, err := tr.train(zstd.SpeedDefault)
+	require.NoError(t, err)
+	assert.Equal(t, dictionaryMagic, binary.LittleEndian.Uint32(dictionary))
+
+	// the dictionary must be usable by the encoder and decoder
+	encoded := compress(t, tr.contents[0], zstd.WithEncoderDict(dictionary))
+	decoder, err := zstd.NewReader(nil, decoderDict(dictionary))
+	require.NoError(t, err)
+	defer decoder.Close()
+	decoded, err := decoder.DecodeAll(encoded, nil)
+	require.NoError(t, err)
+	assert.Equal(t, tr.contents[0], decoded)
+}
+
+func newRecord(t *testing.T, uri string) gowarc.WarcRecord {
+	t.Helper()
+	rb := gowarc.NewRecordBuilder(gowarc.Resource, gowarc.WithBufferTmpDir(t.TempDir()))
+	rb.AddWarcHeader(gowarc.WarcTargetURI, uri)
+	rb.AddWarcHeader(gowarc.ContentType, "text/plain")
+	rb.AddWarcHeaderTime(gowarc.WarcDate, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	_, err := rb.WriteString("content of " + uri)
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	return record
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []WriterOption
+	}{
+		{name: "plain"},
+		{name: "trained dictionary", options: []WriterOption{WithDictionaryTraining(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var closedFiles []string
+			opts := append([]WriterOption{
+				WithFileNameGenerator(&gowarc.PatternNameGenerator{Directory: dir, Prefix: "test-"}),
+				WithTmpDir(t.TempDir()),
+				WithWarcInfoFunc(func(recordBuilder gowarc.WarcRecordBuilder) error {
+					_, err := recordBuilder.WriteString("software: test\r\n")
+					return err
+				}),
+				WithAfterFileCreationHook(func(fileName string, size int64, warcInfoId string) error {
+					closedFiles = append(closedFiles, fileName)
+					return nil
+				}),
+			}, tt.options...)
+			writer, err := NewWriter(opts...)
+			require.NoError(t, err)
+
+			uris := []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"}
+			for _, uri := range uris {
+				record := newRecord(t, uri)
+				for _, response := range writer.Write(record) {
+					require.NoError(t, response.Err)
+				}
+				_ = record.Close()
+			}
+			require.NoError(t, writer.Close())
+
+			files, err := filepath.Glob(filepath.Join(dir, "*"+Suffix))
+			require.NoError(t, err)
+			require.Len(t, files, 1)
+			assert.Equal(t, files, closedFiles)
+
+			f, err := os.Open(files[0])
+			require.NoError(t, err)
+			reader, err := NewReader(f, 0, gowarc.WithBufferTmpDir(t.TempDir()))
+			require.NoError(t, err)
+			var records []gowarc.Record
+			for record, err := range reader.Records() {
+				require.NoError(t, err)
+				assert.Empty(t, record.Validation)
+				assert.Positive(t, record.Size)
+				records = append(records, record)
+				_ = record.Close()
+			}
+			require.NoError(t, reader.Close())
+
+			require.Len(t, records, 4)
+			warcInfoId := records[0].WarcRecord.WarcHeader().Get(gowarc.WarcRecordID)
+			assert.Equal(t, gowarc.Warcinfo, records[0].WarcRecord.Type())
+			for i, uri := range uris {
+				header := records[i+1].WarcRecord.WarcHeader()
+				assert.Equal(t, uri, header.Get(gowarc.WarcTargetURI))
+				assert.Equal(t, warcInfoId, header.Get(gowarc.WarcWarcinfoID))
+				assert.Equal(t, records[i].Offset+records[i].Size, records[i+1].Offset)
+			}
+
+			// reading from the offset of a record starts with that record
+			f, err = os.Open(files[0])
+			require.NoError(t, err)
+			reader, err = NewReader(f, records[2].Offset, gowarc.WithBufferTmpDir(t.TempDir()))
+			require.NoError(t, err)
+			defer func() { _ = reader.Close() }()
+			record, err := reader.Next()
+			require.NoError(t, err)
+			defer func() { _ = record.Close() }()
+			assert.Equal(t, uris[1], record.WarcRecord.WarcHeader().Get(gowarc.WarcTargetURI))
+			content, err := record.WarcRecord.Block().RawBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(content)
+			require.NoError(t, err)
+			assert.Equal(t, "content of "+uris[1], string(b))
+		})
+	}
+}
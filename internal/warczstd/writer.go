@@ -0,0 +1,529 @@
+package warczstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nlnwa/gowarc/v3"
+)
+
+const (
+	// Suffix is appended to the names generated by the file name generator.
+	Suffix = ".zst"
+	// openSuffix marks files that are still being written.
+	openSuffix = ".open"
+
+	// maxSampleSize is the number of bytes of each sampled record used for training. The start of
+	// a record holds the WARC and protocol headers, which is what records have most in common.
+	maxSampleSize = 16 * 1024
+	// dictionaryHistorySize is the size of the content of trained dictionaries.
+	dictionaryHistorySize = 110 * 1024
+	// historyChunkSize is how much of each sample is added to the history at a time.
+	historyChunkSize = 512
+)
+
+type writerOptions struct {
+	nameGenerator     gowarc.WarcFileNameGenerator
+	maxFileSize       int64
+	level             zstd.EncoderLevel
+	dictionary        []byte
+	trainingSamples   int
+	flush             bool
+	tmpDir            string
+	warcInfoFunc      func(recordBuilder gowarc.WarcRecordBuilder) error
+	recordOptions     []gowarc.WarcRecordOption
+	beforeFileCreated func(fileName string) error
+	afterFileCreated  func(fileName string, size int64, warcInfoId string) error
+}
+
+type WriterOption func(*writerOptions)
+
+// WithFileNameGenerator sets the generator of file names. Suffix is appended to the generated names.
+func WithFileNameGenerator(generator gowarc.WarcFileNameGenerator) WriterOption {
+	return func(o *writerOptions) {
+		o.nameGenerator = generator
+	}
+}
+
+// WithMaxFileSize sets the size at which a new file is started. Zero means no limit.
+func WithMaxFileSize(size int64) WriterOption {
+	return func(o *writerOptions) {
+		o.maxFileSize = size
+	}
+}
+
+// WithCompressionLevel sets the zstd compression level (1-22). Negative levels use the default level.
+func WithCompressionLevel(level int) WriterOption {
+	return func(o *writerOptions) {
+		if level < 0 {
+			o.level = zstd.SpeedDefault
+		} else {
+			o.level = zstd.EncoderLevelFromZstd(level)
+		}
+	}
+}
+
+// WithDictionary sets a dictionary in the zstd dictionary format to compress records with.
+// The dictionary is written to the start of every file.
+func WithDictionary(dictionary []byte) WriterOption {
+	return func(o *writerOptions) {
+		o.dictionary = dictionary
+	}
+}
+
+// WithDictionaryTraining makes the writer train a dictionary on the first samples records
+// written. Records are held back in a temporary file until the dictionary is trained.
+func WithDictionaryTraining(samples int) WriterOption {
+	return func(o *writerOptions) {
+		o.trainingSamples = samples
+	}
+}
+
+// WithFlush makes the writer sync the file to disk after every record.
+func WithFlush(flush bool) WriterOption {
+	return func(o *writerOptions) {
+		o.flush = flush
+	}
+}
+
+// WithTmpDir sets the directory of the temporary file used while training a dictionary.
+func WithTmpDir(dir string) WriterOption {
+	return func(o *writerOptions) {
+		o.tmpDir = dir
+	}
+}
+
+// WithWarcInfoFunc sets a function adding content to the warcinfo record written first in every file.
+func WithWarcInfoFunc(f func(recordBuilder gowarc.WarcRecordBuilder) error) WriterOption {
+	return func(o *writerOptions) {
+		o.warcInfoFunc = f
+	}
+}
+
+// WithRecordOptions sets the options used when building warcinfo records.
+func WithRecordOptions(opts ...gowarc.WarcRecordOption) WriterOption {
+	return func(o *writerOptions) {
+		o.recordOptions = opts
+	}
+}
+
+// WithBeforeFileCreationHook sets a function called with the file name before a file is created.
+func WithBeforeFileCreationHook(f func(fileName string) error) WriterOption {
+	return func(o *writerOptions) {
+		o.beforeFileCreated = f
+	}
+}
+
+// WithAfterFileCreationHook sets a function called when a file is complete.
+func WithAfterFileCreationHook(f func(fileName string, size int64, warcInfoId string) error) WriterOption {
+	return func(o *writerOptions) {
+		o.afterFileCreated = f
+	}
+}
+
+// Writer writes records to zstd compressed WARC files (.warc.zst), compressing each record as a
+// zstd frame of its own.
+//
+// Files are written with an .open suffix which is removed when the file is closed.
+type Writer struct {
+	opts       writerOptions
+	mu         sync.Mutex
+	encoder    *zstd.Encoder
+	marshaler  gowarc.Marshaler
+	file       *os.File
+	dir        string
+	name       string
+	size       int64
+	warcInfo   gowarc.WarcRecord
+	warcInfoId string
+	training   *training
+}
+
+func NewWriter(opts ...WriterOption) (*Writer, error) {
+	o := writerOptions{
+		nameGenerator: &gowarc.PatternNameGenerator{},
+		level:         zstd.SpeedDefault,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.dictionary != nil && o.trainingSamples > 0 {
+		return nil, errors.New("a dictionary can not be both given and trained")
+	}
+
+	w := &Writer{
+		opts:      o,
+		marshaler: gowarc.NewMarshaler(),
+	}
+	if o.trainingSamples > 0 {
+		w.training = &training{samples: o.trainingSamples, tmpDir: o.tmpDir}
+		return w, nil
+	}
+	if err := w.newEncoder(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) newEncoder() error {
+	encoderOptions := []zstd.EOption{zstd.WithEncoderLevel(w.opts.level), zstd.WithEncoderConcurrency(1)}
+	if w.opts.dictionary != nil {
+		encoderOptions = append(encoderOptions, zstd.WithEncoderDict(w.opts.dictionary))
+	}
+	encoder, err := zstd.NewWriter(nil, encoderOptions...)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	w.encoder = encoder
+	return nil
+}
+
+// Write writes records and returns a response for each of them. While a dictionary is being
+// trained, the responses have no file name.
+func (w *Writer) Write(records ...gowarc.WarcRecord) []gowarc.WriteResponse {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	responses := make([]gowarc.WriteResponse, len(records))
+	for i, record := range records {
+		responses[i] = w.write(record)
+	}
+	return responses
+}
+
+func (w *Writer) write(record gowarc.WarcRecord) gowarc.WriteResponse {
+	if w.name == "" {
+		if err := w.nextFile(); err != nil {
+			return gowarc.WriteResponse{Err: err}
+		}
+	}
+	if w.warcInfoId != "" && record.Type() != gowarc.Warcinfo {
+		record.WarcHeader().Set(gowarc.WarcWarcinfoID, w.warcInfoId)
+	}
+
+	if w.training != nil {
+		if w.warcInfo != nil {
+			err := w.training.add(w.marshaler, w.warcInfo)
+			_ = w.warcInfo.Close()
+			w.warcInfo = nil
+			if err != nil {
+				return gowarc.WriteResponse{Err: err}
+			}
+		}
+		if err := w.training.add(w.marshaler, record); err != nil {
+			return gowarc.WriteResponse{Err: err}
+		}
+		if len(w.training.sizes) >= w.training.samples {
+			return gowarc.WriteResponse{Err: w.endTraining()}
+		}
+		return gowarc.WriteResponse{}
+	}
+
+	if w.file == nil {
+		if err := w.createFile(); err != nil {
+			return gowarc.WriteResponse{Err: err}
+		}
+	}
+	response := gowarc.WriteResponse{FileName: w.name, FileOffset: w.size}
+	response.BytesWritten, response.Err = w.writeFrame(func(encoder io.Writer) error {
+		_, _, err := w.marshaler.Marshal(encoder, record, 0)
+		return err
+	})
+	if response.Err == nil && w.opts.maxFileSize > 0 && w.size >= w.opts.maxFileSize {
+		response.Err = w.closeFile()
+	}
+	return response
+}
+
+// nextFile names the next file and builds its warcinfo record, which is written after the dictionary.
+func (w *Writer) nextFile() error {
+	dir, name := w.opts.nameGenerator.NewWarcfileName()
+	w.dir, w.name = dir, name+Suffix
+	w.warcInfo, w.warcInfoId = nil, ""
+	if w.opts.warcInfoFunc == nil {
+		return nil
+	}
+
+	recordBuilder := gowarc.NewRecordBuilder(gowarc.Warcinfo, w.opts.recordOptions...)
+	recordBuilder.AddWarcHeaderTime(gowarc.WarcDate, time.Now())
+	recordBuilder.AddWarcHeader(gowarc.WarcFilename, w.name)
+	recordBuilder.AddWarcHeader(gowarc.ContentType, "application/warc-fields")
+	if err := w.opts.warcInfoFunc(recordBuilder); err != nil {
+		return fmt.Errorf("failed to create warcinfo record: %w", err)
+	}
+	warcInfo, _, err := recordBuilder.Build()
+	if err != nil {
+		return fmt.Errorf("failed to create warcinfo record: %w", err)
+	}
+	w.warcInfo = warcInfo
+	w.warcInfoId = warcInfo.WarcHeader().Get(gowarc.WarcRecordID)
+	return nil
+}
+
+// createFile creates the file named by nextFile and writes the dictionary and warcinfo record to it.
+func (w *Writer) createFile() error {
+	path := filepath.Join(w.dir, w.name)
+	if w.opts.beforeFileCreated != nil {
+		if err := w.opts.beforeFileCreated(path); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(path+openSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.size = 0
+
+	if w.opts.dictionary != nil {
+		var header [8]byte
+		binary.LittleEndian.PutUint32(header[:4], dictionaryFrameMagic)
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(w.opts.dictionary)))
+		if err := w.writeRaw(header[:]); err != nil {
+			return err
+		}
+		if err := w.writeRaw(w.opts.dictionary); err != nil {
+			return err
+		}
+	}
+	if w.warcInfo != nil {
+		warcInfo := w.warcInfo
+		w.warcInfo = nil
+		defer func() { _ = warcInfo.Close() }()
+		if _, err := w.writeFrame(func(encoder io.Writer) error {
+			_, _, err := w.marshaler.Marshal(encoder, warcInfo, 0)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) writeRaw(b []byte) error {
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	return err
+}
+
+// writeFrame writes what write writes to the encoder as one zstd frame.
+func (w *Writer) writeFrame(write func(encoder io.Writer) error) (int64, error) {
+	start := w.size
+	counter := &countingWriter{w: w.file}
+	w.encoder.Reset(counter)
+	err := write(w.encoder)
+	if closeErr := w.encoder.Close(); err == nil {
+		err = closeErr
+	}
+	w.size += counter.n
+	if err == nil && w.opts.flush {
+		err = w.file.Sync()
+	}
+	return w.size - start, err
+}
+
+// closeFile closes the current file, removes the .open suffix and runs the after file creation hook.
+func (w *Writer) closeFile() error {
+	if w.file == nil {
+		w.name = ""
+		return nil
+	}
+	file := w.file
+	w.file = nil
+	path := filepath.Join(w.dir, w.name)
+	size, warcInfoId := w.size, w.warcInfoId
+	w.name, w.warcInfoId = "", ""
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+openSuffix, path); err != nil {
+		return err
+	}
+	if w.opts.afterFileCreated != nil {
+		return w.opts.afterFileCreated(path, size, warcInfoId)
+	}
+	return nil
+}
+
+// endTraining trains the dictionary and writes the records held back while sampling. If there is too
+// little data to train a dictionary, the records are written without one.
+//
+// All records held back are written to the same file even if that makes it exceed the maximum size,
+// since they refer to the warcinfo record of that file.
+func (w *Writer) endTraining() error {
+	t := w.training
+	w.training = nil
+	defer t.close()
+
+	if dictionary, err := t.train(w.opts.level); err == nil {
+		w.opts.dictionary = dictionary
+	}
+	if err := w.newEncoder(); err != nil {
+		return err
+	}
+	if len(t.sizes) == 0 {
+		return nil
+	}
+	if err := w.createFile(); err != nil {
+		return err
+	}
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	for _, size := range t.sizes {
+		if _, err := w.writeFrame(func(encoder io.Writer) error {
+			_, err := io.CopyN(encoder, t.file, size)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	if w.opts.maxFileSize > 0 && w.size >= w.opts.maxFileSize {
+		return w.closeFile()
+	}
+	return nil
+}
+
+// Rotate closes the current file. The next record is written to a new file.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.training != nil {
+		if err := w.endTraining(); err != nil {
+			return err
+		}
+	}
+	if w.warcInfo != nil {
+		_ = w.warcInfo.Close()
+		w.warcInfo = nil
+	}
+	return w.closeFile()
+}
+
+// Close writes any records held back for training and closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	if w.training != nil {
+		err = w.endTraining()
+	}
+	if w.warcInfo != nil {
+		_ = w.warcInfo.Close()
+		w.warcInfo = nil
+	}
+	if closeErr := w.closeFile(); err == nil {
+		err = closeErr
+	}
+	if w.encoder != nil {
+		if closeErr := w.encoder.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// training holds back marshaled records in a temporary file and keeps the start of each as a sample.
+type training struct {
+	samples  int
+	tmpDir   string
+	file     *os.File
+	sizes    []int64
+	contents [][]byte
+}
+
+func (t *training) add(marshaler gowarc.Marshaler, record gowarc.WarcRecord) error {
+	if t.file == nil {
+		file, err := os.CreateTemp(t.tmpDir, "warc-zstd-training-*")
+		if err != nil {
+			return err
+		}
+		t.file = file
+	}
+	sample := &sampleWriter{}
+	counter := &countingWriter{w: io.MultiWriter(t.file, sample)}
+	if _, _, err := marshaler.Marshal(counter, record, 0); err != nil {
+		return err
+	}
+	t.sizes = append(t.sizes, counter.n)
+	t.contents = append(t.contents, sample.Bytes())
+	return nil
+}
+
+// train builds a dictionary from the samples. The history of the dictionary is made of the start
+// of the samples, which is where the headers common to many records are.
+func (t *training) train(level zstd.EncoderLevel) (dictionary []byte, err error) {
+	// BuildDict panics on some degenerate samples, e.g. when they are made of nothing but matches
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to train dictionary: %v", r)
+		}
+	}()
+
+	var history []byte
+	for offset := 0; len(history) < dictionaryHistorySize; offset += historyChunkSize {
+		added := false
+		for _, content := range t.contents {
+			if offset < len(content) {
+				history = append(history, content[offset:min(offset+historyChunkSize, len(content))]...)
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	if len(history) > dictionaryHistorySize {
+		history = history[:dictionaryHistorySize]
+	}
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		// ids below 32768 are reserved for registered dictionaries
+		ID:       uint32(32768 + rand.IntN(1<<31-32768)),
+		Contents: t.contents,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+		Level:    level,
+	})
+}
+
+func (t *training) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+		_ = os.Remove(t.file.Name())
+	}
+}
+
+// sampleWriter keeps the first maxSampleSize bytes written to it.
+type sampleWriter struct {
+	bytes.Buffer
+}
+
+func (s *sampleWriter) Write(p []byte) (int, error) {
+	if remaining := maxSampleSize - s.Len(); remaining > 0 {
+		s.Buffer.Write(p[:min(len(p), remaining)])
+	}
+	return len(p), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
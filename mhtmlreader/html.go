@@ -0,0 +1,64 @@
+package mhtmlreader
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// htmlCommentSize is how much of the start of a single-file HTML page is searched for the
+// comments telling where and when it was saved.
+const htmlCommentSize = 64 * 1024
+
+var (
+	// savedFromUrl matches the comment added by browsers saving a page as HTML only, like
+	// <!-- saved from url=(0023)https://example.com/ -->
+	savedFromUrl = regexp.MustCompile(`<!--\s*saved from url=\(\d+\)(\S+?)\s*-->`)
+	// singleFile matches the comment added by the SingleFile extension
+	singleFile     = regexp.MustCompile(`(?s)<!--\s*Page saved with SingleFile.*?-->`)
+	singleFileUrl  = regexp.MustCompile(`(?m)^\s*url:\s*(\S+)`)
+	singleFileDate = regexp.MustCompile(`(?m)^\s*saved date:\s*(.+?)\s*$`)
+)
+
+// singleFileDateLayout is the layout of the saved date of SingleFile, like
+// Mon Jan 01 2024 12:00:00 GMT+0000 (Coordinated Universal Time)
+const singleFileDateLayout = "Mon Jan 02 2006 15:04:05 GMT-0700"
+
+// isHtml reports whether the file is a HTML page rather than a MIME message, which starts
+// with headers.
+func isHtml(br *bufio.Reader) bool {
+	b, _ := br.Peek(512)
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(bytes.TrimLeft(b, " \t\r\n"), []byte("<"))
+}
+
+// openHtml reads a single-file HTML page as the only part of the archive.
+func (mhtmlReader *MhtmlReader) openHtml(r io.Reader) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	mhtmlReader.isHtml = true
+	part := &Part{Index: 1, ContentType: "text/html", Body: bytes.NewReader(body)}
+
+	head := body[:min(len(body), htmlCommentSize)]
+	if m := savedFromUrl.FindSubmatch(head); m != nil {
+		part.ContentLocation = string(m[1])
+	}
+	if comment := singleFile.Find(head); comment != nil {
+		if m := singleFileUrl.FindSubmatch(comment); m != nil {
+			part.ContentLocation = string(m[1])
+		}
+		if m := singleFileDate.FindSubmatch(comment); m != nil {
+			date, _, _ := strings.Cut(string(m[1]), " (")
+			if t, err := time.Parse(singleFileDateLayout, date); err == nil {
+				mhtmlReader.warcDate = t
+			}
+		}
+	}
+	mhtmlReader.html = part
+	return nil
+}
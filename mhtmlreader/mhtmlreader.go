@@ -0,0 +1,311 @@
+package mhtmlreader
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+// MhtmlReader reads a MHTML file (a MIME multipart/related archive as saved by browsers) and
+// returns one record per part followed by a metadata record describing the file.
+//
+// Parts are resource records, or response records with synthesized HTTP headers, with the
+// Content-Location of the part as WARC-Target-URI. The Date header of the archive is used as
+// WARC-Date for all records.
+//
+// A single-file HTML page, as saved by browsers or the SingleFile extension, is read as an
+// archive with the page as its only part. Its URL and date are read from the comments the
+// browser or extension adds to the page.
+type MhtmlReader struct {
+	fs                 afero.Fs
+	filename           string
+	defaultTime        time.Time
+	synthesizeResponse bool
+	warcRecordOptions  []gowarc.WarcRecordOption
+
+	file      afero.File
+	header    mail.Header
+	multipart *multipart.Reader
+	// html is the page of a single-file HTML file until it is returned as a part
+	html         *Part
+	isHtml       bool
+	warcDate     time.Time
+	parts        int
+	mainRecordId string
+	mainURI      string
+	done         bool
+}
+
+type Option func(*MhtmlReader)
+
+// WithSynthesizeResponse makes the reader produce response records with synthesized HTTP
+// headers instead of resource records.
+func WithSynthesizeResponse(synthesize bool) Option {
+	return func(r *MhtmlReader) {
+		r.synthesizeResponse = synthesize
+	}
+}
+
+func NewMhtmlReader(fileSystem afero.Fs, filename string, defaultTime time.Time, options []Option, warcRecordOptions ...gowarc.WarcRecordOption) (*MhtmlReader, error) {
+	mhtmlReader := &MhtmlReader{
+		fs:                fileSystem,
+		filename:          filename,
+		defaultTime:       defaultTime,
+		warcRecordOptions: warcRecordOptions,
+	}
+	for _, option := range options {
+		option(mhtmlReader)
+	}
+	return mhtmlReader, nil
+}
+
+// Part is a part of a MHTML archive with its content transfer encoding removed.
+type Part struct {
+	// Index is the 1-based number of the part in the archive
+	Index           int
+	ContentType     string
+	ContentLocation string
+	ContentID       string
+	Body            io.Reader
+}
+
+// TargetURI returns the URI identifying the part. Parts with neither Content-Location nor
+// Content-ID are identified by their number, like cid:part-3.
+func (p *Part) TargetURI() string {
+	if p.ContentLocation != "" {
+		return p.ContentLocation
+	}
+	if p.ContentID != "" {
+		return "cid:" + strings.Trim(p.ContentID, "<>")
+	}
+	return fmt.Sprintf("cid:part-%d", p.Index)
+}
+
+// hasLocation reports whether the part is identified by its own headers.
+func (p *Part) hasLocation() bool {
+	return p.ContentLocation != "" || p.ContentID != ""
+}
+
+func (mhtmlReader *MhtmlReader) open() error {
+	file, err := mhtmlReader.fs.Open(mhtmlReader.filename)
+	if err != nil {
+		return err
+	}
+	mhtmlReader.file = file
+	mhtmlReader.warcDate = mhtmlReader.defaultTime
+
+	br := bufio.NewReader(file)
+	if isHtml(br) {
+		return mhtmlReader.openHtml(br)
+	}
+	message, err := mail.ReadMessage(br)
+	if err != nil {
+		return fmt.Errorf("failed to read MHTML header: %w", err)
+	}
+	mhtmlReader.header = message.Header
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return fmt.Errorf("not a multipart archive: %s", mediaType)
+	}
+	mhtmlReader.multipart = multipart.NewReader(message.Body, params["boundary"])
+
+	if date, err := message.Header.Date(); err == nil {
+		mhtmlReader.warcDate = date
+	}
+	return nil
+}
+
+// NextPart returns the next part of the archive or io.EOF when there are no more parts.
+func (mhtmlReader *MhtmlReader) NextPart() (*Part, error) {
+	if mhtmlReader.file == nil {
+		if err := mhtmlReader.open(); err != nil {
+			return nil, err
+		}
+	}
+	if mhtmlReader.isHtml {
+		part := mhtmlReader.html
+		if part == nil {
+			return nil, io.EOF
+		}
+		mhtmlReader.html = nil
+		mhtmlReader.parts++
+		return part, nil
+	}
+	p, err := mhtmlReader.multipart.NextRawPart()
+	if err != nil {
+		return nil, err
+	}
+	part := &Part{
+		Index:           mhtmlReader.parts + 1,
+		ContentType:     p.Header.Get("Content-Type"),
+		ContentLocation: p.Header.Get("Content-Location"),
+		ContentID:       p.Header.Get("Content-Id"),
+		Body:            p,
+	}
+	switch strings.ToLower(p.Header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		// line breaks are ignored by the decoder
+		part.Body = base64.NewDecoder(base64.StdEncoding, p)
+	case "quoted-printable":
+		part.Body = quotedprintable.NewReader(p)
+	}
+	if part.ContentType == "" {
+		part.ContentType = "text/plain"
+	}
+	mhtmlReader.parts++
+	return part, nil
+}
+
+func (mhtmlReader *MhtmlReader) Next() (gowarc.Record, error) {
+	if mhtmlReader.done {
+		return gowarc.Record{}, io.EOF
+	}
+	part, err := mhtmlReader.NextPart()
+	if errors.Is(err, io.EOF) {
+		mhtmlReader.done = true
+		return mhtmlReader.metadataRecord()
+	}
+	if err != nil {
+		mhtmlReader.done = true
+		return gowarc.Record{}, err
+	}
+
+	record, err := mhtmlReader.partRecord(part)
+	if err != nil {
+		return record, fmt.Errorf("part %d: %w", mhtmlReader.parts, err)
+	}
+	if mhtmlReader.mainRecordId == "" {
+		mhtmlReader.mainRecordId = record.WarcRecord.WarcHeader().Get(gowarc.WarcRecordID)
+		mhtmlReader.mainURI = part.TargetURI()
+	}
+	return record, nil
+}
+
+func (mhtmlReader *MhtmlReader) partRecord(part *Part) (gowarc.Record, error) {
+	var warcRecordBuilder gowarc.WarcRecordBuilder
+	if mhtmlReader.synthesizeResponse {
+		warcRecordBuilder = gowarc.NewRecordBuilder(gowarc.Response, mhtmlReader.warcRecordOptions...)
+		warcRecordBuilder.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	} else {
+		warcRecordBuilder = gowarc.NewRecordBuilder(gowarc.Resource, mhtmlReader.warcRecordOptions...)
+		warcRecordBuilder.AddWarcHeader(gowarc.ContentType, part.ContentType)
+	}
+	warcRecordBuilder.AddWarcHeader(gowarc.WarcTargetURI, part.TargetURI())
+	warcRecordBuilder.AddWarcHeaderTime(gowarc.WarcDate, mhtmlReader.warcDate)
+
+	body, err := io.ReadAll(part.Body)
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+
+	if mhtmlReader.synthesizeResponse {
+		header := http.Header{}
+		header.Set("Content-Type", part.ContentType)
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		if _, err = warcRecordBuilder.WriteString("HTTP/1.1 200 OK\r\n"); err != nil {
+			return gowarc.Record{}, err
+		}
+		if err = header.Write(warcRecordBuilder); err != nil {
+			return gowarc.Record{}, err
+		}
+		if _, err = warcRecordBuilder.WriteString("\r\n"); err != nil {
+			return gowarc.Record{}, err
+		}
+	}
+	if _, err = warcRecordBuilder.Write(body); err != nil {
+		return gowarc.Record{}, err
+	}
+
+	warcRecord, validation, err := warcRecordBuilder.Build()
+	if !part.hasLocation() {
+		validation = append(validation, fmt.Errorf("part %d has neither Content-Location nor Content-ID, identified as %s", part.Index, part.TargetURI()))
+	}
+	return gowarc.Record{WarcRecord: warcRecord, Validation: validation}, err
+}
+
+// metadataRecord describes the MHTML file the parts were read from.
+func (mhtmlReader *MhtmlReader) metadataRecord() (gowarc.Record, error) {
+	warcRecordBuilder := gowarc.NewRecordBuilder(gowarc.Metadata, mhtmlReader.warcRecordOptions...)
+	warcRecordBuilder.AddWarcHeader(gowarc.ContentType, "application/warc-fields")
+	warcRecordBuilder.AddWarcHeaderTime(gowarc.WarcDate, mhtmlReader.warcDate)
+	if location := mhtmlReader.header.Get("Snapshot-Content-Location"); location != "" {
+		warcRecordBuilder.AddWarcHeader(gowarc.WarcTargetURI, location)
+	} else if mhtmlReader.mainURI != "" {
+		warcRecordBuilder.AddWarcHeader(gowarc.WarcTargetURI, mhtmlReader.mainURI)
+	}
+	if mhtmlReader.mainRecordId != "" {
+		warcRecordBuilder.AddWarcHeader(gowarc.WarcConcurrentTo, mhtmlReader.mainRecordId)
+	}
+
+	fields := &gowarc.WarcFields{}
+	fields.Set("filename", filepath.Base(mhtmlReader.filename))
+	if mhtmlReader.isHtml {
+		fields.Set("format", "HTML")
+	} else {
+		fields.Set("format", "MHTML")
+	}
+	for _, name := range []string{"Snapshot-Content-Location", "Subject", "From", "Date", "Content-Type"} {
+		if v := mhtmlReader.header.Get(name); v != "" {
+			fields.Set(strings.ToLower(name), decodeHeader(v))
+		}
+	}
+	fields.Set("parts", strconv.Itoa(mhtmlReader.parts))
+	if _, err := warcRecordBuilder.WriteString(fields.String()); err != nil {
+		return gowarc.Record{}, err
+	}
+
+	warcRecord, validation, err := warcRecordBuilder.Build()
+	return gowarc.Record{WarcRecord: warcRecord, Validation: validation}, err
+}
+
+// decodeHeader decodes RFC 2047 encoded words, as used in the Subject of archives saved by
+// Chrome.
+func decodeHeader(v string) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(v); err == nil {
+		return decoded
+	}
+	return v
+}
+
+func (mhtmlReader *MhtmlReader) Records() iter.Seq2[gowarc.Record, error] {
+	return func(yield func(gowarc.Record, error) bool) {
+		for {
+			record, err := mhtmlReader.Next()
+			if err == io.EOF {
+				return
+			}
+			if !yield(record, err) {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (mhtmlReader *MhtmlReader) Close() error {
+	if mhtmlReader.file != nil {
+		return mhtmlReader.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package mhtmlreader
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMhtml = "From: <Saved by Blink>\r\n" +
+	"Snapshot-Content-Location: https://example.com/\r\n" +
+	"Subject: =?utf-8?Q?Example=20Domain?=\r\n" +
+	"Date: Mon, 1 Jan 2024 12:00:00 -0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/related;\r\n" +
+	"\ttype=\"text/html\";\r\n" +
+	"\tboundary=\"----MultipartBoundary--abc----\"\r\n" +
+	"\r\n" +
+	"\r\n" +
+	"------MultipartBoundary--abc----\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-ID: <frame-1@mhtml.blink>\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"Content-Location: https://example.com/\r\n" +
+	"\r\n" +
+	"<html><body style=3D\"margin: 0\">Hello</body></html>\r\n" +
+	"------MultipartBoundary--abc----\r\n" +
+	"Content-Type: image/gif\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Location: https://example.com/a.gif\r\n" +
+	"\r\n" +
+	"R0lG\r\nODlh\r\n" +
+	"------MultipartBoundary--abc----\r\n" +
+	"Content-Type: text/css\r\n" +
+	"Content-ID: <css-1@mhtml.blink>\r\n" +
+	"\r\n" +
+	"body {}\r\n" +
+	"------MultipartBoundary--abc------\r\n"
+
+func TestMhtmlReader_NextPart(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/snapshot.mhtml", []byte(testMhtml), 0o644))
+
+	reader, err := NewMhtmlReader(fs, "/snapshot.mhtml", time.Time{}, nil)
+	require.NoError(t, err)
+	defer func() { _ = reader.Close() }()
+
+	want := []struct {
+		contentType string
+		targetURI   string
+		body        string
+	}{
+		{"text/html", "https://example.com/", `<html><body style="margin: 0">Hello</body></html>`},
+		{"image/gif", "https://example.com/a.gif", "GIF89a"},
+		{"text/css", "cid:css-1@mhtml.blink", "body {}"},
+	}
+	for _, w := range want {
+		part, err := reader.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, w.contentType, part.ContentType)
+		assert.Equal(t, w.targetURI, part.TargetURI())
+		body, err := io.ReadAll(part.Body)
+		require.NoError(t, err)
+		assert.Equal(t, w.body, string(body))
+	}
+	_, err = reader.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+
+	assert.Equal(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), reader.warcDate.UTC())
+	assert.Equal(t, "Example Domain", decodeHeader(reader.header.Get("Subject")))
+	assert.Equal(t, 3, reader.parts)
+}
+
+func TestMhtmlReader_NotMultipart(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/page.mhtml", []byte("Content-Type: text/html\r\n\r\n<html>"), 0o644))
+
+	reader, err := NewMhtmlReader(fs, "/page.mhtml", time.Time{}, nil)
+	require.NoError(t, err)
+	defer func() { _ = reader.Close() }()
+
+	_, err = reader.NextPart()
+	assert.ErrorContains(t, err, "not a multipart archive")
+}
+
+func TestMhtmlReader_Html(t *testing.T) {
+	tests := []struct {
+		name      string
+		page      string
+		targetURI string
+		date      time.Time
+	}{
+		{
+			name:      "saved from url",
+			page:      "\xef\xbb\xbf<!DOCTYPE html>\r\n<!-- saved from url=(0023)https://example.com/ -->\r\n<html><body>Hello</body></html>",
+			targetURI: "https://example.com/",
+		},
+		{
+			name: "single file",
+			page: "<!DOCTYPE html> <html><!--\n Page saved with SingleFile \n url: https://example.com/page \n" +
+				" saved date: Mon Jan 01 2024 12:00:00 GMT+0100 (Central European Standard Time)\n--><body>Hello</body></html>",
+			targetURI: "https://example.com/page",
+			date:      time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "unknown url",
+			page:      "<html><body>Hello</body></html>",
+			targetURI: "cid:part-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/page.html", []byte(tt.page), 0o644))
+
+			reader, err := NewMhtmlReader(fs, "/page.html", time.Time{}, nil)
+			require.NoError(t, err)
+			defer func() { _ = reader.Close() }()
+
+			part, err := reader.NextPart()
+			require.NoError(t, err)
+			assert.Equal(t, "text/html", part.ContentType)
+			assert.Equal(t, tt.targetURI, part.TargetURI())
+			assert.Equal(t, tt.targetURI != "cid:part-1", part.hasLocation())
+			body, err := io.ReadAll(part.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.page, string(body))
+			assert.True(t, tt.date.Equal(reader.warcDate), "expected date %v, got %v", tt.date, reader.warcDate)
+
+			_, err = reader.NextPart()
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, 1, reader.parts)
+		})
+	}
+}
+
+func TestPart_TargetURI(t *testing.T) {
+	part := &Part{Index: 3}
+	assert.Equal(t, "cid:part-3", part.TargetURI())
+	assert.False(t, part.hasLocation())
+}
@@ -0,0 +1,271 @@
+package wgetreader
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/spf13/afero"
+)
+
+// WgetReader reads a single file from a directory tree created by wget --mirror and returns it
+// as a WARC record.
+//
+// The URL is reconstructed from the path of the file: the first path segment below the base
+// directory is the host and the rest is the path. Without a base directory the first path
+// segment that looks like a host name is used. Since wget saves directory URLs as index.html,
+// index.html files are given the URL of the directory.
+//
+// wget sets the modification time of the file to the Last-Modified time of the response if the
+// server sent one, otherwise it is the time of download. It is used as WARC-Date, which is the
+// best estimate of the capture time that is available.
+type WgetReader struct {
+	fs                 afero.Fs
+	filename           string
+	baseDir            string
+	scheme             string
+	defaultTime        time.Time
+	synthesizeResponse bool
+	warcRecordOptions  []gowarc.WarcRecordOption
+	done               bool
+}
+
+type Option func(*WgetReader)
+
+// WithBaseDir sets the directory that contains the host directories.
+func WithBaseDir(baseDir string) Option {
+	return func(r *WgetReader) {
+		r.baseDir = baseDir
+	}
+}
+
+// WithScheme sets the URL scheme used for reconstructed URLs. The default is http.
+func WithScheme(scheme string) Option {
+	return func(r *WgetReader) {
+		r.scheme = scheme
+	}
+}
+
+// WithSynthesizeResponse makes the reader produce response records with synthesized HTTP
+// headers instead of resource records.
+func WithSynthesizeResponse(synthesize bool) Option {
+	return func(r *WgetReader) {
+		r.synthesizeResponse = synthesize
+	}
+}
+
+func NewWgetReader(fileSystem afero.Fs, filename string, defaultTime time.Time, options []Option, warcRecordOptions ...gowarc.WarcRecordOption) (*WgetReader, error) {
+	wgetReader := &WgetReader{
+		fs:                fileSystem,
+		filename:          filename,
+		scheme:            "http",
+		defaultTime:       defaultTime,
+		warcRecordOptions: warcRecordOptions,
+	}
+	for _, option := range options {
+		option(wgetReader)
+	}
+	return wgetReader, nil
+}
+
+func (wgetReader *WgetReader) Next() (gowarc.Record, error) {
+	if wgetReader.done {
+		return gowarc.Record{}, io.EOF
+	}
+	defer func() {
+		wgetReader.done = true
+	}()
+
+	targetURI, err := TargetURI(wgetReader.filename, wgetReader.baseDir, wgetReader.scheme)
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+
+	info, err := wgetReader.fs.Stat(wgetReader.filename)
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+	warcDate := info.ModTime()
+	if warcDate.IsZero() || warcDate.Unix() <= 0 {
+		warcDate = wgetReader.defaultTime
+	}
+
+	file, err := wgetReader.fs.Open(wgetReader.filename)
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+	defer func() { _ = file.Close() }()
+
+	contentType, err := ContentType(wgetReader.filename, file)
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+
+	var warcRecordBuilder gowarc.WarcRecordBuilder
+	if wgetReader.synthesizeResponse {
+		warcRecordBuilder = gowarc.NewRecordBuilder(gowarc.Response, wgetReader.warcRecordOptions...)
+		warcRecordBuilder.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	} else {
+		warcRecordBuilder = gowarc.NewRecordBuilder(gowarc.Resource, wgetReader.warcRecordOptions...)
+		warcRecordBuilder.AddWarcHeader(gowarc.ContentType, contentType)
+	}
+	warcRecordBuilder.AddWarcHeader(gowarc.WarcTargetURI, targetURI)
+	warcRecordBuilder.AddWarcHeaderTime(gowarc.WarcDate, warcDate)
+
+	if wgetReader.synthesizeResponse {
+		header := http.Header{}
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		if _, err = warcRecordBuilder.WriteString("HTTP/1.1 200 OK\r\n"); err != nil {
+			return gowarc.Record{}, err
+		}
+		if err = header.Write(warcRecordBuilder); err != nil {
+			return gowarc.Record{}, err
+		}
+		if _, err = warcRecordBuilder.WriteString("\r\n"); err != nil {
+			return gowarc.Record{}, err
+		}
+	}
+
+	if _, err = warcRecordBuilder.ReadFrom(file); err != nil {
+		return gowarc.Record{}, err
+	}
+
+	warcRecord, validation, err := warcRecordBuilder.Build()
+	return gowarc.Record{WarcRecord: warcRecord, Offset: 0, Size: 0, Validation: validation}, err
+}
+
+func (wgetReader *WgetReader) Records() iter.Seq2[gowarc.Record, error] {
+	return func(yield func(gowarc.Record, error) bool) {
+		for {
+			record, err := wgetReader.Next()
+			if err == io.EOF {
+				return
+			}
+			if !yield(record, err) {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (wgetReader *WgetReader) Close() error {
+	return nil
+}
+
+// TargetURI reconstructs the URL of a file saved by wget.
+func TargetURI(filename string, baseDir string, scheme string) (string, error) {
+	if filepath.IsAbs(baseDir) && !filepath.IsAbs(filename) {
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+	}
+	p := filepath.ToSlash(filepath.Clean(filename))
+	var segments []string
+	if baseDir != "" {
+		base := filepath.ToSlash(filepath.Clean(baseDir))
+		rel, ok := strings.CutPrefix(p, base+"/")
+		if !ok {
+			return "", fmt.Errorf("%s is not below base directory %s", filename, baseDir)
+		}
+		segments = strings.Split(rel, "/")
+	} else {
+		segments = strings.Split(strings.TrimPrefix(p, "/"), "/")
+		i := 0
+		for i < len(segments)-1 && !isHost(segments[i]) {
+			i++
+		}
+		if i == len(segments)-1 {
+			return "", fmt.Errorf("no host name found in path %s", filename)
+		}
+		segments = segments[i:]
+	}
+	if len(segments) < 2 {
+		return "", fmt.Errorf("no host name found in path %s", filename)
+	}
+
+	host := segments[0]
+	// wget uses '+' as port separator with --restrict-file-names=windows
+	if h, port, ok := strings.Cut(host, "+"); ok && isPort(port) {
+		host = h + ":" + port
+	}
+
+	name := path.Join(segments[1:]...)
+	var rawQuery string
+	if before, after, ok := strings.Cut(name, "?"); ok {
+		name, rawQuery = before, after
+	}
+	if name == "index.html" {
+		name = ""
+	} else if strings.HasSuffix(name, "/index.html") {
+		name = strings.TrimSuffix(name, "index.html")
+	}
+
+	u := url.URL{Scheme: scheme, Host: host, Path: "/" + name, RawQuery: rawQuery}
+	return u.String(), nil
+}
+
+// isHost reports whether a path segment looks like a host name, optionally with a port.
+func isHost(segment string) bool {
+	host := segment
+	if h, port, ok := strings.Cut(segment, ":"); ok && isPort(port) {
+		host = h
+	} else if h, port, ok := strings.Cut(segment, "+"); ok && isPort(port) {
+		host = h
+	}
+	if !strings.Contains(host, ".") || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") {
+		return false
+	}
+	for _, c := range host {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n < 65536
+}
+
+// serverSideExtensions are extensions of scripts that generated the content rather than
+// describing it.
+var serverSideExtensions = map[string]bool{
+	".php": true, ".php3": true, ".phtml": true, ".asp": true, ".aspx": true, ".jsp": true, ".cgi": true, ".pl": true, ".cfm": true,
+}
+
+// ContentType guesses the content type of a file from its extension or, if the extension is
+// unknown or belongs to a server side script, from its content. The reader is rewound after
+// sniffing.
+func ContentType(filename string, r io.ReadSeeker) (string, error) {
+	name, _, _ := strings.Cut(path.Base(filepath.ToSlash(filename)), "?")
+	ext := strings.ToLower(path.Ext(name))
+	if contentType := mime.TypeByExtension(ext); contentType != "" && !serverSideExtensions[ext] {
+		return contentType, nil
+	}
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,60 @@
+package wgetreader
+
+import (
+	"mime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetURI(t *testing.T) {
+	tests := []struct {
+		filename string
+		baseDir  string
+		want     string
+		wantErr  bool
+	}{
+		{filename: "/data/mirror/www.example.com/index.html", want: "http://www.example.com/"},
+		{filename: "/data/mirror/www.example.com/a/b/index.html", want: "http://www.example.com/a/b/"},
+		{filename: "/data/mirror/www.example.com/page.php?id=1&x=y", want: "http://www.example.com/page.php?id=1&x=y"},
+		{filename: "/data/mirror/www.example.com+8080/img/a b.png", want: "http://www.example.com:8080/img/a%20b.png"},
+		{filename: "/data/2004.harvest/localhost/x.html", baseDir: "/data/2004.harvest", want: "http://localhost/x.html"},
+		{filename: "/data/other/x.html", baseDir: "/data/2004.harvest", wantErr: true},
+		{filename: "/data/mirror/file.html", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := TargetURI(tt.filename, tt.baseDir, "http")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	// the mime types of the host may override the builtin type of .css
+	assert.NoError(t, mime.AddExtensionType(".css", "text/css; charset=utf-8"))
+	got, err := ContentType("style.css", strings.NewReader("body {}"))
+	assert.NoError(t, err)
+	assert.Equal(t, "text/css; charset=utf-8", got)
+
+	r := strings.NewReader("<!DOCTYPE html><html></html>")
+	got, err = ContentType("page.php?id=1", r)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", got)
+	assert.Equal(t, int64(r.Size()), int64(r.Len()), "reader should be rewound")
+}
+
+func TestTargetURI_RelativeFilename(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Chdir(baseDir)
+
+	got, err := TargetURI("www.example.com/a.html", baseDir, "https")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/a.html", got)
+}